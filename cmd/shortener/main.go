@@ -41,7 +41,7 @@ func greeting() {
 }
 
 // handleSignals - обрабатывает сигналы прерывания программы. Останавливает сервер. и освобождает ресурсы
-func handleSignals(server *http.Server) {
+func handleSignals(server *http.Server, dataStorage storage.Storage) {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 
@@ -55,8 +55,29 @@ func handleSignals(server *http.Server) {
 		log.Printf("Failed to gracefully shutdown server: %v\n", err)
 	}
 
-	// тут можно добавить закрытие открытых ресурсов
-	// на данный момент все ресурсы открываются и закрываются по запросам - освобождать нечего.
+	// сохраняем изменения, накопленные хранилищем в памяти (счетчики переходов), и останавливаем фоновые задачи
+	if closer, ok := dataStorage.(storage.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// handleReload - по сигналу SIGHUP перечитывает файлы ключей токенов и политики URL без перезапуска сервера.
+// При ошибке продолжают действовать прежние ключи и правила.
+func handleReload(service *shortener.Shortener) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	for range sigCh {
+		if info, err := service.ReloadKeys(); err != nil {
+			log.Println("не удалось перечитать ключи токенов;", err)
+		} else {
+			log.Printf("ключи токенов перечитаны, ключ подписи %s, ключей проверки %d", info.SigningKey, len(info.Keys))
+		}
+		if err := service.ReloadPolicy(); err != nil {
+			log.Println("не удалось перечитать файл политики;", err)
+		}
+	}
 }
 
 func main() {
@@ -65,6 +86,12 @@ func main() {
 	cfg.LoadConfiguration() // загружаем конфигурацию
 	dataStorage := storage.New(cfg.DB, nil)
 	service := shortener.New(dataStorage, cfg.Service)
+	if cfg.Service.RequirePersistentKey && service.EphemeralKey() && cfg.DB.Persistent() {
+		log.Fatal("ссылки хранятся постоянно, а ключ токенов случайный: после перезапуска пользователи потеряют доступ к своим ссылкам; задайте KEY или KEY_FILE")
+	}
+	go handleReload(service)
+	// ссылки на короткие ссылки сервиса разворачиваются, остальные ссылки на сервис запрещены политикой
+	service.SetServiceURLs(cfg.Server.BaseURL, cfg.Server.AliasDomains...)
 	handler := handlers.New(service, cfg.Server)
 	go func() {
 		http.ListenAndServe(":6060", nil) // сервер для профилирования
@@ -98,6 +125,7 @@ func main() {
 	// запуск gRPC сервера
 	handlerService, servergRPC := gs.New(service, cfg.Server)
 	pb.RegisterHandlerServiceServer(servergRPC, handlerService)
+	pb.RegisterAdminServiceServer(servergRPC, handlerService.AdminService())
 	// определяем порт для сервера
 	listen, err := net.Listen("tcp", ":3200")
 	if err != nil {
@@ -112,6 +140,6 @@ func main() {
 	}()
 
 	// перехватчик сигнала прерывания
-	handleSignals(server)
+	handleSignals(server, dataStorage)
 	log.Println("Сервер остановлен.")
 }
@@ -4,10 +4,13 @@ package config
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/caarlos0/env"
 )
@@ -15,7 +18,16 @@ import (
 // Возвращает экземпляр конфигурации приложения.
 func New() Configuration {
 	cfg := Configuration{
-		Server: CfgServer{ServerAddress: "localhost", Scheme: "http"},
+		Service: CfgService{Passthrough: "none", PassthroughConflict: "keep"},
+		Server: CfgServer{
+			ServerAddress:       "localhost",
+			Scheme:              "http",
+			RedirectType:        http.StatusTemporaryRedirect,
+			RedirectCacheMaxAge: 86400,
+			ReportRateLimit:     10,
+			CookieHTTPOnly:      true,
+			CookieSameSite:      "lax",
+		},
 	}
 	return cfg
 }
@@ -31,6 +43,38 @@ type Configuration struct {
 type CfgService struct {
 	// Переменная для хранения секретного ключа сервиса.
 	SecretKey string `env:"KEY"`
+	// Дополнительные ключи проверки токенов в hex к ключу KEY (прежние ключи после его смены).
+	VerifyKeys []string `env:"VERIFY_KEYS" envSeparator:","`
+	// Путь к файлу ключей токенов: первый ключ подписывает, остальные проверяют. Имеет приоритет над KEY.
+	KeyFile string `env:"KEY_FILE"`
+	// Не запускаться со случайным ключом, если ссылки хранятся в файле или базе данных.
+	RequirePersistentKey bool `env:"REQUIRE_PERSISTENT_KEY"`
+	// Режим передачи параметров и пути запроса для ссылок без собственного режима (none, query, path, all).
+	Passthrough string `env:"PASSTHROUGH"`
+	// Правило для параметров, уже заданных в исходном URL (keep, override, append).
+	PassthroughConflict string `env:"PASSTHROUGH_CONFLICT"`
+	// Путь к базе GeoIP в формате MaxMind DB для правил перенаправления по стране (пусто - страна не определяется).
+	GeoIPPath string `env:"GEOIP_DB"`
+	// Удалять фрагмент (#...) исходного URL при создании ссылки.
+	StripFragment bool `env:"URL_STRIP_FRAGMENT"`
+	// Сортировать параметры запроса исходного URL по имени при создании ссылки.
+	SortQuery bool `env:"URL_SORT_QUERY"`
+	// Путь к файлу политики с запрещенными и разрешенными доменами (пусто - только встроенные проверки).
+	PolicyFile string `env:"POLICY_FILE"`
+	// Разрешать создание ссылок только на домены из списка разрешенных в файле политики.
+	PolicyAllowlistOnly bool `env:"POLICY_ALLOWLIST_ONLY"`
+	// Срок действия токена пользователя (0 - 30 суток).
+	TokenTTL time.Duration `env:"TOKEN_TTL"`
+	// Дата "2006-01-02" (UTC) или время RFC 3339, с которого не принимаются токены старого формата (пусто - принимаются).
+	LegacyTokensUntil string `env:"LEGACY_TOKENS_UNTIL"`
+	// Email или имена учетных записей администраторов, которым доступен административный API.
+	AdminUsers []string `env:"ADMIN_USERS" envSeparator:","`
+	// Квоты анонимных пользователей по IP-адресу клиента: ссылок в сутки и действующих ссылок (0 - без ограничения).
+	QuotaDailyLinks  int `env:"QUOTA_DAILY_LINKS"`
+	QuotaActiveLinks int `env:"QUOTA_ACTIVE_LINKS"`
+	// Квоты учетных записей и рабочих пространств: ссылок в сутки и действующих ссылок (0 - без ограничения).
+	AccountQuotaDailyLinks  int `env:"ACCOUNT_QUOTA_DAILY_LINKS"`
+	AccountQuotaActiveLinks int `env:"ACCOUNT_QUOTA_ACTIVE_LINKS"`
 }
 
 // CfgDataBase - конфигурация базы данных.
@@ -41,6 +85,11 @@ type CfgDataBase struct {
 	DataBaseDSN string `env:"DATABASE_DSN"`
 }
 
+// Persistent - проверяет, что ссылки хранятся в файле или базе данных и переживают перезапуск.
+func (c CfgDataBase) Persistent() bool {
+	return c.FileStoragePath != "" || c.DataBaseDSN != ""
+}
+
 // CfgServer - конфигурация сервера.
 type CfgServer struct {
 	// Адрес сервера.
@@ -48,9 +97,46 @@ type CfgServer struct {
 	// Используемая схема (http/https).
 	Scheme string
 	// Базовый URL для формирования короткой ссылки
-	BaseURL       string `env:"BASE_URL"`
-	EnableHTTPS   bool   `env:"ENABLE_HTTPS"`
+	BaseURL     string `env:"BASE_URL"`
+	EnableHTTPS bool   `env:"ENABLE_HTTPS"`
+	// Доверительные подсети IPv4 и IPv6 в формате CIDR через запятую (см. TrustedSubnets).
 	TrustedSubnet string `env:"TRUSTED_SUBNET"`
+	// Подсети или адреса обратных прокси, от которых принимаются заголовки Forwarded, X-Forwarded-For и X-Real-IP.
+	TrustedProxies []string `env:"TRUSTED_PROXIES" envSeparator:","`
+	// Код перенаправления для ссылок без собственного типа (301, 302, 307, 308).
+	RedirectType int `env:"REDIRECT_TYPE"`
+	// Время кэширования постоянных перенаправлений (301, 308) в секундах.
+	RedirectCacheMaxAge int `env:"REDIRECT_CACHE_MAX_AGE"`
+	// Альтернативные домены, на которых сервис отвечает по тем же путям, что и на BaseURL.
+	AliasDomains []string `env:"ALIAS_DOMAINS" envSeparator:","`
+	// Максимальное количество жалоб на ссылки с одного IP-адреса в час (0 - без ограничения).
+	ReportRateLimit int `env:"REPORT_RATE_LIMIT"`
+	// Ограничения частоты запросов по классам маршрутов в формате "N/период", например "60/1m" (пусто - без ограничения):
+	// создание ссылки, пакетное создание, переход по ссылке и удаление ссылок.
+	RateLimitCreate   string `env:"RATE_LIMIT_CREATE"`
+	RateLimitBatch    string `env:"RATE_LIMIT_BATCH"`
+	RateLimitRedirect string `env:"RATE_LIMIT_REDIRECT"`
+	RateLimitDelete   string `env:"RATE_LIMIT_DELETE"`
+	// Разрешать административный API только из доверительной подсети TrustedSubnet.
+	AdminTrustedSubnetOnly bool `env:"ADMIN_TRUSTED_SUBNET_ONLY"`
+	// Домен куки (пусто - только хост запроса).
+	CookieDomain string `env:"COOKIE_DOMAIN"`
+	// Передавать куки только по HTTPS; включается также при ENABLE_HTTPS, BASE_URL с https и COOKIE_SAME_SITE=none.
+	CookieSecure bool `env:"COOKIE_SECURE"`
+	// Запретить доступ к кукам из JavaScript.
+	CookieHTTPOnly bool `env:"COOKIE_HTTP_ONLY"`
+	// Атрибут SameSite куки (lax, strict, none).
+	CookieSameSite string `env:"COOKIE_SAME_SITE"`
+	// Срок хранения куки token в секундах, не больше срока действия токена (0 - до окончания действия токена).
+	CookieMaxAge int `env:"COOKIE_MAX_AGE"`
+}
+
+// TrustedSubnets - возвращает доверительные подсети из TrustedSubnet.
+func (c CfgServer) TrustedSubnets() []string {
+	if c.TrustedSubnet == "" {
+		return nil
+	}
+	return strings.Split(c.TrustedSubnet, ",")
 }
 
 // LoadConfiguration - заполняет структуру Configuration согласно приоритету (от меньшего к большему).
@@ -96,8 +182,31 @@ func (c *Configuration) LoadConfiguration() {
 // SERVER_ADDRESS - адрес поднимаемого сервера, например "localhost:8080"
 // BASE_URL - базовый адрес для коротких ссылок "http://localhost:8080"
 // KEY - секретный ключ для генерации токенов
+// VERIFY_KEYS - прежние ключи через запятую, которыми еще проверяются токены
+// KEY_FILE - путь к файлу ключей токенов (перечитывается по SIGHUP)
+// REQUIRE_PERSISTENT_KEY - не запускаться со случайным ключом при постоянном хранилище
 // DATABASE_DSN - строка подключения к базе данных
-// TRUSTED_SUBNET - доверенная подсеть
+// TRUSTED_SUBNET - доверенные подсети через запятую
+// TRUSTED_PROXIES - подсети или адреса доверенных обратных прокси через запятую
+// ALIAS_DOMAINS - альтернативные домены сервиса через запятую
+// REPORT_RATE_LIMIT - максимальное количество жалоб на ссылки с одного IP-адреса в час
+// RATE_LIMIT_CREATE, RATE_LIMIT_BATCH, RATE_LIMIT_REDIRECT, RATE_LIMIT_DELETE - ограничения частоты запросов "N/период"
+// REDIRECT_TYPE - код перенаправления по умолчанию
+// REDIRECT_CACHE_MAX_AGE - время кэширования постоянных перенаправлений в секундах
+// PASSTHROUGH - режим передачи параметров и пути запроса по умолчанию
+// PASSTHROUGH_CONFLICT - правило для совпадающих параметров запроса по умолчанию
+// GEOIP_DB - путь к базе GeoIP для правил перенаправления по стране
+// URL_STRIP_FRAGMENT - удалять фрагмент исходного URL при создании ссылки
+// URL_SORT_QUERY - сортировать параметры запроса исходного URL при создании ссылки
+// POLICY_FILE - путь к файлу политики с запрещенными и разрешенными доменами
+// POLICY_ALLOWLIST_ONLY - разрешать ссылки только на домены из списка разрешенных
+// TOKEN_TTL - срок действия токена пользователя, например "720h"
+// LEGACY_TOKENS_UNTIL - дата, с которой не принимаются токены старого формата, например "2026-12-31"
+// ADMIN_USERS - email или имена администраторов через запятую
+// QUOTA_DAILY_LINKS, QUOTA_ACTIVE_LINKS - квоты анонимных пользователей на ссылки в сутки и действующие ссылки
+// ACCOUNT_QUOTA_DAILY_LINKS, ACCOUNT_QUOTA_ACTIVE_LINKS - квоты учетных записей
+// ADMIN_TRUSTED_SUBNET_ONLY - разрешать административный API только из доверенной подсети
+// COOKIE_DOMAIN, COOKIE_SECURE, COOKIE_HTTP_ONLY, COOKIE_SAME_SITE, COOKIE_MAX_AGE - атрибуты куки
 func (c *Configuration) LoadFromEnv() {
 	err := env.Parse(&(c.Server))
 	if err != nil {
@@ -123,13 +232,45 @@ func (c *Configuration) ReadConfigFile(filePath string) error {
 	}
 
 	type cfgJSON struct {
-		ServerAddress   string `json:"server_address"`
-		BaseURL         string `json:"base_url"`
-		FileStoragePath string `json:"file_storage_path"`
-		DataBaseDSN     string `json:"database_dsn"`
-		EnableHTTPS     bool   `json:"enable_https"`
-		SecretKey       string `json:"key"`
-		TrustedSubnet   string `json:"trusted_subnet"`
+		ServerAddress   string   `json:"server_address"`
+		BaseURL         string   `json:"base_url"`
+		FileStoragePath string   `json:"file_storage_path"`
+		DataBaseDSN     string   `json:"database_dsn"`
+		EnableHTTPS     bool     `json:"enable_https"`
+		SecretKey       string   `json:"key"`
+		VerifyKeys      []string `json:"verify_keys"`
+		KeyFile         string   `json:"key_file"`
+		RequireKey      bool     `json:"require_persistent_key"`
+		TrustedSubnet   string   `json:"trusted_subnet"`
+		TrustedProxies  []string `json:"trusted_proxies"`
+		RedirectType    int      `json:"redirect_type"`
+		RedirectMaxAge  int      `json:"redirect_cache_max_age"`
+		AliasDomains    []string `json:"alias_domains"`
+		ReportRateLimit int      `json:"report_rate_limit"`
+		RateCreate      string   `json:"rate_limit_create"`
+		RateBatch       string   `json:"rate_limit_batch"`
+		RateRedirect    string   `json:"rate_limit_redirect"`
+		RateDelete      string   `json:"rate_limit_delete"`
+		Passthrough     string   `json:"passthrough"`
+		Conflict        string   `json:"passthrough_conflict"`
+		GeoIPPath       string   `json:"geoip_db"`
+		StripFragment   bool     `json:"url_strip_fragment"`
+		SortQuery       bool     `json:"url_sort_query"`
+		PolicyFile      string   `json:"policy_file"`
+		AllowlistOnly   bool     `json:"policy_allowlist_only"`
+		TokenTTL        string   `json:"token_ttl"`
+		LegacyUntil     string   `json:"legacy_tokens_until"`
+		AdminUsers      []string `json:"admin_users"`
+		QuotaDaily      int      `json:"quota_daily_links"`
+		QuotaActive     int      `json:"quota_active_links"`
+		AccountDaily    int      `json:"account_quota_daily_links"`
+		AccountActive   int      `json:"account_quota_active_links"`
+		AdminSubnetOnly bool     `json:"admin_trusted_subnet_only"`
+		CookieDomain    string   `json:"cookie_domain"`
+		CookieSecure    bool     `json:"cookie_secure"`
+		CookieHTTPOnly  *bool    `json:"cookie_http_only"`
+		CookieSameSite  string   `json:"cookie_same_site"`
+		CookieMaxAge    int      `json:"cookie_max_age"`
 	}
 	cfgFromFile := cfgJSON{}
 
@@ -141,9 +282,65 @@ func (c *Configuration) ReadConfigFile(filePath string) error {
 	c.Server.EnableHTTPS = cfgFromFile.EnableHTTPS
 	c.Server.ServerAddress = cfgFromFile.ServerAddress
 	c.Service.SecretKey = cfgFromFile.SecretKey
+	c.Service.VerifyKeys = cfgFromFile.VerifyKeys
+	c.Service.KeyFile = cfgFromFile.KeyFile
+	c.Service.RequirePersistentKey = cfgFromFile.RequireKey
 	c.DB.DataBaseDSN = cfgFromFile.DataBaseDSN
 	c.DB.FileStoragePath = cfgFromFile.FileStoragePath
 	c.Server.TrustedSubnet = cfgFromFile.TrustedSubnet
+	c.Server.TrustedProxies = cfgFromFile.TrustedProxies
+	if cfgFromFile.RedirectType != 0 {
+		c.Server.RedirectType = cfgFromFile.RedirectType
+	}
+	c.Server.AliasDomains = cfgFromFile.AliasDomains
+	if cfgFromFile.ReportRateLimit != 0 {
+		c.Server.ReportRateLimit = cfgFromFile.ReportRateLimit
+	}
+	c.Server.RateLimitCreate = cfgFromFile.RateCreate
+	c.Server.RateLimitBatch = cfgFromFile.RateBatch
+	c.Server.RateLimitRedirect = cfgFromFile.RateRedirect
+	c.Server.RateLimitDelete = cfgFromFile.RateDelete
+	if cfgFromFile.RedirectMaxAge != 0 {
+		c.Server.RedirectCacheMaxAge = cfgFromFile.RedirectMaxAge
+	}
+	if cfgFromFile.Passthrough != "" {
+		c.Service.Passthrough = cfgFromFile.Passthrough
+	}
+	if cfgFromFile.Conflict != "" {
+		c.Service.PassthroughConflict = cfgFromFile.Conflict
+	}
+	if cfgFromFile.GeoIPPath != "" {
+		c.Service.GeoIPPath = cfgFromFile.GeoIPPath
+	}
+	c.Service.StripFragment = cfgFromFile.StripFragment
+	c.Service.SortQuery = cfgFromFile.SortQuery
+	if cfgFromFile.PolicyFile != "" {
+		c.Service.PolicyFile = cfgFromFile.PolicyFile
+	}
+	c.Service.PolicyAllowlistOnly = cfgFromFile.AllowlistOnly
+	c.Service.AdminUsers = cfgFromFile.AdminUsers
+	c.Service.LegacyTokensUntil = cfgFromFile.LegacyUntil
+	c.Service.QuotaDailyLinks = cfgFromFile.QuotaDaily
+	c.Service.QuotaActiveLinks = cfgFromFile.QuotaActive
+	c.Service.AccountQuotaDailyLinks = cfgFromFile.AccountDaily
+	c.Service.AccountQuotaActiveLinks = cfgFromFile.AccountActive
+	c.Server.AdminTrustedSubnetOnly = cfgFromFile.AdminSubnetOnly
+	c.Server.CookieDomain = cfgFromFile.CookieDomain
+	c.Server.CookieSecure = cfgFromFile.CookieSecure
+	if cfgFromFile.CookieHTTPOnly != nil {
+		c.Server.CookieHTTPOnly = *cfgFromFile.CookieHTTPOnly
+	}
+	if cfgFromFile.CookieSameSite != "" {
+		c.Server.CookieSameSite = cfgFromFile.CookieSameSite
+	}
+	c.Server.CookieMaxAge = cfgFromFile.CookieMaxAge
+	if cfgFromFile.TokenTTL != "" {
+		ttl, err := time.ParseDuration(cfgFromFile.TokenTTL)
+		if err != nil {
+			return fmt.Errorf("некорректный token_ttl %q; %w", cfgFromFile.TokenTTL, err)
+		}
+		c.Service.TokenTTL = ttl
+	}
 
 	if c.Server.EnableHTTPS {
 		c.Server.Scheme = "https"
@@ -161,7 +358,11 @@ func (c *Configuration) LoadFromFlag() {
 	flag.StringVar(&(c.DB.FileStoragePath), "f", c.DB.FileStoragePath, "path to storage files (FILE_STORAGE_PATH environment)")
 	flag.StringVar(&(c.DB.DataBaseDSN), "d", c.DB.DataBaseDSN, "connecting string to DB (DATABASE_DSN environment)")
 	flag.StringVar(&(c.Service.SecretKey), "k", c.Service.SecretKey, "Secret key for token generating")
-	flag.StringVar(&(c.Server.TrustedSubnet), "t", c.Server.TrustedSubnet, "trusted subnet (TRUSTED_SUBNET environment)")
+	flag.StringVar(&(c.Service.KeyFile), "kf", c.Service.KeyFile, "path to the token key file (KEY_FILE environment)")
+	flag.StringVar(&(c.Server.TrustedSubnet), "t", c.Server.TrustedSubnet, "trusted subnets, comma separated (TRUSTED_SUBNET environment)")
+	flag.IntVar(&(c.Server.RedirectType), "r", c.Server.RedirectType, "default redirect status code (REDIRECT_TYPE environment)")
+	flag.StringVar(&(c.Service.GeoIPPath), "g", c.Service.GeoIPPath, "path to the GeoIP database (GEOIP_DB environment)")
+	flag.StringVar(&(c.Service.PolicyFile), "p", c.Service.PolicyFile, "path to the URL policy file (POLICY_FILE environment)")
 	flag.BoolVar(&(c.Server.EnableHTTPS), "s", c.Server.EnableHTTPS, "")
 	flag.String("c", "", "path to the configuration file")
 	flag.String("config", "", "path to the configuration file")
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS urls_user_id_short_id_idx;
+DROP INDEX IF EXISTS urls_user_id_created_at_idx;
+ALTER TABLE urls
+  DROP COLUMN expires_at,
+  DROP COLUMN created_at;
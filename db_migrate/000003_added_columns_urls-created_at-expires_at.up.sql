@@ -0,0 +1,5 @@
+ALTER TABLE urls
+  ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  ADD COLUMN expires_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS urls_user_id_created_at_idx ON urls (user_id, created_at, short_id);
+CREATE INDEX IF NOT EXISTS urls_user_id_short_id_idx ON urls (user_id, short_id);
@@ -0,0 +1,5 @@
+ALTER TABLE urls
+  DROP COLUMN note,
+  DROP COLUMN title,
+  DROP COLUMN deleted_at,
+  DROP COLUMN updated_at;
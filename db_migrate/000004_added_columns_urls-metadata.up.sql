@@ -0,0 +1,7 @@
+ALTER TABLE urls
+  ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  ADD COLUMN deleted_at TIMESTAMPTZ,
+  ADD COLUMN title TEXT NOT NULL DEFAULT '',
+  ADD COLUMN note TEXT NOT NULL DEFAULT '';
+UPDATE urls SET updated_at = created_at;
+UPDATE urls SET deleted_at = updated_at WHERE NOT available;
@@ -0,0 +1,4 @@
+ALTER TABLE urls DROP COLUMN folder_id;
+DROP TABLE IF EXISTS folders;
+DROP TABLE IF EXISTS url_tags;
+DROP TABLE IF EXISTS tags;
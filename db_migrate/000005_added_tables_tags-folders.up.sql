@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS tags(
+    id BIGSERIAL PRIMARY KEY,
+    user_id CHAR(72) NOT NULL,
+    name TEXT NOT NULL,
+    UNIQUE (user_id, name)
+);
+CREATE TABLE IF NOT EXISTS url_tags(
+    short_id CHAR(50) NOT NULL REFERENCES urls (short_id) ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (short_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS url_tags_tag_id_idx ON url_tags (tag_id);
+
+CREATE TABLE IF NOT EXISTS folders(
+    id BIGSERIAL PRIMARY KEY,
+    user_id CHAR(72) NOT NULL,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS folders_user_id_idx ON folders (user_id);
+ALTER TABLE urls
+  ADD COLUMN folder_id BIGINT REFERENCES folders (id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS urls_folder_id_idx ON urls (folder_id);
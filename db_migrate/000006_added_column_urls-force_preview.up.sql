@@ -0,0 +1,2 @@
+ALTER TABLE urls
+  ADD COLUMN force_preview BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+ALTER TABLE urls
+  ADD COLUMN redirect_type SMALLINT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE urls
+  DROP COLUMN passthrough_conflict,
+  DROP COLUMN passthrough;
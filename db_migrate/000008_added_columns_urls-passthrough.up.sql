@@ -0,0 +1,3 @@
+ALTER TABLE urls
+  ADD COLUMN passthrough TEXT NOT NULL DEFAULT '',
+  ADD COLUMN passthrough_conflict TEXT NOT NULL DEFAULT '';
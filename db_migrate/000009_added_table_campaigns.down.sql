@@ -0,0 +1,4 @@
+ALTER TABLE urls
+  DROP COLUMN clicks,
+  DROP COLUMN campaign_id;
+DROP TABLE IF EXISTS campaigns;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS campaigns(
+    id BIGSERIAL PRIMARY KEY,
+    user_id CHAR(72) NOT NULL,
+    name TEXT NOT NULL,
+    utm JSONB NOT NULL DEFAULT '{}',
+    clicks BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS campaigns_user_id_idx ON campaigns (user_id);
+ALTER TABLE urls
+  ADD COLUMN campaign_id BIGINT REFERENCES campaigns (id) ON DELETE SET NULL,
+  ADD COLUMN clicks BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS urls_campaign_id_idx ON urls (campaign_id);
@@ -0,0 +1,2 @@
+ALTER TABLE urls
+  ADD COLUMN targets JSONB NOT NULL DEFAULT '[]';
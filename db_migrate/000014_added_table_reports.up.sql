@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS reports(
+    id BIGSERIAL PRIMARY KEY,
+    short_id CHAR(50) NOT NULL REFERENCES urls (short_id) ON DELETE CASCADE,
+    category TEXT NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    reporter_ip TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    closed_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS reports_short_id_status_idx ON reports (short_id, status);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS accounts(
+    id CHAR(72) PRIMARY KEY NOT NULL,
+    email TEXT UNIQUE,
+    username TEXT UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE TABLE IF NOT EXISTS api_keys(
+    id TEXT PRIMARY KEY NOT NULL,
+    user_id CHAR(72) NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    scopes TEXT NOT NULL DEFAULT '',
+    secret_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
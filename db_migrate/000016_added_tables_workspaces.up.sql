@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS workspaces(
+    id CHAR(72) PRIMARY KEY NOT NULL,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE TABLE IF NOT EXISTS workspace_members(
+    workspace_id CHAR(72) NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    user_id CHAR(72) NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    added_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (workspace_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS purged_urls(
+    short_id CHAR(50) NOT NULL,
+    user_id CHAR(72) NOT NULL,
+    purged_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
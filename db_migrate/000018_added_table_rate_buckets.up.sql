@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS rate_buckets(
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    full_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS rate_buckets_full_at ON rate_buckets (full_at);
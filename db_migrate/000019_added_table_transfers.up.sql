@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS transfers(
+    short_id CHAR(50) PRIMARY KEY NOT NULL REFERENCES urls (short_id) ON DELETE CASCADE,
+    from_user CHAR(72) NOT NULL,
+    to_user CHAR(72) NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS transfers_from_user_idx ON transfers (from_user);
+CREATE INDEX IF NOT EXISTS transfers_to_user_idx ON transfers (to_user);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS urls_quota_key_created_at_idx;
+ALTER TABLE urls
+  DROP COLUMN quota_key;
@@ -0,0 +1,3 @@
+ALTER TABLE urls
+  ADD COLUMN quota_key VARCHAR(64);
+CREATE INDEX IF NOT EXISTS urls_quota_key_created_at_idx ON urls (quota_key, created_at) WHERE quota_key IS NOT NULL;
@@ -0,0 +1,189 @@
+// Package clientip determines the client IP address of a request behind trusted reverse proxies
+// and checks addresses against trusted subnets.
+package clientip
+
+import (
+	"log"
+	"net"
+	"strings"
+)
+
+// Заголовки, в которых обратные прокси передают адрес клиента, в порядке приоритета.
+const (
+	HeaderForwarded    = "Forwarded"       // RFC 7239: for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"
+	HeaderForwardedFor = "X-Forwarded-For" // адреса через запятую, последний добавлен ближайшим прокси
+	HeaderRealIP       = "X-Real-IP"       // один адрес клиента
+)
+
+// maxForwardedEntries - максимальное количество просматриваемых адресов цепочки прокси.
+const maxForwardedEntries = 64
+
+// Resolver определяет IP-адрес клиента и проверяет его принадлежность доверительным подсетям.
+// Заголовки с адресом клиента учитываются, только если соединение установлено с доверенного прокси;
+// нулевой Resolver не доверяет ни одной подсети и ни одному прокси.
+type Resolver struct {
+	trusted []*net.IPNet
+	proxies []*net.IPNet
+}
+
+// New - создает Resolver по спискам доверительных подсетей trustedSubnets и доверенных прокси trustedProxies
+// в формате CIDR (IPv4 и IPv6) или отдельных IP-адресов. Некорректные и пустые элементы пропускаются.
+func New(trustedSubnets, trustedProxies []string) *Resolver {
+	return &Resolver{trusted: ParseCIDRs(trustedSubnets), proxies: ParseCIDRs(trustedProxies)}
+}
+
+// ParseCIDRs - парсит список подсетей в формате CIDR или отдельных IP-адресов (как подсетей /32 и /128).
+// Некорректные элементы записываются в лог и пропускаются.
+func ParseCIDRs(list []string) []*net.IPNet {
+	result := make([]*net.IPNet, 0, len(list))
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				log.Printf("некорректный IP-адрес %q пропущен;", item)
+				continue
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(item)
+		if err != nil {
+			log.Printf("некорректная подсеть %q пропущена; %v", item, err)
+			continue
+		}
+		result = append(result, subnet)
+	}
+	return result
+}
+
+// Trusted - проверяет, что IP-адрес ip (допускается с портом) входит в одну из доверительных подсетей.
+func (r *Resolver) Trusted(ip string) bool {
+	return r != nil && contains(r.trusted, parseIP(ip))
+}
+
+// TrustedProxy - проверяет, что адрес соединения remoteAddr принадлежит доверенному прокси.
+func (r *Resolver) TrustedProxy(remoteAddr string) bool {
+	return r != nil && contains(r.proxies, parseIP(remoteAddr))
+}
+
+// ClientIP - возвращает IP-адрес клиента без порта по адресу соединения remoteAddr и заголовкам запроса,
+// значения которых возвращает header (для HTTP - http.Header.Values, для gRPC - metadata.MD.Get).
+// Если соединение установлено не с доверенного прокси, заголовки не учитываются и возвращается адрес соединения.
+// Иначе цепочка адресов из Forwarded, X-Forwarded-For или X-Real-IP (первый заданный) просматривается
+// справа налево, и возвращается первый адрес, не принадлежащий доверенному прокси. Некорректный адрес в цепочке
+// (например, "unknown") прерывает просмотр - возвращается последний проверенный адрес.
+func (r *Resolver) ClientIP(remoteAddr string, header func(name string) []string) string {
+	ip := parseIP(remoteAddr)
+	if ip == nil {
+		return stripPort(remoteAddr)
+	}
+	if !r.TrustedProxy(remoteAddr) || header == nil {
+		return ip.String()
+	}
+	chain := forwardedChain(header)
+	for i := len(chain) - 1; i >= 0 && len(chain)-i <= maxForwardedEntries; i-- {
+		hop := parseIP(chain[i])
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !contains(r.proxies, hop) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// forwardedChain - возвращает адреса клиента и промежуточных прокси из первого заданного заголовка
+// Forwarded, X-Forwarded-For или X-Real-IP в порядке прохождения запроса.
+func forwardedChain(header func(name string) []string) []string {
+	if values := header(HeaderForwarded); len(values) > 0 {
+		return parseForwarded(values)
+	}
+	chain := make([]string, 0)
+	for _, value := range header(HeaderForwardedFor) {
+		for _, item := range strings.Split(value, ",") {
+			chain = append(chain, strings.TrimSpace(item))
+		}
+	}
+	if len(chain) > 0 {
+		return chain
+	}
+	if values := header(HeaderRealIP); len(values) > 0 {
+		return []string{strings.TrimSpace(values[len(values)-1])}
+	}
+	return chain
+}
+
+// parseForwarded - возвращает значения параметра for из заголовков Forwarded (RFC 7239).
+// Элемент без параметра for добавляется пустым, чтобы прервать цепочку доверия.
+func parseForwarded(values []string) []string {
+	chain := make([]string, 0)
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			node := ""
+			for _, pair := range splitQuoted(element, ';') {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(strings.TrimSpace(key), "for") {
+					node = strings.Trim(strings.TrimSpace(val), `"`)
+				}
+			}
+			chain = append(chain, node)
+		}
+	}
+	return chain
+}
+
+// splitQuoted - разбивает s по разделителю sep, не учитывая разделители внутри кавычек.
+func splitQuoted(s string, sep rune) []string {
+	result := make([]string, 0, 1)
+	quoted, start := false, 0
+	for i, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			result = append(result, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(result, s[start:])
+}
+
+// parseIP - разбирает IP-адрес, допуская порт и квадратные скобки IPv6 ("[2001:db8::1]:80").
+func parseIP(addr string) net.IP {
+	ip := net.ParseIP(stripPort(strings.TrimSpace(addr)))
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// stripPort - убирает из адреса порт и квадратные скобки IPv6.
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
+
+// contains - проверяет, что ip входит в одну из подсетей.
+func contains(subnets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
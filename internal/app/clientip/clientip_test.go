@@ -0,0 +1,150 @@
+package clientip
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestSplitQuoted(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		sep  rune
+		want []string
+	}{
+		{name: "пустая строка", s: "", sep: ',', want: []string{""}},
+		{name: "без разделителя", s: "for=192.0.2.1", sep: ',', want: []string{"for=192.0.2.1"}},
+		{name: "несколько элементов", s: "for=192.0.2.1, for=198.51.100.2", sep: ',',
+			want: []string{"for=192.0.2.1", " for=198.51.100.2"}},
+		{name: "разделитель в кавычках", s: `for="[2001:db8::1]:4711;x,y";proto=http`, sep: ';',
+			want: []string{`for="[2001:db8::1]:4711;x,y"`, "proto=http"}},
+		{name: "запятая в кавычках", s: `for="192.0.2.1,198.51.100.2", for=203.0.113.3`, sep: ',',
+			want: []string{`for="192.0.2.1,198.51.100.2"`, " for=203.0.113.3"}},
+		{name: "незакрытая кавычка", s: `for="192.0.2.1, for=198.51.100.2`, sep: ',',
+			want: []string{`for="192.0.2.1, for=198.51.100.2`}},
+		{name: "разделитель в конце", s: "for=192.0.2.1,", sep: ',', want: []string{"for=192.0.2.1", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitQuoted(tt.s, tt.sep))
+		})
+	}
+}
+
+func TestParseForwarded(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{name: "адрес с параметрами", values: []string{"for=192.0.2.60;proto=http;by=203.0.113.43"},
+			want: []string{"192.0.2.60"}},
+		{name: "IPv6 с портом в кавычках", values: []string{`for="[2001:db8:cafe::17]:4711"`},
+			want: []string{"[2001:db8:cafe::17]:4711"}},
+		{name: "регистр и пробелы", values: []string{" For = 192.0.2.1 ;proto=https, FOR=198.51.100.2"},
+			want: []string{"192.0.2.1", "198.51.100.2"}},
+		{name: "скрытые узлы", values: []string{`for=_hidden, for="_SEVKISEK", for=unknown`},
+			want: []string{"_hidden", "_SEVKISEK", "unknown"}},
+		{name: "элемент без for", values: []string{"proto=https;by=203.0.113.43, for=192.0.2.1"},
+			want: []string{"", "192.0.2.1"}},
+		{name: "запятая внутри кавычек", values: []string{`for="192.0.2.1, 198.51.100.2"`},
+			want: []string{"192.0.2.1, 198.51.100.2"}},
+		{name: "несколько заголовков", values: []string{"for=192.0.2.1", "for=198.51.100.2;proto=http"},
+			want: []string{"192.0.2.1", "198.51.100.2"}},
+		{name: "последнее значение for в элементе", values: []string{"for=192.0.2.1;for=198.51.100.2"},
+			want: []string{"198.51.100.2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseForwarded(tt.values))
+		})
+	}
+}
+
+func TestResolver_ClientIP(t *testing.T) {
+	proxies := New(nil, []string{"10.0.0.0/8", "2001:db8:ffff::/48"})
+	tests := []struct {
+		name       string
+		resolver   *Resolver
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{name: "без доверенных прокси", resolver: New(nil, nil), remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.1"}}, want: "10.0.0.1"},
+		{name: "нулевой Resolver", remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"X-Real-Ip": {"203.0.113.1"}}, want: "10.0.0.1"},
+		{name: "соединение не с прокси", resolver: proxies, remoteAddr: "198.51.100.1:1234",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.1"}}, want: "198.51.100.1"},
+		{name: "прокси без заголовков", resolver: proxies, remoteAddr: "10.0.0.1:1234", want: "10.0.0.1"},
+		{name: "X-Forwarded-For", resolver: proxies, remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.1"}}, want: "203.0.113.1"},
+		{name: "подмененный левый адрес", resolver: proxies, remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"192.0.2.99, 203.0.113.1"}}, want: "203.0.113.1"},
+		{name: "подмененный адрес в отдельном заголовке", resolver: proxies, remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"192.0.2.99", "203.0.113.1, 10.0.0.2"}}, want: "203.0.113.1"},
+		{name: "цепочка прокси", resolver: proxies, remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.1, 10.0.0.3, 10.0.0.2"}}, want: "203.0.113.1"},
+		{name: "только прокси", resolver: proxies, remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, want: "10.0.0.3"},
+		{name: "некорректный адрес прерывает цепочку", resolver: proxies, remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"192.0.2.99, unknown, 10.0.0.2"}}, want: "10.0.0.2"},
+		{name: "Forwarded важнее X-Forwarded-For", resolver: proxies, remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"Forwarded": {"for=198.51.100.9"}, "X-Forwarded-For": {"203.0.113.1"}}, want: "198.51.100.9"},
+		{name: "Forwarded с подмененным левым узлом", resolver: proxies, remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"Forwarded": {`for=192.0.2.99, for="203.0.113.1:8080";proto=https`}}, want: "203.0.113.1"},
+		{name: "Forwarded IPv6 с портом", resolver: proxies, remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"Forwarded": {`for="[2001:db8::1]:4711"`}}, want: "2001:db8::1"},
+		{name: "Forwarded со скрытым узлом", resolver: proxies, remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"Forwarded": {"for=192.0.2.99, for=_hidden"}}, want: "10.0.0.1"},
+		{name: "Forwarded с запятой в кавычках", resolver: proxies, remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"Forwarded": {`for="192.0.2.99, 203.0.113.1"`}}, want: "10.0.0.1"},
+		{name: "Forwarded без for", resolver: proxies, remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"Forwarded": {"for=192.0.2.99, proto=https"}}, want: "10.0.0.1"},
+		{name: "X-Real-IP", resolver: proxies, remoteAddr: "10.0.0.1:1234",
+			header: http.Header{"X-Real-Ip": {" 203.0.113.5 "}}, want: "203.0.113.5"},
+		{name: "IPv6 прокси с портом", resolver: proxies, remoteAddr: "[2001:db8:ffff::1]:443",
+			header: http.Header{"X-Forwarded-For": {"[2001:db8::5]:50000"}}, want: "2001:db8::5"},
+		{name: "IPv6 клиент с портом", resolver: proxies, remoteAddr: "[2001:db8::9]:443",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.1"}}, want: "2001:db8::9"},
+		{name: "IPv4 в формате IPv6", resolver: proxies, remoteAddr: "[::ffff:10.0.0.1]:443",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.1"}}, want: "203.0.113.1"},
+		{name: "некорректный адрес соединения", resolver: proxies, remoteAddr: "@",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.1"}}, want: "@"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.resolver.ClientIP(tt.remoteAddr, tt.header.Values))
+		})
+	}
+}
+
+func TestResolver_ClientIPMetadata(t *testing.T) {
+	// в gRPC заголовки передаются метаданными с ключами в нижнем регистре
+	resolver := New(nil, []string{"10.0.0.0/8"})
+	tests := []struct {
+		name       string
+		remoteAddr string
+		md         metadata.MD
+		want       string
+	}{
+		{name: "без метаданных", remoteAddr: "10.0.0.1:1234", want: "10.0.0.1"},
+		{name: "x-forwarded-for", remoteAddr: "10.0.0.1:1234",
+			md: metadata.Pairs("x-forwarded-for", "192.0.2.99, 203.0.113.1"), want: "203.0.113.1"},
+		{name: "несколько значений x-forwarded-for", remoteAddr: "10.0.0.1:1234",
+			md: metadata.Pairs("x-forwarded-for", "192.0.2.99", "x-forwarded-for", "203.0.113.1, 10.0.0.2"), want: "203.0.113.1"},
+		{name: "forwarded", remoteAddr: "10.0.0.1:1234",
+			md: metadata.Pairs("forwarded", `for="[2001:db8::1]:4711"`, "x-forwarded-for", "203.0.113.1"), want: "2001:db8::1"},
+		{name: "x-real-ip", remoteAddr: "10.0.0.1:1234", md: metadata.Pairs("x-real-ip", "203.0.113.5"), want: "203.0.113.5"},
+		{name: "соединение не с прокси", remoteAddr: "198.51.100.1:1234",
+			md: metadata.Pairs("x-real-ip", "203.0.113.5"), want: "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, resolver.ClientIP(tt.remoteAddr, tt.md.Get))
+		})
+	}
+}
@@ -4,6 +4,7 @@ package errorapp
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 // ErrorPageNotAvailable - возвращает ошибку, указывающую на то, что запрашиваемая страница больше не доступна.
@@ -35,3 +36,220 @@ func (e *URLDuplicateError) Error() string {
 func (e *URLDuplicateError) Unwrap() error {
 	return e.Err
 }
+
+// URLNotActiveError представляет ошибку, возникающую при переходе по ссылке, время действия которой еще не наступило.
+type URLNotActiveError struct {
+	// ActiveFrom - время, с которого ссылка начнет перенаправлять.
+	ActiveFrom time.Time
+}
+
+// NewURLNotActiveError - создает и возвращает ссылку на ошибку URLNotActiveError.
+func NewURLNotActiveError(activeFrom time.Time) *URLNotActiveError {
+	return &URLNotActiveError{ActiveFrom: activeFrom}
+}
+
+// Error - возвращает текстовое представление ошибки URLNotActiveError.
+func (e *URLNotActiveError) Error() string {
+	return fmt.Sprintf("ссылка начнет действовать %s;", e.ActiveFrom.UTC().Format(time.RFC3339))
+}
+
+// URLDisabledError представляет ошибку, возникающую при переходе по ссылке, отключенной администратором.
+// Оборачивает ErrorPageNotAvailable, т.к. отключенная ссылка недоступна так же, как удаленная.
+type URLDisabledError struct {
+	// Reason - причина отключения.
+	Reason string
+}
+
+// NewURLDisabledError - создает и возвращает ссылку на ошибку URLDisabledError.
+func NewURLDisabledError(reason string) *URLDisabledError {
+	return &URLDisabledError{Reason: reason}
+}
+
+// Error - возвращает текстовое представление ошибки URLDisabledError.
+func (e *URLDisabledError) Error() string {
+	return fmt.Sprintf("%v ссылка отключена: %s", ErrorPageNotAvailable, e.Reason)
+}
+
+// Unwrap - возвращает ErrorPageNotAvailable.
+func (e *URLDisabledError) Unwrap() error {
+	return ErrorPageNotAvailable
+}
+
+// ErrorInvalidListOptions - ошибка в параметрах выборки списка ссылок (курсор, лимит, сортировка, статус).
+var ErrorInvalidListOptions error = errors.New("некорректные параметры выборки списка ссылок;")
+
+// ErrorURLNotFound - ошибка, указывающая на отсутствие короткой ссылки в хранилище.
+var ErrorURLNotFound error = errors.New("короткая ссылка не найдена;")
+
+// ErrorAccessDenied - ошибка, указывающая на то, что пользователь не имеет прав на операцию со ссылкой.
+var ErrorAccessDenied error = errors.New("недостаточно прав для операции со ссылкой;")
+
+// ErrorFolderNotFound - ошибка, указывающая на отсутствие папки у пользователя.
+var ErrorFolderNotFound error = errors.New("папка не найдена;")
+
+// ErrorFolderNameEmpty - ошибка, указывающая на пустое название папки.
+var ErrorFolderNameEmpty error = errors.New("название папки не может быть пустым;")
+
+// ErrorInvalidRedirectType - ошибка, указывающая на недопустимый код перенаправления ссылки.
+var ErrorInvalidRedirectType error = errors.New("допустимые коды перенаправления: 301, 302, 307, 308;")
+
+// ErrorInvalidPassthrough - ошибка, указывающая на недопустимый режим или правило передачи параметров запроса.
+var ErrorInvalidPassthrough error = errors.New("допустимые режимы передачи запроса: none, query, path, all; правила: keep, override, append;")
+
+// ErrorCampaignNotFound - ошибка, указывающая на отсутствие кампании у пользователя.
+var ErrorCampaignNotFound error = errors.New("кампания не найдена;")
+
+// ErrorCampaignNameEmpty - ошибка, указывающая на пустое название кампании.
+var ErrorCampaignNameEmpty error = errors.New("название кампании не может быть пустым;")
+
+// ErrorInvalidRule - ошибка, указывающая на некорректное правило перенаправления ссылки.
+var ErrorInvalidRule error = errors.New("некорректное правило перенаправления;")
+
+// ErrorRuleNotFound - ошибка, указывающая на отсутствие правила перенаправления у ссылки.
+var ErrorRuleNotFound error = errors.New("правило перенаправления не найдено;")
+
+// ErrorInvalidTarget - ошибка, указывающая на некорректный вариант адреса перехода ссылки.
+var ErrorInvalidTarget error = errors.New("некорректный вариант адреса перехода;")
+
+// ErrorInvalidSchedule - ошибка, указывающая на то, что время начала действия ссылки не раньше времени окончания.
+var ErrorInvalidSchedule error = errors.New("время начала действия ссылки должно быть раньше времени окончания;")
+
+// ErrorInvalidURL - ошибка, указывающая на недопустимый исходный URL ссылки.
+var ErrorInvalidURL error = errors.New("некорректный исходный URL;")
+
+// ErrorURLBlocked - ошибка, указывающая на то, что исходный URL запрещен политикой сервиса.
+var ErrorURLBlocked error = errors.New("исходный URL запрещен политикой сервиса;")
+
+// ErrorDisableReasonEmpty - ошибка, указывающая на то, что для отключения ссылки, не нарушающей политику, не указана причина.
+var ErrorDisableReasonEmpty error = errors.New("ссылка не нарушает политику сервиса, укажите причину отключения;")
+
+// ErrorRedirectLoop - ошибка, указывающая на то, что цепочка коротких ссылок замкнута или слишком длинная.
+var ErrorRedirectLoop error = errors.New("цепочка коротких ссылок образует цикл;")
+
+// ErrorShortLinkTarget - ошибка, указывающая на то, что исходный URL ведет на короткую ссылку сервиса,
+// которую нельзя заменить конечным адресом.
+var ErrorShortLinkTarget error = errors.New("исходный URL ведет на короткую ссылку, которую нельзя развернуть;")
+
+// ErrorInvalidReport - ошибка, указывающая на некорректную жалобу на ссылку (неизвестная категория, длинный комментарий).
+var ErrorInvalidReport error = errors.New("некорректная жалоба на ссылку;")
+
+// ErrorTokenInvalid - ошибка, указывающая на поддельный, поврежденный или неизвестный токен пользователя.
+var ErrorTokenInvalid error = errors.New("недействительный токен;")
+
+// ErrorTokenExpired - ошибка, указывающая на то, что срок действия токена пользователя истек.
+var ErrorTokenExpired error = errors.New("срок действия токена истек;")
+
+// ErrorKeyring - ошибка, указывающая на некорректные или недоступные ключи подписи токенов.
+var ErrorKeyring error = errors.New("ошибка загрузки ключей;")
+
+// ErrorInvalidAccount - ошибка, указывающая на некорректные данные учетной записи (email, имя пользователя, пароль).
+var ErrorInvalidAccount error = errors.New("некорректные данные учетной записи;")
+
+// ErrorAccountExists - ошибка, указывающая на то, что email или имя пользователя уже заняты.
+var ErrorAccountExists error = errors.New("учетная запись с таким email или именем уже существует;")
+
+// ErrorAccountNotFound - ошибка, указывающая на отсутствие учетной записи.
+var ErrorAccountNotFound error = errors.New("учетная запись не найдена;")
+
+// ErrorInvalidCredentials - ошибка, указывающая на неверное имя пользователя или пароль.
+var ErrorInvalidCredentials error = errors.New("неверное имя пользователя или пароль;")
+
+// ErrorLoginRequired - ошибка, указывающая на то, что действие доступно только зарегистрированному пользователю.
+var ErrorLoginRequired error = errors.New("требуется вход в учетную запись;")
+
+// ErrorInvalidAPIKey - ошибка, указывающая на некорректные параметры ключа API (название, области действия).
+var ErrorInvalidAPIKey error = errors.New("некорректные параметры ключа API;")
+
+// ErrorAPIKeyNotFound - ошибка, указывающая на отсутствие ключа API у пользователя.
+var ErrorAPIKeyNotFound error = errors.New("ключ API не найден;")
+
+// ErrorAPIKeyRejected - ошибка, указывающая на неизвестный, поврежденный или отозванный ключ API.
+var ErrorAPIKeyRejected error = errors.New("недействительный ключ API;")
+
+// ErrorInsufficientScope - ошибка, указывающая на то, что области действия ключа API не разрешают операцию.
+var ErrorInsufficientScope error = errors.New("ключ API не разрешает эту операцию;")
+
+// ErrorInvalidClaim - ошибка, указывающая на то, что ссылки нельзя передать: источник не анонимный пользователь
+// или совпадает с учетной записью.
+var ErrorInvalidClaim error = errors.New("передать учетной записи можно только ссылки другого анонимного пользователя;")
+
+// ErrorWorkspaceNotFound - ошибка, указывающая на то, что рабочее пространство не найдено или пользователь в нем не состоит.
+var ErrorWorkspaceNotFound error = errors.New("рабочее пространство не найдено;")
+
+// ErrorMemberNotFound - ошибка, указывающая на то, что пользователь не состоит в рабочем пространстве.
+var ErrorMemberNotFound error = errors.New("участник рабочего пространства не найден;")
+
+// ErrorInvalidWorkspace - ошибка, указывающая на некорректные данные рабочего пространства, участника или передачи ссылки.
+var ErrorInvalidWorkspace error = errors.New("некорректные данные рабочего пространства;")
+
+// ErrorWorkspaceRole - ошибка, указывающая на то, что роли участника недостаточно для действия в рабочем пространстве.
+var ErrorWorkspaceRole error = errors.New("недостаточно прав в рабочем пространстве;")
+
+// ErrorTransferNotFound - ошибка, указывающая на то, что предложения передать ссылку пользователю нет
+// или ссылка больше не принадлежит отправителю.
+var ErrorTransferNotFound error = errors.New("предложение передачи ссылки не найдено;")
+
+// ErrorAdminRequired - ошибка, указывающая на то, что действие доступно только администратору.
+var ErrorAdminRequired error = errors.New("требуются права администратора;")
+
+// ErrorRateLimited - ошибка, указывающая на превышение лимита запросов; повторить запрос можно позже.
+var ErrorRateLimited error = errors.New("превышен лимит запросов, повторите позже;")
+
+// ErrorQuotaExceeded - ошибка, указывающая на исчерпание квоты пользователя на создание ссылок.
+var ErrorQuotaExceeded error = errors.New("квота на создание ссылок исчерпана;")
+
+// Квоты на создание ссылок.
+const (
+	QuotaDaily  = "daily"  // ссылки, созданные за сутки
+	QuotaActive = "active" // действующие ссылки
+)
+
+// QuotaExceededError представляет ошибку, возникающую при создании ссылок сверх квоты пользователя.
+// Оборачивает ErrorQuotaExceeded.
+type QuotaExceededError struct {
+	// Quota - исчерпанная квота (QuotaDaily, QuotaActive).
+	Quota string
+	// Limit - размер квоты, Remaining - сколько ссылок еще можно создать.
+	Limit     int
+	Remaining int
+	// ResetAt - время сброса суточной квоты (нулевое для квоты действующих ссылок).
+	ResetAt time.Time
+}
+
+// NewQuotaExceededError - создает и возвращает ссылку на ошибку QuotaExceededError.
+func NewQuotaExceededError(quota string, limit, remaining int, resetAt time.Time) *QuotaExceededError {
+	return &QuotaExceededError{Quota: quota, Limit: limit, Remaining: remaining, ResetAt: resetAt}
+}
+
+// Error - возвращает текстовое представление ошибки QuotaExceededError.
+func (e *QuotaExceededError) Error() string {
+	if e.Quota == QuotaDaily {
+		return fmt.Sprintf("%v за сутки можно создать %d ссылок, осталось %d, квота обновится %s", ErrorQuotaExceeded,
+			e.Limit, e.Remaining, e.ResetAt.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%v можно иметь не более %d действующих ссылок, осталось %d; удалите ненужные ссылки", ErrorQuotaExceeded,
+		e.Limit, e.Remaining)
+}
+
+// Unwrap - возвращает ErrorQuotaExceeded.
+func (e *QuotaExceededError) Unwrap() error {
+	return ErrorQuotaExceeded
+}
+
+// invalidInput - ошибки, вызванные некорректными данными запроса.
+var invalidInput = []error{
+	ErrorInvalidURL, ErrorURLBlocked, ErrorRedirectLoop, ErrorShortLinkTarget,
+	ErrorInvalidRedirectType, ErrorInvalidPassthrough, ErrorInvalidRule, ErrorInvalidTarget, ErrorInvalidSchedule,
+	ErrorFolderNameEmpty, ErrorCampaignNameEmpty, ErrorDisableReasonEmpty, ErrorInvalidReport,
+	ErrorInvalidListOptions, ErrorInvalidAccount, ErrorInvalidAPIKey, ErrorInvalidClaim, ErrorInvalidWorkspace,
+}
+
+// IsInvalidInput - проверяет, что ошибка вызвана некорректными данными запроса (HTTP 400, gRPC InvalidArgument).
+func IsInvalidInput(err error) bool {
+	for _, target := range invalidInput {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/go-chi/chi/v5"
+)
+
+// HandlerAPIRegister - регистрирует пользователя и выполняет вход в новую учетную запись.
+// Принимает JSON {"email": "...", "username": "...", "password": "...", "claim": true}, достаточно email или имени пользователя.
+// С "claim": true новой учетной записи передаются ссылки текущего анонимного пользователя (кука token).
+// Возвращает учетную запись со статусом 201 и куку token с идентификатором нового пользователя;
+// 409, если email или имя заняты.
+func (h *Handlers) HandlerAPIRegister(w http.ResponseWriter, r *http.Request) {
+	input := schema.APIRegisterInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	account, err := h.service.Register(input)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	h.signIn(w, r, account, input.Claim, http.StatusCreated)
+}
+
+// HandlerAPILogin - выполняет вход в учетную запись по email или имени пользователя и паролю.
+// Принимает JSON {"login": "...", "password": "...", "claim": true}. Возвращает учетную запись и куку token;
+// при неверных данных - 401. С "claim": true учетной записи передаются ссылки текущего анонимного пользователя.
+func (h *Handlers) HandlerAPILogin(w http.ResponseWriter, r *http.Request) {
+	input := schema.APILoginInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	account, err := h.service.Login(input)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	h.signIn(w, r, account, input.Claim, http.StatusOK)
+}
+
+// signIn - выдает куку token пользователя учетной записи и пишет учетную запись в ответ.
+// Если claim, до замены куки учетной записи передаются ссылки пользователя из текущей куки token;
+// если в куке уже учетная запись, передача пропускается, а если не хватает квоты учетной записи -
+// вход выполняется без передачи, причина возвращается в claim_error.
+func (h *Handlers) signIn(w http.ResponseWriter, r *http.Request, account schema.Account, claim bool, statusCode int) {
+	result := schema.APISignInResult{Account: account}
+	if claim {
+		previousUserID, err := GetToken(r)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		claimed, err := h.service.ClaimLinks(account.ID, previousUserID)
+		switch {
+		case err == nil:
+			result.Claimed = &claimed
+		case errors.Is(err, errorapp.ErrorQuotaExceeded):
+			result.ClaimError = err.Error()
+		case !errors.Is(err, errorapp.ErrorInvalidClaim):
+			log.Println("ошибка при передаче ссылок учетной записи;", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	raw, claims, err := h.service.UserToken(account.ID)
+	if err != nil {
+		log.Println("ошибка при выдаче токена;", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.setTokenCookie(w, raw, claims)
+	writeJSON(w, statusCode, result)
+}
+
+// HandlerAPIClaim - передает учетной записи текущего пользователя ссылки, папки и кампании анонимного пользователя.
+// Принимает JSON {"token": "..."} с действующим токеном анонимного пользователя (значением его куки token),
+// что подтверждает право на его ссылки. Возвращает переданные ключи и идентификаторы;
+// 401 для анонимного пользователя, 400 для недействительного токена или токена другой учетной записи,
+// 403, если действующих ссылок больше, чем осталось места в квоте учетной записи.
+func (h *Handlers) HandlerAPIClaim(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	input := schema.APIClaimInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	claims, err := h.service.ParseToken(input.Token)
+	if err != nil {
+		http.Error(w, fmt.Errorf("%w %v", errorapp.ErrorInvalidClaim, err).Error(), http.StatusBadRequest)
+		return
+	}
+	claimed, err := h.service.ClaimLinks(userID, claims.UserID)
+	if writeQuotaError(w, err) {
+		return
+	}
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, claimed)
+}
+
+// HandlerAPILogout - выполняет выход из учетной записи: удаляет куку token.
+// Следующий запрос без куки получит токен нового анонимного пользователя.
+func (h *Handlers) HandlerAPILogout(w http.ResponseWriter, r *http.Request) {
+	h.clearTokenCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlerAPIAccount - возвращает учетную запись текущего пользователя, для анонимного пользователя - 401.
+func (h *Handlers) HandlerAPIAccount(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	account, err := h.service.Account(userID)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, account)
+}
+
+// HandlerAPICreateKey - создает ключ API зарегистрированного пользователя.
+// Принимает JSON {"name": "...", "scopes": ["read", "write"]}. Возвращает ключ со статусом 201,
+// ключ целиком (поле key) показывается только в этом ответе.
+func (h *Handlers) HandlerAPICreateKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	input := schema.APIKeyInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	key, err := h.service.CreateAPIKey(userID, input)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, key)
+}
+
+// HandlerAPIListKeys - возвращает ключи API пользователя, в том числе отозванные, без секретных частей.
+func (h *Handlers) HandlerAPIListKeys(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	keys, err := h.service.ListAPIKeys(userID)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// HandlerAPIRevokeKey - отзывает ключ API пользователя и возвращает его.
+func (h *Handlers) HandlerAPIRevokeKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	key, err := h.service.RevokeAPIKey(userID, chi.URLParam(r, "KeyID"))
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, key)
+}
+
+// bearerToken - возвращает значение заголовка "Authorization: Bearer <ключ>", если он есть.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, raw, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(raw), true
+}
+
+// requiredScope - возвращает область действия ключа API, необходимую для запроса с методом method к пути path:
+// schema.ScopeAdmin для административного API, schema.ScopeRead для GET, HEAD и OPTIONS, schema.ScopeWrite для остальных.
+func requiredScope(method, path string) string {
+	if adminPath(path) {
+		return schema.ScopeAdmin
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return schema.ScopeRead
+	}
+	return schema.ScopeWrite
+}
+
+// sessionOnly - проверяет, что путь недоступен по ключу API: вход, регистрация и управление ключами
+// выполняются только по куке token, чтобы утекший ключ нельзя было использовать для выпуска новых ключей.
+func sessionOnly(path string) bool {
+	switch path {
+	case "/api/user/register", "/api/user/login", "/api/user/logout":
+		return true
+	}
+	return path == "/api/user/keys" || strings.HasPrefix(path, "/api/user/keys/")
+}
+
+// apiKeyAuth - аутентифицирует запрос ключом API raw и передает его дальше от имени владельца ключа.
+// Идентификатор владельца передается обработчикам в контексте запроса (см. GetToken), клиенту кука не отправляется.
+// Недействительный ключ отклоняется с кодом 401, ключ без нужной области действия - с кодом 403.
+func (h *Handlers) apiKeyAuth(next http.Handler, w http.ResponseWriter, r *http.Request, raw string) {
+	key, err := h.service.AuthenticateAPIKey(raw)
+	if errors.Is(err, errorapp.ErrorAPIKeyRejected) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Println("ошибка при проверке ключа API;", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if sessionOnly(r.URL.Path) || !key.HasScope(requiredScope(r.Method, r.URL.Path)) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		http.Error(w, errorapp.ErrorInsufficientScope.Error(), http.StatusForbidden)
+		return
+	}
+	next.ServeHTTP(w, withUser(r, key.UserID))
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/go-chi/chi/v5"
+)
+
+// HandlerAPIAdminDisableURL - отключает ссылку любого пользователя по решению администратора.
+// Принимает JSON {"reason": "..."}; без причины ссылка отключается, только если она нарушает политику
+// сервиса (например, ее домен добавлен в файл политики после создания ссылки). Возвращает ссылку в формате JSON.
+func (h *Handlers) HandlerAPIAdminDisableURL(w http.ResponseWriter, r *http.Request) {
+	input := schema.APIDisableURLInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rec, err := h.service.DisableURL(chi.URLParam(r, "ShortKey"), input.Reason)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	h.writeUserURL(w, rec)
+}
+
+// HandlerAPIAdminEnableURL - снимает отключение администратором со ссылки. Возвращает ссылку в формате JSON.
+func (h *Handlers) HandlerAPIAdminEnableURL(w http.ResponseWriter, r *http.Request) {
+	rec, err := h.service.EnableURL(chi.URLParam(r, "ShortKey"))
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	h.writeUserURL(w, rec)
+}
+
+// adminPath - проверяет, что путь относится к административному API.
+func adminPath(path string) bool {
+	return path == "/api/admin" || strings.HasPrefix(path, "/api/admin/")
+}
+
+// AdminHandler - middleware административного API. Пропускает запросы администраторов - учетных записей
+// из ADMIN_USERS, вошедших по куке token или по ключу API с областью admin. Анонимному пользователю
+// отвечает 401, остальным - 403. При ADMIN_TRUSTED_SUBNET_ONLY запросы не из доверительной подсети
+// отклоняются с кодом 403 независимо от пользователя.
+func (h *Handlers) AdminHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.cfg.AdminTrustedSubnetOnly && !h.ips.Trusted(h.clientIP(r)) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		userID, err := GetToken(r)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if _, err := h.service.Account(userID); err != nil {
+			h.writeURLError(w, err)
+			return
+		}
+		if !h.service.IsAdmin(userID) {
+			http.Error(w, errorapp.ErrorAdminRequired.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandlerAPIAdminURLs - ищет ссылки всех пользователей. Принимает те же параметры, что и /api/user/urls,
+// а также key (часть короткого ключа) и owner (идентификатор пользователя, email или имя владельца);
+// без параметра status возвращаются ссылки в любом статусе.
+// Возвращает ссылки с владельцами в формате JSON и курсор следующей страницы в заголовке X-Next-Cursor,
+// если ссылок нет - 204.
+func (h *Handlers) HandlerAPIAdminURLs(w http.ResponseWriter, r *http.Request) {
+	h.writeAdminURLs(w, r, r.URL.Query().Get("owner"))
+}
+
+// HandlerAPIAdminUserURLs - возвращает ссылки пользователя UserID (идентификатор, email или имя) в формате
+// HandlerAPIAdminURLs.
+func (h *Handlers) HandlerAPIAdminUserURLs(w http.ResponseWriter, r *http.Request) {
+	h.writeAdminURLs(w, r, chi.URLParam(r, "UserID"))
+}
+
+// writeAdminURLs - ищет ссылки владельца owner (всех пользователей, если пусто) и пишет страницу в ответ.
+func (h *Handlers) writeAdminURLs(w http.ResponseWriter, r *http.Request, owner string) {
+	query := r.URL.Query()
+	opts, err := parseListOptions(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.Key, opts.Owner = query.Get("key"), owner
+	page, err := h.service.SearchURLs(opts)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	if len(page.Items) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	result := make([]schema.APIAdminURL, len(page.Items))
+	now := time.Now()
+	for i, rec := range page.Items {
+		shortURL, err := h.createLink(rec.ShortKey)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		result[i] = schema.APIAdminURL{APIUserURL: schema.NewAPIUserURL(rec, shortURL, now), UserID: rec.UserID}
+	}
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// HandlerAPIAdminPurgeURL - окончательно удаляет ссылку без возможности восстановления. Возвращает 204.
+func (h *Handlers) HandlerAPIAdminPurgeURL(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.PurgeURL(chi.URLParam(r, "ShortKey")); err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlerAPIAdminPurgeUserURLs - окончательно удаляет все ссылки пользователя UserID (идентификатор, email или имя).
+// Возвращает JSON {"purged": [...]} с короткими ключами удаленных ссылок.
+func (h *Handlers) HandlerAPIAdminPurgeUserURLs(w http.ResponseWriter, r *http.Request) {
+	purged, err := h.service.PurgeUserURLs(chi.URLParam(r, "UserID"))
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, schema.APIPurgeResult{Purged: purged})
+}
+
+// HandlerAPIAdminStats - возвращает статистику сервиса в формате /api/internal/stats.
+func (h *Handlers) HandlerAPIAdminStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.service.GetStatsStorage()
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
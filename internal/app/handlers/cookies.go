@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bubu256/go-url-shortener-server/config"
+	"github.com/bubu256/go-url-shortener-server/internal/app/token"
+)
+
+// userKey - ключ контекста запроса, под которым хранится идентификатор пользователя.
+type userKey struct{}
+
+// withUser - возвращает запрос, выполняемый от имени пользователя userID (см. GetToken).
+func withUser(r *http.Request, userID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, userID))
+}
+
+// GetToken - возвращает идентификатор пользователя, от имени которого выполняется запрос.
+// Идентификатор помещается в контекст запроса в TokenHandler после проверки токена из куки token
+// (или ключа API) и заменяется в WorkspaceHandler идентификатором рабочего пространства.
+func GetToken(r *http.Request) (string, error) {
+	userID, _ := r.Context().Value(userKey{}).(string)
+	if userID == "" {
+		return "", errors.New("пользователь запроса не определен;")
+	}
+	return userID, nil
+}
+
+// cookiePolicy - атрибуты безопасности кук, выдаваемых сервером.
+type cookiePolicy struct {
+	domain   string
+	secure   bool
+	httpOnly bool
+	sameSite http.SameSite
+	// maxAge - предельный срок хранения куки token (0 - до окончания действия токена)
+	maxAge time.Duration
+}
+
+// newCookiePolicy - собирает атрибуты кук из настроек сервера.
+// Куки передаются только по HTTPS, если это задано явно, сервер работает по HTTPS или BASE_URL начинается с https://.
+// SameSite=None без Secure браузеры отклоняют, поэтому для него Secure включается всегда.
+func newCookiePolicy(cfg config.CfgServer) cookiePolicy {
+	policy := cookiePolicy{
+		domain:   cfg.CookieDomain,
+		secure:   cfg.CookieSecure || cfg.EnableHTTPS || strings.HasPrefix(cfg.BaseURL, "https://"),
+		httpOnly: cfg.CookieHTTPOnly,
+		sameSite: http.SameSiteLaxMode,
+	}
+	switch strings.ToLower(cfg.CookieSameSite) {
+	case "", "lax":
+	case "strict":
+		policy.sameSite = http.SameSiteStrictMode
+	case "none":
+		policy.sameSite = http.SameSiteNoneMode
+		policy.secure = true
+	default:
+		log.Printf("недопустимое значение SameSite куки %q, используется lax;", cfg.CookieSameSite)
+	}
+	if cfg.CookieMaxAge > 0 {
+		policy.maxAge = time.Duration(cfg.CookieMaxAge) * time.Second
+	}
+	return policy
+}
+
+// newCookie - возвращает куку name со значением value на пути path с атрибутами безопасности сервера.
+func (h *Handlers) newCookie(name, value, path string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   h.cookies.domain,
+		Secure:   h.cookies.secure,
+		HttpOnly: h.cookies.httpOnly,
+		SameSite: h.cookies.sameSite,
+	}
+}
+
+// setTokenCookie - выдает клиенту куку token с токеном raw на срок его действия, но не дольше COOKIE_MAX_AGE.
+func (h *Handlers) setTokenCookie(w http.ResponseWriter, raw string, claims token.Claims) {
+	cookie := h.newCookie("token", raw, "/")
+	expires := claims.Expires()
+	if h.cookies.maxAge > 0 {
+		if limit := time.Now().Add(h.cookies.maxAge); expires.IsZero() || limit.Before(expires) {
+			expires = limit
+		}
+	}
+	if !expires.IsZero() {
+		cookie.Expires = expires
+		cookie.MaxAge = int(time.Until(expires).Seconds())
+		if cookie.MaxAge <= 0 {
+			cookie.MaxAge = -1
+		}
+	}
+	http.SetCookie(w, cookie)
+}
+
+// clearTokenCookie - удаляет у клиента куку token.
+func (h *Handlers) clearTokenCookie(w http.ResponseWriter) {
+	cookie := h.newCookie("token", "", "/")
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+}
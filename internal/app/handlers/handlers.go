@@ -9,26 +9,36 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/qr"
+	"github.com/bubu256/go-url-shortener-server/internal/app/ratelimit"
 	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/bubu256/go-url-shortener-server/internal/app/targeting"
+	"github.com/bubu256/go-url-shortener-server/internal/app/token"
 
 	"github.com/bubu256/go-url-shortener-server/config"
+	"github.com/bubu256/go-url-shortener-server/internal/app/clientip"
 	"github.com/bubu256/go-url-shortener-server/internal/app/shortener"
 	"github.com/go-chi/chi/v5"
 )
 
 // Handlers - предоставляет HTTP-обработчики для сервиса сокращения URL-адресов.
 type Handlers struct {
-	Router        *chi.Mux
-	service       *shortener.Shortener
-	baseURL       string
-	trustedSubnet *net.IPNet
-	cfg           config.CfgServer
+	Router  *chi.Mux
+	service *shortener.Shortener
+	baseURL string
+	ips     *clientip.Resolver
+	cfg     config.CfgServer
+	// limiter - ограничение частоты запросов по классам маршрутов
+	limiter *ratelimit.Limiter
+	// cookies - атрибуты безопасности выдаваемых кук
+	cookies cookiePolicy
 }
 
 // New возвращает ссылку на новую структуру Handlers.
@@ -37,21 +47,81 @@ func New(service *shortener.Shortener, cfgServer config.CfgServer) *Handlers {
 		log.Fatal("указатель на структуру shortener.Shortener должен быть != nil;")
 	}
 	NewHandlers := Handlers{
-		baseURL:       cfgServer.BaseURL,
-		trustedSubnet: ParseSubnetCIDR(cfgServer.TrustedSubnet),
-		cfg:           cfgServer,
+		baseURL: cfgServer.BaseURL,
+		ips:     clientip.New(cfgServer.TrustedSubnets(), cfgServer.TrustedProxies),
+		cfg:     cfgServer,
+		cookies: newCookiePolicy(cfgServer),
+	}
+	if !schema.ValidRedirectType(cfgServer.RedirectType) || cfgServer.RedirectType == 0 {
+		log.Printf("недопустимый код перенаправления по умолчанию %d, используется %d;", cfgServer.RedirectType, http.StatusTemporaryRedirect)
+		NewHandlers.cfg.RedirectType = http.StatusTemporaryRedirect
 	}
 	NewHandlers.service = service
+	NewHandlers.limiter = ratelimit.New(cfgServer, service)
 	router := chi.NewRouter()
-	router.Use(gzipWriter, gzipReader, NewHandlers.TokenHandler)
+	router.Use(gzipWriter, gzipReader, NewHandlers.TokenHandler, NewHandlers.RateLimitHandler, NewHandlers.WorkspaceHandler)
 	router.Post("/", NewHandlers.HandlerURLtoShort)
 	router.Get("/{ShortKey}", NewHandlers.HandlerShortToURL)
+	router.Get("/{ShortKey}/*", NewHandlers.HandlerShortToURL)
 	router.Post("/api/shorten", NewHandlers.HandlerAPIShorten)
 	router.Get("/api/user/urls", NewHandlers.HandlerAPIUserAllURLs)
 	router.Delete("/api/user/urls", NewHandlers.HandlerAPIDeleteUrls)
+	router.Patch("/api/user/urls/{ShortKey}", NewHandlers.HandlerAPIUpdateURL)
+	router.Post("/api/user/urls/{ShortKey}/tags", NewHandlers.HandlerAPIAddTags)
+	router.Delete("/api/user/urls/{ShortKey}/tags", NewHandlers.HandlerAPIRemoveTags)
+	router.Get("/api/user/urls/{ShortKey}/rules", NewHandlers.HandlerAPIURLRules)
+	router.Put("/api/user/urls/{ShortKey}/rules", NewHandlers.HandlerAPISetRules)
+	router.Post("/api/user/urls/{ShortKey}/rules", NewHandlers.HandlerAPIAddRule)
+	router.Put("/api/user/urls/{ShortKey}/rules/{RuleID}", NewHandlers.HandlerAPIUpdateRule)
+	router.Delete("/api/user/urls/{ShortKey}/rules/{RuleID}", NewHandlers.HandlerAPIDeleteRule)
+	router.Get("/api/user/urls/{ShortKey}/targets", NewHandlers.HandlerAPIURLTargets)
+	router.Put("/api/user/urls/{ShortKey}/targets", NewHandlers.HandlerAPISetTargets)
+	router.Get("/api/user/tags", NewHandlers.HandlerAPIUserTags)
+	router.Get("/api/user/quota", NewHandlers.HandlerAPIUserQuota)
+	router.Post("/api/user/folders", NewHandlers.HandlerAPICreateFolder)
+	router.Get("/api/user/folders", NewHandlers.HandlerAPIUserFolders)
+	router.Delete("/api/user/folders/{FolderID}", NewHandlers.HandlerAPIDeleteFolder)
+	router.Delete("/api/user/folders/{FolderID}/urls", NewHandlers.HandlerAPIDeleteFolderURLs)
+	router.Post("/api/user/campaigns", NewHandlers.HandlerAPICreateCampaign)
+	router.Get("/api/user/campaigns", NewHandlers.HandlerAPIUserCampaigns)
+	router.Get("/api/user/campaigns/{CampaignID}", NewHandlers.HandlerAPIUserCampaign)
+	router.Delete("/api/user/campaigns/{CampaignID}", NewHandlers.HandlerAPIDeleteCampaign)
+	router.Get("/api/qr/{ShortKey}", NewHandlers.HandlerAPIQRCode)
 	router.Post("/api/shorten/batch", NewHandlers.HandlerAPIShortenBatch)
 	router.Get("/ping", NewHandlers.HandlerPing)
 	router.Get("/api/internal/stats", NewHandlers.HandlerAPIINternalStats)
+	router.Post("/api/report/{ShortKey}", NewHandlers.HandlerAPIReport)
+	router.Post("/api/user/register", NewHandlers.HandlerAPIRegister)
+	router.Post("/api/user/login", NewHandlers.HandlerAPILogin)
+	router.Post("/api/user/logout", NewHandlers.HandlerAPILogout)
+	router.Get("/api/user/account", NewHandlers.HandlerAPIAccount)
+	router.Post("/api/user/claim", NewHandlers.HandlerAPIClaim)
+	router.Post("/api/user/keys", NewHandlers.HandlerAPICreateKey)
+	router.Get("/api/user/keys", NewHandlers.HandlerAPIListKeys)
+	router.Delete("/api/user/keys/{KeyID}", NewHandlers.HandlerAPIRevokeKey)
+	router.Post("/api/user/urls/{ShortKey}/transfer", NewHandlers.HandlerAPITransferURL)
+	router.Get("/api/user/transfers", NewHandlers.HandlerAPITransfers)
+	router.Post("/api/user/transfers/{ShortKey}/accept", NewHandlers.HandlerAPIAcceptTransfer)
+	router.Delete("/api/user/transfers/{ShortKey}", NewHandlers.HandlerAPIDeclineTransfer)
+	router.Post("/api/workspaces", NewHandlers.HandlerAPICreateWorkspace)
+	router.Get("/api/workspaces", NewHandlers.HandlerAPIWorkspaces)
+	router.Get("/api/workspaces/{WorkspaceID}", NewHandlers.HandlerAPIWorkspace)
+	router.Put("/api/workspaces/{WorkspaceID}/members", NewHandlers.HandlerAPISetMember)
+	router.Delete("/api/workspaces/{WorkspaceID}/members/{UserID}", NewHandlers.HandlerAPIRemoveMember)
+	router.Route("/api/admin", func(admin chi.Router) {
+		admin.Use(NewHandlers.AdminHandler)
+		admin.Get("/stats", NewHandlers.HandlerAPIAdminStats)
+		admin.Get("/urls", NewHandlers.HandlerAPIAdminURLs)
+		admin.Delete("/urls/{ShortKey}", NewHandlers.HandlerAPIAdminPurgeURL)
+		admin.Post("/urls/{ShortKey}/disable", NewHandlers.HandlerAPIAdminDisableURL)
+		admin.Post("/urls/{ShortKey}/enable", NewHandlers.HandlerAPIAdminEnableURL)
+		admin.Get("/reports", NewHandlers.HandlerAPIAdminReports)
+		admin.Post("/urls/{ShortKey}/dismiss", NewHandlers.HandlerAPIAdminDismissReports)
+		admin.Get("/keys", NewHandlers.HandlerAPIAdminKeys)
+		admin.Post("/keys/reload", NewHandlers.HandlerAPIAdminReloadKeys)
+		admin.Get("/users/{UserID}/urls", NewHandlers.HandlerAPIAdminUserURLs)
+		admin.Delete("/users/{UserID}/urls", NewHandlers.HandlerAPIAdminPurgeUserURLs)
+	})
 	NewHandlers.Router = router
 	return &NewHandlers
 }
@@ -85,12 +155,17 @@ func (h *Handlers) HandlerURLtoShort(w http.ResponseWriter, r *http.Request) {
 		log.Println(err)
 	}
 	// получаем короткий идентификатор ссылки
-	shortKey, err := h.service.CreateShortKey(fullURL, token)
+	shortKey, err := h.service.CreateShortKey(fullURL, token, h.clientIP(r))
 	var errDuplicate *errorapp.URLDuplicateError
 	if errors.As(err, &errDuplicate) {
 		// если ошибка дубликации урл
 		StatusCode = http.StatusConflict
 		shortKey = errDuplicate.ExistsKey
+	} else if errorapp.IsInvalidInput(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if writeQuotaError(w, err) {
+		return
 	} else if err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -109,19 +184,175 @@ func (h *Handlers) HandlerURLtoShort(w http.ResponseWriter, r *http.Request) {
 
 // HandlerShortToURL - обработчик Get запросов, который возвращает полный URL, соответствующий переданному короткому идентификатору
 // ссылки в пути URL, в заголовке ответа Location. Если URL не найден в базе данных, то возвращает соответствующий HTTP статус.
+// Вместо перенаправления показывается страница предпросмотра, если к ключу добавлен "+", передан параметр
+// preview=1 или владелец включил предпросмотр для ссылки.
+// Маршрут "/{ShortKey}/*" обрабатывает переходы с путем после ключа (см. Shortener.Target).
+// До наступления времени начала действия ссылки возвращается страница "Скоро" со статусом 404.
+// Если у ссылки есть правила перенаправления, адрес перехода выбирается по User-Agent, Accept-Language
+// и стране клиента до применения остальных настроек ссылки. Если правило не сработало, а у ссылки есть
+// варианты A/B-теста, адрес выбирается среди вариантов и закрепляется за посетителем в cookie (см. pickVariant).
 func (h Handlers) HandlerShortToURL(w http.ResponseWriter, r *http.Request) {
 	shortKey := chi.URLParam(r, "ShortKey")
-	fullURL, err := h.service.GetURL(shortKey)
+	preview := strings.HasSuffix(shortKey, "+") || r.URL.Query().Get("preview") == "1"
+	shortKey = strings.TrimSuffix(shortKey, "+")
+	link, err := h.service.GetLink(shortKey)
 	if err != nil {
+		var disabled *errorapp.URLDisabledError
+		if errors.As(err, &disabled) {
+			h.writeDisabled(w, shortKey, disabled.Reason)
+			return
+		}
 		if errors.Is(err, errorapp.ErrorPageNotAvailable) {
 			w.WriteHeader(http.StatusGone)
 			return
 		}
+		var notActive *errorapp.URLNotActiveError
+		if errors.As(err, &notActive) {
+			h.writeComingSoon(w, shortKey, notActive.ActiveFrom)
+			return
+		}
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Location", fullURL)
-	w.WriteHeader(http.StatusTemporaryRedirect)
+	matched := false
+	if len(link.Rules) > 0 {
+		client := h.service.Client(r.UserAgent(), r.Header.Get("Accept-Language"), h.clientIP(r))
+		link, matched = targeting.Apply(link, client)
+	}
+	var variantID int64
+	if !matched && len(link.Targets) > 0 {
+		variantID = h.pickVariant(w, r, &link)
+	}
+	// параметры и путь запроса передаются в исходный URL, если это разрешено для ссылки
+	query := r.URL.Query()
+	query.Del("preview")
+	link.FullURL, err = h.service.Target(link, query, chi.URLParam(r, "*"))
+	if err != nil {
+		if errors.Is(err, errorapp.ErrorURLNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if preview || link.ForcePreview {
+		h.writePreview(w, link)
+		return
+	}
+	if err := h.service.RecordClick(link, variantID); err != nil {
+		log.Println("не удалось учесть переход по ссылке;", err)
+	}
+	h.writeRedirect(w, link, time.Now())
+}
+
+// variantCookiePrefix - префикс имени cookie, в котором посетителю закрепляется вариант A/B-теста ссылки.
+const variantCookiePrefix = "variant_"
+
+// variantCookieMaxAge - срок хранения закрепленного варианта A/B-теста в секундах.
+const variantCookieMaxAge = 30 * 24 * 60 * 60
+
+// pickVariant - выбирает вариант A/B-теста ссылки для посетителя, подставляет его адрес в link.FullURL
+// и закрепляет вариант в cookie на пути короткой ссылки (по аналогии с cookie token из TokenHandler).
+// Возвращает номер варианта или 0, если активных вариантов нет.
+func (h *Handlers) pickVariant(w http.ResponseWriter, r *http.Request, link *schema.URLRecord) int64 {
+	name := variantCookiePrefix + link.ShortKey
+	var stickyID int64
+	if cookie, err := r.Cookie(name); err == nil {
+		stickyID, _ = strconv.ParseInt(cookie.Value, 10, 64)
+	}
+	variant, ok := targeting.PickVariant(link.Targets, stickyID)
+	if !ok {
+		return 0
+	}
+	link.FullURL = variant.URL
+	if variant.ID != stickyID {
+		cookie := h.newCookie(name, strconv.FormatInt(variant.ID, 10), "/"+link.ShortKey)
+		cookie.MaxAge = variantCookieMaxAge
+		http.SetCookie(w, cookie)
+	}
+	return variant.ID
+}
+
+// writeRedirect - перенаправляет на исходный URL с кодом, заданным для ссылки (или кодом по умолчанию сервера).
+// Постоянные перенаправления разрешено кэшировать не дольше RedirectCacheMaxAge и не дольше срока действия ссылки,
+// временные не кэшируются. Ответ для ссылки с правилами перенаправления или вариантами A/B-теста зависит
+// от клиента, поэтому кэшируется только в браузере и с заголовком Vary. Ответ с кукой (токеном нового
+// посетителя из TokenHandler или вариантом A/B-теста) также не должен попасть в общий кэш.
+func (h Handlers) writeRedirect(w http.ResponseWriter, link schema.URLRecord, now time.Time) {
+	code := link.RedirectType
+	if code == 0 {
+		code = h.cfg.RedirectType
+	}
+	maxAge := 0
+	if schema.PermanentRedirect(code) {
+		maxAge = h.cfg.RedirectCacheMaxAge
+		if link.ExpiresAt != nil {
+			if left := int(link.ExpiresAt.Sub(now).Seconds()); left < maxAge {
+				maxAge = left
+			}
+		}
+	}
+	scope := "public"
+	if len(link.Rules) > 0 {
+		scope = "private"
+		w.Header().Add("Vary", "User-Agent, Accept-Language")
+	}
+	if len(link.Targets) > 0 {
+		scope = "private"
+		w.Header().Add("Vary", "Cookie")
+	}
+	if len(w.Header().Values("Set-Cookie")) > 0 {
+		scope = "private"
+	}
+	if maxAge > 0 {
+		w.Header().Set("Cache-Control", scope+", max-age="+strconv.Itoa(maxAge))
+		w.Header().Set("Expires", now.Add(time.Duration(maxAge)*time.Second).UTC().Format(http.TimeFormat))
+	} else {
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Header().Set("Expires", now.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Location", link.FullURL)
+	w.WriteHeader(code)
+}
+
+// HandlerAPIQRCode - возвращает QR-код короткой ссылки в формате PNG или SVG.
+// Параметры запроса: format - png (по умолчанию) или svg; size - размер в пикселях;
+// level - уровень коррекции ошибок L, M, Q или H; margin - ширина рамки в модулях.
+func (h *Handlers) HandlerAPIQRCode(w http.ResponseWriter, r *http.Request) {
+	shortKey := chi.URLParam(r, "ShortKey")
+	query := r.URL.Query()
+	opts, err := qr.ParseOptions(query.Get("format"), query.Get("size"), query.Get("level"), query.Get("margin"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// QR-код запланированной ссылки можно получить заранее, до начала ее действия
+	var notActive *errorapp.URLNotActiveError
+	_, err = h.service.GetURL(shortKey)
+	if err != nil && !errors.As(err, &notActive) {
+		if errors.Is(err, errorapp.ErrorPageNotAvailable) {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	shortURL, err := h.createLink(shortKey)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	img, err := qr.Encode(shortURL, opts)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", opts.ContentType())
+	w.WriteHeader(http.StatusOK)
+	w.Write(img)
 }
 
 // HandlerAPIShortenBatch - записывает сокращенный идентификатор и полный URL в хранилище в формате batch.
@@ -153,7 +384,14 @@ func (h *Handlers) HandlerAPIShortenBatch(w http.ResponseWriter, r *http.Request
 		return
 	}
 	// получаем идентификаторы ссылок записанные в базу
-	shortKeys, err := h.service.SetBatchURLs(batch, token)
+	shortKeys, err := h.service.SetBatchURLs(batch, token, h.clientIP(r))
+	if errorapp.IsInvalidInput(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if writeQuotaError(w, err) {
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Println(err)
@@ -210,12 +448,18 @@ func (h *Handlers) HandlerAPIShorten(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// получаем созданный короткий ключ для URL
-	shortKey, err := h.service.CreateShortKey(inputData.URL, token)
+	shortKey, err := h.service.CreateShortKeyWithMeta(inputData.URL, token, h.clientIP(r), inputData.Meta())
 	var errDuplicate *errorapp.URLDuplicateError
 	if errors.As(err, &errDuplicate) {
 		// если ошибка дубликации урл
 		StatusCode = http.StatusConflict
 		shortKey = errDuplicate.ExistsKey
+	} else if errors.Is(err, errorapp.ErrorFolderNotFound) || errors.Is(err, errorapp.ErrorCampaignNotFound) ||
+		errorapp.IsInvalidInput(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if writeQuotaError(w, err) {
+		return
 	} else if err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -230,6 +474,14 @@ func (h *Handlers) HandlerAPIShorten(w http.ResponseWriter, r *http.Request) {
 	}
 	// пишем ответ
 	output := schema.APIShortenOutput{Result: shortURL}
+	if inputData.QR {
+		output.QR, err = qr.DataURI(shortURL)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
 	result, err := json.Marshal(output)
 	if err != nil {
 		log.Println(err)
@@ -241,31 +493,51 @@ func (h *Handlers) HandlerAPIShorten(w http.ResponseWriter, r *http.Request) {
 	w.Write(result)
 }
 
-// HandlerAPIUserAllURLs - возвращает пользователю все его сокращенные и полные URL в формате JSON
+// HandlerAPIUserAllURLs - возвращает пользователю его сокращенные и полные URL в формате JSON постранично.
+// Параметры запроса:
+//   - cursor - курсор следующей страницы из заголовка X-Next-Cursor предыдущего ответа;
+//   - limit - размер страницы (по умолчанию shortener.DefaultListLimit);
+//   - sort - поле сортировки created или key, order - направление asc или desc;
+//   - q - подстрока исходного URL, domain - домен исходного URL;
+//   - status - active (по умолчанию), deleted, expired, scheduled, disabled или all;
+//   - tag - метка ссылки, folder - идентификатор папки, campaign - идентификатор кампании.
+//
+// Если есть следующая страница, ее курсор возвращается в заголовке X-Next-Cursor.
 func (h *Handlers) HandlerAPIUserAllURLs(w http.ResponseWriter, r *http.Request) {
 	token, err := GetToken(r)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Println(err)
 	}
-	// запрашиваем мапу со всеми url пользователя
-	allURLs := h.service.GetAllURLs(token)
-	if len(allURLs) == 0 {
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// запрашиваем страницу url пользователя
+	page, err := h.service.ListURLs(token, opts)
+	if errors.Is(err, errorapp.ErrorInvalidListOptions) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(page.Items) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
-	outUrls := make(schema.APIUserURLs, len(allURLs))
-	i := 0
-	for k, v := range allURLs {
-		shortURL, err2 := h.createLink(k)
+	outUrls := make(schema.APIUserURLs, len(page.Items))
+	now := time.Now()
+	for i, rec := range page.Items {
+		shortURL, err2 := h.createLink(rec.ShortKey)
 		if err2 != nil {
 			log.Println(err2)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		outUrls[i].ShortURL = shortURL
-		outUrls[i].OriginalURL = v
-		i++
+		outUrls[i] = schema.NewAPIUserURL(rec, shortURL, now)
 	}
 
 	result, err := json.Marshal(outUrls)
@@ -274,11 +546,320 @@ func (h *Handlers) HandlerAPIUserAllURLs(w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(result)
 }
 
+// HandlerAPIUpdateURL - изменяет название, заметку, метки и срок действия ссылки пользователя.
+// Принимает JSON schema.APIUpdateURLInput, поля отсутствующие в запросе не изменяются.
+// Возвращает обновленную ссылку в формате JSON.
+func (h *Handlers) HandlerAPIUpdateURL(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIUpdateURL произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	inputData := schema.APIUpdateURLInput{}
+	err = json.NewDecoder(r.Body).Decode(&inputData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rec, err := h.service.UpdateURL(chi.URLParam(r, "ShortKey"), token, inputData.Patch())
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	h.writeUserURL(w, rec)
+}
+
+// HandlerAPIAddTags - добавляет ссылке пользователя метки, переданные JSON массивом строк.
+// Возвращает обновленную ссылку в формате JSON.
+func (h *Handlers) HandlerAPIAddTags(w http.ResponseWriter, r *http.Request) {
+	h.changeTags(w, r, h.service.AddTags)
+}
+
+// HandlerAPIRemoveTags - убирает у ссылки пользователя метки, переданные JSON массивом строк.
+// Возвращает обновленную ссылку в формате JSON.
+func (h *Handlers) HandlerAPIRemoveTags(w http.ResponseWriter, r *http.Request) {
+	h.changeTags(w, r, h.service.RemoveTags)
+}
+
+// changeTags - общая часть обработчиков добавления и удаления меток.
+func (h *Handlers) changeTags(w http.ResponseWriter, r *http.Request, change func(shortKey, tokenID string, tags []string) (schema.URLRecord, error)) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в changeTags произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	tags := []string{}
+	err = json.NewDecoder(r.Body).Decode(&tags)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rec, err := change(chi.URLParam(r, "ShortKey"), token, tags)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	h.writeUserURL(w, rec)
+}
+
+// HandlerAPIUserTags - возвращает метки активных ссылок пользователя с количеством ссылок по каждой метке.
+// Ссылки с меткой можно получить через /api/user/urls?tag=<метка>.
+func (h *Handlers) HandlerAPIUserTags(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIUserTags произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	tags, err := h.service.ListTags(token)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(tags) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// HandlerAPICreateFolder - создает папку пользователя по JSON {"name": "..."}.
+func (h *Handlers) HandlerAPICreateFolder(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPICreateFolder произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	inputData := schema.APIFolderInput{}
+	err = json.NewDecoder(r.Body).Decode(&inputData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	folder, err := h.service.CreateFolder(token, inputData.Name)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, folder)
+}
+
+// HandlerAPIUserFolders - возвращает папки пользователя с количеством активных ссылок в каждой.
+// Ссылки папки можно получить через /api/user/urls?folder=<id>.
+func (h *Handlers) HandlerAPIUserFolders(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIUserFolders произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	folders, err := h.service.ListFolders(token)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(folders) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, folders)
+}
+
+// HandlerAPIDeleteFolder - удаляет папку пользователя. Ссылки из папки остаются без папки.
+func (h *Handlers) HandlerAPIDeleteFolder(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIDeleteFolder произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	folderID, err := strconv.ParseInt(chi.URLParam(r, "FolderID"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	err = h.service.DeleteFolder(folderID, token)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlerAPIDeleteFolderURLs - удаляет все ссылки папки пользователя тем же способом, что и HandlerAPIDeleteUrls.
+// Метод только принимает запрос, удаление может произойти позже.
+func (h *Handlers) HandlerAPIDeleteFolderURLs(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIDeleteFolderURLs произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	folderID, err := strconv.ParseInt(chi.URLParam(r, "FolderID"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	keys, err := h.service.FolderKeys(folderID, token)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	go h.service.DeleteBatch(keys, token)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandlerAPICreateCampaign - создает кампанию пользователя по JSON {"name": "...", "utm": {"utm_source": "...", ...}}.
+// В значениях UTM-параметров можно использовать {short_key} и {title} ссылки.
+func (h *Handlers) HandlerAPICreateCampaign(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPICreateCampaign произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	inputData := schema.APICampaignInput{}
+	err = json.NewDecoder(r.Body).Decode(&inputData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	campaign, err := h.service.CreateCampaign(token, inputData)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, campaign)
+}
+
+// HandlerAPIUserCampaigns - возвращает кампании пользователя с количеством активных ссылок и переходов.
+// Ссылки кампании можно получить через /api/user/urls?campaign=<id>.
+func (h *Handlers) HandlerAPIUserCampaigns(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIUserCampaigns произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	campaigns, err := h.service.ListCampaigns(token)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(campaigns) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, campaigns)
+}
+
+// HandlerAPIUserCampaign - возвращает кампанию пользователя с количеством переходов.
+func (h *Handlers) HandlerAPIUserCampaign(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIUserCampaign произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	campaignID, err := strconv.ParseInt(chi.URLParam(r, "CampaignID"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	campaign, err := h.service.GetCampaign(campaignID, token)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, campaign)
+}
+
+// HandlerAPIDeleteCampaign - удаляет кампанию пользователя. Ссылки кампании остаются без кампании.
+func (h *Handlers) HandlerAPIDeleteCampaign(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIDeleteCampaign произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	campaignID, err := strconv.ParseInt(chi.URLParam(r, "CampaignID"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	err = h.service.DeleteCampaign(campaignID, token)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeUserURL - пишет в ответ ссылку пользователя в формате JSON.
+func (h *Handlers) writeUserURL(w http.ResponseWriter, rec schema.URLRecord) {
+	shortURL, err := h.createLink(rec.ShortKey)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, schema.NewAPIUserURL(rec, shortURL, time.Now()))
+}
+
+// writeJSON - сериализует v в JSON и пишет в ответ с кодом statusCode.
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	result, err := json.Marshal(v)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(result)
+}
+
+// writeURLError - пишет в ответ статус, соответствующий ошибке операции со ссылкой пользователя.
+func (h *Handlers) writeURLError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errorapp.ErrorURLNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, errorapp.ErrorAccessDenied):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, errorapp.ErrorFolderNotFound), errors.Is(err, errorapp.ErrorCampaignNotFound),
+		errors.Is(err, errorapp.ErrorRuleNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errorapp.IsInvalidInput(err):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errorapp.ErrorInvalidCredentials), errors.Is(err, errorapp.ErrorLoginRequired):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, errorapp.ErrorAccountExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errorapp.ErrorAPIKeyNotFound), errors.Is(err, errorapp.ErrorWorkspaceNotFound),
+		errors.Is(err, errorapp.ErrorMemberNotFound), errors.Is(err, errorapp.ErrorTransferNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errorapp.ErrorWorkspaceRole), errors.Is(err, errorapp.ErrorAdminRequired):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
 // HandlerAPIDeleteUrls - удаляет все URL, переданные в запросе в формате JSON
 // Удаление происходит только при получении запроса от автора создания короткого идентификатора.
 func (h *Handlers) HandlerAPIDeleteUrls(w http.ResponseWriter, r *http.Request) {
@@ -307,11 +888,7 @@ func (h *Handlers) HandlerAPIDeleteUrls(w http.ResponseWriter, r *http.Request)
 // HandlerAPIINternalStats - возвращает статистику по хранилищу сервиса. Доступен только для IP из доверительной подсети (доверительная устанавливается при конфигурации сервиса)
 func (h *Handlers) HandlerAPIINternalStats(w http.ResponseWriter, r *http.Request) {
 	// проверяем IP
-	remoteAddr := r.Header.Get("X-Real-IP")
-	if remoteAddr == "" {
-		remoteAddr = r.RemoteAddr
-	}
-	if !h.isTrustedSubnet(remoteAddr) {
+	if !h.ips.Trusted(h.clientIP(r)) {
 		w.WriteHeader(http.StatusForbidden)
 		return
 	}
@@ -339,28 +916,6 @@ func (h *Handlers) createLink(shortKey string) (string, error) {
 	return url.JoinPath(h.baseURL, shortKey)
 }
 
-// isTrustedSubnet - проверяет входит ли IP-адрес в доверительную подсеть сервера
-func (h *Handlers) isTrustedSubnet(remoteAddr string) bool {
-	if h.trustedSubnet == nil {
-		return false
-	}
-	// Парсим IP-адрес из Request.RemoteAddr
-	host, _, err := net.SplitHostPort(remoteAddr)
-	if err != nil {
-		log.Println("Error splitting host and port:", err)
-		// return false // возможно строка не содержит порт, проверяем дальше
-		host = remoteAddr
-	}
-	IP := net.ParseIP(host)
-	if IP == nil {
-		log.Println("Error parsing IP address:", err)
-		return false
-	}
-
-	// Проверяем входит ли IP-адрес в доверительную подсеть
-	return h.trustedSubnet.Contains(IP)
-}
-
 // newWriter - структура для подмены writer
 type newWriter struct {
 	http.ResponseWriter
@@ -372,25 +927,51 @@ func (w newWriter) Write(b []byte) (int, error) {
 	return w.Writer.Write(b)
 }
 
-// TokenHandler - Middleware функция проверяет и выдает токен в куках для аутентификации
+// TokenHandler - Middleware функция проверяет и выдает токен в куках для аутентификации.
+//   - отсутствующий или поддельный токен заменяется токеном нового пользователя;
+//   - истекший токен отклоняется с кодом 401 и удаляется из кук; для GET и HEAD запросов вне /api/
+//     (переходы по ссылкам) вместо отказа выдается токен нового пользователя;
+//   - токен старого формата, токен, срок действия которого подходит к концу, и токен, подписанный
+//     прежним ключом, заменяются новым токеном того же пользователя.
+//
+// Идентификатор пользователя проверенного или только что выданного токена передается дальше в контексте
+// запроса (см. GetToken), поэтому первый запрос без куки выполняется от имени нового пользователя.
+// Запрос с заголовком "Authorization: Bearer" аутентифицируется ключом API (см. apiKeyAuth), кука token не проверяется.
 func (h *Handlers) TokenHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := r.Cookie("token")
-		if err != nil || !h.service.CheckToken(token.Value) {
-			newToken, err := h.service.GenerateNewToken()
-			if err != nil {
-				log.Println("ошибка при генерации токена;", err)
-				w.WriteHeader(http.StatusInternalServerError)
+		if raw, ok := bearerToken(r); ok {
+			h.apiKeyAuth(next, w, r, raw)
+			return
+		}
+		var claims token.Claims
+		cookie, err := r.Cookie("token")
+		if err == nil {
+			claims, err = h.service.ParseToken(cookie.Value)
+		}
+		if errors.Is(err, errorapp.ErrorTokenExpired) {
+			h.clearTokenCookie(w)
+			safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+			if !safe || strings.HasPrefix(r.URL.Path, "/api/") {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
-			// ставим новые куки и в ответ и в запрос
-			cookie := &http.Cookie{Name: "token", Value: newToken, Path: "/"}
-			http.SetCookie(w, cookie)
-			// token.Value = newToken // меняем в request значение токена на новый
-			// r.Cookies()
-			r.AddCookie(cookie) // это не работает
 		}
-		next.ServeHTTP(w, r)
+		newToken := ""
+		switch {
+		case err != nil:
+			newToken, claims, err = h.service.NewUserToken()
+		case h.service.TokenNeedsRefresh(claims):
+			newToken, claims, err = h.service.RefreshToken(cookie.Value)
+		}
+		if err != nil {
+			log.Println("ошибка при выдаче токена;", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if newToken != "" {
+			h.setTokenCookie(w, newToken, claims)
+		}
+		next.ServeHTTP(w, withUser(r, claims.UserID))
 	})
 }
 
@@ -445,29 +1026,43 @@ func gzipReader(next http.Handler) http.Handler {
 	})
 }
 
-// GetToken - функция для получения последнего токена в куках
-// Токен определяется перебором, что исключает ошибки в случае наличия нескольких токенов (берется только последний записанный токен)
-func GetToken(r *http.Request) (string, error) {
-	cookies := r.Cookies()
-	cookie := new(http.Cookie)
-	for _, c := range cookies {
-		if c.Name == "token" {
-			cookie = c
+// parseListOptions - собирает параметры выборки списка ссылок из параметров запроса.
+func parseListOptions(query url.Values) (schema.ListURLsOptions, error) {
+	opts := schema.ListURLsOptions{
+		Cursor: query.Get("cursor"),
+		SortBy: query.Get("sort"),
+		Query:  query.Get("q"),
+		Domain: query.Get("domain"),
+		Status: query.Get("status"),
+		Tag:    query.Get("tag"),
+	}
+	if folder := query.Get("folder"); folder != "" {
+		n, err := strconv.ParseInt(folder, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("некорректный folder %q", folder)
 		}
+		opts.FolderID = n
 	}
-	if cookie == nil {
-		return "", errors.New("токен не найден;")
+	if campaign := query.Get("campaign"); campaign != "" {
+		n, err := strconv.ParseInt(campaign, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("некорректный campaign %q", campaign)
+		}
+		opts.CampaignID = n
 	}
-	return cookie.Value, nil
-}
-
-// ParseSubnetCIDR - парсит строку в формате CIDR и возвращает подсеть *net.IPNet
-func ParseSubnetCIDR(trustedSubnet string) *net.IPNet {
-	// Парсим доверительную подсеть CIDR
-	_, subnet, err := net.ParseCIDR(trustedSubnet)
-	if err != nil {
-		log.Println("Error parsing trusted subnet:", err)
-		return nil
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return opts, fmt.Errorf("некорректный limit %q", limit)
+		}
+		opts.Limit = n
+	}
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, fmt.Errorf("некорректный order %q", order)
 	}
-	return subnet
+	return opts, nil
 }
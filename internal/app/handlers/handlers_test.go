@@ -2,14 +2,29 @@ package handlers
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"io"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bubu256/go-url-shortener-server/config"
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
 	"github.com/bubu256/go-url-shortener-server/internal/app/shortener"
+	"github.com/bubu256/go-url-shortener-server/internal/app/token"
 	"github.com/bubu256/go-url-shortener-server/pkg/storage/mem"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -66,6 +81,16 @@ func TestRouting(t *testing.T) {
 			// проверка body возможна только при фиксации rand.seed в тесте
 			want: want{statusCode: http.StatusCreated, body: cfg.Server.BaseURL + "/23bS"},
 		},
+		{
+			name: "create javascript link 400",
+			req:  req{method: "POST", url: "/", body: "javascript:alert(1)"},
+			want: want{statusCode: http.StatusBadRequest, body: "некорректный исходный URL; допустимы только схемы http и https\n"},
+		},
+		{
+			name: "create empty link 400",
+			req:  req{method: "POST", url: "/", body: "  "},
+			want: want{statusCode: http.StatusBadRequest, body: "некорректный исходный URL; передан пустой URL\n"},
+		},
 	}
 
 	for _, d := range tt {
@@ -89,12 +114,111 @@ func TestRouting(t *testing.T) {
 	}
 }
 
-func TestHandlers_HandlerApiShorten(t *testing.T) {
+// testServer - обработчики поверх хранилища в памяти, общие для тестов пакета.
+type testServer struct {
+	t       *testing.T
+	cfg     config.Configuration
+	storage *mem.MapDBMutex
+	service *shortener.Shortener
+	handler *Handlers
+}
+
+// newTestServer - создает хранилище в памяти, сервис и обработчики с BASE_URL http://example.com.
+// Функции setup изменяют настройки до создания сервиса.
+func newTestServer(t *testing.T, setup ...func(cfg *config.Configuration)) *testServer {
 	cfg := config.New()
 	cfg.Server.BaseURL = "http://example.com"
+	for _, f := range setup {
+		f(&cfg)
+	}
 	dataStorage := mem.NewMapDBMutex(cfg.DB, nil)
 	service := shortener.New(dataStorage, cfg.Service)
-	handler := New(service, cfg.Server)
+	return &testServer{t: t, cfg: cfg, storage: dataStorage, service: service, handler: New(service, cfg.Server)}
+}
+
+// requestOption - изменяет запрос тестового сервера перед отправкой.
+type requestOption func(r *http.Request)
+
+// withCookie - передает токен пользователя в куке token.
+func withCookie(value string) requestOption {
+	return func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "token", Value: value}) }
+}
+
+// withAPIKey - передает ключ API в заголовке Authorization.
+func withAPIKey(key string) requestOption {
+	return withHeader("Authorization", "Bearer "+key)
+}
+
+// withHeader - устанавливает заголовок запроса.
+func withHeader(name, value string) requestOption {
+	return func(r *http.Request) { r.Header.Set(name, value) }
+}
+
+// withRemoteAddr - задает адрес клиента запроса.
+func withRemoteAddr(addr string) requestOption {
+	return func(r *http.Request) { r.RemoteAddr = addr }
+}
+
+// do - выполняет запрос к обработчикам и возвращает ответ. Тело запроса передается как JSON.
+func (s *testServer) do(method, target, body string, opts ...requestOption) *http.Response {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for _, opt := range opts {
+		opt(r)
+	}
+	w := httptest.NewRecorder()
+	s.handler.Router.ServeHTTP(w, r)
+	return w.Result()
+}
+
+// status - выполняет запрос и возвращает код ответа.
+func (s *testServer) status(method, target, body string, opts ...requestOption) int {
+	resp := s.do(method, target, body, opts...)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// decode - проверяет код ответа и разбирает его JSON-тело в v.
+func (s *testServer) decode(resp *http.Response, statusCode int, v any) {
+	defer resp.Body.Close()
+	require.Equal(s.t, statusCode, resp.StatusCode)
+	require.NoError(s.t, json.NewDecoder(resp.Body).Decode(v))
+}
+
+// newUser - выдает токен новому анонимному пользователю, возвращает токен и идентификатор пользователя.
+func (s *testServer) newUser() (string, string) {
+	raw, claims, err := s.service.NewUserToken()
+	require.NoError(s.t, err)
+	return raw, claims.UserID
+}
+
+// register - регистрирует учетную запись username и возвращает ее куку token и идентификатор.
+func (s *testServer) register(username string, opts ...requestOption) (string, string) {
+	resp := s.do("POST", "/api/user/register", `{"username":"`+username+`","password":"password1"}`, opts...)
+	account := schema.Account{}
+	s.decode(resp, http.StatusCreated, &account)
+	return tokenCookie(resp).Value, account.ID
+}
+
+// shorten - создает ссылку через /api/shorten и возвращает ее ключ.
+func (s *testServer) shorten(url string, opts ...requestOption) string {
+	output := schema.APIShortenOutput{}
+	s.decode(s.do("POST", "/api/shorten", `{"url":"`+url+`"}`, opts...), http.StatusCreated, &output)
+	return strings.TrimPrefix(output.Result, s.cfg.Server.BaseURL+"/")
+}
+
+// tokenCookie - возвращает последнюю куку token ответа (middleware может выдать анонимный токен до входа).
+func tokenCookie(resp *http.Response) (cookie *http.Cookie) {
+	for _, c := range resp.Cookies() {
+		if c.Name == "token" {
+			cookie = c
+		}
+	}
+	return cookie
+}
+
+func TestHandlers_HandlerApiShorten(t *testing.T) {
+	handler := newTestServer(t).handler
 
 	type want struct {
 		body        string
@@ -122,7 +246,7 @@ func TestHandlers_HandlerApiShorten(t *testing.T) {
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest("POST", "/api/shorten", bytes.NewBufferString(tt.req.body))
 			r.Header.Set("Content-Type", "application/json")
-			handler.HandlerAPIShorten(w, r)
+			handler.Router.ServeHTTP(w, r)
 			result := w.Result()
 			assert.Equal(t, tt.want.statusCode, result.StatusCode)
 			assert.Equal(t, tt.want.contentType, result.Header.Get("Content-Type"))
@@ -133,3 +257,1673 @@ func TestHandlers_HandlerApiShorten(t *testing.T) {
 		})
 	}
 }
+
+func TestHandlers_HandlerAPIUserAllURLs(t *testing.T) {
+	srv := newTestServer(t)
+	token, userID := srv.newUser()
+	for _, u := range []string{"https://a.example.org/1", "https://b.example.org/2", "https://other.net/3"} {
+		_, err := srv.service.CreateShortKey(u, userID, "")
+		require.NoError(t, err)
+	}
+
+	get := func(query string) *http.Response {
+		return srv.do("GET", "/api/user/urls"+query, "", withCookie(token))
+	}
+	readURLs := func(resp *http.Response) []string {
+		defer resp.Body.Close()
+		out := schema.APIUserURLs{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+		urls := make([]string, 0, len(out))
+		for _, u := range out {
+			urls = append(urls, u.OriginalURL)
+		}
+		return urls
+	}
+
+	// постраничный обход
+	resp := get("?limit=2")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	cursor := resp.Header.Get("X-Next-Cursor")
+	assert.NotEmpty(t, cursor)
+	assert.Equal(t, []string{"https://a.example.org/1", "https://b.example.org/2"}, readURLs(resp))
+	resp = get("?limit=2&cursor=" + cursor)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("X-Next-Cursor"))
+	assert.Equal(t, []string{"https://other.net/3"}, readURLs(resp))
+
+	// фильтр по домену и сортировка по убыванию
+	resp = get("?domain=example.org&order=desc")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"https://b.example.org/2", "https://a.example.org/1"}, readURLs(resp))
+
+	// некорректные параметры
+	resp = get("?sort=unknown")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHandlers_HandlerAPIUpdateURL(t *testing.T) {
+	srv := newTestServer(t)
+	owner, ownerID := srv.newUser()
+	stranger, _ := srv.newUser()
+	key, err := srv.service.CreateShortKeyWithMeta("https://example.org/meta", ownerID, "", schema.URLMeta{Title: "old", Tags: []string{"a"}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		key        string
+		token      string
+		body       string
+		statusCode int
+		want       schema.APIUserURL
+	}{
+		{
+			name:       "update title and tags",
+			key:        key,
+			token:      owner,
+			body:       `{"title":"new","tags":[" B ","b","c"]}`,
+			statusCode: http.StatusOK,
+			want:       schema.APIUserURL{OriginalURL: "https://example.org/meta", Title: "new", Tags: []string{"b", "c"}},
+		},
+		{
+			name:       "not owner",
+			key:        key,
+			token:      stranger,
+			body:       `{"title":"hacked"}`,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "not found",
+			key:        "-noExistKey",
+			token:      owner,
+			body:       `{"title":"new"}`,
+			statusCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := srv.do("PATCH", "/api/user/urls/"+tt.key, tt.body, withCookie(tt.token))
+			defer result.Body.Close()
+			require.Equal(t, tt.statusCode, result.StatusCode)
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+			got := schema.APIUserURL{}
+			require.NoError(t, json.NewDecoder(result.Body).Decode(&got))
+			assert.Equal(t, tt.want.OriginalURL, got.OriginalURL)
+			assert.Equal(t, tt.want.Title, got.Title)
+			assert.Equal(t, tt.want.Tags, got.Tags)
+			assert.NotNil(t, got.CreatedAt)
+		})
+	}
+}
+
+func TestHandlers_TagsAndFolders(t *testing.T) {
+	srv := newTestServer(t)
+	service := srv.service
+	token, userID := srv.newUser()
+	do := func(method, target, body string) *http.Response {
+		return srv.do(method, target, body, withCookie(token))
+	}
+
+	// создаем папку и ссылки в ней
+	folder := schema.Folder{}
+	srv.decode(do("POST", "/api/user/folders", `{"name":"campaign"}`), http.StatusCreated, &folder)
+	keyInFolder, err := service.CreateShortKeyWithMeta("https://example.org/in", userID, "", schema.URLMeta{FolderID: folder.ID})
+	require.NoError(t, err)
+	keyOutside, err := service.CreateShortKey("https://example.org/out", userID, "")
+	require.NoError(t, err)
+
+	// метки
+	resp := do("POST", "/api/user/urls/"+keyOutside+"/tags", `["Promo","spring"]`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = do("DELETE", "/api/user/urls/"+keyOutside+"/tags", `["spring"]`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = do("GET", "/api/user/tags", "")
+	tags := []schema.APITagInfo{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&tags))
+	resp.Body.Close()
+	assert.Equal(t, []schema.APITagInfo{{Name: "promo", Count: 1}}, tags)
+	resp = do("GET", "/api/user/urls?tag=promo", "")
+	out := schema.APIUserURLs{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+	resp.Body.Close()
+	require.Len(t, out, 1)
+	assert.Equal(t, "https://example.org/out", out[0].OriginalURL)
+
+	// удаление ссылок папки через DeleteBatch
+	resp = do("DELETE", "/api/user/folders/"+strconv.FormatInt(folder.ID, 10)+"/urls", "")
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Eventually(t, func() bool {
+		_, err := service.GetURL(keyInFolder)
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	_, err = service.GetURL(keyOutside)
+	assert.NoError(t, err)
+}
+
+func TestHandlers_HandlerAPIQRCode(t *testing.T) {
+	srv := newTestServer(t)
+	token, userID := srv.newUser()
+	shortKey, err := srv.service.CreateShortKey("https://example.org/poster", userID, "")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		target      string
+		statusCode  int
+		contentType string
+		prefix      string
+	}{
+		{"png по умолчанию", "/api/qr/" + shortKey, http.StatusOK, "image/png", "\x89PNG"},
+		{"svg", "/api/qr/" + shortKey + "?format=svg&size=300&level=H&margin=0", http.StatusOK, "image/svg+xml", "<svg"},
+		{"неверный размер", "/api/qr/" + shortKey + "?size=10", http.StatusBadRequest, "", ""},
+		{"неверный уровень", "/api/qr/" + shortKey + "?level=X", http.StatusBadRequest, "", ""},
+		{"нет ссылки", "/api/qr/unknown", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := srv.do("GET", tt.target, "")
+			defer resp.Body.Close()
+			require.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tt.contentType, resp.Header.Get("Content-Type"))
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(body), tt.prefix))
+		})
+	}
+
+	// QR-код в ответе на создание ссылки
+	output := schema.APIShortenOutput{}
+	srv.decode(srv.do("POST", "/api/shorten", `{"url":"https://example.org/qr","qr":true}`, withCookie(token)), http.StatusCreated, &output)
+	assert.True(t, strings.HasPrefix(output.QR, "data:image/png;base64,"))
+}
+
+func TestHandlers_Preview(t *testing.T) {
+	srv := newTestServer(t)
+	service := srv.service
+	_, userID := srv.newUser()
+	plainKey, err := service.CreateShortKeyWithMeta("https://example.org/plain?a=1&b=2", userID, "", schema.URLMeta{Title: "<Плакат>"})
+	require.NoError(t, err)
+	forcedKey, err := service.CreateShortKeyWithMeta("https://example.org/forced", userID, "", schema.URLMeta{ForcePreview: true})
+	require.NoError(t, err)
+	deletedKey, err := service.CreateShortKey("https://example.org/deleted", userID, "")
+	require.NoError(t, err)
+	service.DeleteBatch([]string{deletedKey}, userID)
+
+	tests := []struct {
+		name       string
+		target     string
+		statusCode int
+		contains   []string
+	}{
+		{"перенаправление", "/" + plainKey, http.StatusTemporaryRedirect, nil},
+		{"предпросмотр с плюсом", "/" + plainKey + "+", http.StatusOK,
+			[]string{"https://example.org/plain?a=1&amp;b=2", "&lt;Плакат&gt;", "http://example.com/" + plainKey}},
+		{"предпросмотр параметром", "/" + plainKey + "?preview=1", http.StatusOK, []string{"Продолжить"}},
+		{"предпросмотр владельца", "/" + forcedKey, http.StatusOK, []string{"https://example.org/forced"}},
+		{"удаленная ссылка", "/" + deletedKey + "+", http.StatusGone, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := srv.do("GET", tt.target, "")
+			defer resp.Body.Close()
+			require.Equal(t, tt.statusCode, resp.StatusCode)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			for _, s := range tt.contains {
+				assert.Contains(t, string(body), s)
+			}
+		})
+	}
+}
+
+func TestHandlers_RedirectType(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Configuration) { cfg.Server.RedirectCacheMaxAge = 3600 })
+	service := srv.service
+	visitor, userID := srv.newUser()
+	expiresAt := time.Now().Add(10 * time.Minute)
+
+	tests := []struct {
+		name       string
+		meta       schema.URLMeta
+		cookie     bool
+		statusCode int
+		scope      string
+		// minAge, maxAge - допустимый диапазон max-age (0 - ответ не кэшируется)
+		minAge, maxAge int
+	}{
+		{"по умолчанию", schema.URLMeta{}, true, http.StatusTemporaryRedirect, "private, no-store", 0, 0},
+		{"отслеживаемая", schema.URLMeta{RedirectType: http.StatusFound}, true, http.StatusFound, "private, no-store", 0, 0},
+		{"постоянная", schema.URLMeta{RedirectType: http.StatusMovedPermanently}, true, http.StatusMovedPermanently, "public", 3600, 3600},
+		// время кэширования ограничено сроком действия ссылки (чуть меньше 600 секунд)
+		{"постоянная с истечением", schema.URLMeta{RedirectType: http.StatusPermanentRedirect, ExpiresAt: &expiresAt},
+			true, http.StatusPermanentRedirect, "public", 590, 600},
+		// посетителю без куки выдается токен, такой ответ нельзя сохранять в общем кэше
+		{"постоянная без куки", schema.URLMeta{RedirectType: http.StatusMovedPermanently}, false, http.StatusMovedPermanently, "private", 3600, 3600},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := service.CreateShortKeyWithMeta("https://example.org/"+strconv.Itoa(i), userID, "", tt.meta)
+			require.NoError(t, err)
+			var opts []requestOption
+			if tt.cookie {
+				opts = append(opts, withCookie(visitor))
+			}
+			resp := srv.do("GET", "/"+key, "", opts...)
+			defer resp.Body.Close()
+			require.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.NotEmpty(t, resp.Header.Get("Expires"))
+			cacheControl := resp.Header.Get("Cache-Control")
+			if tt.maxAge == 0 {
+				assert.Equal(t, tt.scope, cacheControl)
+				return
+			}
+			scope, age, found := strings.Cut(cacheControl, ", max-age=")
+			require.True(t, found, "Cache-Control = %q", cacheControl)
+			assert.Equal(t, tt.scope, scope)
+			maxAge, err := strconv.Atoi(age)
+			require.NoError(t, err)
+			assert.True(t, maxAge >= tt.minAge && maxAge <= tt.maxAge, "max-age = %d", maxAge)
+			assert.False(t, scope == "public" && len(resp.Cookies()) > 0, "публичный ответ с Set-Cookie")
+		})
+	}
+
+	_, err := service.CreateShortKeyWithMeta("https://example.org/bad", userID, "", schema.URLMeta{RedirectType: http.StatusOK})
+	assert.ErrorIs(t, err, errorapp.ErrorInvalidRedirectType)
+}
+
+func TestHandlers_Passthrough(t *testing.T) {
+	srv := newTestServer(t)
+	service := srv.service
+	_, userID := srv.newUser()
+	create := func(fullURL string, meta schema.URLMeta) string {
+		key, err := service.CreateShortKeyWithMeta(fullURL, userID, "", meta)
+		require.NoError(t, err)
+		return key
+	}
+	plainKey := create("https://example.org/plain", schema.URLMeta{})
+	keepKey := create("https://example.org/keep?utm_source=site", schema.URLMeta{Passthrough: schema.PassthroughQuery})
+	overrideKey := create("https://example.org/override?utm_source=site", schema.URLMeta{
+		Passthrough: schema.PassthroughAll, PassthroughConflict: schema.ConflictOverride})
+	appendKey := create("https://example.org/append?tag=a", schema.URLMeta{
+		Passthrough: schema.PassthroughQuery, PassthroughConflict: schema.ConflictAppend})
+
+	tests := []struct {
+		name       string
+		target     string
+		statusCode int
+		location   string
+	}{
+		{"выключено", "/" + plainKey + "?utm_source=x", http.StatusTemporaryRedirect, "https://example.org/plain"},
+		{"путь при выключенной передаче", "/" + plainKey + "/extra", http.StatusNotFound, ""},
+		{"keep", "/" + keepKey + "?utm_source=x&ref=y", http.StatusTemporaryRedirect, "https://example.org/keep?ref=y&utm_source=site"},
+		{"путь только для query", "/" + keepKey + "/extra", http.StatusNotFound, ""},
+		{"override и путь", "/" + overrideKey + "/a/../../b?utm_source=x", http.StatusTemporaryRedirect,
+			"https://example.org/override/b?utm_source=x"},
+		{"append", "/" + appendKey + "?tag=b", http.StatusTemporaryRedirect, "https://example.org/append?tag=a&tag=b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := srv.do("GET", tt.target, "")
+			defer resp.Body.Close()
+			require.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Equal(t, tt.location, resp.Header.Get("Location"))
+		})
+	}
+
+	_, err := service.CreateShortKeyWithMeta("https://example.org/bad", userID, "", schema.URLMeta{Passthrough: "everything"})
+	assert.ErrorIs(t, err, errorapp.ErrorInvalidPassthrough)
+}
+
+func TestHandlers_Campaigns(t *testing.T) {
+	srv := newTestServer(t)
+	token, _ := srv.newUser()
+	do := func(method, target, body string) *http.Response {
+		return srv.do(method, target, body, withCookie(token))
+	}
+
+	campaign := schema.Campaign{}
+	srv.decode(do("POST", "/api/user/campaigns", `{"name":"spring","utm":{"utm_source":"poster","utm_campaign":"spring","utm_content":"{short_key}"}}`),
+		http.StatusCreated, &campaign)
+	output := schema.APIShortenOutput{}
+	srv.decode(do("POST", "/api/shorten", `{"url":"https://example.org/page?utm_source=own","campaign":`+strconv.FormatInt(campaign.ID, 10)+`}`),
+		http.StatusCreated, &output)
+	shortKey := strings.TrimPrefix(output.Result, "http://example.com/")
+
+	// UTM-параметры добавляются при переходе, существующие параметры исходного URL сохраняются
+	for i := 0; i < 2; i++ {
+		resp := do("GET", "/"+shortKey, "")
+		resp.Body.Close()
+		require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+		assert.Equal(t, "https://example.org/page?utm_campaign=spring&utm_content="+shortKey+"&utm_source=own",
+			resp.Header.Get("Location"))
+	}
+	rec, err := srv.storage.GetRecord(shortKey)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org/page?utm_source=own", rec.FullURL)
+	assert.Equal(t, int64(2), rec.Clicks)
+
+	srv.decode(do("GET", "/api/user/campaigns/"+strconv.FormatInt(campaign.ID, 10), ""), http.StatusOK, &campaign)
+	assert.Equal(t, int64(2), campaign.Clicks)
+
+	resp := do("POST", "/api/shorten", `{"url":"https://example.org/other","campaign":999}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = do("DELETE", "/api/user/campaigns/"+strconv.FormatInt(campaign.ID, 10), "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = do("GET", "/"+shortKey, "")
+	resp.Body.Close()
+	assert.Equal(t, "https://example.org/page?utm_source=own", resp.Header.Get("Location"))
+}
+
+func TestHandlers_Rules(t *testing.T) {
+	srv := newTestServer(t)
+	token, userID := srv.newUser()
+	shortKey, err := srv.service.CreateShortKey("https://example.org/", userID, "")
+	require.NoError(t, err)
+	do := func(method, target, body string) *http.Response {
+		return srv.do(method, target, body, withCookie(token))
+	}
+	rulesPath := "/api/user/urls/" + shortKey + "/rules"
+
+	resp := do("PUT", rulesPath, `[
+		{"platform":"ios","url":"https://apps.apple.com/app/id1"},
+		{"platform":"android","url":"https://play.google.com/store/apps/details?id=app"},
+		{"language":"ru","url":"https://example.org/ru/"}]`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	rule := schema.RedirectRule{}
+	srv.decode(do("POST", rulesPath, `{"language":"DE","url":"https://example.org/de/"}`), http.StatusCreated, &rule)
+	assert.Equal(t, schema.RedirectRule{ID: 4, Language: "de", URL: "https://example.org/de/"}, rule)
+
+	tests := []struct {
+		name      string
+		userAgent string
+		language  string
+		location  string
+	}{
+		{"iOS", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)", "ru", "https://apps.apple.com/app/id1"},
+		{"Android", "Mozilla/5.0 (Linux; Android 14; Pixel 8)", "", "https://play.google.com/store/apps/details?id=app"},
+		{"предпочтительный язык", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)", "de-DE,ru;q=0.8", "https://example.org/de/"},
+		{"второй язык", "Mozilla/5.0 (X11; Linux x86_64)", "fr-FR,ru-RU;q=0.5", "https://example.org/ru/"},
+		{"по умолчанию", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0)", "en-US,en;q=0.9", "https://example.org/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := srv.do("GET", "/"+shortKey, "", withHeader("User-Agent", tt.userAgent), withHeader("Accept-Language", tt.language))
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+			assert.Equal(t, tt.location, resp.Header.Get("Location"))
+			assert.Equal(t, "User-Agent, Accept-Language", resp.Header.Get("Vary"))
+		})
+	}
+
+	resp = do("POST", rulesPath, `{"platform":"symbian","url":"https://example.org/"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = do("DELETE", rulesPath+"/9", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	rules := []schema.RedirectRule{}
+	srv.decode(do("DELETE", rulesPath+"/1", ""), http.StatusOK, &rules)
+	require.Len(t, rules, 3)
+	assert.Equal(t, int64(1), rules[0].ID)
+	assert.Equal(t, "android", rules[0].Platform)
+}
+
+func TestHandlers_SplitTargets(t *testing.T) {
+	srv := newTestServer(t)
+	service := srv.service
+	token, userID := srv.newUser()
+	shortKey, err := service.CreateShortKeyWithMeta("https://example.org/", userID, "", schema.URLMeta{Targets: []schema.SplitTarget{
+		{URL: "https://example.org/a", Weight: 1},
+		{URL: "https://example.org/b", Weight: 0},
+	}})
+	require.NoError(t, err)
+
+	visit := func(cookies ...*http.Cookie) *http.Response {
+		resp := srv.do("GET", "/"+shortKey, "", func(r *http.Request) {
+			for _, c := range cookies {
+				r.AddCookie(c)
+			}
+		})
+		resp.Body.Close()
+		return resp
+	}
+	variantCookie := func(resp *http.Response) *http.Cookie {
+		for _, c := range resp.Cookies() {
+			if c.Name == "variant_"+shortKey {
+				return c
+			}
+		}
+		return nil
+	}
+
+	// приостановленный вариант не выдается, выбранный вариант закрепляется в cookie
+	resp := visit()
+	assert.Equal(t, "https://example.org/a", resp.Header.Get("Location"))
+	assert.Contains(t, resp.Header.Values("Vary"), "Cookie")
+	cookie := variantCookie(resp)
+	require.NotNil(t, cookie)
+	assert.Equal(t, "1", cookie.Value)
+	assert.Equal(t, "/"+shortKey, cookie.Path)
+	resp = visit(cookie)
+	assert.Equal(t, "https://example.org/a", resp.Header.Get("Location"))
+	assert.Nil(t, variantCookie(resp))
+
+	// вариант 1 сохраняет счетчик, новый вариант получает следующий номер
+	targets, err := service.SetTargets(shortKey, userID, []schema.SplitTarget{
+		{ID: 1, URL: "https://example.org/a", Weight: 1},
+		{URL: "https://example.org/c", Weight: 1},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []schema.SplitTarget{
+		{ID: 1, URL: "https://example.org/a", Weight: 1, Clicks: 2},
+		{ID: 3, URL: "https://example.org/c", Weight: 1},
+	}, targets)
+	for i := 0; i < 5; i++ {
+		resp = visit(&http.Cookie{Name: "variant_" + shortKey, Value: "3"})
+		assert.Equal(t, "https://example.org/c", resp.Header.Get("Location"))
+	}
+
+	srv.decode(srv.do("GET", "/api/user/urls/"+shortKey+"/targets", "", withCookie(token)), http.StatusOK, &targets)
+	assert.Equal(t, int64(2), targets[0].Clicks)
+	assert.Equal(t, int64(5), targets[1].Clicks)
+
+	_, err = service.SetTargets(shortKey, userID, []schema.SplitTarget{{URL: "ftp://example.org/", Weight: 1}})
+	assert.ErrorIs(t, err, errorapp.ErrorInvalidTarget)
+}
+
+func TestHandlers_ActiveFrom(t *testing.T) {
+	srv := newTestServer(t)
+	service := srv.service
+	token, userID := srv.newUser()
+	activeFrom := time.Now().Add(time.Hour)
+	key, err := service.CreateShortKeyWithMeta("https://example.org/launch", userID, "", schema.URLMeta{ActiveFrom: &activeFrom})
+	require.NoError(t, err)
+	request := func(method, target, body string) *http.Response {
+		return srv.do(method, target, body, withCookie(token))
+	}
+
+	// до запуска показывается страница "Скоро" без исходного URL
+	resp := request("GET", "/"+key, "")
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Contains(t, string(body), "Скоро")
+	assert.NotContains(t, string(body), "https://example.org/launch")
+	_, err = service.GetURL(key)
+	var notActive *errorapp.URLNotActiveError
+	require.ErrorAs(t, err, &notActive)
+	assert.True(t, notActive.ActiveFrom.Equal(activeFrom))
+
+	// QR-код можно получить заранее
+	resp = request("GET", "/api/qr/"+key, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	urls := schema.APIUserURLs{}
+	srv.decode(request("GET", "/api/user/urls?status=scheduled", ""), http.StatusOK, &urls)
+	require.Len(t, urls, 1)
+	assert.Equal(t, schema.URLStatusScheduled, urls[0].Status)
+
+	// время начала не может быть позже окончания
+	resp = request("PATCH", "/api/user/urls/"+key, `{"expires_at":"`+time.Now().Format(time.RFC3339)+`"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = request("PATCH", "/api/user/urls/"+key, `{"active_from":null}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = request("GET", "/"+key, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://example.org/launch", resp.Header.Get("Location"))
+}
+
+func TestHandlers_Policy(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.txt")
+	require.NoError(t, os.WriteFile(policyFile, []byte("# запрещенные домены\nevil.example\nre:/phish\n"), 0o600))
+	srv := newTestServer(t, func(cfg *config.Configuration) {
+		cfg.Service.PolicyFile = policyFile
+		cfg.Service.AdminUsers = []string{"root"}
+	})
+	service := srv.service
+	service.SetServiceURLs(srv.cfg.Server.BaseURL)
+	root, _ := srv.register("root")
+	bob, _ := srv.register("bob")
+
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+	}{
+		{"поддомен запрещенного домена", "https://login.evil.example/", http.StatusBadRequest},
+		{"запрещенный шаблон", "https://good.example/phish/login", http.StatusBadRequest},
+		{"ссылка на сам сервис", "http://EXAMPLE.com/", http.StatusBadRequest},
+		{"IP-адрес", "http://192.168.0.1/", http.StatusBadRequest},
+		{"кириллица под видом латиницы", "https://аpple.com/", http.StatusBadRequest},
+		{"международный домен", "https://пример.рф/", http.StatusCreated},
+		{"обычный домен", "https://later.example/x", http.StatusCreated},
+	}
+	var laterKey string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := srv.do("POST", "/", tt.url)
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+			require.Equal(t, tt.statusCode, resp.StatusCode, string(body))
+			if tt.statusCode == http.StatusBadRequest {
+				assert.Contains(t, string(body), "запрещен политикой")
+			}
+			laterKey = strings.TrimPrefix(string(body), srv.cfg.Server.BaseURL+"/")
+		})
+	}
+
+	admin := func(action, key, body string) *http.Response {
+		return srv.do("POST", "/api/admin/urls/"+key+"/"+action, body, withCookie(root))
+	}
+	// ссылка не нарушает политику, без причины не отключается
+	resp := admin("disable", laterKey, "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// домен ссылки добавлен в политику после ее создания
+	require.NoError(t, os.WriteFile(policyFile, []byte("evil.example\nlater.example\n"), 0o600))
+	require.NoError(t, service.ReloadPolicy())
+	got := schema.APIUserURL{}
+	srv.decode(admin("disable", laterKey, ""), http.StatusOK, &got)
+	assert.Equal(t, schema.URLStatusDisabled, got.Status)
+	assert.Contains(t, got.DisabledReason, "later.example")
+	assert.Equal(t, http.StatusGone, srv.status("GET", "/"+laterKey, ""))
+
+	resp = admin("enable", laterKey, "")
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, http.StatusTemporaryRedirect, srv.status("GET", "/"+laterKey, ""))
+
+	// не администратор
+	assert.Equal(t, http.StatusForbidden, srv.status("POST", "/api/admin/urls/"+laterKey+"/disable", `{"reason":"spam"}`,
+		withCookie(bob)))
+}
+
+func TestHandlers_ShortLinkChain(t *testing.T) {
+	srv := newTestServer(t)
+	service, dataStorage := srv.service, srv.storage
+	service.SetServiceURLs(srv.cfg.Server.BaseURL, "sho.rt")
+	_, userID := srv.newUser()
+	finalKey, err := service.CreateShortKeyWithMeta("https://example.org/final", userID, "",
+		schema.URLMeta{Passthrough: schema.PassthroughAll})
+	require.NoError(t, err)
+	rulesKey, err := service.CreateShortKeyWithMeta("https://example.org/", userID, "", schema.URLMeta{
+		Rules: []schema.RedirectRule{{Platform: "ios", URL: "https://apps.apple.com/app/id1"}}})
+	require.NoError(t, err)
+	// цепочка и цикл, записанные в хранилище в обход сервиса
+	for key, fullURL := range map[string]string{
+		"hop":   "http://example.com/" + finalKey,
+		"loopA": "http://example.com/loopB",
+		"loopB": "http://example.com/loopA",
+	} {
+		require.NoError(t, dataStorage.SetNewURL(schema.URLRecord{ShortKey: key, FullURL: fullURL, UserID: userID,
+			Available: true, URLMeta: schema.URLMeta{Passthrough: schema.PassthroughQuery}}, schema.URLQuota{}))
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+		original   string
+		errText    string
+	}{
+		{"ссылка на короткую ссылку совпадает с ней", "http://example.com/" + finalKey, http.StatusConflict,
+			"https://example.org/final", ""},
+		{"альтернативный домен, путь и параметры", "https://SHO.RT/" + finalKey + "/sub?a=1", http.StatusCreated,
+			"https://example.org/final/sub?a=1", ""},
+		{"цепочка из двух ссылок", "http://example.com/hop?a=2#top", http.StatusCreated, "https://example.org/final?a=2#top", ""},
+		{"несуществующая ссылка", "http://example.com/nokey", http.StatusBadRequest, "", "не найдена"},
+		{"ссылка с правилами", "http://example.com/" + rulesKey, http.StatusBadRequest, "", "по правилам"},
+		{"цикл", "http://example.com/loopA", http.StatusBadRequest, "", "цикл"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := srv.do("POST", "/", tt.url)
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+			require.Equal(t, tt.statusCode, resp.StatusCode, string(body))
+			if tt.statusCode == http.StatusBadRequest {
+				assert.Contains(t, string(body), tt.errText)
+				return
+			}
+			rec, err := dataStorage.GetRecord(strings.TrimPrefix(string(body), srv.cfg.Server.BaseURL+"/"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.original, rec.FullURL)
+		})
+	}
+}
+
+func TestHandlers_Reports(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Configuration) {
+		cfg.Server.ReportRateLimit = 5
+		cfg.Service.AdminUsers = []string{"root"}
+	})
+	service, dataStorage := srv.service, srv.storage
+	root, _ := srv.register("root")
+	userToken, userID := srv.newUser()
+	badKey, err := service.CreateShortKey("https://bad.example/login", userID, "")
+	require.NoError(t, err)
+	goodKey, err := service.CreateShortKey("https://good.example/", userID, "")
+	require.NoError(t, err)
+
+	reporter := withRemoteAddr("198.51.100.7:4000")
+	reports := func(query string) []schema.AbuseReport {
+		result := []schema.AbuseReport{}
+		srv.decode(srv.do("GET", "/api/admin/reports"+query, "", withCookie(root)), http.StatusOK, &result)
+		return result
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		body       string
+		statusCode int
+	}{
+		{"неизвестная категория", badKey, `{"category":"boring"}`, http.StatusBadRequest},
+		{"фишинг", badKey, `{"category":"Phishing","comment":"крадет пароли"}`, http.StatusCreated},
+		{"без тела", goodKey, "", http.StatusCreated},
+		{"несуществующая ссылка", "nokey", `{"category":"spam"}`, http.StatusNotFound},
+		{"вредоносное ПО", badKey, `{"category":"malware"}`, http.StatusCreated},
+		{"превышен лимит", badKey, `{"category":"spam"}`, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.statusCode, srv.status("POST", "/api/report/"+tt.key, tt.body, reporter))
+		})
+	}
+	resp := srv.do("POST", "/api/report/"+goodKey, `{"category":"spam"}`, reporter)
+	resp.Body.Close()
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	require.NoError(t, err)
+	assert.True(t, retryAfter >= 1 && retryAfter <= 12*60, "Retry-After = %d", retryAfter)
+	// лимит считается для каждого IP-адреса отдельно
+	require.Equal(t, http.StatusCreated, srv.status("POST", "/api/report/"+goodKey, `{"category":"spam"}`, withRemoteAddr("198.51.100.8:4000")))
+
+	assert.Equal(t, http.StatusUnauthorized, srv.status("GET", "/api/admin/reports", "", withCookie(userToken)))
+	open := reports("?status=open&short_key=" + badKey)
+	require.Len(t, open, 2)
+	assert.Equal(t, schema.ReportMalware, open[0].Category)
+	assert.Equal(t, "198.51.100.7", open[1].ReporterIP)
+
+	// отключение ссылки закрывает жалобы, посетитель видит предупреждение
+	require.Equal(t, http.StatusOK, srv.status("POST", "/api/admin/urls/"+badKey+"/disable", `{"reason":"фишинг"}`, withCookie(root)))
+	assert.Len(t, reports("?status="+schema.ReportStatusResolved), 2)
+	resp = srv.do("GET", "/"+badKey, "")
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+	assert.Contains(t, string(body), "Ссылка заблокирована")
+	assert.NotContains(t, string(body), "bad.example")
+
+	// жалобы на работающую ссылку отклоняются
+	dismissed := []schema.AbuseReport{}
+	srv.decode(srv.do("POST", "/api/admin/urls/"+goodKey+"/dismiss", "", withCookie(root)), http.StatusOK, &dismissed)
+	assert.Len(t, dismissed, 2)
+	assert.Empty(t, reports("?status=open"))
+	assert.Equal(t, http.StatusTemporaryRedirect, srv.status("GET", "/"+goodKey, ""))
+
+	// удаленная владельцем ссылка - пустой ответ 410
+	service.DeleteBatch([]string{goodKey}, userID)
+	require.Eventually(t, func() bool {
+		rec, err := dataStorage.GetRecord(goodKey)
+		return err == nil && !rec.Available
+	}, time.Second, 10*time.Millisecond)
+	resp = srv.do("GET", "/"+goodKey, "")
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+	assert.Empty(t, body)
+}
+
+func TestHandlers_Tokens(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	srv := newTestServer(t, func(cfg *config.Configuration) {
+		cfg.Service.SecretKey = hex.EncodeToString(key)
+		cfg.Service.TokenTTL = time.Hour
+	})
+	service := srv.service
+
+	// токен старого формата: 4 байта идентификатора и их HMAC-SHA256
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte{1, 2, 3, 4})
+	legacy := hex.EncodeToString(append([]byte{1, 2, 3, 4}, mac.Sum(nil)...))
+	legacyKey, err := service.CreateShortKey("https://example.org/legacy", legacy, "")
+	require.NoError(t, err)
+
+	signer := token.NewSigner(token.NewKeyring(key), time.Hour)
+	expired, _, err := signer.Issue("expired-user", time.Now().Add(-2*time.Hour))
+	require.NoError(t, err)
+	stale, _, err := signer.Issue("stale-user", time.Now().Add(-40*time.Minute))
+	require.NoError(t, err)
+	// подпись от другого содержимого
+	parts := strings.Split(stale, ".")
+	parts[2] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"other-user","iat":1,"exp":9999999999}`))
+	forged := strings.Join(parts, ".")
+
+	do := func(method, target string, tokens ...string) *http.Response {
+		opts := make([]requestOption, 0, len(tokens))
+		for _, value := range tokens {
+			opts = append(opts, withCookie(value))
+		}
+		return srv.do(method, target, `{"url":"https://example.org/new"}`, opts...)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		tokens     []string
+		statusCode int
+		newUser    bool
+		refreshed  string
+	}{
+		{"без токена", "POST", "/api/shorten", nil, http.StatusCreated, true, ""},
+		{"короткий токен", "GET", "/api/user/urls", []string{"ab"}, http.StatusNoContent, true, ""},
+		{"поддельный токен", "GET", "/api/user/urls", []string{forged}, http.StatusNoContent, true, ""},
+		{"истекший токен", "POST", "/api/shorten", []string{expired}, http.StatusUnauthorized, false, ""},
+		{"истекший токен при переходе", "GET", "/" + legacyKey, []string{expired}, http.StatusTemporaryRedirect, true, ""},
+		{"токен старого формата", "GET", "/api/user/urls", []string{legacy}, http.StatusOK, false, legacy},
+		{"токен к концу срока", "GET", "/api/user/urls", []string{stale}, http.StatusNoContent, false, "stale-user"},
+		{"вторая кука не подменяет пользователя", "GET", "/api/user/urls", []string{legacy, forged}, http.StatusOK, false, legacy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := do(tt.method, tt.target, tt.tokens...)
+			resp.Body.Close()
+			require.Equal(t, tt.statusCode, resp.StatusCode)
+			cookie := tokenCookie(resp)
+			switch {
+			case tt.newUser:
+				require.NotNil(t, cookie)
+				claims, err := service.ParseToken(cookie.Value)
+				require.NoError(t, err)
+				assert.Len(t, claims.UserID, 2*token.UserIDSize)
+				assert.WithinDuration(t, time.Now().Add(time.Hour), cookie.Expires, 2*time.Second)
+			case tt.refreshed != "":
+				require.NotNil(t, cookie)
+				claims, err := service.ParseToken(cookie.Value)
+				require.NoError(t, err)
+				assert.Equal(t, tt.refreshed, claims.UserID)
+				assert.True(t, strings.HasPrefix(cookie.Value, token.Version+"."))
+			case tt.statusCode == http.StatusUnauthorized:
+				require.NotNil(t, cookie)
+				assert.Equal(t, -1, cookie.MaxAge)
+			default:
+				assert.Nil(t, cookie)
+			}
+		})
+	}
+
+	// ссылки пользователя со старым токеном доступны по обновленному токену
+	resp := do("GET", "/api/user/urls", legacy)
+	resp.Body.Close()
+	resp = do("GET", "/api/user/urls", tokenCookie(resp).Value)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	urls := schema.APIUserURLs{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&urls))
+	require.Len(t, urls, 1)
+	assert.Equal(t, "https://example.org/legacy", urls[0].OriginalURL)
+}
+
+func TestHandlers_Keys(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	keyFile := filepath.Join(t.TempDir(), "keys")
+	writeKeys := func(lines ...string) {
+		require.NoError(t, os.WriteFile(keyFile, []byte(strings.Join(lines, "\n")), 0600))
+	}
+	writeKeys("# ключи токенов", hex.EncodeToString(oldKey))
+	srv := newTestServer(t, func(cfg *config.Configuration) {
+		cfg.Service.KeyFile = keyFile
+		cfg.Service.AdminUsers = []string{"root"}
+	})
+	root, _ := srv.register("root")
+	oldToken, userID := srv.newUser()
+	_, err := srv.service.CreateShortKey("https://example.org/keys", userID, "")
+	require.NoError(t, err)
+
+	keyring := func(method, target string) schema.KeyringInfo {
+		info := schema.KeyringInfo{}
+		srv.decode(srv.do(method, target, "", withCookie(root)), http.StatusOK, &info)
+		return info
+	}
+	userURLs := func(value string) (*http.Response, *http.Cookie) {
+		resp := srv.do("GET", "/api/user/urls", "", withCookie(value))
+		resp.Body.Close()
+		return resp, tokenCookie(resp)
+	}
+
+	assert.Equal(t, schema.KeyringInfo{SigningKey: token.KeyID(oldKey), Keys: []string{token.KeyID(oldKey)}},
+		keyring("GET", "/api/admin/keys"))
+
+	// новый ключ подписи, прежний остается для проверки
+	writeKeys(hex.EncodeToString(newKey), hex.EncodeToString(oldKey))
+	require.Equal(t, http.StatusUnauthorized, srv.status("POST", "/api/admin/keys/reload", "", withCookie(oldToken)))
+	assert.Equal(t, []string{token.KeyID(newKey), token.KeyID(oldKey)}, keyring("POST", "/api/admin/keys/reload").Keys)
+
+	// токен, подписанный прежним ключом, действует и переподписывается новым
+	resp, cookie := userURLs(oldToken)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, cookie)
+	assert.True(t, strings.HasPrefix(cookie.Value, token.Version+"."+token.KeyID(newKey)+"."))
+	resp, refreshed := userURLs(cookie.Value)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, refreshed)
+
+	// некорректный файл не заменяет действующие ключи
+	writeKeys("not hex")
+	require.Equal(t, http.StatusConflict, srv.status("POST", "/api/admin/keys/reload", "", withCookie(root)))
+	resp, _ = userURLs(oldToken)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// после удаления прежнего ключа его токены недействительны
+	writeKeys(hex.EncodeToString(newKey))
+	assert.Equal(t, []string{token.KeyID(newKey)}, keyring("POST", "/api/admin/keys/reload").Keys)
+	resp, cookie = userURLs(oldToken)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.NotNil(t, cookie)
+	resp, _ = userURLs(cookie.Value)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestHandlers_Accounts(t *testing.T) {
+	srv := newTestServer(t)
+	service, do := srv.service, srv.do
+
+	// регистрация
+	registration := []struct {
+		name       string
+		body       string
+		statusCode int
+	}{
+		{"без email и имени", `{"password":"password1"}`, http.StatusBadRequest},
+		{"некорректный email", `{"email":"not an email","password":"password1"}`, http.StatusBadRequest},
+		{"некорректное имя", `{"username":"1ab","password":"password1"}`, http.StatusBadRequest},
+		{"короткий пароль", `{"username":"alice","password":"short"}`, http.StatusBadRequest},
+		{"успешно", `{"email":"Alice@Example.org","username":"alice","password":"password1"}`, http.StatusCreated},
+		{"занятое имя", `{"username":"ALICE","password":"password2"}`, http.StatusConflict},
+		{"занятый email", `{"email":"alice@example.org","password":"password2"}`, http.StatusConflict},
+	}
+	var account schema.Account
+	for _, tt := range registration {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := do("POST", "/api/user/register", tt.body)
+			defer resp.Body.Close()
+			require.Equal(t, tt.statusCode, resp.StatusCode)
+			if tt.statusCode == http.StatusCreated {
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&account))
+				assert.Equal(t, "alice@example.org", account.Email)
+				require.NotNil(t, tokenCookie(resp))
+				claims, err := service.ParseToken(tokenCookie(resp).Value)
+				require.NoError(t, err)
+				assert.Equal(t, account.ID, claims.UserID)
+			}
+		})
+	}
+
+	// вход
+	resp := do("POST", "/api/user/login", `{"login":"alice","password":"wrong password"}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = do("POST", "/api/user/login", `{"login":"nobody","password":"password1"}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = do("POST", "/api/user/login", `{"login":"ALICE@example.org","password":"password1"}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	session := tokenCookie(resp).Value
+	resp = do("POST", "/api/shorten", `{"url":"https://example.org/account"}`, withCookie(session))
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// ключи API доступны только зарегистрированным пользователям
+	anonymous, _ := srv.newUser()
+	resp = do("POST", "/api/user/keys", `{"name":"ci"}`, withCookie(anonymous))
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = do("POST", "/api/user/keys", `{"name":"ci","scopes":["admin"]}`, withCookie(session))
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	createKey := func(body string) schema.APIKey {
+		key := schema.APIKey{}
+		srv.decode(do("POST", "/api/user/keys", body, withCookie(session)), http.StatusCreated, &key)
+		require.True(t, strings.HasPrefix(key.Key, shortener.APIKeyPrefix))
+		return key
+	}
+	readKey := createKey(`{"name":"reports","scopes":["read"]}`)
+	writeKey := createKey(`{"name":"backend"}`)
+	assert.Equal(t, []string{schema.ScopeRead, schema.ScopeWrite}, writeKey.Scopes)
+
+	requests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		key        string
+		statusCode int
+	}{
+		{"чтение ключом read", "GET", "/api/user/urls", "", readKey.Key, http.StatusOK},
+		{"запись ключом read", "POST", "/api/shorten", `{"url":"https://example.org/read"}`, readKey.Key, http.StatusForbidden},
+		{"запись ключом write", "POST", "/api/shorten", `{"url":"https://example.org/write"}`, writeKey.Key, http.StatusCreated},
+		{"управление ключами по ключу", "GET", "/api/user/keys", "", writeKey.Key, http.StatusForbidden},
+		{"неизвестный ключ", "GET", "/api/user/urls", "", shortener.APIKeyPrefix + "0000_0000", http.StatusUnauthorized},
+		{"неверный секрет", "GET", "/api/user/urls", "", readKey.Key[:len(readKey.Key)-1] + "0", http.StatusUnauthorized},
+	}
+	for _, tt := range requests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := do(tt.method, tt.target, tt.body, withAPIKey(tt.key))
+			resp.Body.Close()
+			require.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Nil(t, tokenCookie(resp))
+		})
+	}
+	// ссылки, созданные по ключу, принадлежат учетной записи
+	assert.Len(t, srv.storage.GetAllURLs(account.ID), 2)
+
+	// ключи пользователя без секретных частей, отзыв ключа
+	keys := []schema.APIKey{}
+	srv.decode(do("GET", "/api/user/keys", "", withCookie(session)), http.StatusOK, &keys)
+	require.Len(t, keys, 2)
+	assert.Empty(t, keys[0].Key)
+	resp = do("DELETE", "/api/user/keys/"+readKey.ID, "", withCookie(anonymous))
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = do("DELETE", "/api/user/keys/"+readKey.ID, "", withCookie(session))
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = do("GET", "/api/user/urls", "", withAPIKey(readKey.Key))
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// выход удаляет куку
+	resp = do("POST", "/api/user/logout", "", withCookie(session))
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, -1, tokenCookie(resp).MaxAge)
+}
+
+func TestHandlers_Claim(t *testing.T) {
+	srv := newTestServer(t)
+	service := srv.service
+	do := func(method, target, body, cookie string) *http.Response {
+		return srv.do(method, target, body, withCookie(cookie))
+	}
+
+	// регистрация с передачей ссылок текущего анонимного пользователя
+	anonymous, anonymousID := srv.newUser()
+	key := srv.shorten("https://example.org/before-signup", withCookie(anonymous))
+	require.Equal(t, http.StatusCreated, srv.status("POST", "/api/user/folders", `{"name":"docs"}`, withCookie(anonymous)))
+
+	resp := do("POST", "/api/user/register", `{"username":"bob","password":"password1","claim":true}`, anonymous)
+	result := schema.APISignInResult{}
+	srv.decode(resp, http.StatusCreated, &result)
+	require.NotNil(t, result.Claimed)
+	assert.Equal(t, []string{key}, result.Claimed.URLs)
+	assert.Len(t, result.Claimed.Folders, 1)
+	session := tokenCookie(resp).Value
+	assert.Empty(t, service.GetAllURLs(anonymousID))
+	assert.Len(t, service.GetAllURLs(result.ID), 1)
+	folders, err := service.ListFolders(result.ID)
+	require.NoError(t, err)
+	assert.Len(t, folders, 1)
+
+	// передача по токену другого анонимного пользователя
+	other, _ := srv.newUser()
+	otherKey := srv.shorten("https://example.org/other-device", withCookie(other))
+	tests := []struct {
+		name       string
+		body       string
+		cookie     string
+		statusCode int
+	}{
+		{"анонимный пользователь", `{"token":"` + other + `"}`, anonymous, http.StatusUnauthorized},
+		{"поддельный токен", `{"token":"v1.bad.token.value"}`, session, http.StatusBadRequest},
+		{"свой токен", `{"token":"` + session + `"}`, session, http.StatusBadRequest},
+		{"успешно", `{"token":"` + other + `"}`, session, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := do("POST", "/api/user/claim", tt.body, tt.cookie)
+			if tt.statusCode != http.StatusOK {
+				resp.Body.Close()
+				require.Equal(t, tt.statusCode, resp.StatusCode)
+				return
+			}
+			claimed := schema.ClaimResult{}
+			srv.decode(resp, http.StatusOK, &claimed)
+			assert.Equal(t, []string{otherKey}, claimed.URLs)
+		})
+	}
+	assert.Len(t, service.GetAllURLs(result.ID), 2)
+
+	// токен другой учетной записи не подходит, вход без claim ничего не передает
+	carol, _ := srv.register("carol")
+	resp = do("POST", "/api/user/claim", `{"token":"`+session+`"}`, carol)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	result = schema.APISignInResult{}
+	srv.decode(do("POST", "/api/user/login", `{"login":"carol","password":"password1","claim":true}`, session), http.StatusOK, &result)
+	assert.Nil(t, result.Claimed)
+	assert.Len(t, service.GetAllURLs(result.ID), 0)
+}
+
+func TestHandlers_Workspaces(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Configuration) { cfg.Service.AccountQuotaActiveLinks = 2 })
+	service := srv.service
+	do := func(method, target, body, cookie, workspace string) *http.Response {
+		opts := []requestOption{withCookie(cookie)}
+		if workspace != "" {
+			opts = append(opts, withHeader(WorkspaceHeader, workspace))
+		}
+		return srv.do(method, target, body, opts...)
+	}
+	alice, aliceID := srv.register("alice")
+	bob, bobID := srv.register("bob")
+	carol, carolID := srv.register("carol")
+	anonymous, _ := srv.newUser()
+
+	// создание пространства
+	resp := do("POST", "/api/workspaces", `{"name":"marketing"}`, anonymous, "")
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = do("POST", "/api/workspaces", `{"name":" "}`, alice, "")
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	workspace := schema.Workspace{}
+	srv.decode(do("POST", "/api/workspaces", `{"name":"marketing"}`, alice, ""), http.StatusCreated, &workspace)
+	assert.Equal(t, schema.RoleOwner, workspace.Role)
+
+	// участники
+	members := []struct {
+		name       string
+		cookie     string
+		body       string
+		statusCode int
+	}{
+		{"неизвестная роль", alice, `{"login":"bob","role":"admin"}`, http.StatusBadRequest},
+		{"неизвестный пользователь", alice, `{"login":"nobody","role":"editor"}`, http.StatusBadRequest},
+		{"editor", alice, `{"login":"bob","role":"editor"}`, http.StatusOK},
+		{"viewer", alice, `{"login":"carol","role":"viewer"}`, http.StatusOK},
+		{"не владелец", bob, `{"login":"carol","role":"owner"}`, http.StatusForbidden},
+		{"не участник", anonymous, `{"login":"carol","role":"owner"}`, http.StatusNotFound},
+		{"последний владелец", alice, `{"login":"alice","role":"editor"}`, http.StatusBadRequest},
+	}
+	for _, tt := range members {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := do("PUT", "/api/workspaces/"+workspace.ID+"/members", tt.body, tt.cookie, "")
+			resp.Body.Close()
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+	details := schema.Workspace{}
+	srv.decode(do("GET", "/api/workspaces/"+workspace.ID, "", carol, ""), http.StatusOK, &details)
+	assert.Equal(t, schema.RoleViewer, details.Role)
+	require.Len(t, details.Members, 3)
+	assert.Equal(t, "bob", details.Members[1].Username)
+
+	// запросы от имени пространства
+	requests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		cookie     string
+		statusCode int
+	}{
+		{"editor создает ссылку", "POST", "/api/shorten", `{"url":"https://example.org/team"}`, bob, http.StatusCreated},
+		{"viewer не создает ссылку", "POST", "/api/shorten", `{"url":"https://example.org/viewer"}`, carol, http.StatusForbidden},
+		{"viewer читает ссылки", "GET", "/api/user/urls", "", carol, http.StatusOK},
+		{"не участник", "GET", "/api/user/urls", "", anonymous, http.StatusNotFound},
+		{"учетная запись недоступна", "GET", "/api/user/account", "", bob, http.StatusBadRequest},
+	}
+	for _, tt := range requests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := do(tt.method, tt.target, tt.body, tt.cookie, workspace.ID)
+			resp.Body.Close()
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+	shared := service.GetAllURLs(workspace.ID)
+	require.Len(t, shared, 1)
+	assert.Empty(t, service.GetAllURLs(bobID))
+	var sharedKey string
+	for key := range shared {
+		sharedKey = key
+	}
+	resp = do("PATCH", "/api/user/urls/"+sharedKey, `{"title":"Team"}`, alice, workspace.ID)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = do("PATCH", "/api/user/urls/"+sharedKey, `{"title":"Team"}`, alice, "")
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// передача ссылок
+	personalKey := srv.shorten("https://example.org/personal", withCookie(alice))
+	extraKey := srv.shorten("https://example.org/extra", withCookie(alice))
+	strangerKey := srv.shorten("https://example.org/stranger", withCookie(anonymous))
+	transfers := []struct {
+		name       string
+		key        string
+		body       string
+		cookie     string
+		statusCode int
+	}{
+		{"чужая ссылка", personalKey, `{"to_workspace":"` + workspace.ID + `"}`, bob, http.StatusForbidden},
+		{"в пространство", personalKey, `{"to_workspace":"` + workspace.ID + `"}`, alice, http.StatusOK},
+		{"viewer не передает", sharedKey, `{"from_workspace":"` + workspace.ID + `"}`, carol, http.StatusForbidden},
+		{"квота получателя", extraKey, `{"to_workspace":"` + workspace.ID + `"}`, alice, http.StatusForbidden},
+		{"не участник пространства", strangerKey, `{"to_workspace":"` + workspace.ID + `"}`, anonymous, http.StatusNotFound},
+		{"себе", sharedKey, `{"from_workspace":"` + workspace.ID + `"}`, bob, http.StatusOK},
+	}
+	for _, tt := range transfers {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := do("POST", "/api/user/urls/"+tt.key+"/transfer", tt.body, tt.cookie, "")
+			resp.Body.Close()
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+	assert.Equal(t, []string{personalKey}, keys(service.GetAllURLs(workspace.ID)))
+	assert.Equal(t, []string{sharedKey}, keys(service.GetAllURLs(bobID)))
+	assert.Equal(t, []string{extraKey}, keys(service.GetAllURLs(aliceID)))
+	assert.Empty(t, service.GetAllURLs(carolID))
+
+	// передача другому пользователю по предложению, которое он принимает
+	offers := []struct {
+		name       string
+		key        string
+		body       string
+		cookie     string
+		statusCode int
+	}{
+		{"анонимный отправитель", strangerKey, `{"to_user":"bob"}`, anonymous, http.StatusUnauthorized},
+		{"неизвестный получатель", extraKey, `{"to_user":"nobody"}`, alice, http.StatusBadRequest},
+		{"два получателя", extraKey, `{"to_user":"bob","to_workspace":"` + workspace.ID + `"}`, alice, http.StatusBadRequest},
+		{"себе", extraKey, `{"to_user":"alice"}`, alice, http.StatusBadRequest},
+		{"чужая ссылка", extraKey, `{"to_user":"carol"}`, bob, http.StatusForbidden},
+		{"пользователю", extraKey, `{"to_user":"bob"}`, alice, http.StatusAccepted},
+		{"из пространства", personalKey, `{"from_workspace":"` + workspace.ID + `","to_user":"bob"}`, alice, http.StatusAccepted},
+	}
+	for _, tt := range offers {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := do("POST", "/api/user/urls/"+tt.key+"/transfer", tt.body, tt.cookie, "")
+			resp.Body.Close()
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+	// до принятия ссылка остается у отправителя
+	assert.Equal(t, []string{extraKey}, keys(service.GetAllURLs(aliceID)))
+	received := []schema.TransferOffer{}
+	srv.decode(do("GET", "/api/user/transfers", "", bob, ""), http.StatusOK, &received)
+	require.Len(t, received, 2)
+	assert.ElementsMatch(t, []string{aliceID, workspace.ID}, []string{received[0].FromUserID, received[1].FromUserID})
+	accepts := []struct {
+		name       string
+		method     string
+		key        string
+		cookie     string
+		statusCode int
+	}{
+		{"не получатель", "POST", extraKey, carol, http.StatusNotFound},
+		{"получатель", "POST", extraKey, bob, http.StatusOK},
+		{"повторно", "POST", extraKey, bob, http.StatusNotFound},
+		{"квота получателя", "POST", personalKey, bob, http.StatusForbidden},
+		{"отклонение не получателем", "DELETE", personalKey, carol, http.StatusNotFound},
+		{"отклонение", "DELETE", personalKey, bob, http.StatusNoContent},
+		{"после отклонения", "POST", personalKey, bob, http.StatusNotFound},
+	}
+	for _, tt := range accepts {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/api/user/transfers/" + tt.key
+			if tt.method == "POST" {
+				target += "/accept"
+			}
+			resp := do(tt.method, target, "", tt.cookie, "")
+			resp.Body.Close()
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+	assert.ElementsMatch(t, []string{sharedKey, extraKey}, keys(service.GetAllURLs(bobID)))
+	assert.Empty(t, service.GetAllURLs(aliceID))
+	assert.Equal(t, []string{personalKey}, keys(service.GetAllURLs(workspace.ID)))
+	srv.decode(do("GET", "/api/user/transfers", "", alice, ""), http.StatusOK, &received)
+	assert.Empty(t, received)
+
+	// выход и исключение участников
+	resp = do("DELETE", "/api/workspaces/"+workspace.ID+"/members/"+aliceID, "", alice, "")
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = do("DELETE", "/api/workspaces/"+workspace.ID+"/members/"+bobID, "", carol, "")
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = do("DELETE", "/api/workspaces/"+workspace.ID+"/members/"+carolID, "", carol, "")
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = do("GET", "/api/user/urls", "", carol, workspace.ID)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	list := []schema.Workspace{}
+	srv.decode(do("GET", "/api/workspaces", "", alice, ""), http.StatusOK, &list)
+	require.Len(t, list, 1)
+	assert.Equal(t, schema.RoleOwner, list[0].Role)
+}
+
+func TestHandlers_Admin(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Configuration) {
+		cfg.Server.TrustedSubnet = "192.0.2.0/24"
+		cfg.Service.AdminUsers = []string{" Root "}
+	})
+	service, dataStorage := srv.service, srv.storage
+	do := func(method, target, body, cookie string, opts ...requestOption) *http.Response {
+		return srv.do(method, target, body, append(opts, withCookie(cookie))...)
+	}
+	root, _ := srv.register("root")
+	bob, bobID := srv.register("bob")
+	search := func(target string) []schema.APIAdminURL {
+		resp := do("GET", target, "", root)
+		if resp.StatusCode == http.StatusNoContent {
+			resp.Body.Close()
+			return nil
+		}
+		result := []schema.APIAdminURL{}
+		srv.decode(resp, http.StatusOK, &result)
+		return result
+	}
+	anonymous, anonymousID := srv.newUser()
+	first, err := service.CreateShortKey("https://example.org/first", bobID, "")
+	require.NoError(t, err)
+	second, err := service.CreateShortKey("https://example.org/second", bobID, "")
+	require.NoError(t, err)
+	_, err = service.CreateShortKey("https://example.org/anonymous", anonymousID, "")
+	require.NoError(t, err)
+
+	// доступ
+	access := []struct {
+		name       string
+		cookie     string
+		opts       []requestOption
+		statusCode int
+	}{
+		{"анонимный пользователь", anonymous, nil, http.StatusUnauthorized},
+		{"не администратор", bob, nil, http.StatusForbidden},
+		{"от имени пространства", root, []requestOption{withHeader(WorkspaceHeader, "ws_x")}, http.StatusBadRequest},
+		{"администратор", root, nil, http.StatusOK},
+	}
+	for _, tt := range access {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := do("GET", "/api/admin/stats", "", tt.cookie, tt.opts...)
+			resp.Body.Close()
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+		})
+	}
+
+	// ключи API с областью admin
+	resp := do("POST", "/api/user/keys", `{"name":"admin","scopes":["admin"]}`, bob)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	createKey := func(body string) string {
+		key := schema.APIKey{}
+		srv.decode(do("POST", "/api/user/keys", body, root), http.StatusCreated, &key)
+		return key.Key
+	}
+	adminKey, userKey := createKey(`{"name":"admin","scopes":["admin"]}`), createKey(`{"name":"user"}`)
+	assert.Equal(t, http.StatusForbidden, srv.status("GET", "/api/admin/urls", "", withAPIKey(userKey)))
+	assert.Equal(t, http.StatusOK, srv.status("GET", "/api/admin/urls", "", withAPIKey(adminKey)))
+	assert.Equal(t, http.StatusForbidden, srv.status("GET", "/api/user/urls", "", withAPIKey(adminKey)))
+
+	// поиск
+	assert.Len(t, search("/api/admin/urls"), 3)
+	found := search("/api/admin/urls?owner=BOB&sort=key")
+	require.Len(t, found, 2)
+	assert.Equal(t, bobID, found[0].UserID)
+	found = search("/api/admin/urls?key=" + second)
+	require.Len(t, found, 1)
+	assert.Equal(t, "https://example.org/second", found[0].OriginalURL)
+	assert.Len(t, search("/api/admin/urls?q=anonymous"), 1)
+	assert.Len(t, search("/api/admin/users/"+anonymousID+"/urls"), 1)
+	resp = do("GET", "/api/admin/urls?status=unknown", "", root)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// отключение
+	resp = do("POST", "/api/admin/urls/"+first+"/disable", `{"reason":"phishing"}`, root)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, search("/api/admin/urls?status=disabled"), 1)
+	resp = do("POST", "/api/admin/urls/"+first+"/enable", "", root)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, search("/api/admin/urls?status=disabled"))
+
+	// окончательное удаление
+	lastID, _ := dataStorage.GetLastID()
+	resp = do("DELETE", "/api/admin/urls/"+first, "", root)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = do("DELETE", "/api/admin/urls/"+first, "", root)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	purged := schema.APIPurgeResult{}
+	srv.decode(do("DELETE", "/api/admin/users/bob/urls", "", root), http.StatusOK, &purged)
+	assert.Equal(t, []string{second}, purged.Purged)
+	assert.Empty(t, search("/api/admin/users/"+bobID+"/urls"))
+	_, err = dataStorage.GetRecord(second)
+	assert.ErrorIs(t, err, errorapp.ErrorURLNotFound)
+	afterPurge, _ := dataStorage.GetLastID()
+	assert.Equal(t, lastID, afterPurge, "удаленные ссылки продолжают учитываться в последнем идентификаторе")
+
+	// только из доверительной подсети, адрес клиента передает доверенный прокси
+	srv.cfg.Server.AdminTrustedSubnetOnly = true
+	srv.cfg.Server.TrustedProxies = []string{"192.0.2.1"}
+	srv.handler = New(service, srv.cfg.Server)
+	assert.Equal(t, http.StatusForbidden, srv.status("GET", "/api/admin/stats", "", withCookie(root), withHeader("X-Forwarded-For", "203.0.113.1")))
+	assert.Equal(t, http.StatusOK, srv.status("GET", "/api/admin/stats", "", withCookie(root), withHeader("X-Forwarded-For", "192.0.2.7")))
+}
+
+func TestHandlers_ClientIP(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Configuration) {
+		cfg.Server.TrustedSubnet = "192.0.2.0/24, 2001:db8::/32"
+		cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "fd00::1"}
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		value      string
+		statusCode int
+	}{
+		{"доверительная подсеть IPv4", "192.0.2.10:1234", "", "", http.StatusOK},
+		{"доверительная подсеть IPv6", "[2001:db8::5]:1234", "", "", http.StatusOK},
+		{"вне доверительной подсети", "198.51.100.1:1234", "", "", http.StatusForbidden},
+		{"X-Real-IP не от прокси игнорируется", "198.51.100.1:1234", "X-Real-IP", "192.0.2.1", http.StatusForbidden},
+		{"X-Forwarded-For не от прокси игнорируется", "198.51.100.1:1234", "X-Forwarded-For", "192.0.2.1", http.StatusForbidden},
+		{"X-Real-IP от прокси", "10.1.1.1:1234", "X-Real-IP", "192.0.2.1", http.StatusOK},
+		{"прокси без заголовков", "10.1.1.1:1234", "", "", http.StatusForbidden},
+		{"X-Forwarded-For через цепочку прокси", "10.1.1.1:1234", "X-Forwarded-For", "192.0.2.1, 10.2.2.2", http.StatusOK},
+		{"подмена начала X-Forwarded-For", "10.1.1.1:1234", "X-Forwarded-For", "192.0.2.1, 198.51.100.1", http.StatusForbidden},
+		{"Forwarded с IPv6", "[fd00::1]:443", "Forwarded", `for="[2001:db8::1]:4711";proto=https`, http.StatusOK},
+		{"Forwarded с несколькими узлами", "10.1.1.1:1234", "Forwarded", "for=198.51.100.1, for=192.0.2.60;by=10.1.1.1", http.StatusOK},
+		{"Forwarded с неизвестным узлом", "10.1.1.1:1234", "Forwarded", "for=unknown", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []requestOption{withRemoteAddr(tt.remoteAddr)}
+			if tt.header != "" {
+				opts = append(opts, withHeader(tt.header, tt.value))
+			}
+			assert.Equal(t, tt.statusCode, srv.status("GET", "/api/internal/stats", "", opts...))
+		})
+	}
+}
+
+// keys - возвращает ключи словаря ссылок по возрастанию.
+func keys(urls map[string]string) []string {
+	result := make([]string, 0, len(urls))
+	for key := range urls {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestHandlers_RateLimit(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Configuration) {
+		cfg.Server.RateLimitCreate = "2/1m"
+		cfg.Server.RateLimitRedirect = "3/h"
+		cfg.Server.RateLimitBatch = "не число/1m"
+	})
+	service := srv.service
+	// второй экземпляр сервиса с тем же хранилищем соблюдает общий лимит
+	other := &testServer{t: t, cfg: srv.cfg, storage: srv.storage, service: service, handler: New(service, srv.cfg.Server)}
+
+	do := func(h *testServer, method, target, body, remoteAddr, cookie string) *http.Response {
+		opts := []requestOption{withRemoteAddr(remoteAddr)}
+		if cookie != "" {
+			opts = append(opts, withCookie(cookie))
+		}
+		return h.do(method, target, body, opts...)
+	}
+	status := func(h *testServer, method, target, body, remoteAddr, cookie string) int {
+		resp := do(h, method, target, body, remoteAddr, cookie)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// анонимные пользователи ограничиваются по IP-адресу, новый токен не сбрасывает лимит
+	assert.Equal(t, http.StatusCreated, status(srv, "POST", "/", "https://a.example/", "198.51.100.1:1000", ""))
+	assert.Equal(t, http.StatusCreated, status(other, "POST", "/", "https://b.example/", "198.51.100.1:1001", ""))
+	resp := do(srv, "POST", "/api/shorten", `{"url":"https://c.example/"}`, "198.51.100.1:1002", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	require.NoError(t, err)
+	assert.True(t, retryAfter >= 1 && retryAfter <= 30, "Retry-After = %d", retryAfter)
+	assert.Equal(t, http.StatusCreated, status(srv, "POST", "/", "https://d.example/", "198.51.100.2:1000", ""))
+
+	// зарегистрированный пользователь ограничивается по учетной записи независимо от IP-адреса
+	alice, _ := srv.register("alice", withRemoteAddr("203.0.113.1:1000"))
+	assert.Equal(t, http.StatusCreated, status(srv, "POST", "/", "https://e.example/", "198.51.100.1:1000", alice))
+	assert.Equal(t, http.StatusCreated, status(srv, "POST", "/", "https://f.example/", "203.0.113.2:1000", alice))
+	assert.Equal(t, http.StatusTooManyRequests, status(srv, "POST", "/", "https://g.example/", "203.0.113.3:1000", alice))
+
+	// переходы ограничиваются отдельно от создания, некорректное ограничение пакетов не применяется
+	key, err := service.CreateShortKey("https://h.example/", "user", "")
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusTemporaryRedirect, status(srv, "GET", "/"+key, "", "198.51.100.1:1000", ""))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, status(srv, "GET", "/"+key, "", "198.51.100.1:1000", ""))
+	for i := 0; i < 3; i++ {
+		batch := `[{"correlation_id":"1","original_url":"https://i.example/` + strconv.Itoa(i) + `"}]`
+		assert.Equal(t, http.StatusCreated, status(srv, "POST", "/api/shorten/batch", batch, "198.51.100.1:1000", alice))
+	}
+}
+
+func TestHandlers_Quotas(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Configuration) {
+		cfg.Service.QuotaDailyLinks = 3
+		cfg.Service.QuotaActiveLinks = 2
+		cfg.Service.AccountQuotaDailyLinks = 5
+	})
+	service := srv.service
+	anonymous, anonymousID := srv.newUser()
+	do := func(method, target, body, cookie string) *http.Response {
+		return srv.do(method, target, body, withCookie(cookie))
+	}
+	create := func(url, cookie string) *http.Response {
+		resp := do("POST", "/api/shorten", `{"url":"`+url+`"}`, cookie)
+		resp.Body.Close()
+		return resp
+	}
+	quota := func(cookie string) schema.APIQuota {
+		result := schema.APIQuota{}
+		srv.decode(do("GET", "/api/user/quota", "", cookie), http.StatusOK, &result)
+		return result
+	}
+
+	// анонимный пользователь: не более 2 действующих ссылок и 3 ссылок в сутки
+	assert.Equal(t, http.StatusCreated, create("https://a.example/", anonymous).StatusCode)
+	assert.Equal(t, http.StatusCreated, create("https://b.example/", anonymous).StatusCode)
+	assert.Equal(t, http.StatusForbidden, create("https://c.example/", anonymous).StatusCode)
+	got := quota(anonymous)
+	assert.Equal(t, schema.QuotaTierFree, got.Tier)
+	assert.Equal(t, schema.QuotaCounter{Limit: 3, Used: 2, Remaining: 1}, got.Daily)
+	assert.Equal(t, schema.QuotaCounter{Limit: 2, Used: 2, Remaining: 0}, got.Active)
+	assert.True(t, got.ResetAt.After(time.Now()) && time.Until(got.ResetAt) <= 24*time.Hour)
+
+	// удаление ссылки освобождает место среди действующих, но не восстанавливает суточную квоту
+	keys := keys(service.GetAllURLs(anonymousID))
+	service.DeleteBatch(keys[:1], anonymousID)
+	assert.Equal(t, http.StatusCreated, create("https://c.example/", anonymous).StatusCode)
+	service.DeleteBatch(keys[1:], anonymousID)
+	resp := create("https://d.example/", anonymous)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	require.NoError(t, err)
+	assert.True(t, retryAfter >= 1 && retryAfter <= 24*60*60, "Retry-After = %d", retryAfter)
+	_, err = service.CreateShortKey("https://d.example/", anonymousID, "")
+	assert.ErrorIs(t, err, errorapp.ErrorQuotaExceeded)
+
+	// учетная запись: 5 ссылок в сутки, пакет учитывается целиком
+	alice, _ := srv.register("alice", withCookie(anonymous))
+	batch := func(n int) string {
+		items := make([]string, n)
+		for i := range items {
+			items[i] = `{"correlation_id":"` + strconv.Itoa(i) + `","original_url":"https://batch.example/` + strconv.Itoa(i) + `"}`
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	}
+	resp = do("POST", "/api/shorten/batch", batch(6), alice)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, schema.QuotaCounter{Limit: 5, Used: 0, Remaining: 5}, quota(alice).Daily)
+	resp = do("POST", "/api/shorten/batch", batch(5), alice)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	got = quota(alice)
+	assert.Equal(t, schema.QuotaTierAccount, got.Tier)
+	assert.Equal(t, schema.QuotaCounter{Limit: 5, Used: 5, Remaining: 0}, got.Daily)
+	assert.Equal(t, schema.QuotaCounter{Limit: 0, Used: 5, Remaining: -1}, got.Active)
+	resp = do("POST", "/", "https://e.example/", alice)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// квота проверяется вместе с записью ссылки: параллельные запросы ее не превышают
+	_, parallelID := srv.newUser()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			service.CreateShortKey("https://parallel.example/"+strconv.Itoa(i), parallelID, "")
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, service.GetAllURLs(parallelID), 2)
+}
+
+func TestHandlers_QuotaByIP(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config.Configuration) {
+		cfg.Service.QuotaActiveLinks = 2
+		cfg.Service.AccountQuotaActiveLinks = 3
+	})
+	create := func(url, cookie, remoteAddr string) int {
+		return srv.status("POST", "/api/shorten", `{"url":"`+url+`"}`, withCookie(cookie), withRemoteAddr(remoteAddr))
+	}
+	first, firstID := srv.newUser()
+	second, _ := srv.newUser()
+
+	// квоты анонимных пользователей считаются по IP-адресу, новый токен их не сбрасывает
+	assert.Equal(t, http.StatusCreated, create("https://a.example/", first, "198.51.100.1:1000"))
+	assert.Equal(t, http.StatusCreated, create("https://b.example/", first, "198.51.100.1:1000"))
+	assert.Equal(t, http.StatusForbidden, create("https://c.example/", second, "198.51.100.1:2000"))
+	got := schema.APIQuota{}
+	srv.decode(srv.do("GET", "/api/user/quota", "", withCookie(second), withRemoteAddr("198.51.100.1:2000")), http.StatusOK, &got)
+	assert.Equal(t, schema.QuotaCounter{Limit: 2, Used: 2, Remaining: 0}, got.Active)
+	assert.Equal(t, http.StatusCreated, create("https://c.example/", second, "198.51.100.3:1000"))
+
+	// ссылки, переданные учетной записи, учитываются в ее квоте, а не в квоте IP-адреса
+	result := schema.APISignInResult{}
+	resp := srv.do("POST", "/api/user/register", `{"username":"bob","password":"password1","claim":true}`,
+		withCookie(first), withRemoteAddr("198.51.100.1:1000"))
+	srv.decode(resp, http.StatusCreated, &result)
+	require.NotNil(t, result.Claimed)
+	assert.Len(t, result.Claimed.URLs, 2)
+	bob := tokenCookie(resp).Value
+	assert.Equal(t, http.StatusCreated, create("https://d.example/", second, "198.51.100.1:2000"))
+
+	// передача ссылок, для которых не хватает квоты действующих ссылок учетной записи, не выполняется
+	third, thirdID := srv.newUser()
+	assert.Equal(t, http.StatusCreated, create("https://e.example/", third, "198.51.100.2:1000"))
+	assert.Equal(t, http.StatusCreated, create("https://f.example/", third, "198.51.100.2:1000"))
+	claim := `{"token":"` + third + `"}`
+	assert.Equal(t, http.StatusForbidden, srv.status("POST", "/api/user/claim", claim, withCookie(bob)))
+	assert.Len(t, srv.service.GetAllURLs(thirdID), 2)
+	result = schema.APISignInResult{}
+	srv.decode(srv.do("POST", "/api/user/login", `{"login":"bob","password":"password1","claim":true}`, withCookie(third)),
+		http.StatusOK, &result)
+	assert.Nil(t, result.Claimed)
+	assert.NotEmpty(t, result.ClaimError)
+	assert.Len(t, srv.service.GetAllURLs(thirdID), 2)
+	srv.service.DeleteBatch(keys(srv.service.GetAllURLs(result.ID))[:1], result.ID)
+	claimed := schema.ClaimResult{}
+	srv.decode(srv.do("POST", "/api/user/claim", claim, withCookie(bob)), http.StatusOK, &claimed)
+	assert.Len(t, claimed.URLs, 2)
+	assert.Empty(t, srv.service.GetAllURLs(firstID))
+}
+
+func TestHandlers_Cookies(t *testing.T) {
+	// первый запрос без куки выполняется от имени пользователя выданного токена
+	srv := newTestServer(t)
+	resp := srv.do("POST", "/", "https://first.example/")
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	cookie := tokenCookie(resp)
+	require.NotNil(t, cookie)
+	assert.Equal(t, "/", cookie.Path)
+	assert.True(t, cookie.HttpOnly)
+	assert.False(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	assert.True(t, cookie.MaxAge > 0)
+	claims, err := srv.service.ParseToken(cookie.Value)
+	require.NoError(t, err)
+	userID := claims.UserID
+	assert.Len(t, srv.service.GetAllURLs(userID), 1)
+
+	// подделанный идентификатор в куке не принимается
+	resp = srv.do("GET", "/api/user/urls", "", withCookie(userID))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	claims, err = srv.service.ParseToken(tokenCookie(resp).Value)
+	require.NoError(t, err)
+	assert.NotEqual(t, userID, claims.UserID)
+
+	// настраиваемые атрибуты: домен, SameSite=None (включает Secure) и ограничение срока хранения
+	srv = newTestServer(t, func(cfg *config.Configuration) {
+		cfg.Server.CookieDomain = "example.com"
+		cfg.Server.CookieSameSite = "none"
+		cfg.Server.CookieHTTPOnly = false
+		cfg.Server.CookieMaxAge = 60
+	})
+	resp = srv.do("POST", "/", "https://second.example/")
+	resp.Body.Close()
+	cookie = tokenCookie(resp)
+	require.NotNil(t, cookie)
+	assert.Equal(t, "example.com", cookie.Domain)
+	assert.True(t, cookie.Secure)
+	assert.False(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteNoneMode, cookie.SameSite)
+	assert.True(t, cookie.MaxAge > 0 && cookie.MaxAge <= 60, "MaxAge = %d", cookie.MaxAge)
+
+	// выход удаляет куку с тем же доменом
+	resp = srv.do("POST", "/api/user/logout", "", func(r *http.Request) { r.AddCookie(cookie) })
+	resp.Body.Close()
+	cleared := resp.Cookies()
+	require.Len(t, cleared, 1)
+	assert.Equal(t, "example.com", cleared[0].Domain)
+	assert.True(t, cleared[0].MaxAge < 0)
+}
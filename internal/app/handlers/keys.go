@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+)
+
+// HandlerAPIAdminKeys - возвращает идентификаторы действующих ключей подписи токенов.
+func (h *Handlers) HandlerAPIAdminKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.service.KeyringInfo())
+}
+
+// HandlerAPIAdminReloadKeys - перечитывает файл ключей подписи токенов (KEY_FILE), как по сигналу SIGHUP.
+// Возвращает идентификаторы новых ключей; если файл не задан или некорректен, возвращает 409,
+// а прежние ключи продолжают действовать.
+func (h *Handlers) HandlerAPIAdminReloadKeys(w http.ResponseWriter, r *http.Request) {
+	info, err := h.service.ReloadKeys()
+	if err != nil {
+		log.Println("не удалось перечитать ключи токенов;", err)
+		if errors.Is(err, errorapp.ErrorKeyring) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
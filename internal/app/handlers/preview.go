@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+)
+
+// previewTemplate - шаблон страницы предпросмотра ссылки.
+// html/template экранирует данные и заменяет небезопасные схемы в href (например javascript:).
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Title}}{{.Title}}{{else}}Переход по ссылке{{end}}</title>
+<style>
+body{font-family:sans-serif;max-width:40em;margin:3em auto;padding:0 1em;color:#222}
+.url{word-break:break-all;padding:.5em;background:#f3f3f3;border-radius:4px}
+.continue{display:inline-block;margin-top:1.5em;padding:.6em 1.2em;background:#2a6ee8;color:#fff;text-decoration:none;border-radius:4px}
+.meta{color:#666;font-size:.9em}
+</style>
+</head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else}}Переход по ссылке{{end}}</h1>
+<p>Короткая ссылка {{.ShortURL}} ведет на адрес:</p>
+<p class="url">{{.FullURL}}</p>
+{{if .CreatedAt}}<p class="meta">Ссылка создана {{.CreatedAt}}</p>{{end}}
+<a class="continue" href="{{.FullURL}}" rel="noreferrer nofollow">Продолжить</a>
+</body>
+</html>
+`))
+
+// previewData - данные страницы предпросмотра.
+type previewData struct {
+	Title     string
+	ShortURL  string
+	FullURL   string
+	CreatedAt string
+}
+
+// writePreview - пишет в ответ HTML-страницу предпросмотра ссылки с кнопкой перехода на исходный URL.
+func (h *Handlers) writePreview(w http.ResponseWriter, link schema.URLRecord) {
+	shortURL, err := h.createLink(link.ShortKey)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data := previewData{Title: link.Title, ShortURL: shortURL, FullURL: link.FullURL}
+	if !link.CreatedAt.IsZero() {
+		data.CreatedAt = link.CreatedAt.UTC().Format("02.01.2006 15:04 MST")
+	}
+	var buf bytes.Buffer
+	if err := previewTemplate.Execute(&buf, data); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// comingSoonTemplate - шаблон страницы ссылки, время действия которой еще не наступило.
+// Исходный URL и название ссылки до запуска не раскрываются.
+var comingSoonTemplate = template.Must(template.New("coming-soon").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Скоро</title>
+<style>
+body{font-family:sans-serif;max-width:40em;margin:3em auto;padding:0 1em;color:#222}
+.meta{color:#666;font-size:.9em}
+</style>
+</head>
+<body>
+<h1>Скоро</h1>
+<p>Короткая ссылка {{.ShortURL}} еще не начала работать.</p>
+<p class="meta">Ссылка станет доступна <time datetime="{{.ActiveFromISO}}">{{.ActiveFrom}}</time></p>
+</body>
+</html>
+`))
+
+// comingSoonData - данные страницы ссылки, время действия которой еще не наступило.
+type comingSoonData struct {
+	ShortURL      string
+	ActiveFrom    string
+	ActiveFromISO string
+}
+
+// writeComingSoon - пишет в ответ страницу "Скоро" со статусом 404 для ссылки, которая начнет
+// перенаправлять в activeFrom. Ответ не кэшируется, т.к. после запуска ссылка должна сразу заработать.
+func (h *Handlers) writeComingSoon(w http.ResponseWriter, shortKey string, activeFrom time.Time) {
+	shortURL, err := h.createLink(shortKey)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data := comingSoonData{ShortURL: shortURL, ActiveFrom: activeFrom.UTC().Format("02.01.2006 15:04 MST"),
+		ActiveFromISO: activeFrom.UTC().Format(time.RFC3339)}
+	var buf bytes.Buffer
+	if err := comingSoonTemplate.Execute(&buf, data); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write(buf.Bytes())
+}
+
+// disabledTemplate - шаблон страницы-предупреждения для ссылки, отключенной администратором.
+// Исходный URL не раскрывается, чтобы посетитель не перешел по нему вручную.
+var disabledTemplate = template.Must(template.New("disabled").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Ссылка заблокирована</title>
+<style>
+body{font-family:sans-serif;max-width:40em;margin:3em auto;padding:0 1em;color:#222}
+.warning{padding:1em;background:#fdecea;border-left:4px solid #d93025;border-radius:4px}
+.meta{color:#666;font-size:.9em}
+</style>
+</head>
+<body>
+<h1>Ссылка заблокирована</h1>
+<p class="warning">Короткая ссылка {{.ShortURL}} отключена администратором сервиса и больше не перенаправляет.
+Возможно, она вела на мошеннический или вредоносный сайт.</p>
+{{if .Reason}}<p class="meta">Причина: {{.Reason}}</p>{{end}}
+</body>
+</html>
+`))
+
+// disabledData - данные страницы-предупреждения для отключенной ссылки.
+type disabledData struct {
+	ShortURL string
+	Reason   string
+}
+
+// writeDisabled - пишет в ответ страницу-предупреждение со статусом 410 для ссылки, отключенной администратором.
+// В отличие от удаленной владельцем ссылки (пустой ответ 410), посетитель видит, что ссылка заблокирована.
+func (h *Handlers) writeDisabled(w http.ResponseWriter, shortKey, reason string) {
+	shortURL, err := h.createLink(shortKey)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	if err := disabledTemplate.Execute(&buf, disabledData{ShortURL: shortURL, Reason: reason}); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusGone)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/ratelimit"
+)
+
+// HandlerAPIUserQuota - возвращает квоты пользователя (или рабочего пространства) на создание ссылок:
+// тариф, использование суточной квоты с временем ее сброса и квоты действующих ссылок.
+func (h *Handlers) HandlerAPIUserQuota(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIUserQuota произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	quota, err := h.service.Quota(token, h.clientIP(r))
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, quota)
+}
+
+// writeQuotaError - пишет ответ об исчерпании квоты, если err - *errorapp.QuotaExceededError, и возвращает true.
+// Для суточной квоты возвращается 429 с заголовком Retry-After до ее сброса, для квоты действующих ссылок - 403.
+func writeQuotaError(w http.ResponseWriter, err error) bool {
+	var errQuota *errorapp.QuotaExceededError
+	if !errors.As(err, &errQuota) {
+		return false
+	}
+	if errQuota.Quota == errorapp.QuotaDaily {
+		w.Header().Set("Retry-After", ratelimit.RetryAfter(time.Until(errQuota.ResetAt)))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return true
+	}
+	http.Error(w, err.Error(), http.StatusForbidden)
+	return true
+}
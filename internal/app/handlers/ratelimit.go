@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/ratelimit"
+)
+
+// RateLimitHandler - Middleware ограничивает частоту запросов создания, пакетного создания, удаления ссылок
+// и переходов по ссылкам (RATE_LIMIT_*). Зарегистрированные пользователи ограничиваются по учетной записи,
+// анонимные - по IP-адресу, так как анонимный токен можно получить заново в любой момент.
+// При превышении лимита возвращает 429 с заголовком Retry-After.
+func (h *Handlers) RateLimitHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := routeClass(r.Method, r.URL.Path)
+		if !h.limiter.Enabled(class) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok, retryAfter := h.limiter.Allow(class, h.rateKey(r)); !ok {
+			w.Header().Set("Retry-After", ratelimit.RetryAfter(retryAfter))
+			http.Error(w, errorapp.ErrorRateLimited.Error(), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateKey - возвращает ключ клиента для ограничения частоты запросов: учетную запись или IP-адрес.
+func (h *Handlers) rateKey(r *http.Request) string {
+	if userID, err := GetToken(r); err == nil {
+		if _, err := h.service.Account(userID); err == nil {
+			return ratelimit.UserKey(userID)
+		}
+	}
+	return ratelimit.IPKey(h.clientIP(r))
+}
+
+// routeClass - возвращает класс маршрута для ограничения частоты запросов или пустую строку,
+// если запрос не ограничивается.
+func routeClass(method, path string) string {
+	switch method {
+	case http.MethodPost:
+		switch path {
+		case "/", "/api/shorten":
+			return ratelimit.ClassCreate
+		case "/api/shorten/batch":
+			return ratelimit.ClassBatch
+		}
+	case http.MethodDelete:
+		if path == "/api/user/urls" || (strings.HasPrefix(path, "/api/user/folders/") && strings.HasSuffix(path, "/urls")) {
+			return ratelimit.ClassDelete
+		}
+	case http.MethodGet, http.MethodHead:
+		if path != "/" && path != "/ping" && !strings.HasPrefix(path, "/api/") {
+			return ratelimit.ClassRedirect
+		}
+	}
+	return ""
+}
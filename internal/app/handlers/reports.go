@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/ratelimit"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/go-chi/chi/v5"
+)
+
+// HandlerAPIReport - принимает жалобу посетителя на короткую ссылку.
+// Принимает JSON {"category": "phishing|malware|spam|other", "comment": "..."}, тело может быть пустым.
+// Количество жалоб с одного IP-адреса ограничено (REPORT_RATE_LIMIT в час), при превышении возвращается 429.
+// Возвращает сохраненную жалобу со статусом 201.
+func (h *Handlers) HandlerAPIReport(w http.ResponseWriter, r *http.Request) {
+	ip := h.clientIP(r)
+	if ok, retryAfter := h.limiter.Allow(ratelimit.ClassReport, ratelimit.IPKey(ip)); !ok {
+		w.Header().Set("Retry-After", ratelimit.RetryAfter(retryAfter))
+		http.Error(w, errorapp.ErrorRateLimited.Error(), http.StatusTooManyRequests)
+		return
+	}
+	input := schema.APIReportInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	report, err := h.service.ReportURL(chi.URLParam(r, "ShortKey"), input, ip)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, report)
+}
+
+// HandlerAPIAdminReports - возвращает жалобы на ссылки от новых к старым.
+// Параметры запроса: status - статус жалоб (open, resolved, dismissed), short_key - короткий ключ ссылки.
+func (h *Handlers) HandlerAPIAdminReports(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	reports, err := h.service.ListReports(schema.ReportFilter{ShortKey: query.Get("short_key"), Status: query.Get("status")})
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// HandlerAPIAdminDismissReports - отклоняет открытые жалобы на ссылку, ссылка продолжает работать.
+// Возвращает отклоненные жалобы.
+func (h *Handlers) HandlerAPIAdminDismissReports(w http.ResponseWriter, r *http.Request) {
+	reports, err := h.service.DismissReports(chi.URLParam(r, "ShortKey"))
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/go-chi/chi/v5"
+)
+
+// HandlerAPIURLRules - возвращает правила перенаправления ссылки пользователя в порядке проверки.
+func (h *Handlers) HandlerAPIURLRules(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIURLRules произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rules, err := h.service.ListRules(chi.URLParam(r, "ShortKey"), token)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	if len(rules) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// HandlerAPISetRules - заменяет все правила перенаправления ссылки пользователя правилами,
+// переданными JSON массивом. Порядок правил в массиве задает порядок их проверки.
+func (h *Handlers) HandlerAPISetRules(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPISetRules произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rules := []schema.RedirectRule{}
+	if err = json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rules, err = h.service.SetRules(chi.URLParam(r, "ShortKey"), token, rules)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeRules(w, rules)
+}
+
+// HandlerAPIAddRule - добавляет правило перенаправления в конец списка правил ссылки пользователя.
+func (h *Handlers) HandlerAPIAddRule(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIAddRule произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rule := schema.RedirectRule{}
+	if err = json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rule, err = h.service.AddRule(chi.URLParam(r, "ShortKey"), token, rule)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+// HandlerAPIUpdateRule - заменяет условия и адрес правила перенаправления ссылки пользователя.
+func (h *Handlers) HandlerAPIUpdateRule(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIUpdateRule произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ruleID, err := strconv.ParseInt(chi.URLParam(r, "RuleID"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rule := schema.RedirectRule{}
+	if err = json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rule, err = h.service.UpdateRule(chi.URLParam(r, "ShortKey"), token, ruleID, rule)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+// HandlerAPIDeleteRule - удаляет правило перенаправления ссылки пользователя.
+// Возвращает оставшиеся правила, пронумерованные заново.
+func (h *Handlers) HandlerAPIDeleteRule(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIDeleteRule произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ruleID, err := strconv.ParseInt(chi.URLParam(r, "RuleID"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rules, err := h.service.DeleteRule(chi.URLParam(r, "ShortKey"), token, ruleID)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeRules(w, rules)
+}
+
+// writeRules - пишет в ответ список правил ссылки, пустой список сериализуется как [].
+func writeRules(w http.ResponseWriter, rules []schema.RedirectRule) {
+	if rules == nil {
+		rules = []schema.RedirectRule{}
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// clientIP - возвращает IP-адрес клиента без порта. Заголовки Forwarded, X-Forwarded-For и X-Real-IP
+// учитываются, только если запрос пришел от доверенного прокси (TRUSTED_PROXIES).
+func (h *Handlers) clientIP(r *http.Request) string {
+	return h.ips.ClientIP(r.RemoteAddr, r.Header.Values)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/go-chi/chi/v5"
+)
+
+// HandlerAPIURLTargets - возвращает варианты A/B-теста ссылки пользователя с количеством переходов на каждый вариант.
+func (h *Handlers) HandlerAPIURLTargets(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPIURLTargets произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	targets, err := h.service.ListTargets(chi.URLParam(r, "ShortKey"), token)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	if len(targets) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, targets)
+}
+
+// HandlerAPISetTargets - заменяет варианты A/B-теста ссылки пользователя вариантами, переданными JSON массивом.
+// Варианты с номерами существующих вариантов сохраняют счетчики переходов, пустой массив выключает A/B-тест.
+func (h *Handlers) HandlerAPISetTargets(w http.ResponseWriter, r *http.Request) {
+	token, err := GetToken(r)
+	if err != nil {
+		log.Println(fmt.Errorf("при получении токена в HandlerAPISetTargets произошла ошибка; %w", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	targets := []schema.SplitTarget{}
+	if err = json.NewDecoder(r.Body).Decode(&targets); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	targets, err = h.service.SetTargets(chi.URLParam(r, "ShortKey"), token, targets)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	if targets == nil {
+		targets = []schema.SplitTarget{}
+	}
+	writeJSON(w, http.StatusOK, targets)
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/go-chi/chi/v5"
+)
+
+// WorkspaceHeader - заголовок запроса с идентификатором рабочего пространства, от имени которого выполняется запрос.
+const WorkspaceHeader = "X-Workspace"
+
+// HandlerAPICreateWorkspace - создает рабочее пространство, владельцем которого становится текущий пользователь.
+// Принимает JSON {"name": "..."}. Возвращает пространство со статусом 201, для анонимного пользователя - 401.
+func (h *Handlers) HandlerAPICreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	input := schema.APIWorkspaceInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	workspace, err := h.service.CreateWorkspace(userID, input)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, workspace)
+}
+
+// HandlerAPIWorkspaces - возвращает рабочие пространства текущего пользователя с его ролью в каждом.
+func (h *Handlers) HandlerAPIWorkspaces(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	workspaces, err := h.service.ListWorkspaces(userID)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, workspaces)
+}
+
+// HandlerAPIWorkspace - возвращает рабочее пространство с участниками; 404, если пользователь в нем не состоит.
+func (h *Handlers) HandlerAPIWorkspace(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	workspace, err := h.service.Workspace(userID, chi.URLParam(r, "WorkspaceID"))
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, workspace)
+}
+
+// HandlerAPISetMember - добавляет участника рабочего пространства или изменяет его роль.
+// Принимает JSON {"login": "<email или имя>", "role": "owner|editor|viewer"}, доступно только владельцу.
+func (h *Handlers) HandlerAPISetMember(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	input := schema.APIMemberInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	member, err := h.service.SetWorkspaceMember(userID, chi.URLParam(r, "WorkspaceID"), input)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, member)
+}
+
+// HandlerAPIRemoveMember - исключает участника из рабочего пространства (владельцем) или выходит из него (сам участник).
+func (h *Handlers) HandlerAPIRemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	err = h.service.RemoveWorkspaceMember(userID, chi.URLParam(r, "WorkspaceID"), chi.URLParam(r, "UserID"))
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlerAPITransferURL - передает ссылку другому владельцу.
+// Принимает JSON {"from_workspace": "...", "to_workspace": "...", "to_user": "..."}: без from_workspace передается
+// ссылка пользователя, без получателя - ссылка передается самому пользователю. Возвращает ссылку в формате JSON.
+// Если у получателя исчерпана квота действующих ссылок, возвращается 403.
+// Учетной записи to_user отправляется предложение передачи, которое возвращается в формате JSON со статусом 202.
+func (h *Handlers) HandlerAPITransferURL(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	input := schema.APITransferInput{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if input.ToUser != "" {
+		offer, err := h.service.OfferTransfer(userID, chi.URLParam(r, "ShortKey"), input)
+		if err != nil {
+			h.writeURLError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, offer)
+		return
+	}
+	rec, err := h.service.TransferURL(userID, chi.URLParam(r, "ShortKey"), input)
+	if writeQuotaError(w, err) {
+		return
+	}
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	h.writeUserURL(w, rec)
+}
+
+// HandlerAPITransfers - возвращает предложения передачи ссылок, отправленные пользователем и ему.
+func (h *Handlers) HandlerAPITransfers(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	offers, err := h.service.ListTransfers(userID)
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, offers)
+}
+
+// HandlerAPIAcceptTransfer - принимает предложение передать пользователю ссылку и возвращает ссылку в формате JSON.
+// Если у пользователя исчерпана квота действующих ссылок, возвращается 403, предложение сохраняется.
+func (h *Handlers) HandlerAPIAcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rec, err := h.service.AcceptTransfer(userID, chi.URLParam(r, "ShortKey"))
+	if writeQuotaError(w, err) {
+		return
+	}
+	if err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	h.writeUserURL(w, rec)
+}
+
+// HandlerAPIDeclineTransfer - отклоняет (получатель) или отзывает (отправитель) предложение передачи ссылки.
+func (h *Handlers) HandlerAPIDeclineTransfer(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetToken(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := h.service.DeclineTransfer(userID, chi.URLParam(r, "ShortKey")); err != nil {
+		h.writeURLError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// personalOnly - проверяет, что путь относится к самому пользователю и недоступен от имени рабочего пространства:
+// учетная запись, ключи API, передача ссылок, управление пространствами и административный API.
+func personalOnly(path string) bool {
+	if sessionOnly(path) || adminPath(path) || path == "/api/user/account" || path == "/api/user/claim" {
+		return true
+	}
+	if path == "/api/workspaces" || strings.HasPrefix(path, "/api/workspaces/") {
+		return true
+	}
+	return strings.HasPrefix(path, "/api/user/urls/") && strings.HasSuffix(path, "/transfer")
+}
+
+// WorkspaceHandler - middleware, выполняющее запрос с заголовком X-Workspace от имени рабочего пространства.
+// Участнику с ролью viewer доступны только GET и HEAD запросы, editor и owner - все запросы к ссылкам.
+// Запрос передается дальше от имени пространства (идентификатор пространства подставляется в контекст запроса),
+// поэтому ссылки, папки и кампании создаются и проверяются как принадлежащие пространству.
+// Пользователю, не состоящему в пространстве, отвечает 404, при недостаточной роли - 403.
+func (h *Handlers) WorkspaceHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		workspaceID := strings.TrimSpace(r.Header.Get(WorkspaceHeader))
+		if workspaceID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if personalOnly(r.URL.Path) {
+			http.Error(w, "запрос не выполняется от имени рабочего пространства, уберите заголовок "+WorkspaceHeader,
+				http.StatusBadRequest)
+			return
+		}
+		userID, err := GetToken(r)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		role, err := h.service.WorkspaceRole(workspaceID, userID)
+		if errors.Is(err, errorapp.ErrorWorkspaceNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println("ошибка при проверке участника рабочего пространства;", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if requiredScope(r.Method, r.URL.Path) == schema.ScopeWrite && !schema.RoleCanWrite(role) {
+			http.Error(w, errorapp.ErrorWorkspaceRole.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, withUser(r, workspaceID))
+	})
+}
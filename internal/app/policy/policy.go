@@ -0,0 +1,318 @@
+// Package policy checks original URLs of links against the service policy: blocked domains and patterns
+// from a hot-reloadable file, an optional allowlist-only mode and phishing heuristics
+// (IDN homographs, IP-literal hosts and links pointing back at the service itself).
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"golang.org/x/exp/slices"
+	"golang.org/x/net/idna"
+)
+
+// ReloadInterval - период проверки изменения файла политики.
+const ReloadInterval = 10 * time.Second
+
+// Префиксы строк файла политики.
+const (
+	// prefixPattern - регулярное выражение, которому не должен соответствовать весь URL.
+	prefixPattern = "re:"
+	// prefixAllow - разрешенный домен (для режима allowlist и исключения из эвристик).
+	prefixAllow = "allow:"
+)
+
+// Rules - правила политики, загруженные из файла.
+//
+// Формат файла: одно правило в строке, пустые строки и строки, начинающиеся с "#", пропускаются.
+//   - example.com - запрещен домен и все его поддомены;
+//   - re:<регулярное выражение> - запрещены URL, соответствующие выражению;
+//   - allow:example.com - разрешен домен и все его поддомены.
+type Rules struct {
+	// Blocked - запрещенные домены в punycode.
+	Blocked []string
+	// Patterns - регулярные выражения запрещенных URL.
+	Patterns []*regexp.Regexp
+	// Allowed - разрешенные домены в punycode.
+	Allowed []string
+}
+
+// ParseRules - читает правила политики из r. Возвращает ошибку с номером строки для некорректного правила.
+func ParseRules(r io.Reader) (Rules, error) {
+	rules := Rules{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, prefixPattern):
+			re, err := regexp.Compile(strings.TrimSpace(strings.TrimPrefix(line, prefixPattern)))
+			if err != nil {
+				return Rules{}, fmt.Errorf("строка %d: некорректное регулярное выражение; %w", n, err)
+			}
+			rules.Patterns = append(rules.Patterns, re)
+		case strings.HasPrefix(line, prefixAllow):
+			domain, err := normalizeDomain(strings.TrimPrefix(line, prefixAllow))
+			if err != nil {
+				return Rules{}, fmt.Errorf("строка %d: %w", n, err)
+			}
+			rules.Allowed = append(rules.Allowed, domain)
+		default:
+			domain, err := normalizeDomain(line)
+			if err != nil {
+				return Rules{}, fmt.Errorf("строка %d: %w", n, err)
+			}
+			rules.Blocked = append(rules.Blocked, domain)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// Policy - политика допустимых исходных URL. Безопасна для использования из нескольких горутин.
+type Policy struct {
+	path          string
+	allowlistOnly bool
+
+	mu           sync.RWMutex
+	rules        Rules
+	modTime      time.Time
+	serviceHosts []string
+}
+
+// New - создает политику с правилами из файла path (пусто - без файла).
+// allowlistOnly - разрешать только домены, перечисленные в файле с префиксом "allow:".
+func New(path string, allowlistOnly bool) (*Policy, error) {
+	p := &Policy{path: path, allowlistOnly: allowlistOnly}
+	if path == "" {
+		return p, nil
+	}
+	return p, p.Reload()
+}
+
+// Reload - перечитывает файл политики. При ошибке остаются действовать прежние правила.
+func (p *Policy) Reload() error {
+	if p.path == "" {
+		return nil
+	}
+	file, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	rules, err := ParseRules(file)
+	if err != nil {
+		return fmt.Errorf("файл политики %s: %w", p.path, err)
+	}
+	p.mu.Lock()
+	p.rules, p.modTime = rules, info.ModTime()
+	p.mu.Unlock()
+	return nil
+}
+
+// Watch - раз в interval проверяет время изменения файла политики и перечитывает его при изменении.
+// Работает до закрытия канала stop (nil - до завершения программы).
+func (p *Policy) Watch(interval time.Duration, stop <-chan struct{}) {
+	if p.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(p.path)
+		if err != nil {
+			log.Println("не удалось проверить файл политики;", err)
+			continue
+		}
+		p.mu.RLock()
+		changed := !info.ModTime().Equal(p.modTime)
+		p.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := p.Reload(); err != nil {
+			log.Println("не удалось перечитать файл политики, действуют прежние правила;", err)
+			continue
+		}
+		log.Println("файл политики перечитан:", p.path)
+	}
+}
+
+// SetServiceHosts - задает адреса, по которым доступен сам сервис (базовый URL коротких ссылок).
+// Ссылки на эти хосты запрещены. Принимаются как URL, так и имена хостов.
+func (p *Policy) SetServiceHosts(hosts ...string) {
+	normalized := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if u, err := url.Parse(host); err == nil && u.Host != "" {
+			host = u.Hostname()
+		}
+		if domain, err := normalizeDomain(host); err == nil {
+			normalized = append(normalized, domain)
+		}
+	}
+	p.mu.Lock()
+	p.serviceHosts = normalized
+	p.mu.Unlock()
+}
+
+// Check - проверяет исходный URL по политике. Для запрещенного URL возвращает ошибку,
+// оборачивающую errorapp.ErrorURLBlocked, с причиной запрета.
+//
+// Порядок проверок: ссылка на сам сервис, запрещенные домены и выражения, режим allowlist,
+// эвристики (IP-адрес вместо домена, смешение алфавитов в международном домене).
+// Домены из allowlist не проверяются эвристиками.
+func (p *Policy) Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w некорректный URL", errorapp.ErrorURLBlocked)
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		host = ascii
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if slices.Contains(p.serviceHosts, host) {
+		return fmt.Errorf("%w ссылка указывает на сам сервис", errorapp.ErrorURLBlocked)
+	}
+	if matchDomain(host, p.rules.Blocked) {
+		return fmt.Errorf("%w домен %s запрещен", errorapp.ErrorURLBlocked, host)
+	}
+	for _, re := range p.rules.Patterns {
+		if re.MatchString(rawURL) {
+			return fmt.Errorf("%w URL соответствует запрещенному шаблону %q", errorapp.ErrorURLBlocked, re.String())
+		}
+	}
+	if matchDomain(host, p.rules.Allowed) {
+		return nil
+	}
+	if p.allowlistOnly {
+		return fmt.Errorf("%w домен %s не входит в список разрешенных", errorapp.ErrorURLBlocked, host)
+	}
+	if net.ParseIP(host) != nil {
+		return fmt.Errorf("%w IP-адрес вместо доменного имени", errorapp.ErrorURLBlocked)
+	}
+	if label, ok := homograph(host); ok {
+		return fmt.Errorf("%w домен %s похож на подделку (метка %q)", errorapp.ErrorURLBlocked, host, label)
+	}
+	return nil
+}
+
+// matchDomain - проверяет, что host совпадает с одним из доменов domains или является его поддоменом.
+func matchDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDomain - приводит домен из правила к виду, в котором сравниваются хосты URL (нижний регистр, punycode).
+func normalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	domain = strings.TrimPrefix(domain, "*.")
+	if domain == "" {
+		return "", fmt.Errorf("пустой домен")
+	}
+	if net.ParseIP(domain) != nil {
+		return domain, nil
+	}
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("некорректный домен %q; %w", domain, err)
+	}
+	return ascii, nil
+}
+
+// confusables - буквы кириллицы и греческого алфавита, неотличимые на вид от латинских.
+const confusables = "аеорсухіјѕһԁӏԛԝАВЕКМНОРСТХУІЈЅοαικνρτυχΑΒΕΖΗΙΚΜΝΟΡΤΥΧ"
+
+// Письменности меток домена, которые различает homograph.
+const (
+	scriptNone = iota
+	scriptLatin
+	scriptCyrillic
+	scriptGreek
+	scriptMixed
+)
+
+// labelScript - возвращает письменность букв метки домена в Unicode (scriptMixed, если их несколько)
+// и признак того, что все буквы метки похожи на латинские.
+func labelScript(label string) (int, bool) {
+	script, letters, lookalike := scriptNone, 0, 0
+	for _, r := range label {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if strings.ContainsRune(confusables, r) {
+			lookalike++
+		}
+		current := scriptNone
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			current = scriptLatin
+		case unicode.Is(unicode.Cyrillic, r):
+			current = scriptCyrillic
+		case unicode.Is(unicode.Greek, r):
+			current = scriptGreek
+		}
+		if current == scriptNone || current == script {
+			continue
+		}
+		if script != scriptNone {
+			return scriptMixed, false
+		}
+		script = current
+	}
+	return script, letters > 0 && lookalike == letters
+}
+
+// homograph - ищет в домене метку, которая может выдавать себя за латинскую: метку, смешивающую
+// латиницу, кириллицу или греческий алфавит, или метку из букв, похожих на латинские, в зоне другой
+// письменности (аррӏе.com). Метки в зоне своей письменности (сахар.рф) не считаются подделкой.
+// Возвращает такую метку в Unicode.
+func homograph(host string) (string, bool) {
+	labels := strings.Split(host, ".")
+	tld, err := idna.ToUnicode(labels[len(labels)-1])
+	if err != nil {
+		return "", false
+	}
+	tldScript, _ := labelScript(tld)
+	for _, label := range labels {
+		if !strings.HasPrefix(label, "xn--") {
+			continue
+		}
+		decoded, err := idna.ToUnicode(label)
+		if err != nil {
+			continue
+		}
+		script, lookalike := labelScript(decoded)
+		if script == scriptMixed || (lookalike && script != tldScript) {
+			return decoded, true
+		}
+	}
+	return "", false
+}
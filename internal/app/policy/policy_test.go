@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHomograph(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		blocked bool
+	}{
+		{name: "латинский домен", host: "apple.com"},
+		{name: "кириллический домен в зоне рф", host: "сахар.рф"},
+		{name: "кириллический домен из похожих букв в зоне рф", host: "орех.рф"},
+		{name: "кириллический поддомен в зоне рф", host: "магазин.сахар.рф"},
+		{name: "кириллический домен с непохожими буквами в зоне com", host: "пример.com"},
+		{name: "греческий домен с непохожими буквами в зоне gr", host: "λογος.gr"},
+		{name: "греческий домен из похожих букв в зоне ελ", host: "ακι.ελ"},
+		{name: "смешение латиницы и кириллицы", host: "аpple.com", blocked: true},
+		{name: "смешение в зоне рф", host: "сaхар.рф", blocked: true},
+		{name: "кириллица из похожих букв в зоне com", host: "аррӏе.com", blocked: true},
+		{name: "кириллица из похожих букв в поддомене", host: "рау.example.com", blocked: true},
+		{name: "греческий из похожих букв в зоне com", host: "κοι.com", blocked: true},
+	}
+	p, err := New("", false)
+	require.NoError(t, err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Check("http://" + tt.host + "/path")
+			if tt.blocked {
+				assert.ErrorIs(t, err, errorapp.ErrorURLBlocked)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	rules := `# правила
+blocked.com
+re:^https?://[^/]+/phish
+allow:trusted.org
+`
+	parsed, err := ParseRules(strings.NewReader(rules))
+	require.NoError(t, err)
+	p := &Policy{rules: parsed}
+	p.SetServiceHosts("short.example")
+
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{url: "http://example.com/page"},
+		{url: "http://blocked.com/", blocked: true},
+		{url: "http://sub.blocked.com/", blocked: true},
+		{url: "http://notblocked.com/"},
+		{url: "http://example.com/phish/login", blocked: true},
+		{url: "http://short.example/abc", blocked: true},
+		{url: "http://127.0.0.1/", blocked: true},
+		{url: "http://trusted.org/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := p.Check(tt.url)
+			if tt.blocked {
+				assert.ErrorIs(t, err, errorapp.ErrorURLBlocked)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	p.allowlistOnly = true
+	assert.NoError(t, p.Check("http://www.trusted.org/"))
+	assert.ErrorIs(t, p.Check("http://example.com/"), errorapp.ErrorURLBlocked)
+}
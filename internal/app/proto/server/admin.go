@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	pb "github.com/bubu256/go-url-shortener-server/internal/app/proto"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AdminService содержит gRPC методы административного API.
+// Доступ проверяется в перехватчике HandlerService (см. checkAdmin).
+type AdminService struct {
+	pb.UnimplementedAdminServiceServer
+	h *HandlerService
+}
+
+// AdminService - возвращает административный сервис, использующий настройки HandlerService.
+func (h *HandlerService) AdminService() *AdminService {
+	return &AdminService{h: h}
+}
+
+// adminMethod - проверяет, что метод fullMethod относится к AdminService.
+func adminMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+pb.AdminService_ServiceDesc.ServiceName+"/")
+}
+
+// checkAdmin - проверяет, что запрос выполняет администратор: учетная запись из ADMIN_USERS,
+// авторизованная токеном или ключом API с областью admin. Анонимному пользователю отвечает Unauthenticated,
+// остальным, а также запросам с метаданными workspace и (при ADMIN_TRUSTED_SUBNET_ONLY) запросам
+// не из доверительной подсети - PermissionDenied.
+func (h *HandlerService) checkAdmin(ctx context.Context, md metadata.MD) error {
+	if values := md.Get("workspace"); len(values) > 0 && values[0] != "" {
+		return status.Error(codes.PermissionDenied, "метод не выполняется от имени рабочего пространства;")
+	}
+	if h.cfg.AdminTrustedSubnetOnly {
+		if !h.ips.Trusted(h.clientIP(ctx, "")) {
+			return status.Error(codes.PermissionDenied, "метод не доступен")
+		}
+	}
+	userID := getToken(ctx)
+	if _, err := h.service.Account(userID); errors.Is(err, errorapp.ErrorLoginRequired) {
+		return status.Error(codes.Unauthenticated, err.Error())
+	} else if err != nil {
+		return status.Error(codes.Internal, "ошибка при проверке учетной записи;")
+	}
+	if !h.service.IsAdmin(userID) {
+		return status.Error(codes.PermissionDenied, errorapp.ErrorAdminRequired.Error())
+	}
+	return nil
+}
+
+// Stats - возвращает статистику сервиса.
+func (a *AdminService) Stats(ctx context.Context, req *pb.APIInternalStatsRequest) (*pb.APIInternalStatsResponse, error) {
+	stats, err := a.h.service.GetStatsStorage()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "ошибка при получении статистики по серверу;")
+	}
+	return &pb.APIInternalStatsResponse{Users: int32(stats.Users), Urls: int32(stats.URLs)}, nil
+}
+
+// SearchURLs - ищет ссылки всех пользователей по параметрам выборки, части короткого ключа и владельцу
+// (идентификатор пользователя, email или имя). Без статуса возвращаются ссылки в любом статусе.
+func (a *AdminService) SearchURLs(ctx context.Context, req *pb.AdminSearchURLsRequest) (*pb.AdminURLsResponse, error) {
+	opts := listOptions(req.Options)
+	opts.Key, opts.Owner = req.Key, req.Owner
+	return a.searchURLs(opts)
+}
+
+// UserURLs - возвращает ссылки пользователя user_id (идентификатор, email или имя).
+func (a *AdminService) UserURLs(ctx context.Context, req *pb.AdminUserURLsRequest) (*pb.AdminURLsResponse, error) {
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "не указан пользователь;")
+	}
+	opts := listOptions(req.Options)
+	opts.Owner = req.UserId
+	return a.searchURLs(opts)
+}
+
+// searchURLs - ищет ссылки и собирает ответ с владельцами ссылок.
+func (a *AdminService) searchURLs(opts schema.ListURLsOptions) (*pb.AdminURLsResponse, error) {
+	page, err := a.h.service.SearchURLs(opts)
+	if errors.Is(err, errorapp.ErrorInvalidListOptions) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if err != nil {
+		return nil, status.Errorf(codes.Internal, "ошибка при поиске ссылок %v;", err)
+	}
+	result := make([]*pb.AdminURL, 0, len(page.Items))
+	now := time.Now()
+	for _, rec := range page.Items {
+		result = append(result, &pb.AdminURL{Url: newURLMapping(rec, now), UserId: rec.UserID})
+	}
+	return &pb.AdminURLsResponse{Urls: result, NextCursor: page.NextCursor}, nil
+}
+
+// DisableURL - отключает ссылку любого пользователя.
+// Без причины ссылка отключается, только если она нарушает политику сервиса.
+func (a *AdminService) DisableURL(ctx context.Context, req *pb.DisableURLRequest) (*pb.AdminURLResponse, error) {
+	rec, err := a.h.service.DisableURL(req.ShortKey, req.Reason)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.AdminURLResponse{Url: newURLMapping(rec, time.Now())}, nil
+}
+
+// EnableURL - снимает отключение администратором со ссылки.
+func (a *AdminService) EnableURL(ctx context.Context, req *pb.EnableURLRequest) (*pb.AdminURLResponse, error) {
+	rec, err := a.h.service.EnableURL(req.ShortKey)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.AdminURLResponse{Url: newURLMapping(rec, time.Now())}, nil
+}
+
+// PurgeURL - окончательно удаляет ссылку без возможности восстановления.
+func (a *AdminService) PurgeURL(ctx context.Context, req *pb.AdminPurgeURLRequest) (*pb.AdminPurgeURLResponse, error) {
+	if err := a.h.service.PurgeURL(req.ShortKey); err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.AdminPurgeURLResponse{}, nil
+}
+
+// PurgeUserURLs - окончательно удаляет все ссылки пользователя user_id (идентификатор, email или имя)
+// и возвращает их короткие ключи.
+func (a *AdminService) PurgeUserURLs(ctx context.Context, req *pb.AdminPurgeUserURLsRequest) (*pb.AdminPurgeUserURLsResponse, error) {
+	purged, err := a.h.service.PurgeUserURLs(req.UserId)
+	if errors.Is(err, errorapp.ErrorInvalidListOptions) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.AdminPurgeUserURLsResponse{Purged: purged}, nil
+}
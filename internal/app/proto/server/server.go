@@ -6,38 +6,47 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"net"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/bubu256/go-url-shortener-server/config"
+	"github.com/bubu256/go-url-shortener-server/internal/app/clientip"
 	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
-	"github.com/bubu256/go-url-shortener-server/internal/app/handlers"
 	pb "github.com/bubu256/go-url-shortener-server/internal/app/proto"
+	"github.com/bubu256/go-url-shortener-server/internal/app/qr"
+	"github.com/bubu256/go-url-shortener-server/internal/app/ratelimit"
 	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
 	"github.com/bubu256/go-url-shortener-server/internal/app/shortener"
+	"github.com/bubu256/go-url-shortener-server/internal/app/targeting"
+	"github.com/bubu256/go-url-shortener-server/internal/app/token"
 	"golang.org/x/exp/slices"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // Структура HandlerService хранит настройки для работы сервера и содержит gRPC методы
 type HandlerService struct {
 	pb.UnimplementedHandlerServiceServer
-	service       *shortener.Shortener
-	baseURL       string
-	trustedSubnet *net.IPNet
-	cfg           config.CfgServer
+	service *shortener.Shortener
+	baseURL string
+	ips     *clientip.Resolver
+	cfg     config.CfgServer
+	limiter *ratelimit.Limiter
 }
 
 // New - возвращает ссылку на новую структуру handlerService, и *grpc.Server с подключенными перехватчиками
 func New(service *shortener.Shortener, cfgServer config.CfgServer) (*HandlerService, *grpc.Server) {
 	newHandlerService := HandlerService{
-		baseURL:       cfgServer.BaseURL,
-		trustedSubnet: handlers.ParseSubnetCIDR(cfgServer.TrustedSubnet),
-		cfg:           cfgServer,
+		service: service,
+		baseURL: cfgServer.BaseURL,
+		ips:     clientip.New(cfgServer.TrustedSubnets(), cfgServer.TrustedProxies),
+		cfg:     cfgServer,
+		limiter: ratelimit.New(cfgServer, service),
 	}
 	return &newHandlerService, grpc.NewServer(
 		grpc.UnaryInterceptor(newHandlerService.tokenInterceptor),
@@ -63,7 +72,19 @@ func (h *HandlerService) URLtoShort(ctx context.Context, req *pb.URLtoShortReque
 	}
 
 	// получаем короткий идентификатор ссылки
-	shortKey, err := h.service.CreateShortKey(req.Url, token)
+	meta := schema.URLMeta{Title: req.Title, Note: req.Note, Tags: req.Tags, FolderID: req.FolderId,
+		ForcePreview: req.ForcePreview, RedirectType: int(req.RedirectType), Passthrough: req.Passthrough,
+		PassthroughConflict: req.PassthroughConflict, CampaignID: req.CampaignId, Rules: redirectRules(req.Rules),
+		Targets: splitTargets(req.Targets)}
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.AsTime()
+		meta.ExpiresAt = &expiresAt
+	}
+	if req.ActiveFrom != nil {
+		activeFrom := req.ActiveFrom.AsTime()
+		meta.ActiveFrom = &activeFrom
+	}
+	shortKey, err := h.service.CreateShortKeyWithMeta(req.Url, token, h.clientIP(ctx, ""), meta)
 	var errDuplicate *errorapp.URLDuplicateError
 	if errors.As(err, &errDuplicate) {
 		// если ошибка дубликации урл
@@ -72,6 +93,11 @@ func (h *HandlerService) URLtoShort(ctx context.Context, req *pb.URLtoShortReque
 			return nil, status.Error(codes.Internal, fmt.Errorf("ошибка при сборе короткой ссылки %v; %w", err, errDuplicate).Error())
 		}
 		return &pb.URLtoShortResponse{ShortUrl: shortURL}, status.Errorf(codes.InvalidArgument, "найден дубликат; %v", errDuplicate)
+	} else if errors.Is(err, errorapp.ErrorFolderNotFound) || errors.Is(err, errorapp.ErrorCampaignNotFound) ||
+		errorapp.IsInvalidInput(err) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if errors.Is(err, errorapp.ErrorQuotaExceeded) {
+		return nil, quotaError(ctx, err)
 	} else if err != nil {
 		return nil, status.Errorf(codes.Internal, "ошибка при создании короткого ключа %v;", err)
 	}
@@ -80,19 +106,99 @@ func (h *HandlerService) URLtoShort(ctx context.Context, req *pb.URLtoShortReque
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "ошибка при сборе короткой ссылки %v;", err)
 	}
-	return &pb.URLtoShortResponse{ShortUrl: shortURL}, nil
+	response := &pb.URLtoShortResponse{ShortUrl: shortURL}
+	if req.IncludeQr {
+		response.QrDataUri, err = qr.DataURI(shortURL)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "ошибка при создании QR-кода %v;", err)
+		}
+	}
+	return response, nil
+}
+
+// QRCode - возвращает QR-код короткой ссылки в формате PNG или SVG.
+func (h *HandlerService) QRCode(ctx context.Context, req *pb.QRCodeRequest) (*pb.QRCodeResponse, error) {
+	opts := qr.Options{Format: req.Format, Size: int(req.Size), Level: req.Level}
+	if req.Margin != nil {
+		opts.Margin = int(*req.Margin)
+		if opts.Margin == 0 {
+			opts.Margin = -1 // явно заданная нулевая рамка
+		}
+	}
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// QR-код запланированной ссылки можно получить заранее, до начала ее действия
+	var notActive *errorapp.URLNotActiveError
+	_, err = h.service.GetURL(req.ShortKey)
+	if err != nil && !errors.As(err, &notActive) {
+		if errors.Is(err, errorapp.ErrorPageNotAvailable) {
+			return nil, status.Errorf(codes.NotFound, "ресурс больше не доступен %v;", err)
+		}
+		return nil, status.Errorf(codes.NotFound, "ресурс отсутствует %v;", err)
+	}
+	shortURL, err := h.createLink(req.ShortKey)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ошибка при сборе короткой ссылки %v;", err)
+	}
+	img, err := qr.Encode(shortURL, opts)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ошибка при создании QR-кода %v;", err)
+	}
+	return &pb.QRCodeResponse{Image: img, ContentType: opts.ContentType()}, nil
 }
 
 // ShortToURL - возвращает полный URL по переданному короткому идентификаторы
+// Для ссылки с вариантами A/B-теста возвращает номер выбранного варианта; клиент передает его в variant_id
+// следующих запросов, чтобы закрепить вариант за посетителем.
+// До наступления времени начала действия ссылки возвращает ошибку с кодом FailedPrecondition.
+// Для ссылки, отключенной администратором, возвращает PermissionDenied с причиной отключения в сообщении,
+// чтобы клиент мог показать предупреждение (удаленная владельцем ссылка - NotFound).
 func (h *HandlerService) ShortToURL(ctx context.Context, req *pb.ShortToURLRequest) (*pb.ShortToURLResponse, error) {
-	fullURL, err := h.service.GetURL(req.ShortKey)
+	link, err := h.service.GetLink(req.ShortKey)
 	if err != nil {
+		var disabled *errorapp.URLDisabledError
+		if errors.As(err, &disabled) {
+			return nil, status.Error(codes.PermissionDenied, disabled.Reason)
+		}
 		if errors.Is(err, errorapp.ErrorPageNotAvailable) {
 			return nil, status.Errorf(codes.NotFound, "ресурс больше не доступен %v;", err)
 		}
+		var notActive *errorapp.URLNotActiveError
+		if errors.As(err, &notActive) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
 		return nil, status.Errorf(codes.NotFound, "ресурс отсутствует %v;", err)
 	}
-	return &pb.ShortToURLResponse{FullUrl: fullURL}, nil
+	matched := false
+	if len(link.Rules) > 0 {
+		ip := h.clientIP(ctx, req.ClientIp)
+		link, matched = targeting.Apply(link, h.service.Client(req.UserAgent, req.AcceptLanguage, ip))
+	}
+	var variantID int64
+	if !matched {
+		if variant, ok := targeting.PickVariant(link.Targets, req.VariantId); ok {
+			link.FullURL, variantID = variant.URL, variant.ID
+		}
+	}
+	query, err := url.ParseQuery(req.Query)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "некорректные параметры запроса %v;", err)
+	}
+	target, err := h.service.Target(link, query, req.Path)
+	if err != nil {
+		if errors.Is(err, errorapp.ErrorURLNotFound) {
+			return nil, status.Errorf(codes.NotFound, "ресурс отсутствует %v;", err)
+		}
+		return nil, status.Errorf(codes.Internal, "ошибка при сборе исходного URL %v;", err)
+	}
+	if !link.ForcePreview {
+		if err := h.service.RecordClick(link, variantID); err != nil {
+			log.Println("не удалось учесть переход по ссылке;", err)
+		}
+	}
+	return &pb.ShortToURLResponse{FullUrl: target, ForcePreview: link.ForcePreview, VariantId: variantID}, nil
 }
 
 // APIShortenBatch - записывает переданные сокращенные идентификаторы и полные URL в хранилище.
@@ -108,7 +214,13 @@ func (h *HandlerService) APIShortenBatch(ctx context.Context, req *pb.APIShorten
 		batch[i].OriginalURL = elem.OriginalUrl
 	}
 	// получаем идентификаторы ссылок записанные в базу
-	shortKeys, err := h.service.SetBatchURLs(batch, token)
+	shortKeys, err := h.service.SetBatchURLs(batch, token, h.clientIP(ctx, ""))
+	if errorapp.IsInvalidInput(err) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, errorapp.ErrorQuotaExceeded) {
+		return nil, quotaError(ctx, err)
+	}
 	if err != nil {
 		return nil, status.Error(codes.Internal, "ошибка при добавлении batch ссылок;")
 	}
@@ -123,18 +235,567 @@ func (h *HandlerService) APIShortenBatch(ctx context.Context, req *pb.APIShorten
 	return &pb.APIShortenBatchResponse{ShortUrls: result}, nil
 }
 
-// APIUserAllURLs - возвращает все URL пользователя
+// APIUserAllURLs - возвращает страницу URL пользователя с учетом сортировки и фильтров запроса.
+// Курсор следующей страницы возвращается в поле next_cursor.
 func (h *HandlerService) APIUserAllURLs(ctx context.Context, req *pb.APIUserAllURLsRequest) (*pb.APIUserAllURLsResponse, error) {
 	token := getToken(ctx)
 	if token == "" {
 		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
 	}
-	allURLs := h.service.GetAllURLs(token)
-	result := make([]*pb.URLMapping, 0)
-	for key, URL := range allURLs {
-		result = append(result, &pb.URLMapping{CorrelationId: key, OriginalUrl: URL})
+	page, err := h.service.ListURLs(token, listOptions(req))
+	if errors.Is(err, errorapp.ErrorInvalidListOptions) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if err != nil {
+		return nil, status.Errorf(codes.Internal, "ошибка при получении списка ссылок %v;", err)
+	}
+	result := make([]*pb.URLMapping, 0, len(page.Items))
+	now := time.Now()
+	for _, rec := range page.Items {
+		result = append(result, newURLMapping(rec, now))
+	}
+	return &pb.APIUserAllURLsResponse{Urls: result, NextCursor: page.NextCursor}, nil
+}
+
+// listOptions - собирает параметры выборки ссылок из запроса; для nil возвращает параметры по умолчанию.
+func listOptions(req *pb.APIUserAllURLsRequest) schema.ListURLsOptions {
+	return schema.ListURLsOptions{
+		Cursor:     req.GetCursor(),
+		Limit:      int(req.GetLimit()),
+		SortBy:     req.GetSortBy(),
+		Desc:       req.GetDescending(),
+		Query:      req.GetQuery(),
+		Domain:     req.GetDomain(),
+		Status:     req.GetStatus(),
+		Tag:        req.GetTag(),
+		FolderID:   req.GetFolderId(),
+		CampaignID: req.GetCampaignId(),
+	}
+}
+
+// UpdateURL - изменяет название, заметку, метки и срок действия ссылки пользователя.
+// Поля, не заданные в запросе, не изменяются.
+func (h *HandlerService) UpdateURL(ctx context.Context, req *pb.UpdateURLRequest) (*pb.UpdateURLResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	patch := schema.URLPatch{Title: req.Title, Note: req.Note, FolderID: req.FolderId}
+	if req.Tags != nil {
+		patch.Tags = &req.Tags.Tags
+	}
+	if req.RedirectType != nil {
+		redirectType := int(*req.RedirectType)
+		patch.RedirectType = &redirectType
+	}
+	patch.Passthrough, patch.PassthroughConflict = req.Passthrough, req.PassthroughConflict
+	patch.CampaignID = req.CampaignId
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.AsTime()
+		patch.ExpiresAt = schema.OptionalTime{Set: true, Time: &expiresAt}
+	} else if req.ClearExpiresAt {
+		patch.ExpiresAt = schema.OptionalTime{Set: true}
+	}
+	if req.ActiveFrom != nil {
+		activeFrom := req.ActiveFrom.AsTime()
+		patch.ActiveFrom = schema.OptionalTime{Set: true, Time: &activeFrom}
+	} else if req.ClearActiveFrom {
+		patch.ActiveFrom = schema.OptionalTime{Set: true}
+	}
+	rec, err := h.service.UpdateURL(req.ShortKey, token, patch)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.UpdateURLResponse{Url: newURLMapping(rec, time.Now())}, nil
+}
+
+// AddTags - добавляет метки к ссылке пользователя.
+func (h *HandlerService) AddTags(ctx context.Context, req *pb.ChangeTagsRequest) (*pb.ChangeTagsResponse, error) {
+	return h.changeTags(ctx, req, h.service.AddTags)
+}
+
+// RemoveTags - убирает метки у ссылки пользователя.
+func (h *HandlerService) RemoveTags(ctx context.Context, req *pb.ChangeTagsRequest) (*pb.ChangeTagsResponse, error) {
+	return h.changeTags(ctx, req, h.service.RemoveTags)
+}
+
+// changeTags - общая часть методов добавления и удаления меток.
+func (h *HandlerService) changeTags(ctx context.Context, req *pb.ChangeTagsRequest, change func(shortKey, tokenID string, tags []string) (schema.URLRecord, error)) (*pb.ChangeTagsResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	rec, err := change(req.ShortKey, token, req.Tags)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.ChangeTagsResponse{Url: newURLMapping(rec, time.Now())}, nil
+}
+
+// ListTags - возвращает метки активных ссылок пользователя с количеством ссылок по каждой метке.
+func (h *HandlerService) ListTags(ctx context.Context, req *pb.ListTagsRequest) (*pb.ListTagsResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	tags, err := h.service.ListTags(token)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	result := make([]*pb.TagInfo, 0, len(tags))
+	for _, tag := range tags {
+		result = append(result, &pb.TagInfo{Name: tag.Name, Count: int32(tag.Count)})
+	}
+	return &pb.ListTagsResponse{Tags: result}, nil
+}
+
+// CreateFolder - создает папку пользователя.
+func (h *HandlerService) CreateFolder(ctx context.Context, req *pb.CreateFolderRequest) (*pb.CreateFolderResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	folder, err := h.service.CreateFolder(token, req.Name)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.CreateFolderResponse{Folder: newFolder(folder)}, nil
+}
+
+// ListFolders - возвращает папки пользователя с количеством активных ссылок в каждой.
+func (h *HandlerService) ListFolders(ctx context.Context, req *pb.ListFoldersRequest) (*pb.ListFoldersResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	folders, err := h.service.ListFolders(token)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	result := make([]*pb.Folder, 0, len(folders))
+	for _, folder := range folders {
+		result = append(result, newFolder(folder))
+	}
+	return &pb.ListFoldersResponse{Folders: result}, nil
+}
+
+// DeleteFolder - удаляет папку пользователя, ссылки из папки не удаляются.
+func (h *HandlerService) DeleteFolder(ctx context.Context, req *pb.DeleteFolderRequest) (*pb.DeleteFolderResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	if err := h.service.DeleteFolder(req.FolderId, token); err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.DeleteFolderResponse{Success: true}, nil
+}
+
+// DeleteFolderURLs - принимает запрос на удаление всех ссылок папки пользователя.
+// Удаление выполняется так же, как в APIDeleteUrls, и может произойти позже.
+func (h *HandlerService) DeleteFolderURLs(ctx context.Context, req *pb.DeleteFolderRequest) (*pb.DeleteFolderResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	keys, err := h.service.FolderKeys(req.FolderId, token)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	go h.service.DeleteBatch(keys, token)
+	return &pb.DeleteFolderResponse{Success: true}, nil
+}
+
+// newFolder - собирает сообщение pb.Folder по папке пользователя.
+func newFolder(folder schema.Folder) *pb.Folder {
+	return &pb.Folder{
+		Id:        folder.ID,
+		Name:      folder.Name,
+		CreatedAt: timestamppb.New(folder.CreatedAt),
+		LinkCount: int32(folder.LinkCount),
+	}
+}
+
+// CreateCampaign - создает кампанию пользователя с шаблоном UTM-параметров.
+func (h *HandlerService) CreateCampaign(ctx context.Context, req *pb.CreateCampaignRequest) (*pb.CreateCampaignResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	input := schema.APICampaignInput{Name: req.Name}
+	if req.Utm != nil {
+		input.UTM = schema.UTMTemplate{
+			Source:   req.Utm.UtmSource,
+			Medium:   req.Utm.UtmMedium,
+			Campaign: req.Utm.UtmCampaign,
+			Term:     req.Utm.UtmTerm,
+			Content:  req.Utm.UtmContent,
+		}
+	}
+	campaign, err := h.service.CreateCampaign(token, input)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.CreateCampaignResponse{Campaign: newCampaign(campaign)}, nil
+}
+
+// ListCampaigns - возвращает кампании пользователя с количеством активных ссылок и переходов.
+func (h *HandlerService) ListCampaigns(ctx context.Context, req *pb.ListCampaignsRequest) (*pb.ListCampaignsResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	campaigns, err := h.service.ListCampaigns(token)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	result := make([]*pb.Campaign, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		result = append(result, newCampaign(campaign))
+	}
+	return &pb.ListCampaignsResponse{Campaigns: result}, nil
+}
+
+// DeleteCampaign - удаляет кампанию пользователя, ссылки кампании не удаляются.
+func (h *HandlerService) DeleteCampaign(ctx context.Context, req *pb.DeleteCampaignRequest) (*pb.DeleteCampaignResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	if err := h.service.DeleteCampaign(req.CampaignId, token); err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.DeleteCampaignResponse{Success: true}, nil
+}
+
+// newCampaign - собирает сообщение pb.Campaign по кампании пользователя.
+func newCampaign(campaign schema.Campaign) *pb.Campaign {
+	return &pb.Campaign{
+		Id:   campaign.ID,
+		Name: campaign.Name,
+		Utm: &pb.UTMTemplate{
+			UtmSource:   campaign.UTM.Source,
+			UtmMedium:   campaign.UTM.Medium,
+			UtmCampaign: campaign.UTM.Campaign,
+			UtmTerm:     campaign.UTM.Term,
+			UtmContent:  campaign.UTM.Content,
+		},
+		CreatedAt: timestamppb.New(campaign.CreatedAt),
+		LinkCount: int32(campaign.LinkCount),
+		Clicks:    campaign.Clicks,
+	}
+}
+
+// ListRules - возвращает правила перенаправления ссылки пользователя в порядке проверки.
+func (h *HandlerService) ListRules(ctx context.Context, req *pb.ListRulesRequest) (*pb.RulesResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	rules, err := h.service.ListRules(req.ShortKey, token)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.RulesResponse{Rules: newRedirectRules(rules)}, nil
+}
+
+// SetRules - заменяет все правила перенаправления ссылки пользователя.
+func (h *HandlerService) SetRules(ctx context.Context, req *pb.SetRulesRequest) (*pb.RulesResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	rules, err := h.service.SetRules(req.ShortKey, token, redirectRules(req.Rules))
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.RulesResponse{Rules: newRedirectRules(rules)}, nil
+}
+
+// AddRule - добавляет правило перенаправления в конец списка правил ссылки пользователя.
+func (h *HandlerService) AddRule(ctx context.Context, req *pb.AddRuleRequest) (*pb.RuleResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	rule, err := h.service.AddRule(req.ShortKey, token, redirectRule(req.Rule))
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.RuleResponse{Rule: newRedirectRule(rule)}, nil
+}
+
+// UpdateRule - заменяет условия и адрес правила перенаправления ссылки пользователя.
+func (h *HandlerService) UpdateRule(ctx context.Context, req *pb.UpdateRuleRequest) (*pb.RuleResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	rule, err := h.service.UpdateRule(req.ShortKey, token, req.RuleId, redirectRule(req.Rule))
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.RuleResponse{Rule: newRedirectRule(rule)}, nil
+}
+
+// DeleteRule - удаляет правило перенаправления ссылки пользователя и возвращает оставшиеся правила.
+func (h *HandlerService) DeleteRule(ctx context.Context, req *pb.DeleteRuleRequest) (*pb.RulesResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	rules, err := h.service.DeleteRule(req.ShortKey, token, req.RuleId)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.RulesResponse{Rules: newRedirectRules(rules)}, nil
+}
+
+// newRedirectRule - собирает сообщение pb.RedirectRule по правилу ссылки.
+func newRedirectRule(rule schema.RedirectRule) *pb.RedirectRule {
+	return &pb.RedirectRule{Id: rule.ID, Platform: rule.Platform, Language: rule.Language, Country: rule.Country, Url: rule.URL}
+}
+
+// newRedirectRules - собирает сообщения pb.RedirectRule по правилам ссылки.
+func newRedirectRules(rules []schema.RedirectRule) []*pb.RedirectRule {
+	result := make([]*pb.RedirectRule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, newRedirectRule(rule))
+	}
+	return result
+}
+
+// redirectRule - преобразует сообщение pb.RedirectRule в правило ссылки.
+func redirectRule(rule *pb.RedirectRule) schema.RedirectRule {
+	return schema.RedirectRule{ID: rule.GetId(), Platform: rule.GetPlatform(), Language: rule.GetLanguage(),
+		Country: rule.GetCountry(), URL: rule.GetUrl()}
+}
+
+// redirectRules - преобразует сообщения pb.RedirectRule в правила ссылки.
+func redirectRules(rules []*pb.RedirectRule) []schema.RedirectRule {
+	var result []schema.RedirectRule
+	for _, rule := range rules {
+		result = append(result, redirectRule(rule))
+	}
+	return result
+}
+
+// ListTargets - возвращает варианты A/B-теста ссылки пользователя с количеством переходов.
+func (h *HandlerService) ListTargets(ctx context.Context, req *pb.ListTargetsRequest) (*pb.TargetsResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	targets, err := h.service.ListTargets(req.ShortKey, token)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.TargetsResponse{Targets: newSplitTargets(targets)}, nil
+}
+
+// SetTargets - заменяет варианты A/B-теста ссылки пользователя, пустой набор выключает A/B-тест.
+func (h *HandlerService) SetTargets(ctx context.Context, req *pb.SetTargetsRequest) (*pb.TargetsResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	targets, err := h.service.SetTargets(req.ShortKey, token, splitTargets(req.Targets))
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.TargetsResponse{Targets: newSplitTargets(targets)}, nil
+}
+
+// newSplitTargets - собирает сообщения pb.SplitTarget по вариантам A/B-теста ссылки.
+func newSplitTargets(targets []schema.SplitTarget) []*pb.SplitTarget {
+	result := make([]*pb.SplitTarget, 0, len(targets))
+	for _, target := range targets {
+		result = append(result, &pb.SplitTarget{Id: target.ID, Url: target.URL, Weight: int32(target.Weight), Clicks: target.Clicks})
+	}
+	return result
+}
+
+// splitTargets - преобразует сообщения pb.SplitTarget в варианты A/B-теста ссылки.
+func splitTargets(targets []*pb.SplitTarget) []schema.SplitTarget {
+	var result []schema.SplitTarget
+	for _, target := range targets {
+		result = append(result, schema.SplitTarget{ID: target.GetId(), URL: target.GetUrl(), Weight: int(target.GetWeight())})
+	}
+	return result
+}
+
+// TransferURL - передает ссылку пользователя или рабочего пространства from_workspace рабочему пространству
+// to_workspace или самому пользователю. Если у получателя исчерпана квота, возвращается ResourceExhausted.
+// Учетной записи to_user отправляется предложение передачи, которое возвращается в поле offer.
+func (h *HandlerService) TransferURL(ctx context.Context, req *pb.TransferURLRequest) (*pb.TransferURLResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	input := schema.APITransferInput{FromWorkspace: req.FromWorkspace, ToWorkspace: req.ToWorkspace, ToUser: req.ToUser}
+	if input.ToUser != "" {
+		offer, err := h.service.OfferTransfer(token, req.ShortKey, input)
+		if err != nil {
+			return nil, urlError(err)
+		}
+		return &pb.TransferURLResponse{Offer: newTransferOffer(offer)}, nil
+	}
+	rec, err := h.service.TransferURL(token, req.ShortKey, input)
+	if errors.Is(err, errorapp.ErrorQuotaExceeded) {
+		return nil, quotaError(ctx, err)
+	}
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.TransferURLResponse{Url: newURLMapping(rec, time.Now())}, nil
+}
+
+// ListTransfers - возвращает предложения передачи ссылок, отправленные пользователем и ему.
+func (h *HandlerService) ListTransfers(ctx context.Context, req *pb.ListTransfersRequest) (*pb.ListTransfersResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	offers, err := h.service.ListTransfers(token)
+	if err != nil {
+		return nil, urlError(err)
+	}
+	result := &pb.ListTransfersResponse{Offers: make([]*pb.TransferOffer, 0, len(offers))}
+	for _, offer := range offers {
+		result.Offers = append(result.Offers, newTransferOffer(offer))
+	}
+	return result, nil
+}
+
+// AcceptTransfer - принимает предложение передать пользователю ссылку short_key.
+// Если у пользователя исчерпана квота действующих ссылок, возвращается ResourceExhausted.
+func (h *HandlerService) AcceptTransfer(ctx context.Context, req *pb.TransferRequest) (*pb.TransferURLResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	rec, err := h.service.AcceptTransfer(token, req.ShortKey)
+	if errors.Is(err, errorapp.ErrorQuotaExceeded) {
+		return nil, quotaError(ctx, err)
+	}
+	if err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.TransferURLResponse{Url: newURLMapping(rec, time.Now())}, nil
+}
+
+// DeclineTransfer - отклоняет (получатель) или отзывает (отправитель) предложение передачи ссылки short_key.
+func (h *HandlerService) DeclineTransfer(ctx context.Context, req *pb.TransferRequest) (*pb.DeclineTransferResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	if err := h.service.DeclineTransfer(token, req.ShortKey); err != nil {
+		return nil, urlError(err)
+	}
+	return &pb.DeclineTransferResponse{Success: true}, nil
+}
+
+// newTransferOffer - собирает сообщение pb.TransferOffer по предложению передачи ссылки.
+func newTransferOffer(offer schema.TransferOffer) *pb.TransferOffer {
+	return &pb.TransferOffer{
+		ShortKey:  offer.ShortKey,
+		FromUser:  offer.FromUserID,
+		ToUser:    offer.ToUserID,
+		CreatedAt: timestamppb.New(offer.CreatedAt),
 	}
-	return &pb.APIUserAllURLsResponse{Urls: result}, nil
+}
+
+// Quota - возвращает квоты пользователя (или рабочего пространства) на создание ссылок и их использование.
+// Для квоты без ограничения limit равен 0, а remaining - -1.
+func (h *HandlerService) Quota(ctx context.Context, req *pb.QuotaRequest) (*pb.QuotaResponse, error) {
+	token := getToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "пользователь не авторизован;")
+	}
+	quota, err := h.service.Quota(token, h.clientIP(ctx, ""))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ошибка при получении квот %v;", err)
+	}
+	return &pb.QuotaResponse{
+		Tier:    quota.Tier,
+		Daily:   newQuotaCounter(quota.Daily),
+		ResetAt: timestamppb.New(quota.ResetAt),
+		Active:  newQuotaCounter(quota.Active),
+	}, nil
+}
+
+// newQuotaCounter - собирает сообщение pb.QuotaCounter по использованию квоты.
+func newQuotaCounter(counter schema.QuotaCounter) *pb.QuotaCounter {
+	return &pb.QuotaCounter{Limit: int32(counter.Limit), Used: int32(counter.Used), Remaining: int32(counter.Remaining)}
+}
+
+// quotaError - преобразует ошибку исчерпания квоты в ResourceExhausted. Для суточной квоты время до ее сброса
+// в секундах передается в метаданных retry-after.
+func quotaError(ctx context.Context, err error) error {
+	var errQuota *errorapp.QuotaExceededError
+	if errors.As(err, &errQuota) && errQuota.Quota == errorapp.QuotaDaily {
+		md := metadata.Pairs("retry-after", ratelimit.RetryAfter(time.Until(errQuota.ResetAt)))
+		if err := grpc.SetHeader(ctx, md); err != nil {
+			log.Println("не удалось передать retry-after;", err)
+		}
+	}
+	return status.Error(codes.ResourceExhausted, err.Error())
+}
+
+// urlError - преобразует ошибку операции со ссылкой пользователя в ошибку gRPC.
+func urlError(err error) error {
+	switch {
+	case errors.Is(err, errorapp.ErrorURLNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errorapp.ErrorAccessDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, errorapp.ErrorFolderNotFound), errors.Is(err, errorapp.ErrorCampaignNotFound),
+		errors.Is(err, errorapp.ErrorRuleNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errorapp.IsInvalidInput(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, errorapp.ErrorWorkspaceNotFound), errors.Is(err, errorapp.ErrorMemberNotFound),
+		errors.Is(err, errorapp.ErrorTransferNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errorapp.ErrorWorkspaceRole):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return status.Errorf(codes.Internal, "ошибка при операции со ссылкой %v;", err)
+	}
+}
+
+// newURLMapping - собирает сообщение pb.URLMapping по записи хранилища.
+func newURLMapping(rec schema.URLRecord, now time.Time) *pb.URLMapping {
+	m := &pb.URLMapping{
+		CorrelationId:       rec.ShortKey,
+		OriginalUrl:         rec.FullURL,
+		Status:              rec.Status(now),
+		Title:               rec.Title,
+		Note:                rec.Note,
+		Tags:                rec.Tags,
+		FolderId:            rec.FolderID,
+		ForcePreview:        rec.ForcePreview,
+		RedirectType:        int32(rec.RedirectType),
+		Passthrough:         rec.Passthrough,
+		PassthroughConflict: rec.PassthroughConflict,
+		CampaignId:          rec.CampaignID,
+		Clicks:              rec.Clicks,
+		Rules:               newRedirectRules(rec.Rules),
+		Targets:             newSplitTargets(rec.Targets),
+		DisabledReason:      rec.DisabledReason,
+		CreatedAt:           timestamppb.New(rec.CreatedAt),
+		UpdatedAt:           timestamppb.New(rec.UpdatedAt),
+	}
+	if rec.DeletedAt != nil {
+		m.DeletedAt = timestamppb.New(*rec.DeletedAt)
+	}
+	if rec.ExpiresAt != nil {
+		m.ExpiresAt = timestamppb.New(*rec.ExpiresAt)
+	}
+	if rec.ActiveFrom != nil {
+		m.ActiveFrom = timestamppb.New(*rec.ActiveFrom)
+	}
+	return m
 }
 
 // APIDeleteUrls - принимает запрос на удаление URLs. Удаление возможно только для URLs добавленных пользователем.
@@ -151,9 +812,7 @@ func (h *HandlerService) APIDeleteUrls(ctx context.Context, req *pb.APIDeleteUrl
 
 // APIInternalStats - возвращает статистику сервера
 func (h *HandlerService) APIInternalStats(ctx context.Context, req *pb.APIInternalStatsRequest) (*pb.APIInternalStatsResponse, error) {
-	p, _ := peer.FromContext(ctx)
-	remoteAddr := p.Addr.String()
-	if !h.isTrustedSubnet(remoteAddr) {
+	if !h.ips.Trusted(h.clientIP(ctx, "")) {
 		return nil, status.Error(codes.PermissionDenied, "метод не доступен")
 	}
 	// получаем статистику
@@ -165,17 +824,34 @@ func (h *HandlerService) APIInternalStats(ctx context.Context, req *pb.APIIntern
 }
 
 // TokenHandler - выдает токен пользователю
+// Действительный токен возвращается обратно, а если срок его действия подходит к концу, он старого формата
+// или подписан прежним ключом - заменяется новым токеном того же пользователя. Истекший токен отклоняется с кодом Unauthenticated,
+// для получения токена нового пользователя запрос отправляется без токена.
 func (h *HandlerService) TokenHandler(ctx context.Context, req *pb.TokenHandlerRequest) (*pb.TokenHandlerResponse, error) {
-	// если токен во входящей структуре верный просто возвращаем его обратно
-	if req.Token != "" && h.service.CheckToken(req.Token) {
-		return &pb.TokenHandlerResponse{Token: req.Token}, nil
+	var claims token.Claims
+	err := errorapp.ErrorTokenInvalid
+	if req.Token != "" {
+		claims, err = h.service.ParseToken(req.Token)
+	}
+	if errors.Is(err, errorapp.ErrorTokenExpired) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	newToken := req.Token
+	switch {
+	case err != nil:
+		// выдаем токен нового пользователя
+		newToken, claims, err = h.service.NewUserToken()
+	case h.service.TokenNeedsRefresh(claims):
+		newToken, claims, err = h.service.RefreshToken(req.Token)
 	}
-	// иначе выдаем новый токен
-	newToken, err := h.service.GenerateNewToken()
 	if err != nil {
 		return nil, status.Error(codes.Internal, "ошибка при создании токена;")
 	}
-	return &pb.TokenHandlerResponse{Token: newToken}, nil
+	resp := &pb.TokenHandlerResponse{Token: newToken}
+	if !claims.Legacy {
+		resp.ExpiresAt = timestamppb.New(claims.Expires())
+	}
+	return resp, nil
 }
 
 // createLink - метод создает короткую ссылку на основе ключа
@@ -183,66 +859,203 @@ func (h *HandlerService) createLink(shortKey string) (string, error) {
 	return url.JoinPath(h.baseURL, shortKey)
 }
 
+// userKey - ключ контекста запроса, под которым хранится идентификатор пользователя.
+type userKey struct{}
+
+// withUser - возвращает контекст запроса, выполняемого от имени пользователя userID (см. getToken).
+func withUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
 // tokenInterceptor - перехватчик проверяет наличие и валидность токена
+// и помещает идентификатор пользователя запроса в контекст (см. getToken).
 func (h *HandlerService) tokenInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	// Исключаем методы TokenHandler, ShortToURL из проверки токена и
-	log.Println(info.FullMethod)
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		md = metadata.MD{}
+	}
+
+	// Исключаем методы TokenHandler, ShortToURL, QRCode из проверки токена;
+	// действительный токен учитывается только при ограничении частоты запросов
 	if slices.Contains(
-		[]string{"/server.HandlerService/TokenHandler", "/server.HandlerService/ShortToURL"},
+		[]string{pb.HandlerService_TokenHandler_FullMethodName, pb.HandlerService_ShortToURL_FullMethodName, pb.HandlerService_QRCode_FullMethodName},
 		info.FullMethod,
 	) {
+		if values := md.Get("token"); len(values) > 0 {
+			if claims, err := h.service.ParseToken(values[0]); err == nil {
+				ctx = withUser(ctx, claims.UserID)
+			}
+		}
+		if err := h.rateLimit(ctx, info.FullMethod, req); err != nil {
+			return nil, err
+		}
 		return handler(ctx, req)
 	}
 
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return nil, status.Error(codes.Internal, "Failed to get metadata from context")
+	// запрос с ключом API выполняется от имени владельца ключа
+	if values := md.Get("authorization"); len(values) > 0 {
+		var err error
+		ctx, err = h.apiKeyContext(ctx, values[0], info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Проверка наличия токена в метаданных
+		values := md.Get("token")
+		if len(values) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "Token is missing")
+		}
+		claims, err := h.service.ParseToken(values[0])
+		if errors.Is(err, errorapp.ErrorTokenExpired) {
+			return nil, status.Error(codes.Unauthenticated, "Token is expired")
+		} else if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "Token is invalid")
+		}
+		ctx = withUser(ctx, claims.UserID)
+	}
+
+	if err := h.rateLimit(ctx, info.FullMethod, req); err != nil {
+		return nil, err
 	}
 
-	// Проверка наличия токена в метаданных
-	values := md.Get("token")
-	if len(values) == 0 {
-		return nil, status.Error(codes.Unauthenticated, "Token is missing")
+	// методы AdminService доступны только администраторам и не выполняются от имени рабочего пространства
+	if adminMethod(info.FullMethod) {
+		if err := h.checkAdmin(ctx, md); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
 	}
-	token := values[0]
-	if !h.service.CheckToken(token) {
-		return nil, status.Error(codes.Unauthenticated, "Token is invalid")
+
+	// запрос с метаданными workspace выполняется от имени рабочего пространства
+	if values := md.Get("workspace"); len(values) > 0 && values[0] != "" {
+		var err error
+		ctx, err = h.workspaceContext(ctx, values[0], info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return handler(ctx, req)
 }
 
-// isTrustedSubnet - проверяет входит ли IP-адрес в доверительную подсеть сервера
-func (h *HandlerService) isTrustedSubnet(remoteAddr string) bool {
-	if h.trustedSubnet == nil {
-		return false
+// workspaceContext - проверяет роль пользователя в рабочем пространстве workspaceID для метода fullMethod
+// и возвращает контекст запроса, выполняемого от имени пространства.
+// Участнику с ролью viewer доступны только методы чтения (readMethods). Пользователю, не состоящему
+// в пространстве, отвечает NotFound, при недостаточной роли - PermissionDenied.
+func (h *HandlerService) workspaceContext(ctx context.Context, workspaceID, fullMethod string) (context.Context, error) {
+	if fullMethod == pb.HandlerService_TransferURL_FullMethodName {
+		return ctx, status.Error(codes.InvalidArgument, "метод не выполняется от имени рабочего пространства;")
 	}
-	// Парсим IP-адрес из Request.RemoteAddr
-	host, _, err := net.SplitHostPort(remoteAddr)
-	if err != nil {
-		log.Println("Error splitting host and port:", err)
-		// return false // возможно строка не содержит порт, проверяем дальше
-		host = remoteAddr
+	role, err := h.service.WorkspaceRole(workspaceID, getToken(ctx))
+	if errors.Is(err, errorapp.ErrorWorkspaceNotFound) {
+		return ctx, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return ctx, status.Error(codes.Internal, "ошибка при проверке участника рабочего пространства;")
 	}
-	IP := net.ParseIP(host)
-	if IP == nil {
-		log.Println("Error parsing IP address:", err)
-		return false
+	if !slices.Contains(readMethods, fullMethod) && !schema.RoleCanWrite(role) {
+		return ctx, status.Error(codes.PermissionDenied, errorapp.ErrorWorkspaceRole.Error())
 	}
+	return withUser(ctx, workspaceID), nil
+}
 
-	// Проверяем входит ли IP-адрес в доверительную подсеть
-	return h.trustedSubnet.Contains(IP)
+// readMethods - методы, доступные по ключу API с областью действия schema.ScopeRead.
+// Для методов AdminService нужна область schema.ScopeAdmin, для остальных - schema.ScopeWrite.
+var readMethods = []string{
+	pb.HandlerService_Ping_FullMethodName,
+	pb.HandlerService_APIUserAllURLs_FullMethodName,
+	pb.HandlerService_APIInternalStats_FullMethodName,
+	pb.HandlerService_ListTags_FullMethodName,
+	pb.HandlerService_ListTransfers_FullMethodName,
+	pb.HandlerService_ListFolders_FullMethodName,
+	pb.HandlerService_ListCampaigns_FullMethodName,
+	pb.HandlerService_ListRules_FullMethodName,
+	pb.HandlerService_ListTargets_FullMethodName,
 }
 
-// getToken - возвращает токен из контекста, если он есть.
-func getToken(ctx context.Context) string {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return ""
+// apiKeyContext - проверяет ключ API из метаданных authorization ("Bearer <ключ>") и его область действия для метода
+// fullMethod. Возвращает контекст запроса, выполняемого от имени владельца ключа.
+// Недействительный ключ отклоняется с кодом Unauthenticated, ключ без нужной области действия - PermissionDenied.
+func (h *HandlerService) apiKeyContext(ctx context.Context, authorization, fullMethod string) (context.Context, error) {
+	scheme, raw, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ctx, status.Error(codes.Unauthenticated, "ожидается авторизация Bearer")
 	}
-	// получение токена
-	values := md.Get("token")
-	if len(values) == 0 {
+	key, err := h.service.AuthenticateAPIKey(strings.TrimSpace(raw))
+	if errors.Is(err, errorapp.ErrorAPIKeyRejected) {
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	} else if err != nil {
+		return ctx, status.Error(codes.Internal, "ошибка при проверке ключа API;")
+	}
+	scope := schema.ScopeWrite
+	switch {
+	case adminMethod(fullMethod):
+		scope = schema.ScopeAdmin
+	case slices.Contains(readMethods, fullMethod):
+		scope = schema.ScopeRead
+	}
+	if !key.HasScope(scope) {
+		return ctx, status.Error(codes.PermissionDenied, errorapp.ErrorInsufficientScope.Error())
+	}
+	return withUser(ctx, key.UserID), nil
+}
+
+// clientIP - возвращает IP-адрес клиента без порта по адресу соединения и метаданным запроса
+// forwarded, x-forwarded-for и x-real-ip. Адрес realIP из запроса (client_ip) передается как x-real-ip.
+// Метаданные и realIP учитываются, только если соединение установлено с доверенного прокси (TRUSTED_PROXIES).
+func (h *HandlerService) clientIP(ctx context.Context, realIP string) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
 		return ""
 	}
-	return values[0]
+	md, _ := metadata.FromIncomingContext(ctx)
+	if realIP != "" {
+		md = md.Copy()
+		md.Set(clientip.HeaderRealIP, realIP)
+	}
+	return h.ips.ClientIP(p.Addr.String(), md.Get)
+}
+
+// methodClasses - классы методов для ограничения частоты запросов.
+var methodClasses = map[string]string{
+	pb.HandlerService_URLtoShort_FullMethodName:       ratelimit.ClassCreate,
+	pb.HandlerService_APIShortenBatch_FullMethodName:  ratelimit.ClassBatch,
+	pb.HandlerService_ShortToURL_FullMethodName:       ratelimit.ClassRedirect,
+	pb.HandlerService_APIDeleteUrls_FullMethodName:    ratelimit.ClassDelete,
+	pb.HandlerService_DeleteFolderURLs_FullMethodName: ratelimit.ClassDelete,
+}
+
+// rateLimit - ограничивает частоту вызовов методов создания, пакетного создания, удаления ссылок и перехода
+// по ссылке (RATE_LIMIT_*). Зарегистрированные пользователи ограничиваются по учетной записи, анонимные - по IP-адресу
+// (для ShortToURL с учетом client_ip от доверенного прокси).
+// При превышении лимита возвращает ResourceExhausted и передает время ожидания в секундах в метаданных retry-after.
+func (h *HandlerService) rateLimit(ctx context.Context, fullMethod string, req interface{}) error {
+	class := methodClasses[fullMethod]
+	if !h.limiter.Enabled(class) {
+		return nil
+	}
+	realIP := ""
+	if r, ok := req.(*pb.ShortToURLRequest); ok {
+		realIP = r.ClientIp
+	}
+	key := ratelimit.IPKey(h.clientIP(ctx, realIP))
+	if userID := getToken(ctx); userID != "" {
+		if _, err := h.service.Account(userID); err == nil {
+			key = ratelimit.UserKey(userID)
+		}
+	}
+	ok, retryAfter := h.limiter.Allow(class, key)
+	if ok {
+		return nil
+	}
+	if err := grpc.SetHeader(ctx, metadata.Pairs("retry-after", ratelimit.RetryAfter(retryAfter))); err != nil {
+		log.Println("не удалось передать retry-after;", err)
+	}
+	return status.Error(codes.ResourceExhausted, errorapp.ErrorRateLimited.Error())
+}
+
+// getToken - возвращает идентификатор пользователя, от имени которого выполняется запрос.
+// Идентификатор помещается в контекст в tokenInterceptor после проверки токена из метаданных token
+// (или ключа API) и заменяется в workspaceContext идентификатором рабочего пространства.
+func getToken(ctx context.Context) string {
+	userID, _ := ctx.Value(userKey{}).(string)
+	return userID
 }
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/bubu256/go-url-shortener-server/config"
+	pb "github.com/bubu256/go-url-shortener-server/internal/app/proto"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/bubu256/go-url-shortener-server/internal/app/shortener"
+	"github.com/bubu256/go-url-shortener-server/pkg/storage/mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// testKey - ключ подписи токенов тестового сервиса в hex.
+const testKey = "000102030405060708090a0b0c0d0e0f000102030405060708090a0b0c0d0e0f"
+
+// testService - gRPC сервис с хранилищем в памяти для тестов.
+type testService struct {
+	t       *testing.T
+	service *shortener.Shortener
+	handler *HandlerService
+}
+
+// newTestService - создает тестовый gRPC сервис; setup изменяет конфигурацию до создания сервиса.
+func newTestService(t *testing.T, setup ...func(cfg *config.Configuration)) *testService {
+	cfg := config.New()
+	cfg.Server.BaseURL = "http://example.com"
+	cfg.Service.SecretKey = testKey
+	for _, f := range setup {
+		f(&cfg)
+	}
+	service := shortener.New(mem.NewMapDBMutex(cfg.DB, nil), cfg.Service)
+	handler, _ := New(service, cfg.Server)
+	return &testService{t: t, service: service, handler: handler}
+}
+
+// register - регистрирует учетную запись username и возвращает ее токен и идентификатор пользователя.
+func (s *testService) register(username string) (string, string) {
+	s.t.Helper()
+	account, err := s.service.Register(schema.APIRegisterInput{Username: username, Password: "password123"})
+	require.NoError(s.t, err)
+	raw, _, err := s.service.UserToken(account.ID)
+	require.NoError(s.t, err)
+	return raw, account.ID
+}
+
+// call - вызывает метод method через tokenInterceptor с метаданными md (пары ключ-значение).
+// Возвращает идентификатор пользователя, от имени которого выполнен бы метод, и ошибку перехватчика.
+func (s *testService) call(method string, md ...string) (string, error) {
+	userID, _, err := s.callFrom("", method, md...)
+	return userID, err
+}
+
+// callFrom - вызывает метод method как call с адреса соединения remoteAddr (пусто - без адреса).
+// Дополнительно возвращает метаданные ответа.
+func (s *testService) callFrom(remoteAddr, method string, md ...string) (string, metadata.MD, error) {
+	s.t.Helper()
+	ctx := context.Background()
+	if len(md) > 0 {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(md...))
+	}
+	if remoteAddr != "" {
+		addr, err := net.ResolveTCPAddr("tcp", remoteAddr)
+		require.NoError(s.t, err)
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+	stream := &transportStream{method: method}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+	userID := ""
+	_, err := s.handler.tokenInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			userID = getToken(ctx)
+			return nil, nil
+		})
+	return userID, stream.header, err
+}
+
+// transportStream - поток сервера, запоминающий метаданные ответа.
+type transportStream struct {
+	method string
+	header metadata.MD
+}
+
+func (s *transportStream) Method() string { return s.method }
+
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *transportStream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+
+func (s *transportStream) SetTrailer(md metadata.MD) error { return nil }
+
+// legacyToken - создает токен старого формата пользователя id, подписанный ключом testKey.
+func legacyToken(t *testing.T, id []byte) string {
+	key, err := hex.DecodeString(testKey)
+	require.NoError(t, err)
+	h := hmac.New(sha256.New, key)
+	h.Write(id)
+	return hex.EncodeToString(append(append([]byte{}, id...), h.Sum(nil)...))
+}
+
+func TestTokenInterceptor(t *testing.T) {
+	srv := newTestService(t)
+	userToken, userID := srv.register("alice")
+	_, otherID := srv.register("bob")
+	readKey, err := srv.service.CreateAPIKey(otherID, schema.APIKeyInput{Name: "ci", Scopes: []string{schema.ScopeRead}})
+	require.NoError(t, err)
+	writeKey, err := srv.service.CreateAPIKey(otherID, schema.APIKeyInput{Name: "deploy"})
+	require.NoError(t, err)
+	workspace, err := srv.service.CreateWorkspace(userID, schema.APIWorkspaceInput{Name: "team"})
+	require.NoError(t, err)
+	anonToken, anon, err := srv.service.NewUserToken()
+	require.NoError(t, err)
+	legacy := legacyToken(t, []byte{1, 2, 3, 4})
+
+	write := pb.HandlerService_URLtoShort_FullMethodName
+	read := pb.HandlerService_APIUserAllURLs_FullMethodName
+	tests := []struct {
+		name     string
+		method   string
+		md       []string
+		wantUser string
+		wantCode codes.Code
+	}{
+		{name: "без метаданных", method: write, wantCode: codes.Unauthenticated},
+		{name: "без токена", method: write, md: []string{"workspace", workspace.ID}, wantCode: codes.Unauthenticated},
+		{name: "поддельный токен", method: write, md: []string{"token", "v1.x.y.z"}, wantCode: codes.Unauthenticated},
+		{name: "идентификатор вместо токена", method: write, md: []string{"token", userID}, wantCode: codes.Unauthenticated},
+		{name: "токен пользователя", method: write, md: []string{"token", userToken}, wantUser: userID},
+		{name: "токен анонимного пользователя", method: read, md: []string{"token", anonToken}, wantUser: anon.UserID},
+		{name: "токен старого формата", method: read, md: []string{"token", legacy}, wantUser: legacy},
+		{name: "ключ API", method: write, md: []string{"authorization", "Bearer " + writeKey.Key}, wantUser: otherID},
+		{name: "ключ API важнее токена", method: read, md: []string{"authorization", "Bearer " + readKey.Key, "token", userToken},
+			wantUser: otherID},
+		{name: "ключ API без области write", method: write, md: []string{"authorization", "Bearer " + readKey.Key},
+			wantCode: codes.PermissionDenied},
+		{name: "неизвестный ключ API", method: read, md: []string{"authorization", "Bearer sk_unknown"}, wantCode: codes.Unauthenticated},
+		{name: "авторизация не Bearer", method: read, md: []string{"authorization", "Basic " + writeKey.Key},
+			wantCode: codes.Unauthenticated},
+		{name: "рабочее пространство", method: write, md: []string{"token", userToken, "workspace", workspace.ID},
+			wantUser: workspace.ID},
+		{name: "чужое рабочее пространство", method: read, md: []string{"authorization", "Bearer " + writeKey.Key, "workspace", workspace.ID},
+			wantCode: codes.NotFound},
+		// методы без проверки токена выполняются и без него, недействительный токен не учитывается
+		{name: "переход без токена", method: pb.HandlerService_ShortToURL_FullMethodName},
+		{name: "переход с токеном", method: pb.HandlerService_ShortToURL_FullMethodName, md: []string{"token", userToken},
+			wantUser: userID},
+		{name: "переход с поддельным токеном", method: pb.HandlerService_ShortToURL_FullMethodName, md: []string{"token", userID}},
+		{name: "выдача токена без токена", method: pb.HandlerService_TokenHandler_FullMethodName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser, err := srv.call(tt.method, tt.md...)
+			assert.Equal(t, tt.wantCode, status.Code(err), err)
+			if tt.wantCode == codes.OK {
+				assert.Equal(t, tt.wantUser, gotUser)
+			}
+		})
+	}
+}
+
+func TestTokenInterceptor_Expired(t *testing.T) {
+	srv := newTestService(t, func(cfg *config.Configuration) {
+		cfg.Service.LegacyTokensUntil = "2000-01-01"
+	})
+	_, err := srv.call(pb.HandlerService_APIUserAllURLs_FullMethodName, "token", legacyToken(t, []byte{1, 2, 3, 4}))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "expired")
+
+	// токен со сроком действия меньше секунды истекает сразу после выдачи
+	srv = newTestService(t, func(cfg *config.Configuration) {
+		cfg.Service.TokenTTL = 1
+	})
+	raw, _, err := srv.service.NewUserToken()
+	require.NoError(t, err)
+	_, err = srv.call(pb.HandlerService_APIUserAllURLs_FullMethodName, "token", raw)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "expired")
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := newTestService(t, func(cfg *config.Configuration) {
+		cfg.Server.RateLimitCreate = "1/1m"
+	})
+	aliceToken, _ := srv.register("alice")
+	anonToken, _, err := srv.service.NewUserToken()
+	require.NoError(t, err)
+	otherToken, _, err := srv.service.NewUserToken()
+	require.NoError(t, err)
+	create := pb.HandlerService_URLtoShort_FullMethodName
+
+	// анонимные пользователи ограничиваются по IP-адресу, новый токен ограничение не сбрасывает
+	_, _, err = srv.callFrom("198.51.100.1:1000", create, "token", anonToken)
+	require.NoError(t, err)
+	_, header, err := srv.callFrom("198.51.100.1:2000", create, "token", otherToken)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Len(t, header.Get("retry-after"), 1)
+	retryAfter, err := strconv.Atoi(header.Get("retry-after")[0])
+	require.NoError(t, err)
+	assert.True(t, retryAfter >= 1 && retryAfter <= 60, "retry-after = %d", retryAfter)
+	_, _, err = srv.callFrom("198.51.100.2:1000", create, "token", anonToken)
+	assert.NoError(t, err)
+
+	// учетная запись ограничивается независимо от адреса
+	_, _, err = srv.callFrom("198.51.100.1:1000", create, "token", aliceToken)
+	require.NoError(t, err)
+	_, header, err = srv.callFrom("198.51.100.3:1000", create, "token", aliceToken)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.NotEmpty(t, header.Get("retry-after"))
+
+	// методы без ограничения не учитываются
+	_, header, err = srv.callFrom("198.51.100.1:1000", pb.HandlerService_APIUserAllURLs_FullMethodName, "token", anonToken)
+	assert.NoError(t, err)
+	assert.Empty(t, header.Get("retry-after"))
+}
+
+func TestCheckAdmin(t *testing.T) {
+	setup := func(cfg *config.Configuration) {
+		cfg.Server.TrustedSubnet = "192.0.2.0/24"
+		cfg.Service.AdminUsers = []string{"root"}
+	}
+	srv := newTestService(t, setup)
+	rootToken, rootID := srv.register("root")
+	bobToken, _ := srv.register("bob")
+	anonToken, _, err := srv.service.NewUserToken()
+	require.NoError(t, err)
+	adminKey, err := srv.service.CreateAPIKey(rootID, schema.APIKeyInput{Name: "ops", Scopes: []string{schema.ScopeAdmin}})
+	require.NoError(t, err)
+	readKey, err := srv.service.CreateAPIKey(rootID, schema.APIKeyInput{Name: "ci", Scopes: []string{schema.ScopeRead}})
+	require.NoError(t, err)
+	workspace, err := srv.service.CreateWorkspace(rootID, schema.APIWorkspaceInput{Name: "ops"})
+	require.NoError(t, err)
+
+	stats := pb.AdminService_Stats_FullMethodName
+	tests := []struct {
+		name     string
+		md       []string
+		wantCode codes.Code
+	}{
+		{name: "без токена", wantCode: codes.Unauthenticated},
+		{name: "анонимный пользователь", md: []string{"token", anonToken}, wantCode: codes.Unauthenticated},
+		{name: "не администратор", md: []string{"token", bobToken}, wantCode: codes.PermissionDenied},
+		{name: "от имени пространства", md: []string{"token", rootToken, "workspace", workspace.ID}, wantCode: codes.PermissionDenied},
+		{name: "ключ API без области admin", md: []string{"authorization", "Bearer " + readKey.Key}, wantCode: codes.PermissionDenied},
+		{name: "ключ API с областью admin", md: []string{"authorization", "Bearer " + adminKey.Key}},
+		{name: "администратор", md: []string{"token", rootToken}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := srv.callFrom("198.51.100.1:1000", stats, tt.md...)
+			assert.Equal(t, tt.wantCode, status.Code(err), err)
+		})
+	}
+
+	// с ADMIN_TRUSTED_SUBNET_ONLY администратор допускается только из доверительной подсети
+	srv = newTestService(t, setup, func(cfg *config.Configuration) {
+		cfg.Server.AdminTrustedSubnetOnly = true
+	})
+	rootToken, _ = srv.register("root")
+	_, _, err = srv.callFrom("198.51.100.1:1000", stats, "token", rootToken)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, _, err = srv.callFrom("192.0.2.10:1000", stats, "token", rootToken)
+	assert.NoError(t, err)
+	_, _, err = srv.callFrom("", stats, "token", rootToken)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestShortToURL_Disabled(t *testing.T) {
+	srv := newTestService(t)
+	_, userID := srv.register("alice")
+	key, err := srv.service.CreateShortKey("https://example.org/", userID, "")
+	require.NoError(t, err)
+	_, err = srv.service.DisableURL(key, "фишинг")
+	require.NoError(t, err)
+
+	// отключенная ссылка не выдается, причина отключения передается в сообщении
+	_, err = srv.handler.ShortToURL(context.Background(), &pb.ShortToURLRequest{ShortKey: key})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, "фишинг", status.Convert(err).Message())
+
+	_, err = srv.service.EnableURL(key)
+	require.NoError(t, err)
+	resp, err := srv.handler.ShortToURL(context.Background(), &pb.ShortToURLRequest{ShortKey: key})
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org/", resp.FullUrl)
+}
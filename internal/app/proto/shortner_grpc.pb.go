@@ -27,6 +27,30 @@ const (
 	HandlerService_APIDeleteUrls_FullMethodName    = "/proto.HandlerService/APIDeleteUrls"
 	HandlerService_APIInternalStats_FullMethodName = "/proto.HandlerService/APIInternalStats"
 	HandlerService_TokenHandler_FullMethodName     = "/proto.HandlerService/TokenHandler"
+	HandlerService_UpdateURL_FullMethodName        = "/proto.HandlerService/UpdateURL"
+	HandlerService_AddTags_FullMethodName          = "/proto.HandlerService/AddTags"
+	HandlerService_RemoveTags_FullMethodName       = "/proto.HandlerService/RemoveTags"
+	HandlerService_ListTags_FullMethodName         = "/proto.HandlerService/ListTags"
+	HandlerService_CreateFolder_FullMethodName     = "/proto.HandlerService/CreateFolder"
+	HandlerService_ListFolders_FullMethodName      = "/proto.HandlerService/ListFolders"
+	HandlerService_DeleteFolder_FullMethodName     = "/proto.HandlerService/DeleteFolder"
+	HandlerService_DeleteFolderURLs_FullMethodName = "/proto.HandlerService/DeleteFolderURLs"
+	HandlerService_QRCode_FullMethodName           = "/proto.HandlerService/QRCode"
+	HandlerService_CreateCampaign_FullMethodName   = "/proto.HandlerService/CreateCampaign"
+	HandlerService_ListCampaigns_FullMethodName    = "/proto.HandlerService/ListCampaigns"
+	HandlerService_DeleteCampaign_FullMethodName   = "/proto.HandlerService/DeleteCampaign"
+	HandlerService_ListRules_FullMethodName        = "/proto.HandlerService/ListRules"
+	HandlerService_SetRules_FullMethodName         = "/proto.HandlerService/SetRules"
+	HandlerService_AddRule_FullMethodName          = "/proto.HandlerService/AddRule"
+	HandlerService_UpdateRule_FullMethodName       = "/proto.HandlerService/UpdateRule"
+	HandlerService_DeleteRule_FullMethodName       = "/proto.HandlerService/DeleteRule"
+	HandlerService_ListTargets_FullMethodName      = "/proto.HandlerService/ListTargets"
+	HandlerService_SetTargets_FullMethodName       = "/proto.HandlerService/SetTargets"
+	HandlerService_TransferURL_FullMethodName      = "/proto.HandlerService/TransferURL"
+	HandlerService_ListTransfers_FullMethodName    = "/proto.HandlerService/ListTransfers"
+	HandlerService_AcceptTransfer_FullMethodName   = "/proto.HandlerService/AcceptTransfer"
+	HandlerService_DeclineTransfer_FullMethodName  = "/proto.HandlerService/DeclineTransfer"
+	HandlerService_Quota_FullMethodName            = "/proto.HandlerService/Quota"
 )
 
 // HandlerServiceClient is the client API for HandlerService service.
@@ -41,6 +65,30 @@ type HandlerServiceClient interface {
 	APIDeleteUrls(ctx context.Context, in *APIDeleteUrlsRequest, opts ...grpc.CallOption) (*APIDeleteUrlsResponse, error)
 	APIInternalStats(ctx context.Context, in *APIInternalStatsRequest, opts ...grpc.CallOption) (*APIInternalStatsResponse, error)
 	TokenHandler(ctx context.Context, in *TokenHandlerRequest, opts ...grpc.CallOption) (*TokenHandlerResponse, error)
+	UpdateURL(ctx context.Context, in *UpdateURLRequest, opts ...grpc.CallOption) (*UpdateURLResponse, error)
+	AddTags(ctx context.Context, in *ChangeTagsRequest, opts ...grpc.CallOption) (*ChangeTagsResponse, error)
+	RemoveTags(ctx context.Context, in *ChangeTagsRequest, opts ...grpc.CallOption) (*ChangeTagsResponse, error)
+	ListTags(ctx context.Context, in *ListTagsRequest, opts ...grpc.CallOption) (*ListTagsResponse, error)
+	CreateFolder(ctx context.Context, in *CreateFolderRequest, opts ...grpc.CallOption) (*CreateFolderResponse, error)
+	ListFolders(ctx context.Context, in *ListFoldersRequest, opts ...grpc.CallOption) (*ListFoldersResponse, error)
+	DeleteFolder(ctx context.Context, in *DeleteFolderRequest, opts ...grpc.CallOption) (*DeleteFolderResponse, error)
+	DeleteFolderURLs(ctx context.Context, in *DeleteFolderRequest, opts ...grpc.CallOption) (*DeleteFolderResponse, error)
+	QRCode(ctx context.Context, in *QRCodeRequest, opts ...grpc.CallOption) (*QRCodeResponse, error)
+	CreateCampaign(ctx context.Context, in *CreateCampaignRequest, opts ...grpc.CallOption) (*CreateCampaignResponse, error)
+	ListCampaigns(ctx context.Context, in *ListCampaignsRequest, opts ...grpc.CallOption) (*ListCampaignsResponse, error)
+	DeleteCampaign(ctx context.Context, in *DeleteCampaignRequest, opts ...grpc.CallOption) (*DeleteCampaignResponse, error)
+	ListRules(ctx context.Context, in *ListRulesRequest, opts ...grpc.CallOption) (*RulesResponse, error)
+	SetRules(ctx context.Context, in *SetRulesRequest, opts ...grpc.CallOption) (*RulesResponse, error)
+	AddRule(ctx context.Context, in *AddRuleRequest, opts ...grpc.CallOption) (*RuleResponse, error)
+	UpdateRule(ctx context.Context, in *UpdateRuleRequest, opts ...grpc.CallOption) (*RuleResponse, error)
+	DeleteRule(ctx context.Context, in *DeleteRuleRequest, opts ...grpc.CallOption) (*RulesResponse, error)
+	ListTargets(ctx context.Context, in *ListTargetsRequest, opts ...grpc.CallOption) (*TargetsResponse, error)
+	SetTargets(ctx context.Context, in *SetTargetsRequest, opts ...grpc.CallOption) (*TargetsResponse, error)
+	TransferURL(ctx context.Context, in *TransferURLRequest, opts ...grpc.CallOption) (*TransferURLResponse, error)
+	ListTransfers(ctx context.Context, in *ListTransfersRequest, opts ...grpc.CallOption) (*ListTransfersResponse, error)
+	AcceptTransfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*TransferURLResponse, error)
+	DeclineTransfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*DeclineTransferResponse, error)
+	Quota(ctx context.Context, in *QuotaRequest, opts ...grpc.CallOption) (*QuotaResponse, error)
 }
 
 type handlerServiceClient struct {
@@ -123,6 +171,222 @@ func (c *handlerServiceClient) TokenHandler(ctx context.Context, in *TokenHandle
 	return out, nil
 }
 
+func (c *handlerServiceClient) UpdateURL(ctx context.Context, in *UpdateURLRequest, opts ...grpc.CallOption) (*UpdateURLResponse, error) {
+	out := new(UpdateURLResponse)
+	err := c.cc.Invoke(ctx, HandlerService_UpdateURL_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) AddTags(ctx context.Context, in *ChangeTagsRequest, opts ...grpc.CallOption) (*ChangeTagsResponse, error) {
+	out := new(ChangeTagsResponse)
+	err := c.cc.Invoke(ctx, HandlerService_AddTags_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) RemoveTags(ctx context.Context, in *ChangeTagsRequest, opts ...grpc.CallOption) (*ChangeTagsResponse, error) {
+	out := new(ChangeTagsResponse)
+	err := c.cc.Invoke(ctx, HandlerService_RemoveTags_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) ListTags(ctx context.Context, in *ListTagsRequest, opts ...grpc.CallOption) (*ListTagsResponse, error) {
+	out := new(ListTagsResponse)
+	err := c.cc.Invoke(ctx, HandlerService_ListTags_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) CreateFolder(ctx context.Context, in *CreateFolderRequest, opts ...grpc.CallOption) (*CreateFolderResponse, error) {
+	out := new(CreateFolderResponse)
+	err := c.cc.Invoke(ctx, HandlerService_CreateFolder_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) ListFolders(ctx context.Context, in *ListFoldersRequest, opts ...grpc.CallOption) (*ListFoldersResponse, error) {
+	out := new(ListFoldersResponse)
+	err := c.cc.Invoke(ctx, HandlerService_ListFolders_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) DeleteFolder(ctx context.Context, in *DeleteFolderRequest, opts ...grpc.CallOption) (*DeleteFolderResponse, error) {
+	out := new(DeleteFolderResponse)
+	err := c.cc.Invoke(ctx, HandlerService_DeleteFolder_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) DeleteFolderURLs(ctx context.Context, in *DeleteFolderRequest, opts ...grpc.CallOption) (*DeleteFolderResponse, error) {
+	out := new(DeleteFolderResponse)
+	err := c.cc.Invoke(ctx, HandlerService_DeleteFolderURLs_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) QRCode(ctx context.Context, in *QRCodeRequest, opts ...grpc.CallOption) (*QRCodeResponse, error) {
+	out := new(QRCodeResponse)
+	err := c.cc.Invoke(ctx, HandlerService_QRCode_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) CreateCampaign(ctx context.Context, in *CreateCampaignRequest, opts ...grpc.CallOption) (*CreateCampaignResponse, error) {
+	out := new(CreateCampaignResponse)
+	err := c.cc.Invoke(ctx, HandlerService_CreateCampaign_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) ListCampaigns(ctx context.Context, in *ListCampaignsRequest, opts ...grpc.CallOption) (*ListCampaignsResponse, error) {
+	out := new(ListCampaignsResponse)
+	err := c.cc.Invoke(ctx, HandlerService_ListCampaigns_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) DeleteCampaign(ctx context.Context, in *DeleteCampaignRequest, opts ...grpc.CallOption) (*DeleteCampaignResponse, error) {
+	out := new(DeleteCampaignResponse)
+	err := c.cc.Invoke(ctx, HandlerService_DeleteCampaign_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) ListRules(ctx context.Context, in *ListRulesRequest, opts ...grpc.CallOption) (*RulesResponse, error) {
+	out := new(RulesResponse)
+	err := c.cc.Invoke(ctx, HandlerService_ListRules_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) SetRules(ctx context.Context, in *SetRulesRequest, opts ...grpc.CallOption) (*RulesResponse, error) {
+	out := new(RulesResponse)
+	err := c.cc.Invoke(ctx, HandlerService_SetRules_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) AddRule(ctx context.Context, in *AddRuleRequest, opts ...grpc.CallOption) (*RuleResponse, error) {
+	out := new(RuleResponse)
+	err := c.cc.Invoke(ctx, HandlerService_AddRule_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) UpdateRule(ctx context.Context, in *UpdateRuleRequest, opts ...grpc.CallOption) (*RuleResponse, error) {
+	out := new(RuleResponse)
+	err := c.cc.Invoke(ctx, HandlerService_UpdateRule_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) DeleteRule(ctx context.Context, in *DeleteRuleRequest, opts ...grpc.CallOption) (*RulesResponse, error) {
+	out := new(RulesResponse)
+	err := c.cc.Invoke(ctx, HandlerService_DeleteRule_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) ListTargets(ctx context.Context, in *ListTargetsRequest, opts ...grpc.CallOption) (*TargetsResponse, error) {
+	out := new(TargetsResponse)
+	err := c.cc.Invoke(ctx, HandlerService_ListTargets_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) SetTargets(ctx context.Context, in *SetTargetsRequest, opts ...grpc.CallOption) (*TargetsResponse, error) {
+	out := new(TargetsResponse)
+	err := c.cc.Invoke(ctx, HandlerService_SetTargets_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) TransferURL(ctx context.Context, in *TransferURLRequest, opts ...grpc.CallOption) (*TransferURLResponse, error) {
+	out := new(TransferURLResponse)
+	err := c.cc.Invoke(ctx, HandlerService_TransferURL_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) ListTransfers(ctx context.Context, in *ListTransfersRequest, opts ...grpc.CallOption) (*ListTransfersResponse, error) {
+	out := new(ListTransfersResponse)
+	err := c.cc.Invoke(ctx, HandlerService_ListTransfers_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) AcceptTransfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*TransferURLResponse, error) {
+	out := new(TransferURLResponse)
+	err := c.cc.Invoke(ctx, HandlerService_AcceptTransfer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) DeclineTransfer(ctx context.Context, in *TransferRequest, opts ...grpc.CallOption) (*DeclineTransferResponse, error) {
+	out := new(DeclineTransferResponse)
+	err := c.cc.Invoke(ctx, HandlerService_DeclineTransfer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *handlerServiceClient) Quota(ctx context.Context, in *QuotaRequest, opts ...grpc.CallOption) (*QuotaResponse, error) {
+	out := new(QuotaResponse)
+	err := c.cc.Invoke(ctx, HandlerService_Quota_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // HandlerServiceServer is the server API for HandlerService service.
 // All implementations must embed UnimplementedHandlerServiceServer
 // for forward compatibility
@@ -135,6 +399,30 @@ type HandlerServiceServer interface {
 	APIDeleteUrls(context.Context, *APIDeleteUrlsRequest) (*APIDeleteUrlsResponse, error)
 	APIInternalStats(context.Context, *APIInternalStatsRequest) (*APIInternalStatsResponse, error)
 	TokenHandler(context.Context, *TokenHandlerRequest) (*TokenHandlerResponse, error)
+	UpdateURL(context.Context, *UpdateURLRequest) (*UpdateURLResponse, error)
+	AddTags(context.Context, *ChangeTagsRequest) (*ChangeTagsResponse, error)
+	RemoveTags(context.Context, *ChangeTagsRequest) (*ChangeTagsResponse, error)
+	ListTags(context.Context, *ListTagsRequest) (*ListTagsResponse, error)
+	CreateFolder(context.Context, *CreateFolderRequest) (*CreateFolderResponse, error)
+	ListFolders(context.Context, *ListFoldersRequest) (*ListFoldersResponse, error)
+	DeleteFolder(context.Context, *DeleteFolderRequest) (*DeleteFolderResponse, error)
+	DeleteFolderURLs(context.Context, *DeleteFolderRequest) (*DeleteFolderResponse, error)
+	QRCode(context.Context, *QRCodeRequest) (*QRCodeResponse, error)
+	CreateCampaign(context.Context, *CreateCampaignRequest) (*CreateCampaignResponse, error)
+	ListCampaigns(context.Context, *ListCampaignsRequest) (*ListCampaignsResponse, error)
+	DeleteCampaign(context.Context, *DeleteCampaignRequest) (*DeleteCampaignResponse, error)
+	ListRules(context.Context, *ListRulesRequest) (*RulesResponse, error)
+	SetRules(context.Context, *SetRulesRequest) (*RulesResponse, error)
+	AddRule(context.Context, *AddRuleRequest) (*RuleResponse, error)
+	UpdateRule(context.Context, *UpdateRuleRequest) (*RuleResponse, error)
+	DeleteRule(context.Context, *DeleteRuleRequest) (*RulesResponse, error)
+	ListTargets(context.Context, *ListTargetsRequest) (*TargetsResponse, error)
+	SetTargets(context.Context, *SetTargetsRequest) (*TargetsResponse, error)
+	TransferURL(context.Context, *TransferURLRequest) (*TransferURLResponse, error)
+	ListTransfers(context.Context, *ListTransfersRequest) (*ListTransfersResponse, error)
+	AcceptTransfer(context.Context, *TransferRequest) (*TransferURLResponse, error)
+	DeclineTransfer(context.Context, *TransferRequest) (*DeclineTransferResponse, error)
+	Quota(context.Context, *QuotaRequest) (*QuotaResponse, error)
 	mustEmbedUnimplementedHandlerServiceServer()
 }
 
@@ -166,6 +454,78 @@ func (UnimplementedHandlerServiceServer) APIInternalStats(context.Context, *APII
 func (UnimplementedHandlerServiceServer) TokenHandler(context.Context, *TokenHandlerRequest) (*TokenHandlerResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method TokenHandler not implemented")
 }
+func (UnimplementedHandlerServiceServer) UpdateURL(context.Context, *UpdateURLRequest) (*UpdateURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateURL not implemented")
+}
+func (UnimplementedHandlerServiceServer) AddTags(context.Context, *ChangeTagsRequest) (*ChangeTagsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddTags not implemented")
+}
+func (UnimplementedHandlerServiceServer) RemoveTags(context.Context, *ChangeTagsRequest) (*ChangeTagsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveTags not implemented")
+}
+func (UnimplementedHandlerServiceServer) ListTags(context.Context, *ListTagsRequest) (*ListTagsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTags not implemented")
+}
+func (UnimplementedHandlerServiceServer) CreateFolder(context.Context, *CreateFolderRequest) (*CreateFolderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateFolder not implemented")
+}
+func (UnimplementedHandlerServiceServer) ListFolders(context.Context, *ListFoldersRequest) (*ListFoldersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFolders not implemented")
+}
+func (UnimplementedHandlerServiceServer) DeleteFolder(context.Context, *DeleteFolderRequest) (*DeleteFolderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteFolder not implemented")
+}
+func (UnimplementedHandlerServiceServer) DeleteFolderURLs(context.Context, *DeleteFolderRequest) (*DeleteFolderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteFolderURLs not implemented")
+}
+func (UnimplementedHandlerServiceServer) QRCode(context.Context, *QRCodeRequest) (*QRCodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QRCode not implemented")
+}
+func (UnimplementedHandlerServiceServer) CreateCampaign(context.Context, *CreateCampaignRequest) (*CreateCampaignResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateCampaign not implemented")
+}
+func (UnimplementedHandlerServiceServer) ListCampaigns(context.Context, *ListCampaignsRequest) (*ListCampaignsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListCampaigns not implemented")
+}
+func (UnimplementedHandlerServiceServer) DeleteCampaign(context.Context, *DeleteCampaignRequest) (*DeleteCampaignResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteCampaign not implemented")
+}
+func (UnimplementedHandlerServiceServer) ListRules(context.Context, *ListRulesRequest) (*RulesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRules not implemented")
+}
+func (UnimplementedHandlerServiceServer) SetRules(context.Context, *SetRulesRequest) (*RulesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetRules not implemented")
+}
+func (UnimplementedHandlerServiceServer) AddRule(context.Context, *AddRuleRequest) (*RuleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddRule not implemented")
+}
+func (UnimplementedHandlerServiceServer) UpdateRule(context.Context, *UpdateRuleRequest) (*RuleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateRule not implemented")
+}
+func (UnimplementedHandlerServiceServer) DeleteRule(context.Context, *DeleteRuleRequest) (*RulesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteRule not implemented")
+}
+func (UnimplementedHandlerServiceServer) ListTargets(context.Context, *ListTargetsRequest) (*TargetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTargets not implemented")
+}
+func (UnimplementedHandlerServiceServer) SetTargets(context.Context, *SetTargetsRequest) (*TargetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetTargets not implemented")
+}
+func (UnimplementedHandlerServiceServer) TransferURL(context.Context, *TransferURLRequest) (*TransferURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TransferURL not implemented")
+}
+func (UnimplementedHandlerServiceServer) ListTransfers(context.Context, *ListTransfersRequest) (*ListTransfersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTransfers not implemented")
+}
+func (UnimplementedHandlerServiceServer) AcceptTransfer(context.Context, *TransferRequest) (*TransferURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AcceptTransfer not implemented")
+}
+func (UnimplementedHandlerServiceServer) DeclineTransfer(context.Context, *TransferRequest) (*DeclineTransferResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeclineTransfer not implemented")
+}
+func (UnimplementedHandlerServiceServer) Quota(context.Context, *QuotaRequest) (*QuotaResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Quota not implemented")
+}
 func (UnimplementedHandlerServiceServer) mustEmbedUnimplementedHandlerServiceServer() {}
 
 // UnsafeHandlerServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -323,44 +683,884 @@ func _HandlerService_TokenHandler_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
-// HandlerService_ServiceDesc is the grpc.ServiceDesc for HandlerService service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var HandlerService_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "proto.HandlerService",
-	HandlerType: (*HandlerServiceServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "Ping",
-			Handler:    _HandlerService_Ping_Handler,
-		},
-		{
-			MethodName: "URLtoShort",
-			Handler:    _HandlerService_URLtoShort_Handler,
-		},
-		{
-			MethodName: "ShortToURL",
-			Handler:    _HandlerService_ShortToURL_Handler,
-		},
-		{
-			MethodName: "APIShortenBatch",
-			Handler:    _HandlerService_APIShortenBatch_Handler,
-		},
-		{
-			MethodName: "APIUserAllURLs",
-			Handler:    _HandlerService_APIUserAllURLs_Handler,
-		},
-		{
-			MethodName: "APIDeleteUrls",
-			Handler:    _HandlerService_APIDeleteUrls_Handler,
-		},
-		{
-			MethodName: "APIInternalStats",
-			Handler:    _HandlerService_APIInternalStats_Handler,
-		},
-		{
-			MethodName: "TokenHandler",
-			Handler:    _HandlerService_TokenHandler_Handler,
+func _HandlerService_UpdateURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).UpdateURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_UpdateURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).UpdateURL(ctx, req.(*UpdateURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_AddTags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeTagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).AddTags(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_AddTags_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).AddTags(ctx, req.(*ChangeTagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_RemoveTags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeTagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).RemoveTags(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_RemoveTags_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).RemoveTags(ctx, req.(*ChangeTagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_ListTags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).ListTags(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_ListTags_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).ListTags(ctx, req.(*ListTagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_CreateFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).CreateFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_CreateFolder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).CreateFolder(ctx, req.(*CreateFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_ListFolders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFoldersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).ListFolders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_ListFolders_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).ListFolders(ctx, req.(*ListFoldersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_DeleteFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).DeleteFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_DeleteFolder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).DeleteFolder(ctx, req.(*DeleteFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_DeleteFolderURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).DeleteFolderURLs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_DeleteFolderURLs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).DeleteFolderURLs(ctx, req.(*DeleteFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_QRCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QRCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).QRCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_QRCode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).QRCode(ctx, req.(*QRCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_CreateCampaign_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateCampaignRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).CreateCampaign(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_CreateCampaign_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).CreateCampaign(ctx, req.(*CreateCampaignRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_ListCampaigns_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCampaignsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).ListCampaigns(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_ListCampaigns_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).ListCampaigns(ctx, req.(*ListCampaignsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_DeleteCampaign_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteCampaignRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).DeleteCampaign(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_DeleteCampaign_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).DeleteCampaign(ctx, req.(*DeleteCampaignRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_ListRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRulesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).ListRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_ListRules_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).ListRules(ctx, req.(*ListRulesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_SetRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRulesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).SetRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_SetRules_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).SetRules(ctx, req.(*SetRulesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_AddRule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddRuleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).AddRule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_AddRule_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).AddRule(ctx, req.(*AddRuleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_UpdateRule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRuleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).UpdateRule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_UpdateRule_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).UpdateRule(ctx, req.(*UpdateRuleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_DeleteRule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRuleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).DeleteRule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_DeleteRule_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).DeleteRule(ctx, req.(*DeleteRuleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_ListTargets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTargetsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).ListTargets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_ListTargets_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).ListTargets(ctx, req.(*ListTargetsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_SetTargets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetTargetsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).SetTargets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_SetTargets_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).SetTargets(ctx, req.(*SetTargetsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_TransferURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).TransferURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_TransferURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).TransferURL(ctx, req.(*TransferURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_ListTransfers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTransfersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).ListTransfers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_ListTransfers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).ListTransfers(ctx, req.(*ListTransfersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_AcceptTransfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).AcceptTransfer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_AcceptTransfer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).AcceptTransfer(ctx, req.(*TransferRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_DeclineTransfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).DeclineTransfer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_DeclineTransfer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).DeclineTransfer(ctx, req.(*TransferRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HandlerService_Quota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QuotaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HandlerServiceServer).Quota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: HandlerService_Quota_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HandlerServiceServer).Quota(ctx, req.(*QuotaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// HandlerService_ServiceDesc is the grpc.ServiceDesc for HandlerService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var HandlerService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.HandlerService",
+	HandlerType: (*HandlerServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Ping",
+			Handler:    _HandlerService_Ping_Handler,
+		},
+		{
+			MethodName: "URLtoShort",
+			Handler:    _HandlerService_URLtoShort_Handler,
+		},
+		{
+			MethodName: "ShortToURL",
+			Handler:    _HandlerService_ShortToURL_Handler,
+		},
+		{
+			MethodName: "APIShortenBatch",
+			Handler:    _HandlerService_APIShortenBatch_Handler,
+		},
+		{
+			MethodName: "APIUserAllURLs",
+			Handler:    _HandlerService_APIUserAllURLs_Handler,
+		},
+		{
+			MethodName: "APIDeleteUrls",
+			Handler:    _HandlerService_APIDeleteUrls_Handler,
+		},
+		{
+			MethodName: "APIInternalStats",
+			Handler:    _HandlerService_APIInternalStats_Handler,
+		},
+		{
+			MethodName: "TokenHandler",
+			Handler:    _HandlerService_TokenHandler_Handler,
+		},
+		{
+			MethodName: "UpdateURL",
+			Handler:    _HandlerService_UpdateURL_Handler,
+		},
+		{
+			MethodName: "AddTags",
+			Handler:    _HandlerService_AddTags_Handler,
+		},
+		{
+			MethodName: "RemoveTags",
+			Handler:    _HandlerService_RemoveTags_Handler,
+		},
+		{
+			MethodName: "ListTags",
+			Handler:    _HandlerService_ListTags_Handler,
+		},
+		{
+			MethodName: "CreateFolder",
+			Handler:    _HandlerService_CreateFolder_Handler,
+		},
+		{
+			MethodName: "ListFolders",
+			Handler:    _HandlerService_ListFolders_Handler,
+		},
+		{
+			MethodName: "DeleteFolder",
+			Handler:    _HandlerService_DeleteFolder_Handler,
+		},
+		{
+			MethodName: "DeleteFolderURLs",
+			Handler:    _HandlerService_DeleteFolderURLs_Handler,
+		},
+		{
+			MethodName: "QRCode",
+			Handler:    _HandlerService_QRCode_Handler,
+		},
+		{
+			MethodName: "CreateCampaign",
+			Handler:    _HandlerService_CreateCampaign_Handler,
+		},
+		{
+			MethodName: "ListCampaigns",
+			Handler:    _HandlerService_ListCampaigns_Handler,
+		},
+		{
+			MethodName: "DeleteCampaign",
+			Handler:    _HandlerService_DeleteCampaign_Handler,
+		},
+		{
+			MethodName: "ListRules",
+			Handler:    _HandlerService_ListRules_Handler,
+		},
+		{
+			MethodName: "SetRules",
+			Handler:    _HandlerService_SetRules_Handler,
+		},
+		{
+			MethodName: "AddRule",
+			Handler:    _HandlerService_AddRule_Handler,
+		},
+		{
+			MethodName: "UpdateRule",
+			Handler:    _HandlerService_UpdateRule_Handler,
+		},
+		{
+			MethodName: "DeleteRule",
+			Handler:    _HandlerService_DeleteRule_Handler,
+		},
+		{
+			MethodName: "ListTargets",
+			Handler:    _HandlerService_ListTargets_Handler,
+		},
+		{
+			MethodName: "SetTargets",
+			Handler:    _HandlerService_SetTargets_Handler,
+		},
+		{
+			MethodName: "TransferURL",
+			Handler:    _HandlerService_TransferURL_Handler,
+		},
+		{
+			MethodName: "ListTransfers",
+			Handler:    _HandlerService_ListTransfers_Handler,
+		},
+		{
+			MethodName: "AcceptTransfer",
+			Handler:    _HandlerService_AcceptTransfer_Handler,
+		},
+		{
+			MethodName: "DeclineTransfer",
+			Handler:    _HandlerService_DeclineTransfer_Handler,
+		},
+		{
+			MethodName: "Quota",
+			Handler:    _HandlerService_Quota_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/shortner.proto",
+}
+
+const (
+	AdminService_Stats_FullMethodName         = "/proto.AdminService/Stats"
+	AdminService_SearchURLs_FullMethodName    = "/proto.AdminService/SearchURLs"
+	AdminService_UserURLs_FullMethodName      = "/proto.AdminService/UserURLs"
+	AdminService_DisableURL_FullMethodName    = "/proto.AdminService/DisableURL"
+	AdminService_EnableURL_FullMethodName     = "/proto.AdminService/EnableURL"
+	AdminService_PurgeURL_FullMethodName      = "/proto.AdminService/PurgeURL"
+	AdminService_PurgeUserURLs_FullMethodName = "/proto.AdminService/PurgeUserURLs"
+)
+
+// AdminServiceClient is the client API for AdminService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminServiceClient interface {
+	Stats(ctx context.Context, in *APIInternalStatsRequest, opts ...grpc.CallOption) (*APIInternalStatsResponse, error)
+	SearchURLs(ctx context.Context, in *AdminSearchURLsRequest, opts ...grpc.CallOption) (*AdminURLsResponse, error)
+	UserURLs(ctx context.Context, in *AdminUserURLsRequest, opts ...grpc.CallOption) (*AdminURLsResponse, error)
+	DisableURL(ctx context.Context, in *DisableURLRequest, opts ...grpc.CallOption) (*AdminURLResponse, error)
+	EnableURL(ctx context.Context, in *EnableURLRequest, opts ...grpc.CallOption) (*AdminURLResponse, error)
+	PurgeURL(ctx context.Context, in *AdminPurgeURLRequest, opts ...grpc.CallOption) (*AdminPurgeURLResponse, error)
+	PurgeUserURLs(ctx context.Context, in *AdminPurgeUserURLsRequest, opts ...grpc.CallOption) (*AdminPurgeUserURLsResponse, error)
+}
+
+type adminServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminServiceClient(cc grpc.ClientConnInterface) AdminServiceClient {
+	return &adminServiceClient{cc}
+}
+
+func (c *adminServiceClient) Stats(ctx context.Context, in *APIInternalStatsRequest, opts ...grpc.CallOption) (*APIInternalStatsResponse, error) {
+	out := new(APIInternalStatsResponse)
+	err := c.cc.Invoke(ctx, AdminService_Stats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) SearchURLs(ctx context.Context, in *AdminSearchURLsRequest, opts ...grpc.CallOption) (*AdminURLsResponse, error) {
+	out := new(AdminURLsResponse)
+	err := c.cc.Invoke(ctx, AdminService_SearchURLs_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) UserURLs(ctx context.Context, in *AdminUserURLsRequest, opts ...grpc.CallOption) (*AdminURLsResponse, error) {
+	out := new(AdminURLsResponse)
+	err := c.cc.Invoke(ctx, AdminService_UserURLs_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) DisableURL(ctx context.Context, in *DisableURLRequest, opts ...grpc.CallOption) (*AdminURLResponse, error) {
+	out := new(AdminURLResponse)
+	err := c.cc.Invoke(ctx, AdminService_DisableURL_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) EnableURL(ctx context.Context, in *EnableURLRequest, opts ...grpc.CallOption) (*AdminURLResponse, error) {
+	out := new(AdminURLResponse)
+	err := c.cc.Invoke(ctx, AdminService_EnableURL_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) PurgeURL(ctx context.Context, in *AdminPurgeURLRequest, opts ...grpc.CallOption) (*AdminPurgeURLResponse, error) {
+	out := new(AdminPurgeURLResponse)
+	err := c.cc.Invoke(ctx, AdminService_PurgeURL_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminServiceClient) PurgeUserURLs(ctx context.Context, in *AdminPurgeUserURLsRequest, opts ...grpc.CallOption) (*AdminPurgeUserURLsResponse, error) {
+	out := new(AdminPurgeUserURLsResponse)
+	err := c.cc.Invoke(ctx, AdminService_PurgeUserURLs_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServiceServer is the server API for AdminService service.
+// All implementations must embed UnimplementedAdminServiceServer
+// for forward compatibility
+type AdminServiceServer interface {
+	Stats(context.Context, *APIInternalStatsRequest) (*APIInternalStatsResponse, error)
+	SearchURLs(context.Context, *AdminSearchURLsRequest) (*AdminURLsResponse, error)
+	UserURLs(context.Context, *AdminUserURLsRequest) (*AdminURLsResponse, error)
+	DisableURL(context.Context, *DisableURLRequest) (*AdminURLResponse, error)
+	EnableURL(context.Context, *EnableURLRequest) (*AdminURLResponse, error)
+	PurgeURL(context.Context, *AdminPurgeURLRequest) (*AdminPurgeURLResponse, error)
+	PurgeUserURLs(context.Context, *AdminPurgeUserURLsRequest) (*AdminPurgeUserURLsResponse, error)
+	mustEmbedUnimplementedAdminServiceServer()
+}
+
+// UnimplementedAdminServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServiceServer struct {
+}
+
+func (UnimplementedAdminServiceServer) Stats(context.Context, *APIInternalStatsRequest) (*APIInternalStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
+func (UnimplementedAdminServiceServer) SearchURLs(context.Context, *AdminSearchURLsRequest) (*AdminURLsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchURLs not implemented")
+}
+func (UnimplementedAdminServiceServer) UserURLs(context.Context, *AdminUserURLsRequest) (*AdminURLsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UserURLs not implemented")
+}
+func (UnimplementedAdminServiceServer) DisableURL(context.Context, *DisableURLRequest) (*AdminURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DisableURL not implemented")
+}
+func (UnimplementedAdminServiceServer) EnableURL(context.Context, *EnableURLRequest) (*AdminURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnableURL not implemented")
+}
+func (UnimplementedAdminServiceServer) PurgeURL(context.Context, *AdminPurgeURLRequest) (*AdminPurgeURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeURL not implemented")
+}
+func (UnimplementedAdminServiceServer) PurgeUserURLs(context.Context, *AdminPurgeUserURLsRequest) (*AdminPurgeUserURLsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeUserURLs not implemented")
+}
+func (UnimplementedAdminServiceServer) mustEmbedUnimplementedAdminServiceServer() {}
+
+// UnsafeAdminServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServiceServer will
+// result in compilation errors.
+type UnsafeAdminServiceServer interface {
+	mustEmbedUnimplementedAdminServiceServer()
+}
+
+func RegisterAdminServiceServer(s grpc.ServiceRegistrar, srv AdminServiceServer) {
+	s.RegisterService(&AdminService_ServiceDesc, srv)
+}
+
+func _AdminService_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(APIInternalStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_Stats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).Stats(ctx, req.(*APIInternalStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_SearchURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdminSearchURLsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).SearchURLs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_SearchURLs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).SearchURLs(ctx, req.(*AdminSearchURLsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_UserURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdminUserURLsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).UserURLs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_UserURLs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).UserURLs(ctx, req.(*AdminUserURLsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_DisableURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DisableURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).DisableURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_DisableURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).DisableURL(ctx, req.(*DisableURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_EnableURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnableURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).EnableURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_EnableURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).EnableURL(ctx, req.(*EnableURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_PurgeURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdminPurgeURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).PurgeURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_PurgeURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).PurgeURL(ctx, req.(*AdminPurgeURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdminService_PurgeUserURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdminPurgeUserURLsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).PurgeUserURLs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_PurgeUserURLs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).PurgeUserURLs(ctx, req.(*AdminPurgeUserURLsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AdminService_ServiceDesc is the grpc.ServiceDesc for AdminService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AdminService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.AdminService",
+	HandlerType: (*AdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Stats",
+			Handler:    _AdminService_Stats_Handler,
+		},
+		{
+			MethodName: "SearchURLs",
+			Handler:    _AdminService_SearchURLs_Handler,
+		},
+		{
+			MethodName: "UserURLs",
+			Handler:    _AdminService_UserURLs_Handler,
+		},
+		{
+			MethodName: "DisableURL",
+			Handler:    _AdminService_DisableURL_Handler,
+		},
+		{
+			MethodName: "EnableURL",
+			Handler:    _AdminService_EnableURL_Handler,
+		},
+		{
+			MethodName: "PurgeURL",
+			Handler:    _AdminService_PurgeURL_Handler,
+		},
+		{
+			MethodName: "PurgeUserURLs",
+			Handler:    _AdminService_PurgeUserURLs_Handler,
 		},
 	},
 	Streams:  []grpc.StreamDesc{},
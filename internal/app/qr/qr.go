@@ -0,0 +1,203 @@
+// Package qr renders short links as QR codes in PNG and SVG formats.
+package qr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Форматы изображения QR-кода.
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+// Значения параметров по умолчанию и их ограничения.
+const (
+	DefaultSize   = 256
+	MinSize       = 64
+	MaxSize       = 2048
+	DefaultMargin = 4
+	MaxMargin     = 16
+	DefaultLevel  = "M"
+)
+
+// ErrorInvalidOptions - ошибка некорректных параметров QR-кода.
+var ErrorInvalidOptions = errors.New("некорректные параметры QR-кода")
+
+// levels - соответствие уровней коррекции ошибок уровням библиотеки.
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Options - параметры изображения QR-кода.
+type Options struct {
+	Format string // png или svg
+	Size   int    // ширина и высота изображения в пикселях
+	Level  string // уровень коррекции ошибок L, M, Q или H
+	Margin int    // ширина пустой рамки в модулях QR-кода, отрицательное значение - без рамки
+}
+
+// margin - возвращает ширину рамки в модулях.
+func (o Options) margin() int {
+	if o.Margin < 0 {
+		return 0
+	}
+	return o.Margin
+}
+
+// DefaultOptions - возвращает параметры QR-кода по умолчанию.
+func DefaultOptions() Options {
+	return Options{Format: FormatPNG, Size: DefaultSize, Level: DefaultLevel, Margin: DefaultMargin}
+}
+
+// Normalize - заполняет незаданные параметры значениями по умолчанию и проверяет их.
+// Нулевые Size и Margin считаются незаданными, отрицательный Margin означает рамку нулевой ширины.
+func (o Options) Normalize() (Options, error) {
+	o.Format = strings.ToLower(o.Format)
+	if o.Format == "" {
+		o.Format = FormatPNG
+	}
+	if o.Format != FormatPNG && o.Format != FormatSVG {
+		return o, fmt.Errorf("%w; неизвестный формат %q", ErrorInvalidOptions, o.Format)
+	}
+	if o.Size == 0 {
+		o.Size = DefaultSize
+	}
+	if o.Size < MinSize || o.Size > MaxSize {
+		return o, fmt.Errorf("%w; размер должен быть от %d до %d", ErrorInvalidOptions, MinSize, MaxSize)
+	}
+	o.Level = strings.ToUpper(o.Level)
+	if o.Level == "" {
+		o.Level = DefaultLevel
+	}
+	if _, ok := levels[o.Level]; !ok {
+		return o, fmt.Errorf("%w; неизвестный уровень коррекции %q", ErrorInvalidOptions, o.Level)
+	}
+	switch {
+	case o.Margin == 0:
+		o.Margin = DefaultMargin
+	case o.Margin > MaxMargin:
+		return o, fmt.Errorf("%w; рамка не должна превышать %d", ErrorInvalidOptions, MaxMargin)
+	}
+	return o, nil
+}
+
+// ContentType - возвращает MIME-тип изображения для формата.
+func (o Options) ContentType() string {
+	if o.Format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// ParseOptions - собирает параметры QR-кода из строковых значений параметров запроса.
+func ParseOptions(format, size, level, margin string) (Options, error) {
+	opts := Options{Format: format, Level: level}
+	var err error
+	if size != "" {
+		if opts.Size, err = strconv.Atoi(size); err != nil {
+			return opts, fmt.Errorf("%w; size: %v", ErrorInvalidOptions, err)
+		}
+	}
+	if margin != "" {
+		if opts.Margin, err = strconv.Atoi(margin); err != nil {
+			return opts, fmt.Errorf("%w; margin: %v", ErrorInvalidOptions, err)
+		}
+		if opts.Margin == 0 {
+			opts.Margin = -1 // явно заданная нулевая рамка
+		}
+	}
+	return opts.Normalize()
+}
+
+// Encode - кодирует content в QR-код в формате и с параметрами opts.
+func Encode(content string, opts Options) ([]byte, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	code, err := qrcode.New(content, levels[opts.Level])
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+	if opts.Format == FormatSVG {
+		return renderSVG(bitmap, opts), nil
+	}
+	return renderPNG(bitmap, opts)
+}
+
+// DataURI - возвращает QR-код в формате PNG с параметрами по умолчанию в виде data URI.
+func DataURI(content string) (string, error) {
+	img, err := Encode(content, DefaultOptions())
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(img), nil
+}
+
+// renderPNG - рисует матрицу QR-кода с рамкой в PNG размером opts.Size.
+// Если размер меньше числа модулей, изображение увеличивается до минимально возможного.
+func renderPNG(bitmap [][]bool, opts Options) ([]byte, error) {
+	margin := opts.margin()
+	modules := len(bitmap) + 2*margin
+	size := opts.Size
+	if size < modules {
+		size = modules
+	}
+	palette := color.Palette{color.White, color.Black}
+	img := image.NewPaletted(image.Rect(0, 0, size, size), palette)
+	for y := 0; y < size; y++ {
+		my := y*modules/size - margin
+		for x := 0; x < size; x++ {
+			mx := x*modules/size - margin
+			if my >= 0 && my < len(bitmap) && mx >= 0 && mx < len(bitmap) && bitmap[my][mx] {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderSVG - рисует матрицу QR-кода с рамкой в SVG. Один модуль - одна единица viewBox.
+func renderSVG(bitmap [][]bool, opts Options) []byte {
+	margin := opts.margin()
+	modules := len(bitmap) + 2*margin
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, modules, modules)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			// объединяем подряд идущие модули строки в один прямоугольник
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start+margin, y+margin, x-start, x-start)
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
@@ -0,0 +1,127 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/color"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name                        string
+		format, size, level, margin string
+		want                        Options
+		wantErr                     bool
+	}{
+		{name: "по умолчанию", want: DefaultOptions()},
+		{name: "регистр формата и уровня", format: "SVG", size: "300", level: "h", margin: "2",
+			want: Options{Format: FormatSVG, Size: 300, Level: "H", Margin: 2}},
+		{name: "нулевая рамка", margin: "0", want: Options{Format: FormatPNG, Size: DefaultSize, Level: DefaultLevel, Margin: -1}},
+		{name: "минимальный размер", size: strconv.Itoa(MinSize), want: Options{Format: FormatPNG, Size: MinSize, Level: DefaultLevel, Margin: DefaultMargin}},
+		{name: "максимальный размер", size: strconv.Itoa(MaxSize), want: Options{Format: FormatPNG, Size: MaxSize, Level: DefaultLevel, Margin: DefaultMargin}},
+		{name: "максимальная рамка", margin: strconv.Itoa(MaxMargin), want: Options{Format: FormatPNG, Size: DefaultSize, Level: DefaultLevel, Margin: MaxMargin}},
+		{name: "размер меньше допустимого", size: strconv.Itoa(MinSize - 1), wantErr: true},
+		{name: "размер больше допустимого", size: strconv.Itoa(MaxSize + 1), wantErr: true},
+		{name: "отрицательный размер", size: "-256", wantErr: true},
+		{name: "размер не число", size: "big", wantErr: true},
+		{name: "неизвестный уровень", level: "X", wantErr: true},
+		{name: "неизвестный формат", format: "gif", wantErr: true},
+		{name: "рамка больше допустимой", margin: strconv.Itoa(MaxMargin + 1), wantErr: true},
+		{name: "рамка не число", margin: "wide", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOptions(tt.format, tt.size, tt.level, tt.margin)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrorInvalidOptions)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEncodePNG(t *testing.T) {
+	black := color.Gray{}
+	long := "http://example.com/" + strings.Repeat("a", 200)
+	tests := []struct {
+		name    string
+		content string
+		opts    Options
+		size    int
+		corner  color.Color
+	}{
+		// левый верхний угол - рамка или угол поискового узора QR-кода
+		{"с рамкой", "http://example.com/abc", Options{Size: 200}, 200, color.Gray{Y: 0xff}},
+		{"без рамки", "http://example.com/abc", Options{Size: 200, Margin: -1}, 200, black},
+		// размер меньше числа модулей увеличивается до минимально возможного
+		{"увеличение размера", long, Options{Size: MinSize, Margin: MaxMargin, Level: "H"}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Encode(tt.content, tt.opts)
+			require.NoError(t, err)
+			img, err := png.Decode(bytes.NewReader(data))
+			require.NoError(t, err)
+			bounds := img.Bounds()
+			assert.Equal(t, bounds.Dx(), bounds.Dy())
+			if tt.size == 0 {
+				assert.Greater(t, bounds.Dx(), MinSize)
+				return
+			}
+			assert.Equal(t, tt.size, bounds.Dx())
+			assert.Equal(t, color.GrayModel.Convert(tt.corner), color.GrayModel.Convert(img.At(0, 0)))
+		})
+	}
+}
+
+func TestEncodeSVG(t *testing.T) {
+	viewBox := regexp.MustCompile(`viewBox="0 0 (\d+) (\d+)"`)
+	for _, margin := range []int{-1, 2} {
+		data, err := Encode("http://example.com/abc", Options{Format: FormatSVG, Size: 300, Margin: margin})
+		require.NoError(t, err)
+		svg := string(data)
+		require.True(t, strings.HasPrefix(svg, "<svg"))
+		assert.True(t, strings.HasSuffix(svg, "</svg>"))
+		assert.Contains(t, svg, `width="300" height="300"`)
+		match := viewBox.FindStringSubmatch(svg)
+		require.NotNil(t, match)
+		assert.Equal(t, match[1], match[2])
+		modules, err := strconv.Atoi(match[1])
+		require.NoError(t, err)
+		// сторона QR-кода версии v - 17+4v модулей
+		if margin < 0 {
+			margin = 0
+		}
+		assert.Equal(t, 0, (modules-2*margin-17)%4)
+		// первый модуль - угол поискового узора с учетом рамки
+		assert.Contains(t, svg, `d="M`+strconv.Itoa(margin)+" "+strconv.Itoa(margin)+"h7")
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	_, err := Encode("http://example.com/abc", Options{Size: MaxSize + 1})
+	assert.ErrorIs(t, err, ErrorInvalidOptions)
+	_, err = Encode(strings.Repeat("x", 8000), DefaultOptions())
+	assert.Error(t, err)
+}
+
+func TestDataURI(t *testing.T) {
+	uri, err := DataURI("http://example.com/abc")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(uri, "data:image/png;base64,"))
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, "data:image/png;base64,"))
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, DefaultSize, img.Bounds().Dx())
+}
@@ -0,0 +1,124 @@
+// Package ratelimit limits the request rate per route class with token buckets
+// kept in a shared store, so that several service instances enforce a common limit.
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bubu256/go-url-shortener-server/config"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+)
+
+// Классы маршрутов с отдельными ограничениями частоты запросов.
+const (
+	ClassCreate   = "create"   // создание ссылки
+	ClassBatch    = "batch"    // пакетное создание ссылок
+	ClassRedirect = "redirect" // переход по ссылке
+	ClassDelete   = "delete"   // удаление ссылок
+	ClassReport   = "report"   // жалоба на ссылку
+)
+
+// Store - хранилище корзин токенов.
+type Store interface {
+	// TakeRateToken забирает токен из корзины key с ограничением limit на момент now.
+	TakeRateToken(key string, limit schema.RateLimit, now time.Time) (bool, time.Duration, error)
+}
+
+// Limiter ограничивает частоту запросов каждого класса маршрутов для каждого клиента.
+// Нулевой Limiter и класс без ограничения пропускают все запросы.
+type Limiter struct {
+	limits map[string]schema.RateLimit
+	store  Store
+}
+
+// New - создает Limiter по ограничениям из конфигурации сервера. Некорректные ограничения записываются в лог
+// и не применяются. Жалобы ограничиваются REPORT_RATE_LIMIT в час.
+func New(cfg config.CfgServer, store Store) *Limiter {
+	specs := map[string]string{
+		ClassCreate:   cfg.RateLimitCreate,
+		ClassBatch:    cfg.RateLimitBatch,
+		ClassRedirect: cfg.RateLimitRedirect,
+		ClassDelete:   cfg.RateLimitDelete,
+	}
+	if cfg.ReportRateLimit > 0 {
+		specs[ClassReport] = strconv.Itoa(cfg.ReportRateLimit) + "/h"
+	}
+	limits := make(map[string]schema.RateLimit)
+	for class, spec := range specs {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		limit, err := ParseLimit(spec)
+		if err != nil {
+			log.Printf("ограничение запросов %s не применяется; %v", class, err)
+			continue
+		}
+		limits[class] = limit
+	}
+	return &Limiter{limits: limits, store: store}
+}
+
+// ParseLimit - разбирает ограничение в формате "N/период": не более N запросов за период с возможностью
+// сделать все N запросов сразу. Период задается длительностью ("1m", "30s", "1h") или единицей ("s", "m", "h").
+func ParseLimit(spec string) (schema.RateLimit, error) {
+	count, period, ok := strings.Cut(strings.TrimSpace(spec), "/")
+	if !ok {
+		return schema.RateLimit{}, fmt.Errorf("некорректное ограничение %q, ожидается N/период", spec)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n <= 0 {
+		return schema.RateLimit{}, fmt.Errorf("некорректное количество запросов в ограничении %q", spec)
+	}
+	period = strings.TrimSpace(period)
+	if period != "" && strings.IndexAny(period[:1], "0123456789") < 0 {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return schema.RateLimit{}, fmt.Errorf("некорректный период в ограничении %q", spec)
+	}
+	return schema.RateLimit{Rate: float64(n) / d.Seconds(), Burst: n}, nil
+}
+
+// Enabled - проверяет, что для класса маршрутов class задано ограничение.
+func (l *Limiter) Enabled(class string) bool {
+	if l == nil {
+		return false
+	}
+	_, ok := l.limits[class]
+	return ok
+}
+
+// Allow - учитывает запрос класса class от клиента key. Если лимит исчерпан, возвращает false и время,
+// через которое запрос можно повторить. При ошибке хранилища запрос пропускается.
+func (l *Limiter) Allow(class, key string) (bool, time.Duration) {
+	if !l.Enabled(class) {
+		return true, 0
+	}
+	ok, retryAfter, err := l.store.TakeRateToken(class+":"+key, l.limits[class], time.Now())
+	if err != nil {
+		log.Println("ошибка при проверке ограничения запросов;", err)
+		return true, 0
+	}
+	return ok, retryAfter
+}
+
+// RetryAfter - возвращает значение заголовка Retry-After: время ожидания в целых секундах с округлением вверх.
+func RetryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(d.Seconds()))))
+}
+
+// UserKey - возвращает ключ клиента для пользователя userID.
+func UserKey(userID string) string {
+	return "user:" + userID
+}
+
+// IPKey - возвращает ключ клиента для IP-адреса ip.
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
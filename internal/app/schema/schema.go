@@ -1,20 +1,176 @@
 // Package schema предоставляет структуры, необходимые для пересылки данных между пакетами.
 package schema
 
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"golang.org/x/exp/slices"
+)
+
 // APIShortenInput - структура, используемая для принятия данных в запросе
 type APIShortenInput struct {
-	URL string `json:"url"`
+	URL       string     `json:"url"`
+	Title     string     `json:"title,omitempty"`
+	Note      string     `json:"note,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ActiveFrom - время, с которого ссылка начинает перенаправлять (nil - сразу после создания).
+	ActiveFrom *time.Time `json:"active_from,omitempty"`
+	FolderID   int64      `json:"folder_id,omitempty"`
+	// ForcePreview - показывать страницу предпросмотра вместо немедленного перенаправления.
+	ForcePreview bool `json:"force_preview,omitempty"`
+	// RedirectType - код ответа при переходе по ссылке (301, 302, 307, 308), 0 - по умолчанию сервера.
+	RedirectType int `json:"redirect_type,omitempty"`
+	// Passthrough - режим передачи параметров и пути запроса в исходный URL, пусто - по умолчанию сервера.
+	Passthrough string `json:"passthrough,omitempty"`
+	// PassthroughConflict - правило для параметров, которые уже есть в исходном URL, пусто - по умолчанию сервера.
+	PassthroughConflict string `json:"passthrough_conflict,omitempty"`
+	// CampaignID - кампания ссылки, UTM-параметры которой добавляются при переходе.
+	CampaignID int64 `json:"campaign,omitempty"`
+	// Rules - правила выбора адреса перехода по признакам клиента.
+	Rules []RedirectRule `json:"rules,omitempty"`
+	// Targets - варианты адреса перехода для A/B-теста с весами.
+	Targets []SplitTarget `json:"targets,omitempty"`
+	// QR - включить в ответ QR-код короткой ссылки в виде data URI.
+	QR bool `json:"qr,omitempty"`
+}
+
+// Meta - возвращает метаданные ссылки, переданные в запросе.
+func (in APIShortenInput) Meta() URLMeta {
+	return URLMeta{Title: in.Title, Note: in.Note, Tags: in.Tags, ExpiresAt: in.ExpiresAt, ActiveFrom: in.ActiveFrom,
+		FolderID: in.FolderID, ForcePreview: in.ForcePreview, RedirectType: in.RedirectType, Passthrough: in.Passthrough,
+		PassthroughConflict: in.PassthroughConflict, CampaignID: in.CampaignID, Rules: in.Rules,
+		Targets: in.Targets}
+}
+
+// APIUpdateURLInput - структура, используемая для частичного изменения ссылки пользователем.
+// Поля, отсутствующие в запросе, не изменяются.
+type APIUpdateURLInput struct {
+	Title     *string      `json:"title"`
+	Note      *string      `json:"note"`
+	Tags      *[]string    `json:"tags"`
+	ExpiresAt OptionalTime `json:"expires_at"`
+	// ActiveFrom - время начала действия ссылки, null - ссылка действует сразу.
+	ActiveFrom OptionalTime `json:"active_from"`
+	// FolderID - папка ссылки, 0 - убрать ссылку из папки.
+	FolderID *int64 `json:"folder_id"`
+	// RedirectType - код ответа при переходе по ссылке, 0 - по умолчанию сервера.
+	RedirectType *int `json:"redirect_type"`
+	// Passthrough, PassthroughConflict - режим и правило передачи параметров запроса, пусто - по умолчанию сервера.
+	Passthrough         *string `json:"passthrough"`
+	PassthroughConflict *string `json:"passthrough_conflict"`
+	// CampaignID - кампания ссылки, 0 - убрать ссылку из кампании.
+	CampaignID *int64 `json:"campaign"`
+}
+
+// Patch - возвращает изменения ссылки, переданные в запросе.
+func (in APIUpdateURLInput) Patch() URLPatch {
+	return URLPatch{Title: in.Title, Note: in.Note, Tags: in.Tags, ExpiresAt: in.ExpiresAt, ActiveFrom: in.ActiveFrom,
+		FolderID: in.FolderID, RedirectType: in.RedirectType, Passthrough: in.Passthrough, PassthroughConflict: in.PassthroughConflict,
+		CampaignID: in.CampaignID}
+}
+
+// OptionalTime - время, для которого различаются отсутствие поля в JSON и явный null.
+type OptionalTime struct {
+	// Set - поле присутствовало в JSON.
+	Set bool
+	// Time - значение поля, nil если передан null.
+	Time *time.Time
+}
+
+// UnmarshalJSON - декодирует значение поля и отмечает его наличие.
+func (t *OptionalTime) UnmarshalJSON(b []byte) error {
+	t.Set = true
+	return json.Unmarshal(b, &t.Time)
+}
+
+// APIDisableURLInput - структура, используемая администратором для отключения ссылки.
+type APIDisableURLInput struct {
+	// Reason - причина отключения, пусто - нарушение политики сервиса, которому соответствует ссылка.
+	Reason string `json:"reason"`
+}
+
+// APIAdminURL - ссылка в результатах поиска администратором: данные ссылки и идентификатор владельца.
+type APIAdminURL struct {
+	APIUserURL
+	UserID string `json:"user_id"`
+}
+
+// APIPurgeResult - короткие ключи ссылок, окончательно удаленных администратором.
+type APIPurgeResult struct {
+	Purged []string `json:"purged"`
 }
 
 // APIShortenOutput - структура, используемая для отправки сокращенного URL в JSON.
 type APIShortenOutput struct {
 	Result string `json:"result"`
+	QR     string `json:"qr,omitempty"`
 }
 
 // APIUserURLs - массив структур, используемый для отправки всех URL пользователя в JSON.
-type APIUserURLs []struct {
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+type APIUserURLs []APIUserURL
+
+// APIUserURL - структура с данными одной ссылки пользователя.
+type APIUserURL struct {
+	ShortURL            string         `json:"short_url"`
+	OriginalURL         string         `json:"original_url"`
+	Status              string         `json:"status,omitempty"`
+	Title               string         `json:"title,omitempty"`
+	Note                string         `json:"note,omitempty"`
+	Tags                []string       `json:"tags,omitempty"`
+	FolderID            int64          `json:"folder_id,omitempty"`
+	ForcePreview        bool           `json:"force_preview,omitempty"`
+	RedirectType        int            `json:"redirect_type,omitempty"`
+	Passthrough         string         `json:"passthrough,omitempty"`
+	PassthroughConflict string         `json:"passthrough_conflict,omitempty"`
+	CampaignID          int64          `json:"campaign,omitempty"`
+	Rules               []RedirectRule `json:"rules,omitempty"`
+	Targets             []SplitTarget  `json:"targets,omitempty"`
+	Clicks              int64          `json:"clicks"`
+	CreatedAt           *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt           *time.Time     `json:"updated_at,omitempty"`
+	DeletedAt           *time.Time     `json:"deleted_at,omitempty"`
+	ExpiresAt           *time.Time     `json:"expires_at,omitempty"`
+	ActiveFrom          *time.Time     `json:"active_from,omitempty"`
+	DisabledReason      string         `json:"disabled_reason,omitempty"`
+}
+
+// NewAPIUserURL - заполняет структуру APIUserURL по записи хранилища и готовой короткой ссылке.
+func NewAPIUserURL(rec URLRecord, shortURL string, now time.Time) APIUserURL {
+	out := APIUserURL{
+		ShortURL:            shortURL,
+		OriginalURL:         rec.FullURL,
+		Status:              rec.Status(now),
+		Title:               rec.Title,
+		Note:                rec.Note,
+		Tags:                rec.Tags,
+		FolderID:            rec.FolderID,
+		ForcePreview:        rec.ForcePreview,
+		RedirectType:        rec.RedirectType,
+		Passthrough:         rec.Passthrough,
+		PassthroughConflict: rec.PassthroughConflict,
+		CampaignID:          rec.CampaignID,
+		Rules:               rec.Rules,
+		Targets:             rec.Targets,
+		Clicks:              rec.Clicks,
+		DeletedAt:           rec.DeletedAt,
+		ExpiresAt:           rec.ExpiresAt,
+		ActiveFrom:          rec.ActiveFrom,
+		DisabledReason:      rec.DisabledReason,
+	}
+	if !rec.CreatedAt.IsZero() {
+		out.CreatedAt = &rec.CreatedAt
+	}
+	if !rec.UpdatedAt.IsZero() {
+		out.UpdatedAt = &rec.UpdatedAt
+	}
+	return out
 }
 
 // APIShortenBatchInput - массив структур, используемый для приемки множества ссылок и их коротких идентификаторов.
@@ -34,3 +190,775 @@ type APIInternalStats struct {
 	URLs  int `json:"urls"`
 	Users int `json:"users"`
 }
+
+// Статусы ссылки, используемые при фильтрации списка ссылок пользователя.
+const (
+	URLStatusActive    = "active"
+	URLStatusDeleted   = "deleted"
+	URLStatusExpired   = "expired"
+	URLStatusScheduled = "scheduled"
+	URLStatusDisabled  = "disabled"
+	URLStatusAll       = "all"
+)
+
+// Поля, по которым возможна сортировка списка ссылок пользователя.
+const (
+	SortByCreated = "created"
+	SortByKey     = "key"
+)
+
+// URLMeta - метаданные ссылки.
+type URLMeta struct {
+	// CreatedAt - время создания ссылки.
+	CreatedAt time.Time
+	// UpdatedAt - время последнего изменения ссылки.
+	UpdatedAt time.Time
+	// DeletedAt - время удаления ссылки пользователем (nil - не удалена).
+	DeletedAt *time.Time
+	// ExpiresAt - время, после которого ссылка перестает работать (nil - бессрочная).
+	ExpiresAt *time.Time
+	// ActiveFrom - время, до которого ссылка еще не перенаправляет (nil - действует с момента создания).
+	ActiveFrom *time.Time
+	// DisabledReason - причина отключения ссылки администратором (пусто - ссылка не отключена).
+	DisabledReason string
+	// Title - название ссылки, задаваемое владельцем.
+	Title string
+	// Note - заметка владельца к ссылке.
+	Note string
+	// Tags - метки ссылки.
+	Tags []string
+	// FolderID - идентификатор папки ссылки (0 - ссылка не в папке).
+	FolderID int64
+	// ForcePreview - при переходе по ссылке всегда показывается страница предпросмотра.
+	ForcePreview bool
+	// RedirectType - код ответа при переходе по ссылке (0 - по умолчанию сервера).
+	RedirectType int
+	// Passthrough - режим передачи параметров и пути запроса в исходный URL (пусто - по умолчанию сервера).
+	Passthrough string
+	// PassthroughConflict - правило для параметров, уже заданных в исходном URL (пусто - по умолчанию сервера).
+	PassthroughConflict string
+	// CampaignID - идентификатор кампании ссылки (0 - ссылка не в кампании).
+	CampaignID int64
+	// Rules - правила выбора адреса перехода по признакам клиента (проверяются до исходного URL).
+	Rules []RedirectRule
+	// Targets - варианты адреса перехода с весами для A/B-теста (используются, если не сработало ни одно правило).
+	Targets []SplitTarget
+	// Clicks - количество переходов по ссылке.
+	Clicks int64
+	// QuotaKey - ключ квоты, по которому учитывается ссылка анонимного пользователя (см. URLQuota.Key);
+	// пусто - ссылка учитывается в квотах владельца. Сбрасывается при передаче ссылки другому владельцу.
+	QuotaKey string
+}
+
+// RedirectRule - правило перенаправления ссылки на другой адрес по признакам клиента.
+// Пустые условия не проверяются, правило подходит клиенту, если выполнены все непустые условия.
+type RedirectRule struct {
+	// ID - номер правила в пределах ссылки.
+	ID int64 `json:"id"`
+	// Platform - платформа клиента по User-Agent: ios, android, windows, macos или linux.
+	Platform string `json:"platform,omitempty"`
+	// Language - язык клиента по Accept-Language, например "ru" или "en-us".
+	Language string `json:"language,omitempty"`
+	// Country - код страны клиента ISO 3166-1 по базе GeoIP, например "DE".
+	Country string `json:"country,omitempty"`
+	// URL - адрес перехода для клиентов, подходящих под правило.
+	URL string `json:"url"`
+}
+
+// SplitTarget - вариант адреса перехода ссылки при A/B-тесте.
+// Вариант выбирается случайно с вероятностью, пропорциональной весу, и закрепляется за посетителем.
+type SplitTarget struct {
+	// ID - номер варианта в пределах ссылки, не меняется при изменении набора вариантов.
+	ID int64 `json:"id"`
+	// URL - адрес перехода варианта.
+	URL string `json:"url"`
+	// Weight - вес варианта, 0 - вариант приостановлен и новым посетителям не выдается.
+	Weight int `json:"weight"`
+	// Clicks - количество переходов на вариант.
+	Clicks int64 `json:"clicks"`
+}
+
+// Режимы передачи параметров и пути запроса при переходе по ссылке.
+const (
+	PassthroughNone  = "none"  // запрос не передается
+	PassthroughQuery = "query" // передаются параметры запроса
+	PassthroughPath  = "path"  // дописывается путь после короткого ключа
+	PassthroughAll   = "all"   // передаются параметры и путь
+)
+
+// Правила для параметров запроса, которые уже есть в исходном URL.
+const (
+	ConflictKeep     = "keep"     // остается значение исходного URL
+	ConflictOverride = "override" // значение заменяется значением из запроса
+	ConflictAppend   = "append"   // сохраняются оба значения
+)
+
+// ValidPassthrough - проверяет режим передачи запроса. Пустая строка означает режим по умолчанию сервера.
+func ValidPassthrough(mode string) bool {
+	switch mode {
+	case "", PassthroughNone, PassthroughQuery, PassthroughPath, PassthroughAll:
+		return true
+	}
+	return false
+}
+
+// ValidPassthroughConflict - проверяет правило для совпадающих параметров. Пустая строка означает правило по умолчанию сервера.
+func ValidPassthroughConflict(conflict string) bool {
+	switch conflict {
+	case "", ConflictKeep, ConflictOverride, ConflictAppend:
+		return true
+	}
+	return false
+}
+
+// ValidRedirectType - проверяет, что код подходит для перенаправления по ссылке.
+// Значение 0 означает код по умолчанию сервера.
+func ValidRedirectType(code int) bool {
+	switch code {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// PermanentRedirect - проверяет, что код перенаправления постоянный и ответ может кэшироваться.
+func PermanentRedirect(code int) bool {
+	return code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect
+}
+
+// URLPatch - изменения метаданных ссылки. Поля со значением nil не изменяются.
+type URLPatch struct {
+	Title               *string
+	Note                *string
+	Tags                *[]string
+	ExpiresAt           OptionalTime
+	ActiveFrom          OptionalTime
+	FolderID            *int64
+	RedirectType        *int
+	Passthrough         *string
+	PassthroughConflict *string
+	CampaignID          *int64
+	Rules               *[]RedirectRule
+	Targets             *[]SplitTarget
+	// DisabledReason - изменяется только администратором (см. Shortener.DisableURL).
+	DisabledReason *string
+}
+
+// Apply - применяет изменения к метаданным ссылки.
+func (p URLPatch) Apply(meta *URLMeta) {
+	if p.Title != nil {
+		meta.Title = *p.Title
+	}
+	if p.Note != nil {
+		meta.Note = *p.Note
+	}
+	if p.Tags != nil {
+		meta.Tags = *p.Tags
+	}
+	if p.ExpiresAt.Set {
+		meta.ExpiresAt = p.ExpiresAt.Time
+	}
+	if p.ActiveFrom.Set {
+		meta.ActiveFrom = p.ActiveFrom.Time
+	}
+	if p.FolderID != nil {
+		meta.FolderID = *p.FolderID
+	}
+	if p.RedirectType != nil {
+		meta.RedirectType = *p.RedirectType
+	}
+	if p.Passthrough != nil {
+		meta.Passthrough = *p.Passthrough
+	}
+	if p.PassthroughConflict != nil {
+		meta.PassthroughConflict = *p.PassthroughConflict
+	}
+	if p.CampaignID != nil {
+		meta.CampaignID = *p.CampaignID
+	}
+	if p.Rules != nil {
+		meta.Rules = *p.Rules
+	}
+	if p.DisabledReason != nil {
+		meta.DisabledReason = *p.DisabledReason
+	}
+	if p.Targets != nil {
+		// счетчики переходов сохраняются для вариантов, оставшихся в наборе
+		targets := slices.Clone(*p.Targets)
+		for i := range targets {
+			j := slices.IndexFunc(meta.Targets, func(t SplitTarget) bool { return t.ID == targets[i].ID })
+			if j >= 0 {
+				targets[i].Clicks = meta.Targets[j].Clicks
+			}
+		}
+		meta.Targets = targets
+	}
+}
+
+// URLRecord - полная запись о ссылке в хранилище.
+type URLRecord struct {
+	ShortKey  string
+	FullURL   string
+	UserID    string
+	Available bool
+	URLMeta
+}
+
+// Status - возвращает статус ссылки на момент времени now.
+func (r URLRecord) Status(now time.Time) string {
+	if !r.Available {
+		return URLStatusDeleted
+	}
+	if r.DisabledReason != "" {
+		return URLStatusDisabled
+	}
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(now) {
+		return URLStatusExpired
+	}
+	if r.ActiveFrom != nil && r.ActiveFrom.After(now) {
+		return URLStatusScheduled
+	}
+	return URLStatusActive
+}
+
+// Host - возвращает хост исходного URL в нижнем регистре (пустую строку, если URL не разбирается).
+func (r URLRecord) Host() string {
+	u, err := url.Parse(r.FullURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// ListURLsOptions - параметры выборки ссылок пользователя.
+type ListURLsOptions struct {
+	// Cursor - курсор, полученный с предыдущей страницы (пустой для первой страницы).
+	Cursor string
+	// Limit - максимальное количество ссылок на странице.
+	Limit int
+	// SortBy - поле сортировки: SortByCreated или SortByKey.
+	SortBy string
+	// Desc - сортировка по убыванию.
+	Desc bool
+	// Query - подстрока, которую должен содержать исходный URL (без учета регистра).
+	Query string
+	// Domain - домен исходного URL (включая поддомены).
+	Domain string
+	// Status - статус ссылок: URLStatusActive, URLStatusDeleted, URLStatusExpired,
+	// URLStatusScheduled, URLStatusDisabled или URLStatusAll.
+	Status string
+	// Tag - метка, которая должна быть у ссылки.
+	Tag string
+	// FolderID - папка, в которой должна находиться ссылка (0 - любая).
+	FolderID int64
+	// CampaignID - кампания, к которой должна относиться ссылка (0 - любая).
+	CampaignID int64
+	// Key - подстрока, которую должен содержать короткий ключ ссылки.
+	Key string
+	// Owner - идентификатор владельца ссылки (пусто - любой); используется при поиске администратором.
+	Owner string
+}
+
+// MatchDomain - проверяет, что host совпадает с доменом Domain или является его поддоменом.
+func (o ListURLsOptions) MatchDomain(host string) bool {
+	if o.Domain == "" {
+		return true
+	}
+	return host == o.Domain || strings.HasSuffix(host, "."+o.Domain)
+}
+
+// Match - проверяет, что запись rec удовлетворяет фильтрам выборки (кроме курсора).
+func (o ListURLsOptions) Match(rec URLRecord, now time.Time) bool {
+	if o.Status != URLStatusAll && rec.Status(now) != o.Status {
+		return false
+	}
+	if o.Query != "" && !strings.Contains(strings.ToLower(rec.FullURL), strings.ToLower(o.Query)) {
+		return false
+	}
+	if o.Tag != "" && !slices.Contains(rec.Tags, o.Tag) {
+		return false
+	}
+	if o.FolderID != 0 && rec.FolderID != o.FolderID {
+		return false
+	}
+	if o.CampaignID != 0 && rec.CampaignID != o.CampaignID {
+		return false
+	}
+	if o.Key != "" && !strings.Contains(rec.ShortKey, o.Key) {
+		return false
+	}
+	if o.Owner != "" && rec.UserID != o.Owner {
+		return false
+	}
+	return o.MatchDomain(rec.Host())
+}
+
+// URLPage - страница списка ссылок пользователя.
+type URLPage struct {
+	Items []URLRecord
+	// NextCursor - курсор следующей страницы, пустой если страница последняя.
+	NextCursor string
+}
+
+// ListCursor - позиция последней выданной записи в списке ссылок.
+// Передается клиенту в виде непрозрачной строки (см. Encode и DecodeListCursor).
+type ListCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ShortKey  string    `json:"k"`
+}
+
+// NewListCursor - создает курсор, указывающий на запись rec.
+func NewListCursor(rec URLRecord) ListCursor {
+	return ListCursor{CreatedAt: rec.CreatedAt, ShortKey: rec.ShortKey}
+}
+
+// Encode - кодирует курсор в строку для передачи клиенту.
+func (c ListCursor) Encode() string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// After - проверяет, что запись rec следует за курсором при заданной сортировке.
+func (c ListCursor) After(rec URLRecord, sortBy string, desc bool) bool {
+	var cmp int
+	if sortBy == SortByCreated {
+		switch {
+		case rec.CreatedAt.Before(c.CreatedAt):
+			cmp = -1
+		case rec.CreatedAt.After(c.CreatedAt):
+			cmp = 1
+		}
+	}
+	if cmp == 0 {
+		cmp = strings.Compare(rec.ShortKey, c.ShortKey)
+	}
+	if desc {
+		return cmp < 0
+	}
+	return cmp > 0
+}
+
+// DecodeListCursor - декодирует курсор, полученный от клиента.
+func DecodeListCursor(s string) (ListCursor, error) {
+	c := ListCursor{}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
+
+// APITagInfo - метка пользователя и количество ссылок с ней.
+type APITagInfo struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// APIFolderInput - структура, используемая для создания папки.
+type APIFolderInput struct {
+	Name string `json:"name"`
+}
+
+// Folder - папка, объединяющая ссылки пользователя.
+type Folder struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"-"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// LinkCount - количество активных ссылок в папке (заполняется при выборке списка папок).
+	LinkCount int `json:"link_count"`
+}
+
+// UTMTemplate - шаблон UTM-параметров кампании.
+// В значениях подставляются {short_key} и {title} ссылки, по которой выполняется переход.
+type UTMTemplate struct {
+	Source   string `json:"utm_source,omitempty"`
+	Medium   string `json:"utm_medium,omitempty"`
+	Campaign string `json:"utm_campaign,omitempty"`
+	Term     string `json:"utm_term,omitempty"`
+	Content  string `json:"utm_content,omitempty"`
+}
+
+// Values - возвращает заполненные UTM-параметры шаблона для ссылки rec.
+func (t UTMTemplate) Values(rec URLRecord) url.Values {
+	replacer := strings.NewReplacer("{short_key}", rec.ShortKey, "{title}", rec.Title)
+	values := url.Values{}
+	for name, value := range map[string]string{
+		"utm_source":   t.Source,
+		"utm_medium":   t.Medium,
+		"utm_campaign": t.Campaign,
+		"utm_term":     t.Term,
+		"utm_content":  t.Content,
+	} {
+		if value != "" {
+			values.Set(name, replacer.Replace(value))
+		}
+	}
+	return values
+}
+
+// Campaign - маркетинговая кампания пользователя с шаблоном UTM-параметров для ее ссылок.
+type Campaign struct {
+	ID        int64       `json:"id"`
+	UserID    string      `json:"-"`
+	Name      string      `json:"name"`
+	UTM       UTMTemplate `json:"utm"`
+	CreatedAt time.Time   `json:"created_at"`
+	// LinkCount - количество активных ссылок кампании (заполняется при выборке списка кампаний).
+	LinkCount int `json:"link_count"`
+	// Clicks - количество переходов по ссылкам кампании.
+	Clicks int64 `json:"clicks"`
+}
+
+// APICampaignInput - структура, используемая для создания кампании.
+type APICampaignInput struct {
+	Name string      `json:"name"`
+	UTM  UTMTemplate `json:"utm"`
+}
+
+// Категории жалоб на ссылки.
+const (
+	ReportPhishing = "phishing" // фишинг, кража учетных данных
+	ReportMalware  = "malware"  // вредоносное ПО
+	ReportSpam     = "spam"     // спам
+	ReportOther    = "other"    // другое, подробности в комментарии
+)
+
+// Статусы жалоб на ссылки.
+const (
+	ReportStatusOpen      = "open"      // жалоба ожидает рассмотрения
+	ReportStatusResolved  = "resolved"  // ссылка отключена администратором
+	ReportStatusDismissed = "dismissed" // жалоба отклонена администратором
+)
+
+// ValidReportCategory - проверяет категорию жалобы.
+func ValidReportCategory(category string) bool {
+	switch category {
+	case ReportPhishing, ReportMalware, ReportSpam, ReportOther:
+		return true
+	}
+	return false
+}
+
+// AbuseReport - жалоба посетителя на короткую ссылку.
+type AbuseReport struct {
+	ID       int64  `json:"id"`
+	ShortKey string `json:"short_key"`
+	Category string `json:"category"`
+	Comment  string `json:"comment,omitempty"`
+	// ReporterIP - IP-адрес, с которого отправлена жалоба.
+	ReporterIP string    `json:"reporter_ip"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	// ClosedAt - время рассмотрения жалобы администратором.
+	ClosedAt *time.Time `json:"closed_at,omitempty"`
+}
+
+// APIReportInput - структура, используемая для отправки жалобы на ссылку.
+type APIReportInput struct {
+	Category string `json:"category"`
+	Comment  string `json:"comment"`
+}
+
+// ReportFilter - параметры выборки жалоб. Пустые поля не ограничивают выборку.
+type ReportFilter struct {
+	ShortKey string
+	Status   string
+}
+
+// Match - проверяет, что жалоба соответствует фильтру.
+func (f ReportFilter) Match(report AbuseReport) bool {
+	return (f.ShortKey == "" || report.ShortKey == f.ShortKey) && (f.Status == "" || report.Status == f.Status)
+}
+
+// KeyringInfo - сведения о ключах подписи токенов без самих ключей.
+type KeyringInfo struct {
+	// SigningKey - идентификатор ключа, которым подписываются новые токены.
+	SigningKey string `json:"signing_key"`
+	// Keys - идентификаторы всех ключей, которыми проверяются токены, первым - ключ подписи.
+	Keys []string `json:"keys"`
+	// Ephemeral - ключ создан случайно при запуске и будет потерян при перезапуске.
+	Ephemeral bool `json:"ephemeral"`
+}
+
+// Account - учетная запись зарегистрированного пользователя.
+// ID совпадает с идентификатором пользователя (user_id), под которым хранятся его ссылки.
+type Account struct {
+	ID       string `json:"user_id"`
+	Email    string `json:"email,omitempty"`
+	Username string `json:"username,omitempty"`
+	// PasswordHash - bcrypt-хеш пароля, в ответах не передается.
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// APIRegisterInput - структура, используемая для регистрации. Нужно указать email, имя пользователя или оба.
+// Claim - передать учетной записи ссылки текущего анонимного пользователя (см. ClaimResult).
+type APIRegisterInput struct {
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Claim    bool   `json:"claim"`
+}
+
+// APILoginInput - структура, используемая для входа. Login - email или имя пользователя.
+// Claim - передать учетной записи ссылки текущего анонимного пользователя.
+type APILoginInput struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	Claim    bool   `json:"claim"`
+}
+
+// Области действия ключей API.
+const (
+	ScopeRead  = "read"  // чтение ссылок пользователя (GET и HEAD запросы)
+	ScopeWrite = "write" // создание, изменение и удаление ссылок
+	ScopeAdmin = "admin" // административный API (/api/admin/...), выдается только администраторам
+)
+
+// ValidScope - проверяет область действия ключа API.
+func ValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeWrite || scope == ScopeAdmin
+}
+
+// APIKey - ключ API пользователя для запросов с заголовком "Authorization: Bearer <ключ>".
+type APIKey struct {
+	ID     string   `json:"id"`
+	UserID string   `json:"-"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// SecretHash - SHA-256 секретной части ключа в hex, сам ключ не хранится.
+	SecretHash string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Key - ключ целиком, возвращается только при создании.
+	Key string `json:"key,omitempty"`
+}
+
+// HasScope - проверяет, что ключ имеет область действия scope.
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyInput - структура, используемая для создания ключа API. Без областей действия ключ получает области read и write.
+type APIKeyInput struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// ClaimResult - ссылки, папки и кампании, переданные учетной записи от анонимного пользователя.
+type ClaimResult struct {
+	URLs      []string `json:"urls"`
+	Folders   []int64  `json:"folders"`
+	Campaigns []int64  `json:"campaigns"`
+}
+
+// APIClaimInput - структура, используемая для передачи ссылок анонимного пользователя учетной записи.
+// Token - токен анонимного пользователя (значение куки token до входа).
+type APIClaimInput struct {
+	Token string `json:"token"`
+}
+
+// APISignInResult - ответ на регистрацию и вход: учетная запись и переданные ей ссылки (если запрошено).
+// ClaimError - причина, по которой запрошенные ссылки не переданы (например, исчерпана квота учетной записи).
+type APISignInResult struct {
+	Account
+	Claimed    *ClaimResult `json:"claimed,omitempty"`
+	ClaimError string       `json:"claim_error,omitempty"`
+}
+
+// Роли участников рабочего пространства.
+const (
+	RoleOwner  = "owner"  // все действия со ссылками и управление участниками
+	RoleEditor = "editor" // создание, изменение, удаление и передача ссылок
+	RoleViewer = "viewer" // только чтение ссылок
+)
+
+// ValidRole - проверяет роль участника рабочего пространства.
+func ValidRole(role string) bool {
+	return role == RoleOwner || role == RoleEditor || role == RoleViewer
+}
+
+// RoleCanWrite - проверяет, что роль разрешает изменять ссылки рабочего пространства.
+func RoleCanWrite(role string) bool {
+	return role == RoleOwner || role == RoleEditor
+}
+
+// Workspace - рабочее пространство, ссылки которого доступны всем его участникам.
+// ID используется как идентификатор владельца (user_id) ссылок, папок и кампаний пространства.
+type Workspace struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Role - роль текущего пользователя (заполняется при выборке списка пространств пользователя).
+	Role string `json:"role,omitempty"`
+	// Members - участники пространства (заполняется при запросе пространства).
+	Members []WorkspaceMember `json:"members,omitempty"`
+}
+
+// WorkspaceMember - участник рабочего пространства.
+type WorkspaceMember struct {
+	WorkspaceID string `json:"-"`
+	UserID      string `json:"user_id"`
+	Role        string `json:"role"`
+	// Email, Username - данные учетной записи участника (заполняются при выборке участников).
+	Email    string    `json:"email,omitempty"`
+	Username string    `json:"username,omitempty"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+// APIWorkspaceInput - структура, используемая для создания рабочего пространства.
+type APIWorkspaceInput struct {
+	Name string `json:"name"`
+}
+
+// APIMemberInput - структура, используемая для добавления участника или изменения его роли.
+// Login - email или имя пользователя учетной записи.
+type APIMemberInput struct {
+	Login string `json:"login"`
+	Role  string `json:"role"`
+}
+
+// APITransferInput - структура, используемая для передачи ссылки другому владельцу.
+// FromWorkspace - пространство, которому сейчас принадлежит ссылка (пусто - ссылка пользователя).
+// ToWorkspace - пространство-получатель, ToUser - email или имя пользователя-получателя, которому отправляется
+// предложение передачи (см. TransferOffer); если оба пусты, ссылка передается самому пользователю.
+type APITransferInput struct {
+	FromWorkspace string `json:"from_workspace"`
+	ToWorkspace   string `json:"to_workspace"`
+	ToUser        string `json:"to_user"`
+}
+
+// TransferOffer - предложение передать ссылку другому пользователю. Ссылка остается у отправителя,
+// пока получатель не примет предложение; для ссылки действует только последнее предложение.
+type TransferOffer struct {
+	ShortKey   string    `json:"short_key"`
+	FromUserID string    `json:"from_user"`
+	ToUserID   string    `json:"to_user"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// RateLimit - ограничение частоты запросов по алгоритму token bucket:
+// корзина вмещает Burst токенов и пополняется со скоростью Rate токенов в секунду, каждый запрос забирает один токен.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateBucket - состояние корзины токенов: количество токенов Tokens на момент Updated.
+type RateBucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Take - пополняет корзину bucket на момент now и забирает из нее токен.
+// Пустая корзина (нулевой Updated) считается полной. Возвращает новое состояние корзины и,
+// если токенов не хватает, false и время до появления токена.
+func (l RateLimit) Take(bucket RateBucket, now time.Time) (RateBucket, bool, time.Duration) {
+	if bucket.Updated.IsZero() {
+		bucket = RateBucket{Tokens: float64(l.Burst), Updated: now}
+	}
+	if elapsed := now.Sub(bucket.Updated).Seconds(); elapsed > 0 {
+		bucket.Tokens += elapsed * l.Rate
+		bucket.Updated = now
+	}
+	if bucket.Tokens > float64(l.Burst) {
+		bucket.Tokens = float64(l.Burst)
+	}
+	if bucket.Tokens < 1 {
+		wait := time.Duration((1 - bucket.Tokens) / l.Rate * float64(time.Second))
+		return bucket, false, wait
+	}
+	bucket.Tokens--
+	return bucket, true, 0
+}
+
+// FullAt - возвращает момент, когда корзина bucket снова заполнится, и ее состояние можно не хранить.
+func (l RateLimit) FullAt(bucket RateBucket) time.Time {
+	missing := float64(l.Burst) - bucket.Tokens
+	return bucket.Updated.Add(time.Duration(missing / l.Rate * float64(time.Second)))
+}
+
+// Тарифы квот на создание ссылок.
+const (
+	QuotaTierFree    = "free"    // анонимный пользователь
+	QuotaTierAccount = "account" // учетная запись или рабочее пространство
+)
+
+// URLCounts - количество ссылок пользователя для учета квот.
+type URLCounts struct {
+	// Created - ссылки, созданные начиная с заданного момента, в любом статусе.
+	Created int
+	// Active - действующие ссылки: не удаленные и не истекшие.
+	Active int
+}
+
+// URLQuota - квоты пользователя, которые хранилище проверяет вместе с записью новых ссылок,
+// чтобы параллельные запросы (в том числе к разным экземплярам сервиса) не превысили квоту.
+// Нулевая квота не ограничена.
+type URLQuota struct {
+	Daily  int
+	Active int
+	// Key - ключ квоты, например IP-адрес клиента анонимного пользователя: если задан, учитываются ссылки,
+	// созданные с этим ключом (URLMeta.QuotaKey), а не ссылки владельца.
+	Key string
+	// DayStart - начало текущих суток квоты, ResetAt - время ее сброса.
+	DayStart time.Time
+	ResetAt  time.Time
+}
+
+// Enabled - проверяет, что задана хотя бы одна квота.
+func (q URLQuota) Enabled() bool {
+	return q.Daily > 0 || q.Active > 0
+}
+
+// Check - проверяет, что пользователь, у которого уже есть counts ссылок, может создать еще count ссылок.
+// Если квота исчерпана, возвращает *errorapp.QuotaExceededError.
+func (q URLQuota) Check(counts URLCounts, count int) error {
+	if q.Daily > 0 && counts.Created+count > q.Daily {
+		return errorapp.NewQuotaExceededError(errorapp.QuotaDaily, q.Daily, NewQuotaCounter(q.Daily, counts.Created).Remaining, q.ResetAt)
+	}
+	if q.Active > 0 && counts.Active+count > q.Active {
+		return errorapp.NewQuotaExceededError(errorapp.QuotaActive, q.Active, NewQuotaCounter(q.Active, counts.Active).Remaining, time.Time{})
+	}
+	return nil
+}
+
+// QuotaCounter - использование одной квоты. Limit 0 - квота не ограничена, Remaining в этом случае -1.
+type QuotaCounter struct {
+	Limit     int `json:"limit"`
+	Used      int `json:"used"`
+	Remaining int `json:"remaining"`
+}
+
+// APIQuota - квоты пользователя на создание ссылок.
+type APIQuota struct {
+	// Tier - тариф квот (QuotaTierFree, QuotaTierAccount).
+	Tier string `json:"tier"`
+	// Daily - ссылки, созданные с начала текущих суток UTC, сбрасывается в ResetAt.
+	Daily   QuotaCounter `json:"daily"`
+	ResetAt time.Time    `json:"reset_at"`
+	// Active - действующие ссылки пользователя.
+	Active QuotaCounter `json:"active"`
+}
+
+// NewQuotaCounter - возвращает использование квоты с ограничением limit (0 - без ограничения).
+func NewQuotaCounter(limit, used int) QuotaCounter {
+	remaining := -1
+	if limit > 0 {
+		remaining = limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+	}
+	return QuotaCounter{Limit: limit, Used: used, Remaining: remaining}
+}
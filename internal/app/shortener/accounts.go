@@ -0,0 +1,228 @@
+package shortener
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/bubu256/go-url-shortener-server/internal/app/token"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Ограничения учетных записей и ключей API.
+const (
+	// MinPasswordLength, MaxPasswordLength - допустимая длина пароля в байтах (bcrypt учитывает не больше 72 байт).
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+	// MaxAPIKeyName - максимальная длина названия ключа API в символах.
+	MaxAPIKeyName = 100
+	// APIKeyPrefix - префикс ключа API, по которому его легко найти в конфигурации и логах.
+	APIKeyPrefix = "usk_"
+)
+
+// apiKeyIDSize, apiKeySecretSize - размер идентификатора и секретной части ключа API в байтах.
+const (
+	apiKeyIDSize     = 8
+	apiKeySecretSize = 32
+)
+
+// dummyPasswordHash - хеш, с которым сравнивается пароль при входе под несуществующим именем,
+// чтобы время ответа не выдавало, зарегистрировано ли имя.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// Register создает учетную запись с новым идентификатором пользователя.
+// Email и имя пользователя приводятся к нижнему регистру, пароль хранится в виде bcrypt-хеша.
+// Возвращает ошибку, оборачивающую errorapp.ErrorInvalidAccount, или errorapp.ErrorAccountExists.
+func (s *Shortener) Register(input schema.APIRegisterInput) (schema.Account, error) {
+	account := schema.Account{
+		Email:    strings.ToLower(strings.TrimSpace(input.Email)),
+		Username: strings.ToLower(strings.TrimSpace(input.Username)),
+	}
+	if account.Email == "" && account.Username == "" {
+		return account, fmt.Errorf("%w укажите email или имя пользователя", errorapp.ErrorInvalidAccount)
+	}
+	if account.Email != "" {
+		addr, err := mail.ParseAddress(account.Email)
+		if err != nil || addr.Address != account.Email || len(account.Email) > 254 {
+			return account, fmt.Errorf("%w некорректный email", errorapp.ErrorInvalidAccount)
+		}
+	}
+	if account.Username != "" && !validUsername(account.Username) {
+		return account, fmt.Errorf("%w имя пользователя должно начинаться с буквы и содержать от 3 до 32 латинских букв, цифр и знаков . _ -",
+			errorapp.ErrorInvalidAccount)
+	}
+	if len(input.Password) < MinPasswordLength || len(input.Password) > MaxPasswordLength {
+		return account, fmt.Errorf("%w длина пароля должна быть от %d до %d байт", errorapp.ErrorInvalidAccount,
+			MinPasswordLength, MaxPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return account, err
+	}
+	account.PasswordHash = string(hash)
+	if account.ID, err = token.NewUserID(); err != nil {
+		return account, err
+	}
+	return s.db.CreateAccount(account)
+}
+
+// validUsername - проверяет имя пользователя: 3-32 символа a-z, 0-9, ".", "_", "-", первый символ - буква.
+// Имя не может содержать "@", поэтому не совпадает ни с одним email.
+func validUsername(username string) bool {
+	if len(username) < 3 || len(username) > 32 || username[0] < 'a' || username[0] > 'z' {
+		return false
+	}
+	for _, r := range username {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// Login проверяет email или имя пользователя и пароль и возвращает учетную запись.
+// При неверных данных возвращает errorapp.ErrorInvalidCredentials, не уточняя, что именно неверно.
+func (s *Shortener) Login(input schema.APILoginInput) (schema.Account, error) {
+	account, err := s.db.FindAccount(strings.ToLower(strings.TrimSpace(input.Login)))
+	if errors.Is(err, errorapp.ErrorAccountNotFound) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(input.Password))
+		return schema.Account{}, errorapp.ErrorInvalidCredentials
+	}
+	if err != nil {
+		return schema.Account{}, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(input.Password)) != nil {
+		return schema.Account{}, errorapp.ErrorInvalidCredentials
+	}
+	return account, nil
+}
+
+// UserToken выдает токен существующему пользователю userID (например, после входа в учетную запись).
+func (s *Shortener) UserToken(userID string) (string, token.Claims, error) {
+	return s.tokens.Issue(userID, time.Now())
+}
+
+// Account возвращает учетную запись пользователя userID.
+// Для анонимного пользователя возвращается errorapp.ErrorLoginRequired.
+func (s *Shortener) Account(userID string) (schema.Account, error) {
+	account, err := s.db.GetAccount(userID)
+	if errors.Is(err, errorapp.ErrorAccountNotFound) {
+		return account, errorapp.ErrorLoginRequired
+	}
+	return account, err
+}
+
+// ClaimLinks передает учетной записи пользователя accountUserID все ссылки, папки и кампании
+// анонимного пользователя anonymousUserID, чтобы после регистрации не потерять созданные ранее ссылки.
+// Для анонимного accountUserID возвращает errorapp.ErrorLoginRequired; если anonymousUserID пустой,
+// совпадает с accountUserID или принадлежит другой учетной записи - ошибку, оборачивающую errorapp.ErrorInvalidClaim.
+// Действующие ссылки учитываются в квоте действующих ссылок учетной записи, как при передаче (см. TransferURL):
+// если места не хватает, ничего не передается и возвращается *errorapp.QuotaExceededError.
+func (s *Shortener) ClaimLinks(accountUserID, anonymousUserID string) (schema.ClaimResult, error) {
+	if _, err := s.Account(accountUserID); err != nil {
+		return schema.ClaimResult{}, err
+	}
+	if anonymousUserID == "" || anonymousUserID == accountUserID {
+		return schema.ClaimResult{}, fmt.Errorf("%w укажите токен другого анонимного пользователя", errorapp.ErrorInvalidClaim)
+	}
+	_, err := s.db.GetAccount(anonymousUserID)
+	if err == nil {
+		return schema.ClaimResult{}, fmt.Errorf("%w ссылки другой учетной записи передать нельзя", errorapp.ErrorInvalidClaim)
+	}
+	if !errors.Is(err, errorapp.ErrorAccountNotFound) {
+		return schema.ClaimResult{}, err
+	}
+	return s.db.ReassignUser(anonymousUserID, accountUserID, s.transferQuota(accountUserID))
+}
+
+// CreateAPIKey создает ключ API зарегистрированного пользователя userID.
+// Без областей действия ключ получает области read и write; область admin может запросить только администратор.
+// Ключ целиком возвращается только здесь, в хранилище записывается SHA-256 его секретной части.
+func (s *Shortener) CreateAPIKey(userID string, input schema.APIKeyInput) (schema.APIKey, error) {
+	if _, err := s.Account(userID); err != nil {
+		return schema.APIKey{}, err
+	}
+	key := schema.APIKey{UserID: userID, Name: strings.TrimSpace(input.Name), Scopes: make([]string, 0, len(input.Scopes))}
+	if key.Name == "" || utf8.RuneCountInString(key.Name) > MaxAPIKeyName {
+		return key, fmt.Errorf("%w название ключа должно содержать от 1 до %d символов", errorapp.ErrorInvalidAPIKey, MaxAPIKeyName)
+	}
+	for _, scope := range input.Scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !schema.ValidScope(scope) {
+			return key, fmt.Errorf("%w неизвестная область действия %q", errorapp.ErrorInvalidAPIKey, scope)
+		}
+		if scope == schema.ScopeAdmin && !s.IsAdmin(userID) {
+			return key, fmt.Errorf("%w область действия %q доступна только администратору", errorapp.ErrorInvalidAPIKey, scope)
+		}
+		if !key.HasScope(scope) {
+			key.Scopes = append(key.Scopes, scope)
+		}
+	}
+	if len(key.Scopes) == 0 {
+		key.Scopes = []string{schema.ScopeRead, schema.ScopeWrite}
+	}
+	id, err := GenerateRandomBytes(apiKeyIDSize)
+	if err != nil {
+		return key, err
+	}
+	secret, err := GenerateRandomBytes(apiKeySecretSize)
+	if err != nil {
+		return key, err
+	}
+	key.ID = hex.EncodeToString(id)
+	key.SecretHash = hashSecret(hex.EncodeToString(secret))
+	key, err = s.db.CreateAPIKey(key)
+	if err != nil {
+		return key, err
+	}
+	key.Key = APIKeyPrefix + key.ID + "_" + hex.EncodeToString(secret)
+	return key, nil
+}
+
+// ListAPIKeys возвращает ключи API пользователя userID без секретных частей.
+func (s *Shortener) ListAPIKeys(userID string) ([]schema.APIKey, error) {
+	return s.db.ListAPIKeys(userID)
+}
+
+// RevokeAPIKey отзывает ключ API id пользователя userID. Отозванный ключ перестает приниматься сразу.
+func (s *Shortener) RevokeAPIKey(userID, id string) (schema.APIKey, error) {
+	return s.db.RevokeAPIKey(id, userID)
+}
+
+// AuthenticateAPIKey проверяет ключ API вида "usk_<идентификатор>_<секрет>" и возвращает его данные.
+// Для неизвестного, поврежденного или отозванного ключа возвращает ошибку, оборачивающую errorapp.ErrorAPIKeyRejected.
+func (s *Shortener) AuthenticateAPIKey(raw string) (schema.APIKey, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(raw, APIKeyPrefix), "_")
+	if !strings.HasPrefix(raw, APIKeyPrefix) || !ok {
+		return schema.APIKey{}, fmt.Errorf("%w неизвестный формат ключа", errorapp.ErrorAPIKeyRejected)
+	}
+	key, err := s.db.GetAPIKey(id)
+	if errors.Is(err, errorapp.ErrorAPIKeyNotFound) {
+		return key, fmt.Errorf("%w ключ не найден", errorapp.ErrorAPIKeyRejected)
+	}
+	if err != nil {
+		return key, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.SecretHash)) != 1 {
+		return schema.APIKey{}, fmt.Errorf("%w неверный ключ", errorapp.ErrorAPIKeyRejected)
+	}
+	if key.RevokedAt != nil {
+		return schema.APIKey{}, fmt.Errorf("%w ключ отозван", errorapp.ErrorAPIKeyRejected)
+	}
+	return key, nil
+}
+
+// hashSecret - возвращает SHA-256 секретной части ключа API в hex.
+// Секрет случайный и длинный, поэтому медленный хеш, как для паролей, не нужен.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,101 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+)
+
+// IsAdmin проверяет, что пользователь userID - учетная запись, email или имя которой указаны в ADMIN_USERS.
+func (s *Shortener) IsAdmin(userID string) bool {
+	if len(s.admins) == 0 || userID == "" {
+		return false
+	}
+	account, err := s.db.GetAccount(userID)
+	if err != nil {
+		return false
+	}
+	return (account.Email != "" && s.admins[account.Email]) || (account.Username != "" && s.admins[account.Username])
+}
+
+// SearchURLs ищет ссылки всех пользователей для администратора.
+// Владелец opts.Owner задается идентификатором пользователя, email или именем учетной записи;
+// без фильтра по статусу возвращаются ссылки в любом статусе.
+// Возвращает ошибку, оборачивающую errorapp.ErrorInvalidListOptions, если параметры некорректны.
+func (s *Shortener) SearchURLs(opts schema.ListURLsOptions) (schema.URLPage, error) {
+	if opts.Status == "" {
+		opts.Status = schema.URLStatusAll
+	}
+	opts, err := normalizeListOptions(opts)
+	if err != nil {
+		return schema.URLPage{}, err
+	}
+	if opts.Owner, err = s.resolveOwner(opts.Owner); err != nil {
+		return schema.URLPage{}, err
+	}
+	return s.db.SearchURLs(opts)
+}
+
+// PurgeURL окончательно удаляет ссылку shortKey вместе с ее метками, жалобами и переходами.
+// В отличие от удаления пользователем, ссылка не сохраняется в хранилище и не может быть восстановлена.
+func (s *Shortener) PurgeURL(shortKey string) error {
+	purged, err := s.db.PurgeURLs([]string{shortKey})
+	if err != nil {
+		return err
+	}
+	if len(purged) == 0 {
+		return errorapp.ErrorURLNotFound
+	}
+	return nil
+}
+
+// PurgeUserURLs окончательно удаляет все ссылки владельца owner (идентификатор пользователя, email или имя)
+// и возвращает их короткие ключи.
+func (s *Shortener) PurgeUserURLs(owner string) ([]string, error) {
+	userID, err := s.resolveOwner(owner)
+	if err != nil {
+		return nil, err
+	}
+	if userID == "" {
+		return nil, fmt.Errorf("%w не указан владелец ссылок", errorapp.ErrorInvalidListOptions)
+	}
+	keys := make([]string, 0)
+	opts := schema.ListURLsOptions{Owner: userID, Status: schema.URLStatusAll, SortBy: schema.SortByKey, Limit: MaxListLimit}
+	for {
+		page, err := s.db.SearchURLs(opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range page.Items {
+			keys = append(keys, rec.ShortKey)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	if len(keys) == 0 {
+		return keys, nil
+	}
+	return s.db.PurgeURLs(keys)
+}
+
+// resolveOwner - возвращает идентификатор пользователя по email или имени учетной записи;
+// если учетная запись не найдена, owner считается идентификатором пользователя.
+func (s *Shortener) resolveOwner(owner string) (string, error) {
+	owner = strings.TrimSpace(owner)
+	if owner == "" {
+		return "", nil
+	}
+	account, err := s.db.FindAccount(strings.ToLower(owner))
+	if errors.Is(err, errorapp.ErrorAccountNotFound) {
+		return owner, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return account.ID, nil
+}
@@ -0,0 +1,120 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"golang.org/x/exp/slices"
+)
+
+// MaxChainHops - максимальное количество коротких ссылок сервиса, через которые разворачивается цепочка.
+const MaxChainHops = 10
+
+// SetServiceURLs задает адреса, по которым доступен сам сервис: базовый URL коротких ссылок baseURL
+// и альтернативные домены aliases, на которых сервис отвечает по тем же путям.
+// Исходный URL, указывающий на короткую ссылку сервиса, при создании ссылки заменяется конечным адресом
+// цепочки (см. resolveChain), остальные ссылки на сервис запрещены политикой.
+// Вызывается при запуске до начала обработки запросов.
+func (s *Shortener) SetServiceURLs(baseURL string, aliases ...string) {
+	s.serviceHosts, s.servicePath = nil, "/"
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		s.serviceHosts = append(s.serviceHosts, u.Hostname())
+		s.servicePath = strings.TrimSuffix(u.Path, "/") + "/"
+	}
+	for _, alias := range aliases {
+		if u, err := url.Parse(alias); err == nil && u.Host != "" {
+			alias = u.Hostname()
+		}
+		if alias = strings.TrimSpace(alias); alias != "" {
+			s.serviceHosts = append(s.serviceHosts, alias)
+		}
+	}
+	for i, host := range s.serviceHosts {
+		if normalized, err := normalizeHost(host); err == nil {
+			s.serviceHosts[i] = normalized
+		}
+	}
+	s.policy.SetServiceHosts(s.serviceHosts...)
+}
+
+// shortLink - возвращает короткий ключ и путь после него, если u является короткой ссылкой сервиса.
+// Порт не учитывается: сервис на том же хосте считается тем же сервисом.
+func (s *Shortener) shortLink(u *url.URL) (key, extraPath string, ok bool) {
+	host, err := normalizeHost(u.Hostname())
+	if err != nil || !slices.Contains(s.serviceHosts, host) {
+		return "", "", false
+	}
+	if !strings.HasPrefix(u.Path, s.servicePath) {
+		return "", "", false
+	}
+	key, extraPath, _ = strings.Cut(strings.TrimPrefix(u.Path, s.servicePath), "/")
+	key = strings.TrimSuffix(key, "+") // ссылка на страницу предпросмотра
+	return key, extraPath, key != ""
+}
+
+// resolveChain - если fullURL указывает на короткую ссылку сервиса, разворачивает цепочку коротких ссылок
+// и возвращает конечный адрес с учетом передачи параметров и пути каждой ссылки цепочки.
+//
+// Возвращает ошибку, оборачивающую errorapp.ErrorRedirectLoop, если цепочка замкнута или длиннее MaxChainHops,
+// и errorapp.ErrorShortLinkTarget, если короткая ссылка цепочки не существует, недоступна или выбирает
+// адрес перехода по правилам или A/B-тесту (такую ссылку нельзя заменить одним адресом).
+func (s *Shortener) resolveChain(fullURL string) (string, error) {
+	seen := make(map[string]bool)
+	for {
+		u, err := url.Parse(fullURL)
+		if err != nil {
+			return fullURL, nil
+		}
+		key, extraPath, ok := s.shortLink(u)
+		if !ok {
+			return fullURL, nil
+		}
+		if seen[key] {
+			return "", fmt.Errorf("%w короткая ссылка %s повторяется в цепочке", errorapp.ErrorRedirectLoop, key)
+		}
+		if len(seen) == MaxChainHops {
+			return "", fmt.Errorf("%w цепочка длиннее %d коротких ссылок", errorapp.ErrorRedirectLoop, MaxChainHops)
+		}
+		seen[key] = true
+		link, err := s.GetLink(key)
+		var notActive *errorapp.URLNotActiveError
+		switch {
+		case errors.Is(err, errorapp.ErrorPageNotAvailable), errors.As(err, &notActive):
+			return "", fmt.Errorf("%w короткая ссылка %s недоступна", errorapp.ErrorShortLinkTarget, key)
+		case err != nil:
+			return "", fmt.Errorf("%w короткая ссылка %s не найдена", errorapp.ErrorShortLinkTarget, key)
+		case len(link.Rules) > 0 || len(link.Targets) > 0:
+			return "", fmt.Errorf("%w короткая ссылка %s выбирает адрес по правилам или A/B-тесту",
+				errorapp.ErrorShortLinkTarget, key)
+		}
+		next, err := s.Target(link, u.Query(), extraPath)
+		if err != nil {
+			return "", fmt.Errorf("%w короткая ссылка %s не передает путь запроса", errorapp.ErrorShortLinkTarget, key)
+		}
+		if u.Fragment != "" && !strings.Contains(next, "#") {
+			// фрагмент сохраняется браузером при перенаправлении
+			next += "#" + u.EscapedFragment()
+		}
+		fullURL = next
+	}
+}
+
+// resolveDestinations - заменяет адреса правил и вариантов A/B-теста, указывающие на короткие ссылки сервиса,
+// конечными адресами цепочек.
+func (s *Shortener) resolveDestinations(rules []schema.RedirectRule, targets []schema.SplitTarget) (err error) {
+	for i := range rules {
+		if rules[i].URL, err = s.resolveChain(rules[i].URL); err != nil {
+			return fmt.Errorf("%w (правило %d)", err, rules[i].ID)
+		}
+	}
+	for i := range targets {
+		if targets[i].URL, err = s.resolveChain(targets[i].URL); err != nil {
+			return fmt.Errorf("%w (вариант %d)", err, targets[i].ID)
+		}
+	}
+	return nil
+}
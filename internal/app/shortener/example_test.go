@@ -59,3 +59,25 @@ func ExampleCounterID_Run_goroutine() {
 	// ожидаем завершения всех горутин
 	wg.Wait()
 }
+
+func ExampleNormalizeURL() {
+	for _, rawURL := range []string{
+		"HTTPS://Пример.РФ:443/Путь?b=2&a=1#top",
+		"http://Example.com:8080/?utm=1",
+		"javascript:alert(1)",
+		"example.com/page",
+	} {
+		fullURL, err := NormalizeURL(rawURL, true, true)
+		if err != nil {
+			fmt.Println("ошибка:", err)
+			continue
+		}
+		fmt.Println(fullURL)
+	}
+
+	// Output:
+	// https://xn--e1afmkfd.xn--p1ai/%D0%9F%D1%83%D1%82%D1%8C?a=1&b=2
+	// http://example.com:8080/?utm=1
+	// ошибка: некорректный исходный URL; допустимы только схемы http и https
+	// ошибка: некорректный исходный URL; допустимы только схемы http и https
+}
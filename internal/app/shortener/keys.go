@@ -0,0 +1,85 @@
+package shortener
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bubu256/go-url-shortener-server/config"
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/bubu256/go-url-shortener-server/internal/app/token"
+)
+
+// loadKeys - загружает ключи токенов при создании сервиса. Источники в порядке приоритета:
+// файл ключей (KEY_FILE), ключ KEY с дополнительными ключами проверки VERIFY_KEYS, случайный ключ.
+// Случайный ключ действует только до перезапуска, после него все выданные токены становятся недействительными.
+func (s *Shortener) loadKeys(cfg config.CfgService) {
+	if cfg.KeyFile != "" {
+		signing, verify, err := token.LoadKeyFile(cfg.KeyFile)
+		if err == nil {
+			s.keys = token.NewKeyring(signing, verify...)
+			return
+		}
+		log.Println("не удалось загрузить файл ключей;", err)
+	}
+	if cfg.SecretKey != "" {
+		signing, err := token.DecodeKey(cfg.SecretKey)
+		if err == nil {
+			verify := make([][]byte, 0, len(cfg.VerifyKeys))
+			for _, encoded := range cfg.VerifyKeys {
+				key, err := token.DecodeKey(encoded)
+				if err != nil {
+					log.Println("ключ проверки пропущен;", err)
+					continue
+				}
+				verify = append(verify, key)
+			}
+			s.keys = token.NewKeyring(signing, verify...)
+			return
+		}
+		log.Println("ошибка декодирования секретного ключа (hex);", err)
+	}
+	genKey, err := GenerateRandomBytes(32)
+	if err != nil {
+		log.Fatal("ошибка при генерации секретного ключа (shortener new generateRandomKey);")
+	}
+	log.Printf("создан рандомный ключ %s", token.KeyID(genKey))
+	log.Println("токены пользователей станут недействительны после перезапуска, задайте KEY или KEY_FILE;")
+	s.keys = token.NewKeyring(genKey)
+	s.ephemeralKey.Store(true)
+}
+
+// ReloadKeys перечитывает файл ключей (KEY_FILE) и возвращает сведения о новых ключах.
+// Новые токены подписываются первым ключом файла, ранее выданные проверяются всеми ключами файла.
+// При ошибке продолжают действовать прежние ключи; если файл не задан или некорректен,
+// возвращается ошибка, оборачивающая errorapp.ErrorKeyring.
+func (s *Shortener) ReloadKeys() (schema.KeyringInfo, error) {
+	if s.keyFile == "" {
+		return s.KeyringInfo(), fmt.Errorf("%w файл ключей не задан", errorapp.ErrorKeyring)
+	}
+	signing, verify, err := token.LoadKeyFile(s.keyFile)
+	if err != nil {
+		return s.KeyringInfo(), err
+	}
+	s.keys.Set(signing, verify...)
+	s.ephemeralKey.Store(false)
+	return s.KeyringInfo(), nil
+}
+
+// KeyringInfo возвращает идентификаторы действующих ключей токенов (сами ключи не раскрываются).
+func (s *Shortener) KeyringInfo() schema.KeyringInfo {
+	signing, _ := s.keys.Signing()
+	return schema.KeyringInfo{SigningKey: signing, Keys: s.keys.IDs(), Ephemeral: s.ephemeralKey.Load()}
+}
+
+// EphemeralKey проверяет, что токены подписываются случайным ключом, созданным при запуске.
+func (s *Shortener) EphemeralKey() bool {
+	return s.ephemeralKey.Load()
+}
+
+// TokenNeedsRefresh проверяет, что действительный токен пора заменить новым (см. RefreshToken):
+// он старого формата, подходит к концу срока действия или подписан ключом, который больше не является ключом подписи.
+func (s *Shortener) TokenNeedsRefresh(claims token.Claims) bool {
+	return s.tokens.Stale(claims, time.Now())
+}
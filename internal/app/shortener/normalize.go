@@ -0,0 +1,89 @@
+package shortener
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"golang.org/x/net/idna"
+)
+
+// hostProfile - профиль преобразования доменных имен в punycode: правила IDNA для поиска в DNS,
+// но с разрешенным "_" в метках (встречается в реальных поддоменах) и проверкой длины меток.
+var hostProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false), idna.BidiRule(), idna.VerifyDNSLength(true))
+
+// defaultPorts - порты, используемые по умолчанию для допустимых схем исходного URL.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// NormalizeURL проверяет исходный URL ссылки и приводит его к каноническому виду:
+// схема и хост в нижнем регистре, международный домен в punycode, порт по умолчанию для схемы удален.
+// stripFragment - удалить фрагмент (#...), sortQuery - отсортировать параметры запроса по имени.
+//
+// Допускаются только абсолютные URL со схемой http или https. Для некорректного URL
+// возвращается ошибка, оборачивающая errorapp.ErrorInvalidURL.
+func NormalizeURL(rawURL string, stripFragment, sortQuery bool) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", fmt.Errorf("%w передан пустой URL", errorapp.ErrorInvalidURL)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("%w %v", errorapp.ErrorInvalidURL, err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := defaultPorts[u.Scheme]; !ok {
+		return "", fmt.Errorf("%w допустимы только схемы http и https", errorapp.ErrorInvalidURL)
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", fmt.Errorf("%w URL должен содержать хост", errorapp.ErrorInvalidURL)
+	}
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("%w некорректный порт %q", errorapp.ErrorInvalidURL, port)
+		}
+	}
+	if port == "" || port == defaultPorts[u.Scheme] {
+		// квадратные скобки IPv6 адреса добавляются обратно JoinHostPort, поэтому без порта добавляем их сами
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		u.Host = host
+	} else {
+		u.Host = net.JoinHostPort(host, port)
+	}
+	if stripFragment {
+		u.Fragment, u.RawFragment = "", ""
+	}
+	if sortQuery && u.RawQuery != "" {
+		// Encode сортирует параметры по имени, порядок значений одного параметра сохраняется
+		if query, err := url.ParseQuery(u.RawQuery); err == nil {
+			u.RawQuery = query.Encode()
+		}
+	}
+	return u.String(), nil
+}
+
+// normalizeHost - приводит хост исходного URL к нижнему регистру и переводит международное доменное имя в punycode.
+// IP-адреса возвращаются без изменений (IPv6 - без квадратных скобок).
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return "", fmt.Errorf("%w URL должен содержать хост", errorapp.ErrorInvalidURL)
+	}
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	ascii, err := hostProfile.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("%w некорректное доменное имя %q", errorapp.ErrorInvalidURL, host)
+	}
+	return ascii, nil
+}
@@ -0,0 +1,79 @@
+package shortener
+
+import (
+	"time"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+)
+
+// quotaLimits - квоты тарифа: ссылок в сутки и действующих ссылок (0 - без ограничения).
+type quotaLimits struct {
+	daily  int
+	active int
+}
+
+// enabled - проверяет, что задана хотя бы одна квота.
+func (q quotaLimits) enabled() bool {
+	return q.daily > 0 || q.active > 0
+}
+
+// Quota возвращает квоты пользователя userID на создание ссылок и их использование.
+// Учетные записи и рабочие пространства получают квоты ACCOUNT_QUOTA_*, остальные пользователи - QUOTA_*,
+// администраторы не ограничены. Суточная квота считается с начала суток UTC, удаление ссылки ее не восстанавливает.
+// Анонимный токен выдается без ограничений, поэтому квоты анонимных пользователей считаются по IP-адресу
+// клиента clientIP: учитываются ссылки, созданные анонимными пользователями с этого адреса и не переданные
+// учетной записи. Без адреса квоты считаются по пользователю.
+func (s *Shortener) Quota(userID, clientIP string) (schema.APIQuota, error) {
+	tier, quota := s.quotaTier(userID, clientIP)
+	counts, err := s.db.CountUserURLs(userID, quota.Key, quota.DayStart)
+	if err != nil {
+		return schema.APIQuota{}, err
+	}
+	return schema.APIQuota{
+		Tier:    tier,
+		Daily:   schema.NewQuotaCounter(quota.Daily, counts.Created),
+		ResetAt: quota.ResetAt,
+		Active:  schema.NewQuotaCounter(quota.Active, counts.Active),
+	}, nil
+}
+
+// quotaTier - возвращает тариф и квоты пользователя на текущие сутки.
+// Квоты анонимного пользователя получают ключ по IP-адресу клиента clientIP (см. Quota).
+func (s *Shortener) quotaTier(userID, clientIP string) (string, schema.URLQuota) {
+	tier, limits, key := schema.QuotaTierFree, s.freeQuota, ""
+	switch {
+	case s.IsAdmin(userID):
+		tier, limits = schema.QuotaTierAccount, quotaLimits{}
+	case s.isAccount(userID):
+		tier, limits = schema.QuotaTierAccount, s.accountQuota
+	case clientIP != "":
+		key = ipQuotaKey(clientIP)
+	}
+	dayStart := time.Now().UTC().Truncate(24 * time.Hour)
+	return tier, schema.URLQuota{Daily: limits.daily, Active: limits.active, Key: key, DayStart: dayStart,
+		ResetAt: dayStart.Add(24 * time.Hour)}
+}
+
+// ipQuotaKey - возвращает ключ квоты анонимных пользователей с IP-адреса ip.
+func ipQuotaKey(ip string) string {
+	return "ip:" + ip
+}
+
+// isAccount - проверяет, что userID - учетная запись или рабочее пространство.
+func (s *Shortener) isAccount(userID string) bool {
+	if _, err := s.db.GetAccount(userID); err == nil {
+		return true
+	}
+	_, err := s.db.GetWorkspace(userID)
+	return err == nil
+}
+
+// urlQuota - возвращает квоты, которые хранилище проверяет при записи ссылок пользователя userID
+// с IP-адреса clientIP. Если квоты не заданы, пользователь не определяется, а адрес не сохраняется.
+func (s *Shortener) urlQuota(userID, clientIP string) schema.URLQuota {
+	if !s.freeQuota.enabled() && !s.accountQuota.enabled() {
+		return schema.URLQuota{}
+	}
+	_, quota := s.quotaTier(userID, clientIP)
+	return quota
+}
@@ -0,0 +1,67 @@
+package shortener
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+)
+
+// MaxReportComment - максимальная длина комментария к жалобе в символах.
+const MaxReportComment = 1000
+
+// ReportURL сохраняет жалобу посетителя с IP-адреса reporterIP на ссылку shortKey.
+// Пустая категория считается категорией schema.ReportOther.
+// Для несуществующей или удаленной ссылки возвращается errorapp.ErrorURLNotFound,
+// для некорректной жалобы - ошибка, оборачивающая errorapp.ErrorInvalidReport.
+func (s *Shortener) ReportURL(shortKey string, input schema.APIReportInput, reporterIP string) (schema.AbuseReport, error) {
+	category := strings.ToLower(strings.TrimSpace(input.Category))
+	if category == "" {
+		category = schema.ReportOther
+	}
+	if !schema.ValidReportCategory(category) {
+		return schema.AbuseReport{}, fmt.Errorf("%w неизвестная категория %q", errorapp.ErrorInvalidReport, input.Category)
+	}
+	comment := strings.TrimSpace(input.Comment)
+	if utf8.RuneCountInString(comment) > MaxReportComment {
+		return schema.AbuseReport{}, fmt.Errorf("%w комментарий длиннее %d символов", errorapp.ErrorInvalidReport, MaxReportComment)
+	}
+	rec, err := s.db.GetRecord(shortKey)
+	if err != nil {
+		return schema.AbuseReport{}, err
+	}
+	if !rec.Available {
+		return schema.AbuseReport{}, errorapp.ErrorURLNotFound
+	}
+	return s.db.AddReport(schema.AbuseReport{ShortKey: shortKey, Category: category, Comment: comment, ReporterIP: reporterIP})
+}
+
+// ListReports возвращает жалобы, соответствующие фильтру, от новых к старым.
+func (s *Shortener) ListReports(filter schema.ReportFilter) ([]schema.AbuseReport, error) {
+	switch filter.Status {
+	case "", schema.ReportStatusOpen, schema.ReportStatusResolved, schema.ReportStatusDismissed:
+	default:
+		return nil, fmt.Errorf("%w неизвестный статус жалобы %q", errorapp.ErrorInvalidListOptions, filter.Status)
+	}
+	return s.db.ListReports(filter)
+}
+
+// DismissReports отклоняет открытые жалобы на ссылку shortKey, ссылка продолжает работать.
+// Возвращает отклоненные жалобы.
+func (s *Shortener) DismissReports(shortKey string) ([]schema.AbuseReport, error) {
+	if _, err := s.db.GetRecord(shortKey); err != nil {
+		return nil, err
+	}
+	return s.db.CloseReports(shortKey, schema.ReportStatusDismissed)
+}
+
+// resolveReports - закрывает открытые жалобы на ссылку shortKey после ее отключения.
+// Ошибка только логируется: ссылка уже отключена, а жалобы можно закрыть повторным отключением.
+func (s *Shortener) resolveReports(shortKey string) {
+	if _, err := s.db.CloseReports(shortKey, schema.ReportStatusResolved); err != nil {
+		log.Println("не удалось закрыть жалобы на отключенную ссылку;", err)
+	}
+}
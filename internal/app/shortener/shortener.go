@@ -2,19 +2,26 @@
 package shortener
 
 import (
-	"crypto/hmac"
 	crand "crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/bubu256/go-url-shortener-server/config"
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/policy"
 	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/bubu256/go-url-shortener-server/internal/app/targeting"
+	"github.com/bubu256/go-url-shortener-server/internal/app/token"
 	"github.com/bubu256/go-url-shortener-server/pkg/storage"
+	"golang.org/x/exp/slices"
 )
 
 // константы участвующие в создании короткой ссылки
@@ -24,6 +31,14 @@ const (
 	baseKey      = len(basicSymbols)
 )
 
+// константы выборки списка ссылок пользователя
+const (
+	// DefaultListLimit - размер страницы, если лимит не указан
+	DefaultListLimit = 100
+	// MaxListLimit - максимальный размер страницы
+	MaxListLimit = 1000
+)
+
 // CounterID - структура хранящая последний выданный ID короткого идентификатора.
 // При выдаче след ID икрементирует свою внутреннюю переменную.
 // Для правильной работы со структурой необходимо после инициализации вызывать метод Run() для запуска инкрементирующей горутины.
@@ -65,41 +80,94 @@ type Shortener struct {
 	db            storage.Storage
 	lastID        *CounterID
 	rndSymbolsEnd int // количество случайных символов в конце ссылки-ключа
-	secretKey     []byte
+	// keys - ключи подписи и проверки токенов, keyFile - файл, из которого они перечитываются (см. ReloadKeys)
+	keys    *token.Keyring
+	keyFile string
+	// ephemeralKey - ключ подписи создан случайно при запуске, токены станут недействительны после перезапуска
+	ephemeralKey atomic.Bool
+	// tokens - выдача и проверка токенов пользователей, подписанных ключами keys
+	tokens *token.Signer
+	// passthrough, passthroughConflict - режим и правило передачи запроса для ссылок без собственных настроек
+	passthrough         string
+	passthroughConflict string
+	// geoIP - база для определения страны клиента, nil если база не задана
+	geoIP *targeting.GeoIP
+	// stripFragment, sortQuery - параметры приведения исходного URL к каноническому виду (см. NormalizeURL)
+	stripFragment bool
+	sortQuery     bool
+	// policy - политика допустимых исходных URL, проверяется перед записью ссылки в хранилище
+	policy *policy.Policy
+	// admins - email и имена учетных записей администраторов в нижнем регистре (см. IsAdmin)
+	admins map[string]bool
+	// serviceHosts, servicePath - хосты и путь коротких ссылок самого сервиса (см. SetServiceURLs)
+	serviceHosts []string
+	servicePath  string
+	// freeQuota, accountQuota - квоты анонимных пользователей и учетных записей на создание ссылок (см. Quota)
+	freeQuota    quotaLimits
+	accountQuota quotaLimits
 }
 
 // New создает ссылку на новый объект Shortener с переданными параметрами
 func New(db storage.Storage, cfg config.CfgService) *Shortener {
 	rand.Seed(time.Now().Unix())
 
-	// установка секретного ключа
-	var keyByte []byte
-	if cfg.SecretKey != "" {
-		hexdecode, err := hex.DecodeString(cfg.SecretKey)
+	// создание сервиса
+	NewSh := Shortener{
+		db:                  db,
+		rndSymbolsEnd:       3,
+		keyFile:             cfg.KeyFile,
+		passthrough:         cfg.Passthrough,
+		passthroughConflict: cfg.PassthroughConflict,
+		stripFragment:       cfg.StripFragment,
+		sortQuery:           cfg.SortQuery,
+		freeQuota:           quotaLimits{daily: cfg.QuotaDailyLinks, active: cfg.QuotaActiveLinks},
+		accountQuota:        quotaLimits{daily: cfg.AccountQuotaDailyLinks, active: cfg.AccountQuotaActiveLinks},
+	}
+	NewSh.loadKeys(cfg)
+	NewSh.admins = make(map[string]bool, len(cfg.AdminUsers))
+	for _, login := range cfg.AdminUsers {
+		if login = strings.ToLower(strings.TrimSpace(login)); login != "" {
+			NewSh.admins[login] = true
+		}
+	}
+	NewSh.tokens = token.NewSigner(NewSh.keys, cfg.TokenTTL)
+	if cfg.LegacyTokensUntil != "" {
+		until, err := parseCutoff(cfg.LegacyTokensUntil)
 		if err != nil {
-			log.Println("ошибка декодирования секретного ключа (hex);")
-			genKey, err := GenerateRandomBytes(32)
-			if err != nil {
-				log.Fatal("ошибка при генерации секретного ключа (shortener new generateRandomKey);")
-			}
-			log.Printf("создан рандомный ключ: %x", genKey)
-			keyByte = genKey
-		} else {
-			keyByte = hexdecode
+			log.Printf("некорректная дата LEGACY_TOKENS_UNTIL %q, токены старого формата не принимаются;", cfg.LegacyTokensUntil)
+			until = time.Now()
 		}
-	} else {
-		genKey, err := GenerateRandomBytes(32)
+		NewSh.tokens.RejectLegacyFrom(until)
+	}
+	if !schema.ValidPassthrough(NewSh.passthrough) {
+		log.Printf("недопустимый режим передачи запроса %q, используется %q;", cfg.Passthrough, schema.PassthroughNone)
+		NewSh.passthrough = ""
+	}
+	if NewSh.passthrough == "" {
+		NewSh.passthrough = schema.PassthroughNone
+	}
+	if !schema.ValidPassthroughConflict(NewSh.passthroughConflict) {
+		log.Printf("недопустимое правило передачи запроса %q, используется %q;", cfg.PassthroughConflict, schema.ConflictKeep)
+		NewSh.passthroughConflict = ""
+	}
+	if NewSh.passthroughConflict == "" {
+		NewSh.passthroughConflict = schema.ConflictKeep
+	}
+	if cfg.GeoIPPath != "" {
+		geoIP, err := targeting.OpenGeoIP(cfg.GeoIPPath)
 		if err != nil {
-			log.Fatal("ошибка при генерации секретного ключа (shortener new generateRandomKey);")
+			log.Println("не удалось открыть базу GeoIP, правила по стране не будут срабатывать;", err)
+		} else {
+			NewSh.geoIP = geoIP
 		}
-		log.Printf("создан рандомный ключ: %x", genKey)
-		keyByte = genKey
 	}
-	// создание сервиса
-	NewSh := Shortener{
-		db:            db,
-		rndSymbolsEnd: 3,
-		secretKey:     keyByte,
+	pol, err := policy.New(cfg.PolicyFile, cfg.PolicyAllowlistOnly)
+	if err != nil {
+		log.Println("не удалось загрузить файл политики, действуют только встроенные проверки;", err)
+	}
+	NewSh.policy = pol
+	if cfg.PolicyFile != "" {
+		go pol.Watch(policy.ReloadInterval, nil)
 	}
 	// инициализация счетчика количества записей
 	lastID, ok := db.GetLastID()
@@ -118,8 +186,95 @@ func New(db storage.Storage, cfg config.CfgService) *Shortener {
 // SetBatchURLs - осуществляет пакетную установку множества ссылок в хранилище.
 // Функция принимает входные данные batch типа schema.APIShortenBatchInput и token типа string,
 // и возвращает слайс строк с короткими идентификаторами ссылок и ошибку типа error.
-func (s *Shortener) SetBatchURLs(batch schema.APIShortenBatchInput, token string) ([]string, error) {
-	return s.db.SetBatchURLs(batch, token)
+// Исходные URL приводятся к каноническому виду, ссылки на короткие ссылки сервиса заменяются конечными адресами,
+// затем адреса проверяются политикой сервиса;
+// если хотя бы один URL некорректен или запрещен, пакет не сохраняется.
+// Пакет учитывается в квотах пользователя (анонимного пользователя - IP-адреса clientIP) целиком:
+// если в квоте не хватает места для всех ссылок, пакет не сохраняется и возвращается *errorapp.QuotaExceededError.
+func (s *Shortener) SetBatchURLs(batch schema.APIShortenBatchInput, token, clientIP string) ([]string, error) {
+	normalized := make(schema.APIShortenBatchInput, len(batch))
+	for i, elem := range batch {
+		fullURL, err := s.NormalizeURL(elem.OriginalURL)
+		if err == nil {
+			fullURL, err = s.resolveChain(fullURL)
+		}
+		if err == nil {
+			err = s.policy.Check(fullURL)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w (correlation_id %q)", err, elem.CorrelationID)
+		}
+		normalized[i] = elem
+		normalized[i].OriginalURL = fullURL
+	}
+	return s.db.SetBatchURLs(normalized, token, s.urlQuota(token, clientIP))
+}
+
+// NormalizeURL проверяет исходный URL и приводит его к каноническому виду согласно настройкам сервиса.
+// Нормализованный URL сохраняется в хранилище и используется для поиска дубликатов.
+func (s *Shortener) NormalizeURL(rawURL string) (string, error) {
+	return NormalizeURL(rawURL, s.stripFragment, s.sortQuery)
+}
+
+// ReloadPolicy перечитывает файл политики, не дожидаясь его автоматической проверки.
+func (s *Shortener) ReloadPolicy() error {
+	return s.policy.Reload()
+}
+
+// checkPolicy - проверяет политикой исходный URL ссылки и адреса ее правил и вариантов A/B-теста.
+// Пустой fullURL не проверяется (при изменении только правил или вариантов).
+func (s *Shortener) checkPolicy(fullURL string, rules []schema.RedirectRule, targets []schema.SplitTarget) error {
+	if fullURL != "" {
+		if err := s.policy.Check(fullURL); err != nil {
+			return err
+		}
+	}
+	for _, rule := range rules {
+		if err := s.policy.Check(rule.URL); err != nil {
+			return fmt.Errorf("%w (правило %d)", err, rule.ID)
+		}
+	}
+	for _, target := range targets {
+		if err := s.policy.Check(target.URL); err != nil {
+			return fmt.Errorf("%w (вариант %d)", err, target.ID)
+		}
+	}
+	return nil
+}
+
+// DisableURL отключает ссылку shortKey любого пользователя по решению администратора: переход по ней
+// перестает работать, а причина показывается владельцу в списке ссылок.
+// Если причина не указана, ею становится нарушение политики, которому соответствует ссылка
+// (например, после добавления домена в файл политики); если ссылка политику не нарушает,
+// возвращается errorapp.ErrorDisableReasonEmpty. Открытые жалобы на ссылку закрываются как рассмотренные.
+func (s *Shortener) DisableURL(shortKey, reason string) (schema.URLRecord, error) {
+	rec, err := s.db.GetRecord(shortKey)
+	if err != nil {
+		return rec, err
+	}
+	if reason = strings.TrimSpace(reason); reason == "" {
+		err := s.checkPolicy(rec.FullURL, rec.Rules, rec.Targets)
+		if err == nil {
+			return schema.URLRecord{}, errorapp.ErrorDisableReasonEmpty
+		}
+		reason = err.Error()
+	}
+	rec, err = s.db.UpdateURL(shortKey, rec.UserID, schema.URLPatch{DisabledReason: &reason})
+	if err != nil {
+		return rec, err
+	}
+	s.resolveReports(shortKey)
+	return rec, nil
+}
+
+// EnableURL снимает отключение администратором со ссылки shortKey.
+func (s *Shortener) EnableURL(shortKey string) (schema.URLRecord, error) {
+	rec, err := s.db.GetRecord(shortKey)
+	if err != nil {
+		return rec, err
+	}
+	reason := ""
+	return s.db.UpdateURL(shortKey, rec.UserID, schema.URLPatch{DisabledReason: &reason})
 }
 
 // DeleteBatch - осуществляет пакетное удаление множества ссылок из хранилища.
@@ -162,35 +317,51 @@ func GenerateRandomBytes(size int) ([]byte, error) {
 	return b, nil
 }
 
-// GenerateNewToken генерирует новый токен для пользователя на основе рандомного набора байт в качестве id пользователя
-// и секретного ключа, используя алгоритм HMAC-SHA256.
-// Возвращает токен в виде строки в шестнадцатеричном виде и ошибку, если таковая возникла.
+// GenerateNewToken создает нового пользователя со случайным 128-битным идентификатором
+// и выдает ему токен (см. пакет token), подписанный секретным ключом сервиса.
 func (s *Shortener) GenerateNewToken() (string, error) {
-	idUser, err := GenerateRandomBytes(4)
+	raw, _, err := s.NewUserToken()
+	return raw, err
+}
+
+// NewUserToken создает нового пользователя и выдает ему токен, как GenerateNewToken,
+// дополнительно возвращая данные токена (идентификатор пользователя, срок действия).
+func (s *Shortener) NewUserToken() (string, token.Claims, error) {
+	userID, err := token.NewUserID()
 	if err != nil {
-		return "", err
+		return "", token.Claims{}, err
 	}
-	h := hmac.New(sha256.New, s.secretKey)
-	h.Write(idUser)
-	dst := h.Sum(nil)
-	dst = append(idUser, dst...) // содержит байты id и подписи
-	// кодируем в hex и отдаем как токен в виде строки
-	return hex.EncodeToString(dst), nil
+	return s.tokens.Issue(userID, time.Now())
+}
+
+// parseCutoff - разбирает дату "2006-01-02" (начало суток UTC) или время в формате RFC 3339.
+func parseCutoff(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// ParseToken проверяет подпись и срок действия токена и возвращает его данные.
+// Возвращает ошибку, оборачивающую errorapp.ErrorTokenInvalid или errorapp.ErrorTokenExpired.
+func (s *Shortener) ParseToken(raw string) (token.Claims, error) {
+	return s.tokens.Parse(raw, time.Now())
 }
 
-// CheckToken проверяет подлинность токена, переданного в виде строки в шестнадцатеричном виде,
-// используя секретный ключ и алгоритм HMAC-SHA256. Возвращает true, если токен подлинный и false, если нет.
-func (s *Shortener) CheckToken(token string) bool {
-	decodeToken, err := hex.DecodeString(token)
+// CheckToken проверяет подлинность и срок действия токена. Возвращает true, если токен действителен.
+func (s *Shortener) CheckToken(raw string) bool {
+	_, err := s.ParseToken(raw)
+	return err == nil
+}
+
+// RefreshToken выдает взамен действительного токена новый токен того же пользователя с полным сроком действия.
+// Токен старого формата заменяется токеном текущей версии. Истекший токен обновить нельзя.
+func (s *Shortener) RefreshToken(raw string) (string, token.Claims, error) {
+	claims, err := s.ParseToken(raw)
 	if err != nil {
-		return false
+		return "", claims, err
 	}
-	idUser := decodeToken[:4]
-	sing := decodeToken[4:]
-	h := hmac.New(sha256.New, s.secretKey)
-	h.Write(idUser)
-	dst := h.Sum(nil)
-	return hmac.Equal(sing, dst)
+	return s.tokens.Issue(claims.UserID, time.Now())
 }
 
 // getNewKey - создает и возвращает новый ключ состоящий из закодированного id и случайных символов в конце.
@@ -247,17 +418,347 @@ func (s *Shortener) getNewKeyV2() string {
 //
 // fullURL - полный URL, для которого нужно сгенерировать короткий ключ
 // tokenID - идентификатор пользователя, для которого генерируется ключ
+// clientIP - IP-адрес клиента, по которому учитываются квоты анонимного пользователя (см. Quota)
 //
 // Возвращает короткий ключ, созданный для полного URL, и ошибку, если таковая произошла.
-func (s *Shortener) CreateShortKey(fullURL, tokenID string) (shortKey string, err error) {
+func (s *Shortener) CreateShortKey(fullURL, tokenID, clientIP string) (shortKey string, err error) {
+	return s.CreateShortKeyWithMeta(fullURL, tokenID, clientIP, schema.URLMeta{})
+}
+
+// CreateShortKeyWithMeta генерирует новый короткий ключ для полного URL и сохраняет его в хранилище
+// вместе с метаданными ссылки (название, заметка, метки, срок действия).
+// Время создания и изменения проставляет хранилище.
+// Если квота пользователя (анонимного пользователя - IP-адреса clientIP) исчерпана, возвращает *errorapp.QuotaExceededError.
+func (s *Shortener) CreateShortKeyWithMeta(fullURL, tokenID, clientIP string, meta schema.URLMeta) (shortKey string, err error) {
+	if fullURL, err = s.NormalizeURL(fullURL); err != nil {
+		return "", err
+	}
+	meta.CreatedAt, meta.UpdatedAt, meta.DeletedAt, meta.Clicks = time.Time{}, time.Time{}, nil, 0
+	meta.DisabledReason = ""
+	meta.Tags = normalizeTags(meta.Tags)
+	if !schema.ValidRedirectType(meta.RedirectType) {
+		return "", errorapp.ErrorInvalidRedirectType
+	}
+	if !schema.ValidPassthrough(meta.Passthrough) || !schema.ValidPassthroughConflict(meta.PassthroughConflict) {
+		return "", errorapp.ErrorInvalidPassthrough
+	}
+	if !validSchedule(meta) {
+		return "", errorapp.ErrorInvalidSchedule
+	}
+	if meta.Rules, err = targeting.NormalizeAll(meta.Rules); err != nil {
+		return "", err
+	}
+	if len(meta.Rules) == 0 {
+		meta.Rules = nil
+	}
+	if meta.Targets, err = targeting.NormalizeTargets(meta.Targets, nil); err != nil {
+		return "", err
+	}
+	if fullURL, err = s.resolveChain(fullURL); err != nil {
+		return "", err
+	}
+	if err = s.resolveDestinations(meta.Rules, meta.Targets); err != nil {
+		return "", err
+	}
+	if err = s.checkPolicy(fullURL, meta.Rules, meta.Targets); err != nil {
+		return "", err
+	}
+	if meta.FolderID != 0 {
+		if _, err = s.GetFolder(meta.FolderID, tokenID); err != nil {
+			return "", err
+		}
+	}
+	if meta.CampaignID != 0 {
+		if _, err = s.GetCampaign(meta.CampaignID, tokenID); err != nil {
+			return "", err
+		}
+	}
 	key := s.getNewKey()
-	err = s.db.SetNewURL(key, fullURL, tokenID, true)
+	quota := s.urlQuota(tokenID, clientIP)
+	meta.QuotaKey = quota.Key
+	err = s.db.SetNewURL(schema.URLRecord{ShortKey: key, FullURL: fullURL, UserID: tokenID, Available: true, URLMeta: meta}, quota)
 	if err != nil {
 		return "", err
 	}
 	return key, nil
 }
 
+// UpdateURL изменяет метаданные ссылки shortKey, принадлежащей пользователю tokenID.
+// Возвращает обновленную запись или ошибку errorapp.ErrorURLNotFound / errorapp.ErrorAccessDenied.
+func (s *Shortener) UpdateURL(shortKey, tokenID string, patch schema.URLPatch) (schema.URLRecord, error) {
+	if patch.RedirectType != nil && !schema.ValidRedirectType(*patch.RedirectType) {
+		return schema.URLRecord{}, errorapp.ErrorInvalidRedirectType
+	}
+	if (patch.Passthrough != nil && !schema.ValidPassthrough(*patch.Passthrough)) ||
+		(patch.PassthroughConflict != nil && !schema.ValidPassthroughConflict(*patch.PassthroughConflict)) {
+		return schema.URLRecord{}, errorapp.ErrorInvalidPassthrough
+	}
+	if patch.Tags != nil {
+		tags := normalizeTags(*patch.Tags)
+		patch.Tags = &tags
+	}
+	if patch.Rules != nil {
+		rules, err := targeting.NormalizeAll(*patch.Rules)
+		if err != nil {
+			return schema.URLRecord{}, err
+		}
+		if err = s.resolveDestinations(rules, nil); err != nil {
+			return schema.URLRecord{}, err
+		}
+		if err = s.checkPolicy("", rules, nil); err != nil {
+			return schema.URLRecord{}, err
+		}
+		patch.Rules = &rules
+	}
+	if patch.ActiveFrom.Set || patch.ExpiresAt.Set {
+		rec, err := s.ownRecord(shortKey, tokenID)
+		if err != nil {
+			return schema.URLRecord{}, err
+		}
+		patch.Apply(&rec.URLMeta)
+		if !validSchedule(rec.URLMeta) {
+			return schema.URLRecord{}, errorapp.ErrorInvalidSchedule
+		}
+	}
+	if patch.Targets != nil {
+		rec, err := s.ownRecord(shortKey, tokenID)
+		if err != nil {
+			return schema.URLRecord{}, err
+		}
+		targets, err := targeting.NormalizeTargets(*patch.Targets, rec.Targets)
+		if err != nil {
+			return schema.URLRecord{}, err
+		}
+		if err = s.resolveDestinations(nil, targets); err != nil {
+			return schema.URLRecord{}, err
+		}
+		if err = s.checkPolicy("", nil, targets); err != nil {
+			return schema.URLRecord{}, err
+		}
+		patch.Targets = &targets
+	}
+	return s.db.UpdateURL(shortKey, tokenID, patch)
+}
+
+// validSchedule - проверяет, что время начала действия ссылки раньше времени окончания, если заданы оба.
+func validSchedule(meta schema.URLMeta) bool {
+	return meta.ActiveFrom == nil || meta.ExpiresAt == nil || meta.ActiveFrom.Before(*meta.ExpiresAt)
+}
+
+// ListTargets возвращает варианты адреса перехода ссылки shortKey пользователя tokenID с количеством переходов.
+func (s *Shortener) ListTargets(shortKey, tokenID string) ([]schema.SplitTarget, error) {
+	rec, err := s.ownRecord(shortKey, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Targets, nil
+}
+
+// SetTargets заменяет варианты адреса перехода ссылки. Пустой набор выключает A/B-тест.
+// Варианты с номерами текущих вариантов сохраняют номер и счетчик переходов, новым вариантам выдаются новые номера.
+func (s *Shortener) SetTargets(shortKey, tokenID string, targets []schema.SplitTarget) ([]schema.SplitTarget, error) {
+	rec, err := s.UpdateURL(shortKey, tokenID, schema.URLPatch{Targets: &targets})
+	return rec.Targets, err
+}
+
+// ListRules возвращает правила перенаправления ссылки shortKey, принадлежащей пользователю tokenID.
+func (s *Shortener) ListRules(shortKey, tokenID string) ([]schema.RedirectRule, error) {
+	rec, err := s.ownRecord(shortKey, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Rules, nil
+}
+
+// SetRules заменяет все правила перенаправления ссылки. Правила нумеруются заново в переданном порядке.
+func (s *Shortener) SetRules(shortKey, tokenID string, rules []schema.RedirectRule) ([]schema.RedirectRule, error) {
+	rec, err := s.UpdateURL(shortKey, tokenID, schema.URLPatch{Rules: &rules})
+	return rec.Rules, err
+}
+
+// AddRule добавляет правило перенаправления в конец списка правил ссылки и возвращает его с присвоенным номером.
+func (s *Shortener) AddRule(shortKey, tokenID string, rule schema.RedirectRule) (schema.RedirectRule, error) {
+	rec, err := s.ownRecord(shortKey, tokenID)
+	if err != nil {
+		return schema.RedirectRule{}, err
+	}
+	rules, err := s.SetRules(shortKey, tokenID, append(slices.Clone(rec.Rules), rule))
+	if err != nil {
+		return schema.RedirectRule{}, err
+	}
+	return rules[len(rules)-1], nil
+}
+
+// UpdateRule заменяет условия и адрес правила ruleID ссылки, сохраняя его место в списке.
+// Возвращает errorapp.ErrorRuleNotFound, если правила у ссылки нет.
+func (s *Shortener) UpdateRule(shortKey, tokenID string, ruleID int64, rule schema.RedirectRule) (schema.RedirectRule, error) {
+	rec, err := s.ownRecord(shortKey, tokenID)
+	if err != nil {
+		return schema.RedirectRule{}, err
+	}
+	i := slices.IndexFunc(rec.Rules, func(r schema.RedirectRule) bool { return r.ID == ruleID })
+	if i < 0 {
+		return schema.RedirectRule{}, errorapp.ErrorRuleNotFound
+	}
+	rules := slices.Clone(rec.Rules)
+	rules[i] = rule
+	if rules, err = s.SetRules(shortKey, tokenID, rules); err != nil {
+		return schema.RedirectRule{}, err
+	}
+	return rules[i], nil
+}
+
+// DeleteRule удаляет правило ruleID ссылки. Оставшиеся правила нумеруются заново.
+// Возвращает errorapp.ErrorRuleNotFound, если правила у ссылки нет.
+func (s *Shortener) DeleteRule(shortKey, tokenID string, ruleID int64) ([]schema.RedirectRule, error) {
+	rec, err := s.ownRecord(shortKey, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(rec.Rules, func(r schema.RedirectRule) bool { return r.ID == ruleID })
+	if i < 0 {
+		return nil, errorapp.ErrorRuleNotFound
+	}
+	return s.SetRules(shortKey, tokenID, slices.Delete(slices.Clone(rec.Rules), i, i+1))
+}
+
+// ownRecord - возвращает запись о ссылке shortKey, если она принадлежит пользователю tokenID.
+func (s *Shortener) ownRecord(shortKey, tokenID string) (schema.URLRecord, error) {
+	rec, err := s.db.GetRecord(shortKey)
+	if err != nil {
+		return rec, err
+	}
+	if rec.UserID != tokenID {
+		return schema.URLRecord{}, errorapp.ErrorAccessDenied
+	}
+	return rec, nil
+}
+
+// Client собирает признаки клиента для выбора правила перенаправления ссылки.
+// Страна определяется по IP-адресу ip через базу GeoIP, если она задана в конфигурации.
+func (s *Shortener) Client(userAgent, acceptLanguage, ip string) targeting.Client {
+	return targeting.NewClient(userAgent, acceptLanguage, s.geoIP.Country(ip))
+}
+
+// AddTags добавляет метки к ссылке shortKey, принадлежащей пользователю tokenID, и возвращает обновленную запись.
+func (s *Shortener) AddTags(shortKey, tokenID string, tags []string) (schema.URLRecord, error) {
+	return s.db.ChangeTags(shortKey, tokenID, normalizeTags(tags), nil)
+}
+
+// RemoveTags убирает метки у ссылки shortKey, принадлежащей пользователю tokenID, и возвращает обновленную запись.
+func (s *Shortener) RemoveTags(shortKey, tokenID string, tags []string) (schema.URLRecord, error) {
+	return s.db.ChangeTags(shortKey, tokenID, nil, normalizeTags(tags))
+}
+
+// ListTags возвращает метки активных ссылок пользователя с количеством ссылок по каждой метке.
+func (s *Shortener) ListTags(tokenID string) ([]schema.APITagInfo, error) {
+	return s.db.ListTags(tokenID)
+}
+
+// CreateFolder создает папку пользователя tokenID с названием name.
+func (s *Shortener) CreateFolder(tokenID, name string) (schema.Folder, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return schema.Folder{}, errorapp.ErrorFolderNameEmpty
+	}
+	return s.db.CreateFolder(tokenID, name)
+}
+
+// GetFolder возвращает папку folderID, если она принадлежит пользователю tokenID, иначе errorapp.ErrorFolderNotFound.
+func (s *Shortener) GetFolder(folderID int64, tokenID string) (schema.Folder, error) {
+	folder, err := s.db.GetFolder(folderID)
+	if err != nil {
+		return folder, err
+	}
+	if folder.UserID != tokenID {
+		return schema.Folder{}, errorapp.ErrorFolderNotFound
+	}
+	return folder, nil
+}
+
+// ListFolders возвращает папки пользователя tokenID.
+func (s *Shortener) ListFolders(tokenID string) ([]schema.Folder, error) {
+	return s.db.ListFolders(tokenID)
+}
+
+// DeleteFolder удаляет папку пользователя tokenID. Ссылки из папки не удаляются.
+func (s *Shortener) DeleteFolder(folderID int64, tokenID string) error {
+	return s.db.DeleteFolder(folderID, tokenID)
+}
+
+// FolderKeys возвращает короткие ключи всех активных ссылок в папке folderID пользователя tokenID.
+// Используется для пакетного удаления ссылок папки через DeleteBatch.
+func (s *Shortener) FolderKeys(folderID int64, tokenID string) ([]string, error) {
+	if _, err := s.GetFolder(folderID, tokenID); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0)
+	opts := schema.ListURLsOptions{FolderID: folderID, Limit: MaxListLimit}
+	for {
+		page, err := s.ListURLs(tokenID, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range page.Items {
+			keys = append(keys, rec.ShortKey)
+		}
+		if page.NextCursor == "" {
+			return keys, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// CreateCampaign создает кампанию пользователя tokenID с названием и UTM-шаблоном из input.
+func (s *Shortener) CreateCampaign(tokenID string, input schema.APICampaignInput) (schema.Campaign, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return schema.Campaign{}, errorapp.ErrorCampaignNameEmpty
+	}
+	return s.db.CreateCampaign(schema.Campaign{UserID: tokenID, Name: name, UTM: input.UTM})
+}
+
+// GetCampaign возвращает кампанию campaignID, если она принадлежит пользователю tokenID, иначе errorapp.ErrorCampaignNotFound.
+func (s *Shortener) GetCampaign(campaignID int64, tokenID string) (schema.Campaign, error) {
+	campaign, err := s.db.GetCampaign(campaignID)
+	if err != nil {
+		return campaign, err
+	}
+	if campaign.UserID != tokenID {
+		return schema.Campaign{}, errorapp.ErrorCampaignNotFound
+	}
+	return campaign, nil
+}
+
+// ListCampaigns возвращает кампании пользователя tokenID с количеством ссылок и переходов.
+func (s *Shortener) ListCampaigns(tokenID string) ([]schema.Campaign, error) {
+	return s.db.ListCampaigns(tokenID)
+}
+
+// DeleteCampaign удаляет кампанию пользователя tokenID. Ссылки кампании не удаляются.
+func (s *Shortener) DeleteCampaign(campaignID int64, tokenID string) error {
+	return s.db.DeleteCampaign(campaignID, tokenID)
+}
+
+// RecordClick учитывает переход по ссылке link в счетчиках ссылки, ее кампании и варианта variantID
+// (0 - переход не на вариант A/B-теста).
+func (s *Shortener) RecordClick(link schema.URLRecord, variantID int64) error {
+	return s.db.RecordClick(link.ShortKey, link.CampaignID, variantID)
+}
+
+// normalizeTags - приводит метки к нижнему регистру, убирает пробелы по краям, пустые метки и повторы.
+func normalizeTags(tags []string) []string {
+	var result []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(result, tag) {
+			continue
+		}
+		result = append(result, tag)
+	}
+	return result
+}
+
 // GetURL получает полный URL по заданному короткому ключу
 //
 // shortKey - короткий ключ, для которого нужно получить полный URL
@@ -267,6 +768,86 @@ func (s *Shortener) GetURL(shortKey string) (string, error) {
 	return s.db.GetURL(shortKey)
 }
 
+// GetLink возвращает запись о доступной ссылке для перехода по ней.
+// Доступность (удаление, срок действия, время начала действия) проверяется через GetURL, поэтому ошибки совпадают с ошибками GetURL.
+func (s *Shortener) GetLink(shortKey string) (schema.URLRecord, error) {
+	fullURL, err := s.GetURL(shortKey)
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	rec, err := s.db.GetRecord(shortKey)
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	rec.FullURL = fullURL
+	return rec, nil
+}
+
+// Target возвращает URL, на который перенаправляется переход по ссылке link.
+//
+// query - параметры запроса перехода, extraPath - путь после короткого ключа.
+// Если ссылка входит в кампанию, к исходному URL добавляются UTM-параметры кампании,
+// которых в нем еще нет; сохраненный исходный URL не меняется.
+// В зависимости от режима передачи запроса ссылки (или режима сервиса по умолчанию) параметры query
+// объединяются с параметрами исходного URL по правилу для совпадающих параметров, а extraPath дописывается к пути.
+//
+// Возвращает errorapp.ErrorURLNotFound, если передан extraPath, а передача пути для ссылки выключена.
+func (s *Shortener) Target(link schema.URLRecord, query url.Values, extraPath string) (string, error) {
+	mode, conflict := link.Passthrough, link.PassthroughConflict
+	if mode == "" {
+		mode = s.passthrough
+	}
+	if conflict == "" {
+		conflict = s.passthroughConflict
+	}
+	passQuery := (mode == schema.PassthroughQuery || mode == schema.PassthroughAll) && len(query) > 0
+	passPath := mode == schema.PassthroughPath || mode == schema.PassthroughAll
+	extraPath = strings.Trim(extraPath, "/")
+	if extraPath != "" && !passPath {
+		return "", errorapp.ErrorURLNotFound
+	}
+	var utm url.Values
+	if link.CampaignID != 0 {
+		campaign, err := s.db.GetCampaign(link.CampaignID)
+		if err != nil && !errors.Is(err, errorapp.ErrorCampaignNotFound) {
+			return "", err
+		}
+		utm = campaign.UTM.Values(link)
+	}
+	if !passQuery && extraPath == "" && len(utm) == 0 {
+		return link.FullURL, nil
+	}
+	target, err := url.Parse(link.FullURL)
+	if err != nil {
+		return "", err
+	}
+	if extraPath != "" {
+		// path.Clean от корня не дает выйти за пределы пути исходного URL через ".."
+		target = target.JoinPath(path.Clean("/" + extraPath))
+	}
+	if passQuery || len(utm) > 0 {
+		values := target.Query()
+		for name, value := range utm {
+			if !values.Has(name) {
+				values[name] = value
+			}
+		}
+		for name, incoming := range query {
+			if !passQuery {
+				break
+			}
+			switch {
+			case !values.Has(name) || conflict == schema.ConflictOverride:
+				values[name] = incoming
+			case conflict == schema.ConflictAppend:
+				values[name] = append(values[name], incoming...)
+			}
+		}
+		target.RawQuery = values.Encode()
+	}
+	return target.String(), nil
+}
+
 // GetAllURLs получает все URL, связанные с заданным идентификатором пользователя
 //
 // tokenID - идентификатор пользователя, для которого нужно получить все URL
@@ -276,7 +857,64 @@ func (s *Shortener) GetAllURLs(tokenID string) map[string]string {
 	return s.db.GetAllURLs(tokenID)
 }
 
+// ListURLs получает страницу ссылок пользователя с сортировкой и фильтрацией
+//
+// tokenID - идентификатор пользователя, для которого нужно получить ссылки
+// opts - параметры выборки; незаполненные параметры принимают значения по умолчанию:
+// первые DefaultListLimit активных ссылок, отсортированные по времени создания
+//
+// Возвращает ошибку, оборачивающую errorapp.ErrorInvalidListOptions, если параметры некорректны.
+func (s *Shortener) ListURLs(tokenID string, opts schema.ListURLsOptions) (schema.URLPage, error) {
+	if opts.Status == "" {
+		opts.Status = schema.URLStatusActive
+	}
+	opts, err := normalizeListOptions(opts)
+	if err != nil {
+		return schema.URLPage{}, err
+	}
+	return s.db.ListURLs(tokenID, opts)
+}
+
+// normalizeListOptions - проверяет параметры выборки ссылок и заполняет незаданные значениями по умолчанию
+// (кроме статуса, значение по умолчанию которого зависит от вызывающего).
+func normalizeListOptions(opts schema.ListURLsOptions) (schema.ListURLsOptions, error) {
+	switch {
+	case opts.Limit == 0:
+		opts.Limit = DefaultListLimit
+	case opts.Limit < 0 || opts.Limit > MaxListLimit:
+		return opts, fmt.Errorf("%w лимит должен быть от 1 до %d", errorapp.ErrorInvalidListOptions, MaxListLimit)
+	}
+	switch opts.SortBy {
+	case "":
+		opts.SortBy = schema.SortByCreated
+	case schema.SortByCreated, schema.SortByKey:
+	default:
+		return opts, fmt.Errorf("%w неизвестное поле сортировки %q", errorapp.ErrorInvalidListOptions, opts.SortBy)
+	}
+	switch opts.Status {
+	case schema.URLStatusActive, schema.URLStatusDeleted, schema.URLStatusExpired, schema.URLStatusScheduled,
+		schema.URLStatusDisabled, schema.URLStatusAll:
+	default:
+		return opts, fmt.Errorf("%w неизвестный статус %q", errorapp.ErrorInvalidListOptions, opts.Status)
+	}
+	if opts.Cursor != "" {
+		if _, err := schema.DecodeListCursor(opts.Cursor); err != nil {
+			return opts, fmt.Errorf("%w некорректный курсор", errorapp.ErrorInvalidListOptions)
+		}
+	}
+	opts.Domain = strings.ToLower(strings.TrimSuffix(opts.Domain, "."))
+	opts.Tag = strings.ToLower(strings.TrimSpace(opts.Tag))
+	opts.Key = strings.TrimSpace(opts.Key)
+	return opts, nil
+}
+
 // GetStatsStorage - возвращает статистику из хранилища
 func (s *Shortener) GetStatsStorage() (schema.APIInternalStats, error) {
 	return s.db.GetStats()
 }
+
+// TakeRateToken - забирает токен из корзины ограничения частоты запросов key в хранилище.
+// Корзины хранятся в общем хранилище, поэтому лимит соблюдается всеми экземплярами сервиса.
+func (s *Shortener) TakeRateToken(key string, limit schema.RateLimit, now time.Time) (bool, time.Duration, error) {
+	return s.db.TakeRateToken(key, limit, now)
+}
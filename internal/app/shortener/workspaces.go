@@ -0,0 +1,238 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/bubu256/go-url-shortener-server/internal/app/token"
+)
+
+// Ограничения рабочих пространств.
+const (
+	// MaxWorkspaceName - максимальная длина названия рабочего пространства в символах.
+	MaxWorkspaceName = 100
+	// WorkspaceIDPrefix - префикс идентификатора рабочего пространства, отличающий его от идентификатора пользователя.
+	WorkspaceIDPrefix = "ws_"
+)
+
+// CreateWorkspace создает рабочее пространство, владельцем которого становится пользователь userID.
+// Создать пространство может только зарегистрированный пользователь.
+func (s *Shortener) CreateWorkspace(userID string, input schema.APIWorkspaceInput) (schema.Workspace, error) {
+	if _, err := s.Account(userID); err != nil {
+		return schema.Workspace{}, err
+	}
+	workspace := schema.Workspace{Name: strings.TrimSpace(input.Name)}
+	if workspace.Name == "" || utf8.RuneCountInString(workspace.Name) > MaxWorkspaceName {
+		return workspace, fmt.Errorf("%w название должно содержать от 1 до %d символов", errorapp.ErrorInvalidWorkspace, MaxWorkspaceName)
+	}
+	id, err := token.NewUserID()
+	if err != nil {
+		return workspace, err
+	}
+	workspace.ID = WorkspaceIDPrefix + id
+	workspace, err = s.db.CreateWorkspace(workspace, userID)
+	if err != nil {
+		return workspace, err
+	}
+	workspace.Role = schema.RoleOwner
+	return workspace, nil
+}
+
+// ListWorkspaces возвращает рабочие пространства, в которых состоит пользователь userID, с его ролью.
+func (s *Shortener) ListWorkspaces(userID string) ([]schema.Workspace, error) {
+	return s.db.ListWorkspaces(userID)
+}
+
+// Workspace возвращает рабочее пространство id с участниками и ролью пользователя userID.
+// Пользователю, не состоящему в пространстве, возвращается errorapp.ErrorWorkspaceNotFound.
+func (s *Shortener) Workspace(userID, id string) (schema.Workspace, error) {
+	role, err := s.WorkspaceRole(id, userID)
+	if err != nil {
+		return schema.Workspace{}, err
+	}
+	workspace, err := s.db.GetWorkspace(id)
+	if err != nil {
+		return workspace, err
+	}
+	workspace.Role = role
+	workspace.Members, err = s.db.ListWorkspaceMembers(id)
+	return workspace, err
+}
+
+// WorkspaceRole возвращает роль пользователя userID в рабочем пространстве id.
+// Если пространства нет или пользователь в нем не состоит, возвращает errorapp.ErrorWorkspaceNotFound.
+func (s *Shortener) WorkspaceRole(id, userID string) (string, error) {
+	member, err := s.db.GetWorkspaceMember(id, userID)
+	if errors.Is(err, errorapp.ErrorMemberNotFound) {
+		return "", errorapp.ErrorWorkspaceNotFound
+	}
+	return member.Role, err
+}
+
+// SetWorkspaceMember добавляет в рабочее пространство id учетную запись с email или именем input.Login
+// или изменяет ее роль. Доступно только владельцу пространства; последний владелец не может понизить свою роль.
+func (s *Shortener) SetWorkspaceMember(userID, id string, input schema.APIMemberInput) (schema.WorkspaceMember, error) {
+	if err := s.requireWorkspaceOwner(id, userID); err != nil {
+		return schema.WorkspaceMember{}, err
+	}
+	role := strings.ToLower(strings.TrimSpace(input.Role))
+	if !schema.ValidRole(role) {
+		return schema.WorkspaceMember{}, fmt.Errorf("%w неизвестная роль %q", errorapp.ErrorInvalidWorkspace, input.Role)
+	}
+	account, err := s.db.FindAccount(strings.ToLower(strings.TrimSpace(input.Login)))
+	if errors.Is(err, errorapp.ErrorAccountNotFound) {
+		return schema.WorkspaceMember{}, fmt.Errorf("%w учетная запись %q не найдена", errorapp.ErrorInvalidWorkspace, input.Login)
+	}
+	if err != nil {
+		return schema.WorkspaceMember{}, err
+	}
+	if role != schema.RoleOwner {
+		if err := s.keepOwner(id, account.ID); err != nil {
+			return schema.WorkspaceMember{}, err
+		}
+	}
+	member, err := s.db.SetWorkspaceMember(schema.WorkspaceMember{WorkspaceID: id, UserID: account.ID, Role: role})
+	member.Email, member.Username = account.Email, account.Username
+	return member, err
+}
+
+// RemoveWorkspaceMember исключает участника memberID из рабочего пространства id.
+// Владелец может исключить любого участника, остальные - только выйти сами; последний владелец выйти не может.
+func (s *Shortener) RemoveWorkspaceMember(userID, id, memberID string) error {
+	if memberID != userID {
+		if err := s.requireWorkspaceOwner(id, userID); err != nil {
+			return err
+		}
+	} else if _, err := s.WorkspaceRole(id, userID); err != nil {
+		return err
+	}
+	if err := s.keepOwner(id, memberID); err != nil {
+		return err
+	}
+	return s.db.RemoveWorkspaceMember(id, memberID)
+}
+
+// requireWorkspaceOwner - проверяет, что пользователь userID является владельцем рабочего пространства id.
+func (s *Shortener) requireWorkspaceOwner(id, userID string) error {
+	role, err := s.WorkspaceRole(id, userID)
+	if err != nil {
+		return err
+	}
+	if role != schema.RoleOwner {
+		return fmt.Errorf("%w управлять участниками может только владелец", errorapp.ErrorWorkspaceRole)
+	}
+	return nil
+}
+
+// keepOwner - проверяет, что после понижения роли или исключения участника memberID
+// в рабочем пространстве id останется хотя бы один владелец.
+func (s *Shortener) keepOwner(id, memberID string) error {
+	members, err := s.db.ListWorkspaceMembers(id)
+	if err != nil {
+		return err
+	}
+	owners, isOwner := 0, false
+	for _, member := range members {
+		if member.Role == schema.RoleOwner {
+			owners++
+			isOwner = isOwner || member.UserID == memberID
+		}
+	}
+	if isOwner && owners == 1 {
+		return fmt.Errorf("%w в пространстве должен остаться хотя бы один владелец", errorapp.ErrorInvalidWorkspace)
+	}
+	return nil
+}
+
+// TransferURL передает ссылку key от пользователя userID или рабочего пространства input.FromWorkspace
+// рабочему пространству input.ToWorkspace или самому пользователю.
+// Передавать ссылки из пространства и в пространство могут участники с ролью editor или owner,
+// поэтому ссылка не попадает к получателю без его участия; другому пользователю ссылка передается
+// через предложение, которое он принимает (см. OfferTransfer). Переданная ссылка учитывается в квоте
+// действующих ссылок получателя; суточную квоту, которая ограничивает создание ссылок, передача не расходует.
+func (s *Shortener) TransferURL(userID, key string, input schema.APITransferInput) (schema.URLRecord, error) {
+	if input.ToUser != "" {
+		return schema.URLRecord{}, fmt.Errorf("%w ссылка передается пользователю только по предложению", errorapp.ErrorInvalidWorkspace)
+	}
+	from, err := s.transferParty(userID, input.FromWorkspace)
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	to, err := s.transferParty(userID, input.ToWorkspace)
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	return s.db.TransferURL(key, from, to, s.transferQuota(to))
+}
+
+// OfferTransfer предлагает передать ссылку key пользователя userID или рабочего пространства input.FromWorkspace
+// учетной записи с email или именем input.ToUser. Ссылка остается у отправителя, пока получатель
+// не примет предложение (см. AcceptTransfer); новое предложение для ссылки заменяет прежнее.
+// Отправителем может быть только учетная запись или рабочее пространство.
+func (s *Shortener) OfferTransfer(userID, key string, input schema.APITransferInput) (schema.TransferOffer, error) {
+	if input.ToWorkspace != "" {
+		return schema.TransferOffer{}, fmt.Errorf("%w укажите только одного получателя", errorapp.ErrorInvalidWorkspace)
+	}
+	from, err := s.transferParty(userID, input.FromWorkspace)
+	if err != nil {
+		return schema.TransferOffer{}, err
+	}
+	if !s.isAccount(from) {
+		return schema.TransferOffer{}, errorapp.ErrorLoginRequired
+	}
+	account, err := s.db.FindAccount(strings.ToLower(strings.TrimSpace(input.ToUser)))
+	if errors.Is(err, errorapp.ErrorAccountNotFound) {
+		return schema.TransferOffer{}, fmt.Errorf("%w учетная запись %q не найдена", errorapp.ErrorInvalidWorkspace, input.ToUser)
+	}
+	if err != nil {
+		return schema.TransferOffer{}, err
+	}
+	if account.ID == from {
+		return schema.TransferOffer{}, fmt.Errorf("%w ссылка уже принадлежит получателю", errorapp.ErrorInvalidWorkspace)
+	}
+	return s.db.OfferTransfer(schema.TransferOffer{ShortKey: key, FromUserID: from, ToUserID: account.ID})
+}
+
+// ListTransfers возвращает действующие предложения передачи ссылок, отправленные пользователем userID или ему.
+func (s *Shortener) ListTransfers(userID string) ([]schema.TransferOffer, error) {
+	return s.db.ListTransfers(userID)
+}
+
+// AcceptTransfer принимает предложение передать пользователю userID ссылку key.
+// Ссылка учитывается в квоте действующих ссылок пользователя, как при передаче (см. TransferURL).
+func (s *Shortener) AcceptTransfer(userID, key string) (schema.URLRecord, error) {
+	return s.db.AcceptTransfer(key, userID, s.transferQuota(userID))
+}
+
+// DeclineTransfer отклоняет предложение передачи ссылки key (получателем) или отзывает его (отправителем).
+func (s *Shortener) DeclineTransfer(userID, key string) error {
+	return s.db.DeleteTransfer(key, userID)
+}
+
+// transferQuota - возвращает квоты, которые проверяются при передаче ссылки владельцу userID:
+// только квота действующих ссылок, которая считается по владельцу.
+func (s *Shortener) transferQuota(userID string) schema.URLQuota {
+	quota := s.urlQuota(userID, "")
+	quota.Daily = 0
+	return quota
+}
+
+// transferParty - возвращает владельца ссылок для передачи: рабочее пространство workspaceID,
+// в котором пользователь userID может изменять ссылки, или самого пользователя, если пространство не указано.
+func (s *Shortener) transferParty(userID, workspaceID string) (string, error) {
+	if workspaceID == "" {
+		return userID, nil
+	}
+	role, err := s.WorkspaceRole(workspaceID, userID)
+	if err != nil {
+		return "", err
+	}
+	if !schema.RoleCanWrite(role) {
+		return "", fmt.Errorf("%w передавать ссылки может участник с ролью editor или owner", errorapp.ErrorWorkspaceRole)
+	}
+	return workspaceID, nil
+}
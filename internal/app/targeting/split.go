@@ -0,0 +1,88 @@
+package targeting
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+)
+
+// Ограничения вариантов A/B-теста ссылки.
+const (
+	// MaxTargets - максимальное количество вариантов у одной ссылки.
+	MaxTargets = 20
+	// MaxWeight - максимальный вес варианта.
+	MaxWeight = 1000
+)
+
+// NormalizeTargets - проверяет новый набор вариантов ссылки и назначает номера вариантам.
+//
+// Вариант сохраняет номер, если такой номер есть среди текущих вариантов existing,
+// новым вариантам выдаются номера больше всех текущих. Счетчики переходов из запроса не принимаются.
+// Возвращает ошибку, оборачивающую errorapp.ErrorInvalidTarget.
+func NormalizeTargets(targets, existing []schema.SplitTarget) ([]schema.SplitTarget, error) {
+	if len(targets) > MaxTargets {
+		return nil, fmt.Errorf("%w у ссылки может быть не больше %d вариантов", errorapp.ErrorInvalidTarget, MaxTargets)
+	}
+	known := make(map[int64]bool, len(existing))
+	var nextID int64 = 1
+	for _, target := range existing {
+		known[target.ID] = true
+		if target.ID >= nextID {
+			nextID = target.ID + 1
+		}
+	}
+	used := make(map[int64]bool, len(targets))
+	var result []schema.SplitTarget
+	for _, target := range targets {
+		target.URL = strings.TrimSpace(target.URL)
+		if !validTargetURL(target.URL) {
+			return nil, fmt.Errorf("%w адрес варианта должен быть абсолютным http(s) URL", errorapp.ErrorInvalidTarget)
+		}
+		if target.Weight < 0 || target.Weight > MaxWeight {
+			return nil, fmt.Errorf("%w вес варианта должен быть от 0 до %d", errorapp.ErrorInvalidTarget, MaxWeight)
+		}
+		if !known[target.ID] || used[target.ID] {
+			target.ID = nextID
+			nextID++
+		}
+		used[target.ID] = true
+		target.Clicks = 0
+		result = append(result, target)
+	}
+	return result, nil
+}
+
+// PickVariant - выбирает вариант адреса перехода для посетителя.
+//
+// Если stickyID - номер варианта с ненулевым весом, выбранного посетителю ранее, возвращается он.
+// Иначе вариант выбирается случайно с вероятностью, пропорциональной весу.
+// Возвращает false, если у ссылки нет вариантов с ненулевым весом.
+func PickVariant(targets []schema.SplitTarget, stickyID int64) (schema.SplitTarget, bool) {
+	total := 0
+	for _, target := range targets {
+		if target.Weight <= 0 {
+			continue
+		}
+		if target.ID == stickyID {
+			return target, true
+		}
+		total += target.Weight
+	}
+	if total == 0 {
+		return schema.SplitTarget{}, false
+	}
+	n := rand.Intn(total)
+	for _, target := range targets {
+		if target.Weight <= 0 {
+			continue
+		}
+		if n < target.Weight {
+			return target, true
+		}
+		n -= target.Weight
+	}
+	return schema.SplitTarget{}, false
+}
@@ -0,0 +1,274 @@
+// Package targeting selects a redirect destination for a link based on client attributes:
+// User-Agent platform, Accept-Language and the country resolved from a GeoIP database.
+package targeting
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// MaxRules - максимальное количество правил у одной ссылки.
+const MaxRules = 50
+
+// Платформы клиента, определяемые по User-Agent.
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformWindows = "windows"
+	PlatformMacOS   = "macos"
+	PlatformLinux   = "linux"
+)
+
+// Client - признаки клиента, по которым выбирается правило перенаправления.
+type Client struct {
+	// Platform - платформа клиента (пусто, если не определена).
+	Platform string
+	// Languages - языки клиента в порядке предпочтения, в нижнем регистре.
+	Languages []string
+	// Country - код страны ISO 3166-1 клиента в верхнем регистре (пусто, если не определена).
+	Country string
+}
+
+// NewClient - собирает признаки клиента по заголовкам User-Agent, Accept-Language и коду страны.
+func NewClient(userAgent, acceptLanguage, country string) Client {
+	return Client{
+		Platform:  DetectPlatform(userAgent),
+		Languages: ParseAcceptLanguage(acceptLanguage),
+		Country:   strings.ToUpper(country),
+	}
+}
+
+// DetectPlatform - определяет платформу клиента по заголовку User-Agent.
+// iOS и Android проверяются раньше настольных систем, т.к. их User-Agent содержит "Mac OS X" и "Linux".
+func DetectPlatform(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return PlatformIOS
+	case strings.Contains(ua, "android"):
+		return PlatformAndroid
+	case strings.Contains(ua, "windows"):
+		return PlatformWindows
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		return PlatformMacOS
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"):
+		return PlatformLinux
+	}
+	return ""
+}
+
+// ParseAcceptLanguage - возвращает языки из заголовка Accept-Language в порядке убывания веса q.
+// Языки с q=0 и "*" пропускаются.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			parsed, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		langs = append(langs, weighted{tag: tag, q: q})
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	result := make([]string, 0, len(langs))
+	for _, lang := range langs {
+		result = append(result, lang.tag)
+	}
+	return result
+}
+
+// languageRank - возвращает позицию первого языка клиента, подходящего под язык правила, или -1.
+// Правило "en" подходит для "en" и "en-us", правило "en-us" - только для "en-us".
+func (c Client) languageRank(language string) int {
+	for i, lang := range c.Languages {
+		if lang == language || strings.HasPrefix(lang, language+"-") {
+			return i
+		}
+	}
+	return -1
+}
+
+// Select - выбирает правило для клиента из правил ссылки.
+//
+// Правило подходит, если выполнены все его непустые условия. Из подходящих правил выбирается правило
+// с наиболее предпочтительным для клиента языком; правила без условия по языку считаются подходящими
+// для самого предпочтительного языка. При равенстве выбирается правило, стоящее раньше.
+func Select(rules []schema.RedirectRule, client Client) (schema.RedirectRule, bool) {
+	best, bestRank := -1, 0
+	for i, rule := range rules {
+		if rule.Platform != "" && rule.Platform != client.Platform {
+			continue
+		}
+		if rule.Country != "" && rule.Country != client.Country {
+			continue
+		}
+		rank := 0
+		if rule.Language != "" {
+			if rank = client.languageRank(rule.Language); rank < 0 {
+				continue
+			}
+		}
+		if best < 0 || rank < bestRank {
+			best, bestRank = i, rank
+		}
+	}
+	if best < 0 {
+		return schema.RedirectRule{}, false
+	}
+	return rules[best], true
+}
+
+// Apply - возвращает ссылку link, исходный URL которой заменен адресом выбранного для клиента правила,
+// и признак того, что правило найдено. Если ни одно правило не подходит, ссылка возвращается без изменений.
+func Apply(link schema.URLRecord, client Client) (schema.URLRecord, bool) {
+	rule, ok := Select(link.Rules, client)
+	if ok {
+		link.FullURL = rule.URL
+	}
+	return link, ok
+}
+
+// Normalize - приводит условия правила к каноническому виду и проверяет правило.
+// Возвращает ошибку, оборачивающую errorapp.ErrorInvalidRule.
+func Normalize(rule schema.RedirectRule) (schema.RedirectRule, error) {
+	rule.Platform = strings.ToLower(strings.TrimSpace(rule.Platform))
+	rule.Language = strings.ToLower(strings.TrimSpace(strings.ReplaceAll(rule.Language, "_", "-")))
+	rule.Country = strings.ToUpper(strings.TrimSpace(rule.Country))
+	rule.URL = strings.TrimSpace(rule.URL)
+	switch rule.Platform {
+	case "", PlatformIOS, PlatformAndroid, PlatformWindows, PlatformMacOS, PlatformLinux:
+	default:
+		return rule, fmt.Errorf("%w неизвестная платформа %q", errorapp.ErrorInvalidRule, rule.Platform)
+	}
+	if rule.Country != "" && !isLetters(rule.Country, 2, 2) {
+		return rule, fmt.Errorf("%w код страны должен состоять из двух букв ISO 3166-1", errorapp.ErrorInvalidRule)
+	}
+	if rule.Language != "" {
+		primary, _, _ := strings.Cut(rule.Language, "-")
+		if !isLetters(primary, 2, 3) {
+			return rule, fmt.Errorf("%w некорректный код языка %q", errorapp.ErrorInvalidRule, rule.Language)
+		}
+	}
+	if rule.Platform == "" && rule.Language == "" && rule.Country == "" {
+		return rule, fmt.Errorf("%w правило должно содержать хотя бы одно условие", errorapp.ErrorInvalidRule)
+	}
+	if !validTargetURL(rule.URL) {
+		return rule, fmt.Errorf("%w адрес правила должен быть абсолютным http(s) URL", errorapp.ErrorInvalidRule)
+	}
+	return rule, nil
+}
+
+// validTargetURL - проверяет, что адрес перехода является абсолютным http(s) URL.
+func validTargetURL(rawURL string) bool {
+	target, err := url.Parse(rawURL)
+	return err == nil && target.Host != "" && (target.Scheme == "http" || target.Scheme == "https")
+}
+
+// NormalizeAll - проверяет набор правил ссылки и нумерует правила по порядку начиная с 1.
+func NormalizeAll(rules []schema.RedirectRule) ([]schema.RedirectRule, error) {
+	if len(rules) > MaxRules {
+		return nil, fmt.Errorf("%w у ссылки может быть не больше %d правил", errorapp.ErrorInvalidRule, MaxRules)
+	}
+	result := make([]schema.RedirectRule, 0, len(rules))
+	for i, rule := range rules {
+		rule, err := Normalize(rule)
+		if err != nil {
+			return nil, err
+		}
+		rule.ID = int64(i + 1)
+		result = append(result, rule)
+	}
+	return result, nil
+}
+
+// isLetters - проверяет, что s состоит из латинских букв и имеет длину от min до max.
+func isLetters(s string, min, max int) bool {
+	if len(s) < min || len(s) > max {
+		return false
+	}
+	for _, r := range strings.ToLower(s) {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// GeoIP - определение страны по IP-адресу через локальную базу в формате MaxMind DB
+// (GeoLite2-Country, GeoLite2-City или совместимую).
+type GeoIP struct {
+	reader *maxminddb.Reader
+}
+
+// geoRecord - поля записи базы GeoIP, необходимые для определения страны.
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// OpenGeoIP - открывает базу GeoIP из файла path.
+func OpenGeoIP(path string) (*GeoIP, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &GeoIP{reader: reader}, nil
+}
+
+// Country - возвращает код страны для IP-адреса ip или пустую строку, если страна не определена.
+// ip может содержать порт (формат Request.RemoteAddr). Для nil базы всегда возвращается пустая строка.
+func (g *GeoIP) Country(ip string) string {
+	if g == nil || ip == "" {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	addr := net.ParseIP(strings.TrimSpace(ip))
+	if addr == nil {
+		return ""
+	}
+	rec := geoRecord{}
+	if err := g.reader.Lookup(addr, &rec); err != nil {
+		return ""
+	}
+	if rec.Country.ISOCode != "" {
+		return rec.Country.ISOCode
+	}
+	return rec.RegisteredCountry.ISOCode
+}
+
+// Close - закрывает базу GeoIP.
+func (g *GeoIP) Close() error {
+	if g == nil {
+		return nil
+	}
+	return g.reader.Close()
+}
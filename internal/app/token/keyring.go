@@ -0,0 +1,136 @@
+package token
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+)
+
+// Keyring - набор ключей: один ключ подписи новых токенов и ключи, которыми еще проверяются
+// ранее выданные токены. Ключ подписи всегда входит в число ключей проверки.
+// Набор можно заменить целиком (Set) во время работы; безопасен для использования из нескольких горутин.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[string][]byte
+	order   []string
+	signing string
+}
+
+// NewKeyring - создает набор с ключом подписи signing и дополнительными ключами проверки verify.
+func NewKeyring(signing []byte, verify ...[]byte) *Keyring {
+	k := &Keyring{}
+	k.Set(signing, verify...)
+	return k
+}
+
+// Set - заменяет все ключи набора: signing - ключ подписи, verify - дополнительные ключи проверки.
+// Повторяющиеся ключи пропускаются.
+func (k *Keyring) Set(signing []byte, verify ...[]byte) {
+	keys := make(map[string][]byte, len(verify)+1)
+	order := make([]string, 0, len(verify)+1)
+	for _, key := range append([][]byte{signing}, verify...) {
+		id := KeyID(key)
+		if _, ok := keys[id]; ok {
+			continue
+		}
+		keys[id] = key
+		order = append(order, id)
+	}
+	k.mu.Lock()
+	k.keys, k.order, k.signing = keys, order, KeyID(signing)
+	k.mu.Unlock()
+}
+
+// Signing - возвращает идентификатор и ключ подписи.
+func (k *Keyring) Signing() (string, []byte) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.signing, k.keys[k.signing]
+}
+
+// Key - возвращает ключ проверки по идентификатору.
+func (k *Keyring) Key(id string) ([]byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// IDs - возвращает идентификаторы всех ключей набора, первым - ключ подписи.
+func (k *Keyring) IDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return append([]string(nil), k.order...)
+}
+
+// all - возвращает все ключи набора, первым - ключ подписи.
+func (k *Keyring) all() [][]byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys := make([][]byte, 0, len(k.order))
+	for _, id := range k.order {
+		keys = append(keys, k.keys[id])
+	}
+	return keys
+}
+
+// DecodeKey - декодирует непустой ключ из hex.
+func DecodeKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("%w ключ должен быть записан в hex", errorapp.ErrorKeyring)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%w пустой ключ", errorapp.ErrorKeyring)
+	}
+	return key, nil
+}
+
+// ParseKeys - читает ключи из r.
+//
+// Формат: один ключ в hex в строке, пустые строки и строки, начинающиеся с "#", пропускаются.
+// Первый ключ - ключ подписи, остальные - только для проверки ранее выданных токенов.
+// Для смены ключа новый ключ дописывается первой строкой, а прежний удаляется из файла
+// после истечения срока действия подписанных им токенов.
+func ParseKeys(r io.Reader) ([]byte, [][]byte, error) {
+	var keys [][]byte
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := DecodeKey(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("строка %d: %w", n, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil, fmt.Errorf("%w не найдено ни одного ключа", errorapp.ErrorKeyring)
+	}
+	return keys[0], keys[1:], nil
+}
+
+// LoadKeyFile - читает ключи из файла path (формат см. ParseKeys).
+func LoadKeyFile(path string) ([]byte, [][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w %v", errorapp.ErrorKeyring, err)
+	}
+	defer file.Close()
+	signing, verify, err := ParseKeys(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("файл ключей %s: %w", path, err)
+	}
+	return signing, verify, nil
+}
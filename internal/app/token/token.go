@@ -0,0 +1,201 @@
+// Package token issues and verifies versioned signed auth tokens.
+//
+// A token has the form "v1.<key id>.<claims>.<signature>", where claims is base64url-encoded JSON
+// with the user ID, issue and expiry times, and signature is base64url-encoded HMAC-SHA256 of
+// everything before it. Tokens are signed with the signing key of a Keyring and verified with the key
+// named in the token, so keys can be rotated without invalidating tokens already issued. Tokens of the legacy format (hex of a 4-byte user ID and its HMAC) are
+// accepted until an optional cutoff so that existing users keep their links; they carry no expiry and are reissued
+// in the current format on use.
+package token
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+)
+
+// Version - версия формата токена, первая часть токена.
+const Version = "v1"
+
+// DefaultTTL - срок действия токена по умолчанию.
+const DefaultTTL = 30 * 24 * time.Hour
+
+// UserIDSize - размер случайного идентификатора пользователя в байтах (128 бит).
+const UserIDSize = 16
+
+// legacyIDSize - размер идентификатора пользователя в токене старого формата.
+const legacyIDSize = 4
+
+// Claims - данные, подписанные в токене.
+type Claims struct {
+	// UserID - идентификатор пользователя.
+	UserID string `json:"sub"`
+	// IssuedAt, ExpiresAt - время выдачи и окончания действия токена в секундах Unix.
+	IssuedAt  int64 `json:"iat"`
+	ExpiresAt int64 `json:"exp"`
+	// KeyID - идентификатор ключа, которым подписан токен.
+	KeyID string `json:"-"`
+	// Legacy - токен старого формата без срока действия.
+	Legacy bool `json:"-"`
+}
+
+// Expires - возвращает время окончания действия токена (нулевое для токена старого формата).
+func (c Claims) Expires() time.Time {
+	if c.Legacy {
+		return time.Time{}
+	}
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// NeedsRefresh - проверяет, что токен пора заменить новым: он старого формата
+// или до окончания его действия осталось меньше половины срока.
+func (c Claims) NeedsRefresh(now time.Time) bool {
+	if c.Legacy {
+		return true
+	}
+	return c.ExpiresAt-now.Unix() < (c.ExpiresAt-c.IssuedAt)/2
+}
+
+// Signer - выдает токены, подписанные ключом подписи набора ключей, и проверяет токены всеми ключами набора.
+type Signer struct {
+	keys *Keyring
+	ttl  time.Duration
+	// legacyUntil - момент, с которого токены старого формата не принимаются (нулевой - принимаются всегда).
+	legacyUntil time.Time
+}
+
+// NewSigner - создает Signer с набором ключей keys и сроком действия выдаваемых токенов ttl (0 - DefaultTTL).
+func NewSigner(keys *Keyring, ttl time.Duration) *Signer {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Signer{keys: keys, ttl: ttl}
+}
+
+// RejectLegacyFrom - задает момент until, с которого токены старого формата отклоняются как истекшие
+// (нулевое время - токены старого формата принимаются без ограничения).
+func (s *Signer) RejectLegacyFrom(until time.Time) {
+	s.legacyUntil = until
+}
+
+// Stale - проверяет, что токен пора заменить новым: он подходит к концу срока действия (см. Claims.NeedsRefresh)
+// или подписан ключом, который больше не является ключом подписи.
+func (s *Signer) Stale(claims Claims, now time.Time) bool {
+	signing, _ := s.keys.Signing()
+	return claims.NeedsRefresh(now) || claims.KeyID != signing
+}
+
+// KeyID - возвращает идентификатор ключа: первые 4 байта SHA-256 ключа в hex.
+// Идентификатор не раскрывает ключ и позволяет выбрать ключ для проверки токена.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// NewUserID - создает случайный идентификатор пользователя размером UserIDSize байт в hex.
+func NewUserID() (string, error) {
+	b := make([]byte, UserIDSize)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Issue - выдает токен пользователю userID в момент now.
+func (s *Signer) Issue(userID string, now time.Time) (string, Claims, error) {
+	keyID, key := s.keys.Signing()
+	claims := Claims{UserID: userID, IssuedAt: now.Unix(), ExpiresAt: now.Add(s.ttl).Unix(), KeyID: keyID}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", claims, err
+	}
+	unsigned := Version + "." + keyID + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sign(key, unsigned)), claims, nil
+}
+
+// Parse - проверяет подпись и срок действия токена в момент now и возвращает его данные.
+// Возвращает ошибку, оборачивающую errorapp.ErrorTokenInvalid для поддельного или поврежденного токена,
+// и errorapp.ErrorTokenExpired для токена с истекшим сроком действия.
+func (s *Signer) Parse(raw string, now time.Time) (Claims, error) {
+	if !strings.HasPrefix(raw, Version+".") {
+		return s.parseLegacy(raw, now)
+	}
+	parts := strings.Split(raw, ".")
+	if len(parts) != 4 {
+		return Claims{}, fmt.Errorf("%w ожидается 4 части токена, получено %d", errorapp.ErrorTokenInvalid, len(parts))
+	}
+	key, ok := s.keys.Key(parts[1])
+	if !ok {
+		return Claims{}, fmt.Errorf("%w неизвестный ключ %q", errorapp.ErrorTokenInvalid, parts[1])
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil || !hmac.Equal(signature, sign(key, strings.Join(parts[:3], "."))) {
+		return Claims{}, fmt.Errorf("%w неверная подпись", errorapp.ErrorTokenInvalid)
+	}
+	claims, err := decodeClaims(parts[2])
+	if err != nil {
+		return Claims{}, err
+	}
+	claims.KeyID = parts[1]
+	if claims.UserID == "" {
+		return Claims{}, fmt.Errorf("%w не указан пользователь", errorapp.ErrorTokenInvalid)
+	}
+	if !now.Before(claims.Expires()) {
+		return claims, fmt.Errorf("%w срок действия истек %s", errorapp.ErrorTokenExpired,
+			claims.Expires().UTC().Format(time.RFC3339))
+	}
+	return claims, nil
+}
+
+// parseLegacy - проверяет токен старого формата: hex идентификатора пользователя и его HMAC-SHA256.
+// В токене старого формата нет идентификатора ключа, поэтому подпись проверяется всеми ключами набора.
+// Идентификатором пользователя такого токена является сам токен, под ним хранятся ссылки пользователя.
+// Начиная с момента, заданного RejectLegacyFrom, подлинный токен старого формата отклоняется как истекший.
+func (s *Signer) parseLegacy(raw string, now time.Time) (Claims, error) {
+	decoded, err := hex.DecodeString(raw)
+	if err != nil || len(decoded) != legacyIDSize+sha256.Size {
+		return Claims{}, fmt.Errorf("%w неизвестный формат токена", errorapp.ErrorTokenInvalid)
+	}
+	for _, key := range s.keys.all() {
+		h := hmac.New(sha256.New, key)
+		h.Write(decoded[:legacyIDSize])
+		if !hmac.Equal(decoded[legacyIDSize:], h.Sum(nil)) {
+			continue
+		}
+		claims := Claims{UserID: raw, Legacy: true}
+		if !s.legacyUntil.IsZero() && !now.Before(s.legacyUntil) {
+			return claims, fmt.Errorf("%w токены старого формата не принимаются с %s", errorapp.ErrorTokenExpired,
+				s.legacyUntil.UTC().Format(time.RFC3339))
+		}
+		return claims, nil
+	}
+	return Claims{}, fmt.Errorf("%w неверная подпись", errorapp.ErrorTokenInvalid)
+}
+
+// sign - возвращает HMAC-SHA256 строки unsigned на ключе key.
+func sign(key []byte, unsigned string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(unsigned))
+	return h.Sum(nil)
+}
+
+// decodeClaims - декодирует данные токена из base64url JSON.
+func decodeClaims(encoded string) (Claims, error) {
+	claims := Claims{}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return claims, fmt.Errorf("%w поврежденные данные токена", errorapp.ErrorTokenInvalid)
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return claims, fmt.Errorf("%w поврежденные данные токена", errorapp.ErrorTokenInvalid)
+	}
+	return claims, nil
+}
@@ -0,0 +1,115 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testKey  = []byte("0123456789abcdef0123456789abcdef")
+	otherKey = []byte("fedcba9876543210fedcba9876543210")
+)
+
+// legacyToken - создает токен старого формата пользователя id, подписанный ключом key.
+func legacyToken(key []byte, id []byte) string {
+	h := hmac.New(sha256.New, key)
+	h.Write(id)
+	return hex.EncodeToString(append(append([]byte{}, id...), h.Sum(nil)...))
+}
+
+func TestSigner_IssueParse(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer := NewSigner(NewKeyring(testKey), time.Hour)
+	raw, claims, err := signer.Issue("user", now)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, Version+"."+KeyID(testKey)+"."))
+	assert.Equal(t, now.Add(time.Hour), claims.Expires())
+
+	got, err := signer.Parse(raw, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "user", got.UserID)
+	assert.Equal(t, KeyID(testKey), got.KeyID)
+	assert.False(t, got.Legacy)
+	assert.False(t, signer.Stale(got, now.Add(time.Minute)))
+	assert.True(t, signer.Stale(got, now.Add(40*time.Minute)))
+
+	// срок действия
+	_, err = signer.Parse(raw, now.Add(time.Hour))
+	assert.ErrorIs(t, err, errorapp.ErrorTokenExpired)
+
+	// токен, подписанный прежним ключом, проверяется им и подлежит замене
+	rotated := NewSigner(NewKeyring(otherKey, testKey), time.Hour)
+	got, err = rotated.Parse(raw, now)
+	require.NoError(t, err)
+	assert.True(t, rotated.Stale(got, now))
+}
+
+func TestSigner_ParseInvalid(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer := NewSigner(NewKeyring(testKey), 0)
+	raw, _, err := signer.Issue("user", now)
+	require.NoError(t, err)
+	parts := strings.Split(raw, ".")
+	foreign, _, err := NewSigner(NewKeyring(otherKey), 0).Issue("user", now)
+	require.NoError(t, err)
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","iat":1700000000,"exp":1900000000}`))
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"iat":1700000000,"exp":1900000000}`))
+	unsignedToken := Version + "." + parts[1] + "." + unsigned
+	unsignedToken += "." + base64.RawURLEncoding.EncodeToString(sign(testKey, unsignedToken))
+
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"пустой токен", ""},
+		{"короткий токен", "v1."},
+		{"лишние части", raw + ".extra"},
+		{"не хватает частей", strings.Join(parts[:3], ".")},
+		{"неизвестный ключ", foreign},
+		{"неверная подпись", strings.Join(parts[:3], ".") + "." + base64.RawURLEncoding.EncodeToString([]byte("bad"))},
+		{"подпись не base64", strings.Join(parts[:3], ".") + ".!!!"},
+		{"подмененные данные", parts[0] + "." + parts[1] + "." + forged + "." + parts[3]},
+		{"без пользователя", unsignedToken},
+		{"не hex", "zz"},
+		{"hex неверной длины", "abcdef"},
+		{"старый формат с чужой подписью", legacyToken(otherKey, []byte{1, 2, 3, 4})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := signer.Parse(tt.raw, now)
+			assert.ErrorIs(t, err, errorapp.ErrorTokenInvalid)
+		})
+	}
+}
+
+func TestSigner_ParseLegacy(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	raw := legacyToken(testKey, []byte{1, 2, 3, 4})
+	// токен старого формата проверяется всеми ключами набора
+	signer := NewSigner(NewKeyring(otherKey, testKey), 0)
+
+	claims, err := signer.Parse(raw, now)
+	require.NoError(t, err)
+	assert.Equal(t, raw, claims.UserID)
+	assert.True(t, claims.Legacy)
+	assert.True(t, claims.Expires().IsZero())
+	assert.True(t, signer.Stale(claims, now))
+
+	// после даты отключения подлинный токен старого формата отклоняется как истекший
+	signer.RejectLegacyFrom(now.Add(time.Hour))
+	_, err = signer.Parse(raw, now)
+	assert.NoError(t, err)
+	_, err = signer.Parse(raw, now.Add(time.Hour))
+	assert.ErrorIs(t, err, errorapp.ErrorTokenExpired)
+	_, err = signer.Parse(legacyToken(otherKey, []byte{5, 6, 7, 8})[:10], now.Add(time.Hour))
+	assert.ErrorIs(t, err, errorapp.ErrorTokenInvalid)
+}
@@ -1,7 +1,10 @@
 // Package helperfunc contains helper functions that are used by several modules.
 package helperfunc
 
-import "sync"
+import (
+	"strings"
+	"sync"
+)
 
 // FanInSliceString - объединяет несколько каналов типа []string в один канал и возвращает его.
 // Функция ожидает, что каждый канал будет закрыт после передачи всех данных.
@@ -23,3 +26,14 @@ func FanInSliceString(chs ...chan []string) chan []string {
 	}()
 	return OutCh
 }
+
+// DeletedURL - возвращает значение full_url, под которым хранится удаленная ссылка.
+// Префикс освобождает исходный URL для повторного сокращения (full_url уникален).
+func DeletedURL(shortKey, fullURL string) string {
+	return shortKey + "_deleted=" + fullURL
+}
+
+// RestoreDeletedURL - возвращает исходный URL удаленной ссылки, убирая префикс, добавленный DeletedURL.
+func RestoreDeletedURL(shortKey, storedURL string) string {
+	return strings.TrimPrefix(storedURL, shortKey+"_deleted=")
+}
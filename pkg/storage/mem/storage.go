@@ -4,7 +4,9 @@ package mem
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/bubu256/go-url-shortener-server/config"
 	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
@@ -17,11 +19,40 @@ import (
 type MapDBMutex struct {
 	keyToURL         map[string]string
 	userToKeys       map[string][]string
+	keyToUser        map[string]string
 	keyAvailable     map[string]bool
+	keyMeta          map[string]schema.URLMeta
+	folders          map[int64]schema.Folder
+	lastFolderID     int64
+	campaigns        map[int64]schema.Campaign
+	lastCampaignID   int64
+	reports          []schema.AbuseReport
+	lastReportID     int64
+	accounts         map[string]schema.Account
+	accountLogins    map[string]string // email и имя пользователя -> идентификатор учетной записи
+	apiKeys          map[string]schema.APIKey
+	workspaces       map[string]schema.Workspace
+	members          map[string]map[string]schema.WorkspaceMember // пространство -> пользователь -> участник
+	transfers        map[string]schema.TransferOffer              // короткий ключ -> предложение передачи
+	purged           int64                                        // количество окончательно удаленных ссылок
 	connectingString string
 	mutex            sync.RWMutex
+	// корзины ограничения частоты запросов защищены отдельным мьютексом, чтобы не задерживать работу со ссылками
+	buckets   map[string]rateBucket
+	rateMutex sync.Mutex
+	// rateSweptAt - время последнего удаления заполненных корзин
+	rateSweptAt time.Time
 }
 
+// rateBucket - корзина токенов с моментом, когда она снова заполнится.
+type rateBucket struct {
+	schema.RateBucket
+	fullAt time.Time
+}
+
+// rateSweepInterval - период удаления заполненных корзин из памяти.
+const rateSweepInterval = time.Minute
+
 // NewMapDBMutex - создает новый экземпляр MapDBMutex с указанными параметрами.
 func NewMapDBMutex(cfgDB config.CfgDataBase, initData map[string]string) *MapDBMutex {
 	// Инициализация нового хранилища в памяти с параметрами, указанными в config.CfgDataBase
@@ -29,9 +60,20 @@ func NewMapDBMutex(cfgDB config.CfgDataBase, initData map[string]string) *MapDBM
 	NewStorage := MapDBMutex{connectingString: cfgDB.DataBaseDSN}
 	NewStorage.keyToURL = make(map[string]string)
 	NewStorage.userToKeys = make(map[string][]string)
+	NewStorage.keyToUser = make(map[string]string)
 	NewStorage.keyAvailable = make(map[string]bool)
+	NewStorage.keyMeta = make(map[string]schema.URLMeta)
+	NewStorage.folders = make(map[int64]schema.Folder)
+	NewStorage.campaigns = make(map[int64]schema.Campaign)
+	NewStorage.accounts = make(map[string]schema.Account)
+	NewStorage.accountLogins = make(map[string]string)
+	NewStorage.apiKeys = make(map[string]schema.APIKey)
+	NewStorage.workspaces = make(map[string]schema.Workspace)
+	NewStorage.members = make(map[string]map[string]schema.WorkspaceMember)
+	NewStorage.transfers = make(map[string]schema.TransferOffer)
+	NewStorage.buckets = make(map[string]rateBucket)
 	for k, v := range initData {
-		NewStorage.SetNewURL(k, v, "", true)
+		NewStorage.SetNewURL(schema.URLRecord{ShortKey: k, FullURL: v, Available: true}, schema.URLQuota{})
 	}
 	return &NewStorage
 }
@@ -45,11 +87,24 @@ func (s *MapDBMutex) Ping() error {
 }
 
 // SetBatchURLs - добавление пакета коротких URL-адресов в хранилище
-// Возвращает список коротких ключей добавленных URL-адресов
-func (s *MapDBMutex) SetBatchURLs(batch schema.APIShortenBatchInput, token string) ([]string, error) {
+// Возвращает список коротких ключей добавленных URL-адресов. Пакет учитывается в квотах quota целиком.
+func (s *MapDBMutex) SetBatchURLs(batch schema.APIShortenBatchInput, token string, quota schema.URLQuota) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if quota.Enabled() {
+		if err := quota.Check(s.countUserURLs(token, quota.Key, quota.DayStart), len(batch)); err != nil {
+			return nil, err
+		}
+	}
 	result := make([]string, 0, len(batch))
 	for _, elem := range batch {
-		err := s.SetNewURL(elem.CorrelationID, elem.OriginalURL, token, true)
+		err := s.setNewURL(schema.URLRecord{
+			ShortKey:  elem.CorrelationID,
+			FullURL:   elem.OriginalURL,
+			UserID:    token,
+			Available: true,
+			URLMeta:   schema.URLMeta{QuotaKey: quota.Key},
+		}, schema.URLQuota{})
 		if err != nil {
 			continue
 		}
@@ -62,9 +117,14 @@ func (s *MapDBMutex) SetBatchURLs(batch schema.APIShortenBatchInput, token strin
 func (s *MapDBMutex) DeleteBatch(chs []chan []string) error {
 	for keyUser := range helperfunc.FanInSliceString(chs...) {
 		s.mutex.Lock()
-		if slices.Contains(s.userToKeys[keyUser[1]], keyUser[0]) {
+		if slices.Contains(s.userToKeys[keyUser[1]], keyUser[0]) && s.keyAvailable[keyUser[0]] {
 			s.keyAvailable[keyUser[0]] = false
-			s.keyToURL[keyUser[0]] = keyUser[0] + "_deleted=" + s.keyToURL[keyUser[0]]
+			s.keyToURL[keyUser[0]] = helperfunc.DeletedURL(keyUser[0], s.keyToURL[keyUser[0]])
+			meta := s.keyMeta[keyUser[0]]
+			now := time.Now()
+			meta.UpdatedAt = now
+			meta.DeletedAt = &now
+			s.keyMeta[keyUser[0]] = meta
 		}
 		s.mutex.Unlock()
 	}
@@ -82,10 +142,37 @@ func (s *MapDBMutex) GetURL(key string) (string, error) {
 	if !s.keyAvailable[key] {
 		return "", errorapp.ErrorPageNotAvailable
 	}
+	if expiresAt := s.keyMeta[key].ExpiresAt; expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", errorapp.ErrorPageNotAvailable
+	}
+	if reason := s.keyMeta[key].DisabledReason; reason != "" {
+		return "", errorapp.NewURLDisabledError(reason)
+	}
+	if activeFrom := s.keyMeta[key].ActiveFrom; activeFrom != nil && activeFrom.After(time.Now()) {
+		return "", errorapp.NewURLNotActiveError(*activeFrom)
+	}
 
 	return fullURL, nil
 }
 
+// GetRecord - возвращает полную запись о ссылке по короткому ключу, в том числе для удаленных ссылок.
+func (s *MapDBMutex) GetRecord(key string) (schema.URLRecord, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	fullURL, ok := s.keyToURL[key]
+	if !ok {
+		return schema.URLRecord{}, errorapp.ErrorURLNotFound
+	}
+	rec := schema.URLRecord{
+		ShortKey:  key,
+		FullURL:   helperfunc.RestoreDeletedURL(key, fullURL),
+		Available: s.keyAvailable[key],
+		URLMeta:   s.keyMeta[key],
+	}
+	rec.UserID = s.keyToUser[key]
+	return rec, nil
+}
+
 // GetAllURLs - возвращает все записи URL, которые были сохранены пользователем с указанным идентификатором.
 // Ключи URL сохранены в виде ключей словаря, значения - в виде URL.
 func (s *MapDBMutex) GetAllURLs(userID string) map[string]string {
@@ -105,35 +192,1002 @@ func (s *MapDBMutex) GetAllURLs(userID string) map[string]string {
 	return result
 }
 
-// SetNewURL - сохраняет URL по ключу key в хранилище.
+// SetNewURL - сохраняет запись rec в хранилище.
 // Если URL уже существует в хранилище, возвращает ошибку.
-func (s *MapDBMutex) SetNewURL(key, URL, tokenID string, available bool) error {
+// Если время создания не указано, используется текущее время.
+func (s *MapDBMutex) SetNewURL(rec schema.URLRecord, quota schema.URLQuota) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	return s.setNewURL(rec, quota)
+}
+
+// setNewURL - сохраняет запись о ссылке, если она не дублирует существующую и пользователь не превысил квоты.
+// Вызывается под блокировкой.
+func (s *MapDBMutex) setNewURL(rec schema.URLRecord, quota schema.URLQuota) error {
 	// проверяем существует ли урл
 	// наверное это очень дорогая операция для проверки на дупликацию урл, но как лучше пока не знаю
 	for existKey, fullURL := range s.keyToURL {
-		if fullURL == URL {
+		if fullURL == rec.FullURL {
 			return errorapp.NewURLDuplicateError(
-				fmt.Errorf("запись URL %s невозможна т.к. он уже есть базе;", URL),
+				fmt.Errorf("запись URL %s невозможна т.к. он уже есть базе;", rec.FullURL),
 				existKey,
 				fullURL,
 			)
 		}
 	}
-	s.keyToURL[key] = URL
-	s.userToKeys[tokenID] = append(s.userToKeys[tokenID], key)
-	s.keyAvailable[key] = available
+	if quota.Enabled() {
+		if err := quota.Check(s.countUserURLs(rec.UserID, quota.Key, quota.DayStart), 1); err != nil {
+			return err
+		}
+	}
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now()
+	}
+	if rec.UpdatedAt.IsZero() {
+		rec.UpdatedAt = rec.CreatedAt
+	}
+	s.keyToURL[rec.ShortKey] = rec.FullURL
+	s.userToKeys[rec.UserID] = append(s.userToKeys[rec.UserID], rec.ShortKey)
+	s.keyToUser[rec.ShortKey] = rec.UserID
+	s.keyAvailable[rec.ShortKey] = rec.Available
+	s.keyMeta[rec.ShortKey] = rec.URLMeta
+	return nil
+}
+
+// RestoreRecord - записывает rec в хранилище без проверки на дубликаты, заменяя существующую запись с тем же ключом.
+// Используется для восстановления состояния хранилища из журнала (см. storage.NewWrapToSaveFile).
+// Удаленные ссылки передаются в исходном виде, как их возвращает GetRecord.
+func (s *MapDBMutex) RestoreRecord(rec schema.URLRecord) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if prevUser, ok := s.keyToUser[rec.ShortKey]; ok && prevUser != rec.UserID {
+		keys := s.userToKeys[prevUser]
+		if i := slices.Index(keys, rec.ShortKey); i >= 0 {
+			s.userToKeys[prevUser] = slices.Delete(keys, i, i+1)
+		}
+	}
+	if !slices.Contains(s.userToKeys[rec.UserID], rec.ShortKey) {
+		s.userToKeys[rec.UserID] = append(s.userToKeys[rec.UserID], rec.ShortKey)
+	}
+	if rec.Available {
+		s.keyToURL[rec.ShortKey] = rec.FullURL
+	} else {
+		s.keyToURL[rec.ShortKey] = helperfunc.DeletedURL(rec.ShortKey, rec.FullURL)
+	}
+	s.keyToUser[rec.ShortKey] = rec.UserID
+	s.keyAvailable[rec.ShortKey] = rec.Available
+	s.keyMeta[rec.ShortKey] = rec.URLMeta
+}
+
+// UpdateURL - изменяет метаданные ссылки key, принадлежащей пользователю userID.
+// Возвращает обновленную запись, errorapp.ErrorURLNotFound если ссылки нет
+// и errorapp.ErrorAccessDenied если ссылка принадлежит другому пользователю.
+func (s *MapDBMutex) UpdateURL(key, userID string, patch schema.URLPatch) (schema.URLRecord, error) {
+	s.mutex.Lock()
+	owner, ok := s.keyToUser[key]
+	if !ok {
+		s.mutex.Unlock()
+		return schema.URLRecord{}, errorapp.ErrorURLNotFound
+	}
+	if owner != userID {
+		s.mutex.Unlock()
+		return schema.URLRecord{}, errorapp.ErrorAccessDenied
+	}
+	if patch.FolderID != nil && *patch.FolderID != 0 && s.folders[*patch.FolderID].UserID != userID {
+		s.mutex.Unlock()
+		return schema.URLRecord{}, errorapp.ErrorFolderNotFound
+	}
+	if patch.CampaignID != nil && *patch.CampaignID != 0 && s.campaigns[*patch.CampaignID].UserID != userID {
+		s.mutex.Unlock()
+		return schema.URLRecord{}, errorapp.ErrorCampaignNotFound
+	}
+	meta := s.keyMeta[key]
+	patch.Apply(&meta)
+	meta.UpdatedAt = time.Now()
+	s.keyMeta[key] = meta
+	s.mutex.Unlock()
+	return s.GetRecord(key)
+}
+
+// ChangeTags - добавляет метки add и удаляет метки remove у ссылки key, принадлежащей пользователю userID.
+// Возвращает обновленную запись.
+func (s *MapDBMutex) ChangeTags(key, userID string, add, remove []string) (schema.URLRecord, error) {
+	s.mutex.Lock()
+	owner, ok := s.keyToUser[key]
+	if !ok {
+		s.mutex.Unlock()
+		return schema.URLRecord{}, errorapp.ErrorURLNotFound
+	}
+	if owner != userID {
+		s.mutex.Unlock()
+		return schema.URLRecord{}, errorapp.ErrorAccessDenied
+	}
+	meta := s.keyMeta[key]
+	tags := make([]string, 0, len(meta.Tags)+len(add))
+	for _, tag := range meta.Tags {
+		if !slices.Contains(remove, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	for _, tag := range add {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	meta.Tags = tags
+	meta.UpdatedAt = time.Now()
+	s.keyMeta[key] = meta
+	s.mutex.Unlock()
+	return s.GetRecord(key)
+}
+
+// ListTags - возвращает метки активных ссылок пользователя и количество ссылок с каждой меткой.
+func (s *MapDBMutex) ListTags(userID string) ([]schema.APITagInfo, error) {
+	s.mutex.RLock()
+	counts := make(map[string]int)
+	for _, key := range s.userToKeys[userID] {
+		if !s.keyAvailable[key] {
+			continue
+		}
+		for _, tag := range s.keyMeta[key].Tags {
+			counts[tag]++
+		}
+	}
+	s.mutex.RUnlock()
+	result := make([]schema.APITagInfo, 0, len(counts))
+	for tag, count := range counts {
+		result = append(result, schema.APITagInfo{Name: tag, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// CreateFolder - создает папку пользователя userID с названием name.
+func (s *MapDBMutex) CreateFolder(userID, name string) (schema.Folder, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastFolderID++
+	folder := schema.Folder{ID: s.lastFolderID, UserID: userID, Name: name, CreatedAt: time.Now()}
+	s.folders[folder.ID] = folder
+	return folder, nil
+}
+
+// RestoreFolder - записывает папку в хранилище, заменяя существующую с тем же идентификатором.
+// Папка с пустым UserID удаляется. Используется для восстановления состояния хранилища из журнала.
+func (s *MapDBMutex) RestoreFolder(folder schema.Folder) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if folder.ID > s.lastFolderID {
+		s.lastFolderID = folder.ID
+	}
+	if folder.UserID == "" {
+		delete(s.folders, folder.ID)
+		for key, meta := range s.keyMeta {
+			if meta.FolderID == folder.ID {
+				meta.FolderID = 0
+				s.keyMeta[key] = meta
+			}
+		}
+		return
+	}
+	s.folders[folder.ID] = folder
+}
+
+// GetFolder - возвращает папку по идентификатору или errorapp.ErrorFolderNotFound.
+func (s *MapDBMutex) GetFolder(id int64) (schema.Folder, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	folder, ok := s.folders[id]
+	if !ok {
+		return folder, errorapp.ErrorFolderNotFound
+	}
+	return folder, nil
+}
+
+// ListFolders - возвращает папки пользователя с количеством активных ссылок в каждой.
+func (s *MapDBMutex) ListFolders(userID string) ([]schema.Folder, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := make([]schema.Folder, 0)
+	for _, folder := range s.folders {
+		if folder.UserID != userID {
+			continue
+		}
+		for _, key := range s.userToKeys[userID] {
+			if s.keyAvailable[key] && s.keyMeta[key].FolderID == folder.ID {
+				folder.LinkCount++
+			}
+		}
+		result = append(result, folder)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// DeleteFolder - удаляет папку пользователя. Ссылки из папки остаются у пользователя без папки.
+func (s *MapDBMutex) DeleteFolder(id int64, userID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	folder, ok := s.folders[id]
+	if !ok || folder.UserID != userID {
+		return errorapp.ErrorFolderNotFound
+	}
+	delete(s.folders, id)
+	for _, key := range s.userToKeys[userID] {
+		if meta := s.keyMeta[key]; meta.FolderID == id {
+			meta.FolderID = 0
+			s.keyMeta[key] = meta
+		}
+	}
+	return nil
+}
+
+// CreateCampaign - создает кампанию campaign.UserID с названием и UTM-шаблоном из campaign.
+func (s *MapDBMutex) CreateCampaign(campaign schema.Campaign) (schema.Campaign, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastCampaignID++
+	campaign.ID = s.lastCampaignID
+	campaign.CreatedAt = time.Now()
+	campaign.LinkCount, campaign.Clicks = 0, 0
+	s.campaigns[campaign.ID] = campaign
+	return campaign, nil
+}
+
+// RestoreCampaign - записывает кампанию в хранилище, заменяя существующую с тем же идентификатором.
+// Кампания с пустым UserID удаляется. Если у кампании не задано количество переходов (журнал прежней версии),
+// сохраняется уже учтенное. Используется для восстановления состояния хранилища из журнала.
+func (s *MapDBMutex) RestoreCampaign(campaign schema.Campaign) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if campaign.ID > s.lastCampaignID {
+		s.lastCampaignID = campaign.ID
+	}
+	if campaign.UserID == "" {
+		s.deleteCampaign(campaign.ID)
+		return
+	}
+	if campaign.Clicks == 0 {
+		campaign.Clicks = s.campaigns[campaign.ID].Clicks
+	}
+	s.campaigns[campaign.ID] = campaign
+}
+
+// GetCampaign - возвращает кампанию по идентификатору или errorapp.ErrorCampaignNotFound.
+func (s *MapDBMutex) GetCampaign(id int64) (schema.Campaign, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	campaign, ok := s.campaigns[id]
+	if !ok {
+		return campaign, errorapp.ErrorCampaignNotFound
+	}
+	return campaign, nil
+}
+
+// ListCampaigns - возвращает кампании пользователя с количеством активных ссылок в каждой.
+func (s *MapDBMutex) ListCampaigns(userID string) ([]schema.Campaign, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := make([]schema.Campaign, 0)
+	for _, campaign := range s.campaigns {
+		if campaign.UserID != userID {
+			continue
+		}
+		for _, key := range s.userToKeys[userID] {
+			if s.keyAvailable[key] && s.keyMeta[key].CampaignID == campaign.ID {
+				campaign.LinkCount++
+			}
+		}
+		result = append(result, campaign)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// DeleteCampaign - удаляет кампанию пользователя. Ссылки кампании остаются у пользователя без кампании.
+func (s *MapDBMutex) DeleteCampaign(id int64, userID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	campaign, ok := s.campaigns[id]
+	if !ok || campaign.UserID != userID {
+		return errorapp.ErrorCampaignNotFound
+	}
+	s.deleteCampaign(id)
 	return nil
 }
 
-// GetLastID - возвращает количество сохраненных URL в хранилище.
+// deleteCampaign - удаляет кампанию и отвязывает от нее ссылки. Вызывается под блокировкой.
+func (s *MapDBMutex) deleteCampaign(id int64) {
+	delete(s.campaigns, id)
+	for key, meta := range s.keyMeta {
+		if meta.CampaignID == id {
+			meta.CampaignID = 0
+			s.keyMeta[key] = meta
+		}
+	}
+}
+
+// RecordClick - увеличивает счетчик переходов ссылки key, кампании campaignID (если она задана и существует)
+// и варианта адреса перехода variantID (если он есть у ссылки).
+func (s *MapDBMutex) RecordClick(key string, campaignID, variantID int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	meta, ok := s.keyMeta[key]
+	if !ok {
+		return errorapp.ErrorURLNotFound
+	}
+	meta.Clicks++
+	if i := slices.IndexFunc(meta.Targets, func(t schema.SplitTarget) bool { return t.ID == variantID }); i >= 0 {
+		// срез вариантов может разделяться с ранее выданными записями, поэтому изменяется копия
+		meta.Targets = slices.Clone(meta.Targets)
+		meta.Targets[i].Clicks++
+	}
+	s.keyMeta[key] = meta
+	if campaign, ok := s.campaigns[campaignID]; ok {
+		campaign.Clicks++
+		s.campaigns[campaignID] = campaign
+	}
+	return nil
+}
+
+// CountUserURLs - возвращает количество ссылок пользователя, созданных начиная с since (в том числе удаленных),
+// и его действующих ссылок (не удаленных и не истекших). Если задан ключ квоты quotaKey,
+// считаются ссылки, созданные с этим ключом.
+func (s *MapDBMutex) CountUserURLs(userID, quotaKey string, since time.Time) (schema.URLCounts, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.countUserURLs(userID, quotaKey, since), nil
+}
+
+// countUserURLs - считает ссылки пользователя или ключа квоты quotaKey для учета квот. Вызывается под блокировкой.
+func (s *MapDBMutex) countUserURLs(userID, quotaKey string, since time.Time) schema.URLCounts {
+	keys := s.userToKeys[userID]
+	if quotaKey != "" {
+		keys = make([]string, 0)
+		for key, meta := range s.keyMeta {
+			if meta.QuotaKey == quotaKey {
+				keys = append(keys, key)
+			}
+		}
+	}
+	now := time.Now()
+	counts := schema.URLCounts{}
+	for _, key := range keys {
+		meta := s.keyMeta[key]
+		if !meta.CreatedAt.Before(since) {
+			counts.Created++
+		}
+		if s.active(key, now) {
+			counts.Active++
+		}
+	}
+	return counts
+}
+
+// active - проверяет, что ссылка key действует (не удалена и не истекла) на момент now. Вызывается под блокировкой.
+func (s *MapDBMutex) active(key string, now time.Time) bool {
+	meta := s.keyMeta[key]
+	return s.keyAvailable[key] && (meta.ExpiresAt == nil || meta.ExpiresAt.After(now))
+}
+
+// ListURLs - возвращает страницу ссылок пользователя, отобранных и отсортированных согласно opts.
+// Параметры opts должны быть предварительно проверены (см. shortener.Shortener.ListURLs).
+func (s *MapDBMutex) ListURLs(userID string, opts schema.ListURLsOptions) (schema.URLPage, error) {
+	opts.Owner = userID
+	return s.searchURLs(opts, true)
+}
+
+// SearchURLs - возвращает страницу ссылок всех пользователей или владельца opts.Owner,
+// отобранных и отсортированных согласно opts.
+func (s *MapDBMutex) SearchURLs(opts schema.ListURLsOptions) (schema.URLPage, error) {
+	return s.searchURLs(opts, opts.Owner != "")
+}
+
+// searchURLs - отбирает ссылки владельца opts.Owner (byOwner) или всех пользователей.
+func (s *MapDBMutex) searchURLs(opts schema.ListURLsOptions, byOwner bool) (schema.URLPage, error) {
+	page := schema.URLPage{}
+	var cursor *schema.ListCursor
+	if opts.Cursor != "" {
+		c, err := schema.DecodeListCursor(opts.Cursor)
+		if err != nil {
+			return page, fmt.Errorf("%w %v", errorapp.ErrorInvalidListOptions, err)
+		}
+		cursor = &c
+	}
+	now := time.Now()
+
+	s.mutex.RLock()
+	keys := s.userToKeys[opts.Owner]
+	if !byOwner {
+		keys = make([]string, 0, len(s.keyToURL))
+		for key := range s.keyToURL {
+			keys = append(keys, key)
+		}
+	}
+	records := make([]schema.URLRecord, 0, len(keys))
+	for _, key := range keys {
+		rec := schema.URLRecord{
+			ShortKey:  key,
+			FullURL:   helperfunc.RestoreDeletedURL(key, s.keyToURL[key]),
+			UserID:    s.keyToUser[key],
+			Available: s.keyAvailable[key],
+			URLMeta:   s.keyMeta[key],
+		}
+		if !opts.Match(rec, now) {
+			continue
+		}
+		if cursor != nil && !cursor.After(rec, opts.SortBy, opts.Desc) {
+			continue
+		}
+		records = append(records, rec)
+	}
+	s.mutex.RUnlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		c := schema.NewListCursor(records[i])
+		return c.After(records[j], opts.SortBy, opts.Desc)
+	})
+	if len(records) > opts.Limit {
+		records = records[:opts.Limit]
+		page.NextCursor = schema.NewListCursor(records[len(records)-1]).Encode()
+	}
+	page.Items = records
+	return page, nil
+}
+
+// PurgeURLs - окончательно удаляет ссылки и жалобы на них. Отсутствующие ключи пропускаются.
+// Количество удаленных ссылок запоминается, чтобы GetLastID не уменьшался.
+func (s *MapDBMutex) PurgeURLs(keys []string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	purged := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := s.keyToURL[key]; !ok {
+			continue
+		}
+		owner := s.keyToUser[key]
+		if i := slices.Index(s.userToKeys[owner], key); i >= 0 {
+			s.userToKeys[owner] = slices.Delete(s.userToKeys[owner], i, i+1)
+		}
+		if len(s.userToKeys[owner]) == 0 {
+			delete(s.userToKeys, owner)
+		}
+		delete(s.keyToURL, key)
+		delete(s.keyToUser, key)
+		delete(s.keyAvailable, key)
+		delete(s.keyMeta, key)
+		delete(s.transfers, key)
+		s.purged++
+		purged = append(purged, key)
+	}
+	reports := s.reports[:0]
+	for _, report := range s.reports {
+		if !slices.Contains(purged, report.ShortKey) {
+			reports = append(reports, report)
+		}
+	}
+	s.reports = reports
+	sort.Strings(purged)
+	return purged, nil
+}
+
+// AddReport - сохраняет жалобу на ссылку со статусом schema.ReportStatusOpen.
+func (s *MapDBMutex) AddReport(report schema.AbuseReport) (schema.AbuseReport, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastReportID++
+	report.ID = s.lastReportID
+	report.Status = schema.ReportStatusOpen
+	report.CreatedAt = time.Now()
+	report.ClosedAt = nil
+	s.reports = append(s.reports, report)
+	return report, nil
+}
+
+// RestoreReport - записывает жалобу в хранилище, заменяя существующую с тем же идентификатором.
+// Используется для восстановления состояния хранилища из журнала.
+func (s *MapDBMutex) RestoreReport(report schema.AbuseReport) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if report.ID > s.lastReportID {
+		s.lastReportID = report.ID
+	}
+	for i := range s.reports {
+		if s.reports[i].ID == report.ID {
+			s.reports[i] = report
+			return
+		}
+	}
+	s.reports = append(s.reports, report)
+}
+
+// ListReports - возвращает жалобы, соответствующие фильтру, от новых к старым.
+func (s *MapDBMutex) ListReports(filter schema.ReportFilter) ([]schema.AbuseReport, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := make([]schema.AbuseReport, 0)
+	for i := len(s.reports) - 1; i >= 0; i-- {
+		if filter.Match(s.reports[i]) {
+			result = append(result, s.reports[i])
+		}
+	}
+	return result, nil
+}
+
+// CloseReports - переводит открытые жалобы на ссылку key в статус status и возвращает их.
+func (s *MapDBMutex) CloseReports(key, status string) ([]schema.AbuseReport, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	result := make([]schema.AbuseReport, 0)
+	for i, report := range s.reports {
+		if report.ShortKey != key || report.Status != schema.ReportStatusOpen {
+			continue
+		}
+		report.Status = status
+		report.ClosedAt = &now
+		s.reports[i] = report
+		result = append(result, report)
+	}
+	return result, nil
+}
+
+// ReassignUser - передает все ссылки, папки и кампании пользователя fromUserID пользователю toUserID.
+// Метки хранятся в ссылках и переходят вместе с ними. Действующие ссылки учитываются в квотах quota
+// нового владельца, ключ квоты ссылок сбрасывается.
+func (s *MapDBMutex) ReassignUser(fromUserID, toUserID string, quota schema.URLQuota) (schema.ClaimResult, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := schema.ClaimResult{URLs: make([]string, 0), Folders: make([]int64, 0), Campaigns: make([]int64, 0)}
+	if fromUserID == toUserID {
+		return result, nil
+	}
+	if quota.Enabled() {
+		now, active := time.Now(), 0
+		for _, key := range s.userToKeys[fromUserID] {
+			if s.active(key, now) {
+				active++
+			}
+		}
+		if err := quota.Check(s.countUserURLs(toUserID, quota.Key, quota.DayStart), active); err != nil {
+			return result, err
+		}
+	}
+	for _, key := range s.userToKeys[fromUserID] {
+		s.keyToUser[key] = toUserID
+		s.userToKeys[toUserID] = append(s.userToKeys[toUserID], key)
+		meta := s.keyMeta[key]
+		meta.QuotaKey = ""
+		s.keyMeta[key] = meta
+		result.URLs = append(result.URLs, key)
+	}
+	delete(s.userToKeys, fromUserID)
+	for id, folder := range s.folders {
+		if folder.UserID == fromUserID {
+			folder.UserID = toUserID
+			s.folders[id] = folder
+			result.Folders = append(result.Folders, id)
+		}
+	}
+	for id, campaign := range s.campaigns {
+		if campaign.UserID == fromUserID {
+			campaign.UserID = toUserID
+			s.campaigns[id] = campaign
+			result.Campaigns = append(result.Campaigns, id)
+		}
+	}
+	sort.Slice(result.Folders, func(i, j int) bool { return result.Folders[i] < result.Folders[j] })
+	sort.Slice(result.Campaigns, func(i, j int) bool { return result.Campaigns[i] < result.Campaigns[j] })
+	return result, nil
+}
+
+// CreateAccount - сохраняет учетную запись. Email и имя пользователя должны быть свободны.
+func (s *MapDBMutex) CreateAccount(account schema.Account) (schema.Account, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.accounts[account.ID]; ok {
+		return account, errorapp.ErrorAccountExists
+	}
+	for _, login := range []string{account.Email, account.Username} {
+		if _, ok := s.accountLogins[login]; login != "" && ok {
+			return account, errorapp.ErrorAccountExists
+		}
+	}
+	account.CreatedAt = time.Now()
+	s.restoreAccount(account)
+	return account, nil
+}
+
+// RestoreAccount - записывает учетную запись в хранилище без проверки занятости email и имени.
+// Используется для восстановления состояния хранилища из журнала.
+func (s *MapDBMutex) RestoreAccount(account schema.Account) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.restoreAccount(account)
+}
+
+// restoreAccount - записывает учетную запись и ее email и имя в индекс. Вызывается под блокировкой.
+func (s *MapDBMutex) restoreAccount(account schema.Account) {
+	s.accounts[account.ID] = account
+	for _, login := range []string{account.Email, account.Username} {
+		if login != "" {
+			s.accountLogins[login] = account.ID
+		}
+	}
+}
+
+// GetAccount - возвращает учетную запись по идентификатору пользователя.
+func (s *MapDBMutex) GetAccount(userID string) (schema.Account, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	account, ok := s.accounts[userID]
+	if !ok {
+		return account, errorapp.ErrorAccountNotFound
+	}
+	return account, nil
+}
+
+// FindAccount - возвращает учетную запись по email или имени пользователя.
+func (s *MapDBMutex) FindAccount(login string) (schema.Account, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	id, ok := s.accountLogins[login]
+	if !ok || login == "" {
+		return schema.Account{}, errorapp.ErrorAccountNotFound
+	}
+	return s.accounts[id], nil
+}
+
+// CreateAPIKey - сохраняет ключ API.
+func (s *MapDBMutex) CreateAPIKey(key schema.APIKey) (schema.APIKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.apiKeys[key.ID]; ok {
+		return key, fmt.Errorf("ключ API %s уже существует", key.ID)
+	}
+	key.CreatedAt = time.Now()
+	key.RevokedAt = nil
+	s.apiKeys[key.ID] = key
+	return key, nil
+}
+
+// RestoreAPIKey - записывает ключ API в хранилище, заменяя существующий с тем же идентификатором.
+// Используется для восстановления состояния хранилища из журнала.
+func (s *MapDBMutex) RestoreAPIKey(key schema.APIKey) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.apiKeys[key.ID] = key
+}
+
+// GetAPIKey - возвращает ключ API по идентификатору.
+func (s *MapDBMutex) GetAPIKey(id string) (schema.APIKey, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	key, ok := s.apiKeys[id]
+	if !ok {
+		return key, errorapp.ErrorAPIKeyNotFound
+	}
+	return key, nil
+}
+
+// ListAPIKeys - возвращает ключи API пользователя в порядке создания.
+func (s *MapDBMutex) ListAPIKeys(userID string) ([]schema.APIKey, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := make([]schema.APIKey, 0)
+	for _, key := range s.apiKeys {
+		if key.UserID == userID {
+			result = append(result, key)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// RevokeAPIKey - отзывает ключ API пользователя. Повторный отзыв не меняет время отзыва.
+func (s *MapDBMutex) RevokeAPIKey(id, userID string) (schema.APIKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key, ok := s.apiKeys[id]
+	if !ok || key.UserID != userID {
+		return schema.APIKey{}, errorapp.ErrorAPIKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		s.apiKeys[id] = key
+	}
+	return key, nil
+}
+
+// TransferURL - передает ссылку key от владельца fromUserID владельцу toUserID.
+// Ссылка убирается из папки и кампании прежнего владельца, метки сохраняются.
+// Квоты quota нового владельца проверяются под той же блокировкой, что и передача.
+func (s *MapDBMutex) TransferURL(key, fromUserID, toUserID string, quota schema.URLQuota) (schema.URLRecord, error) {
+	s.mutex.Lock()
+	err := s.transferURL(key, fromUserID, toUserID, quota)
+	s.mutex.Unlock()
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	return s.GetRecord(key)
+}
+
+// transferURL - передает ссылку key от владельца fromUserID владельцу toUserID. Вызывается под блокировкой.
+func (s *MapDBMutex) transferURL(key, fromUserID, toUserID string, quota schema.URLQuota) error {
+	owner, ok := s.keyToUser[key]
+	if !ok {
+		return errorapp.ErrorURLNotFound
+	}
+	if owner != fromUserID {
+		return errorapp.ErrorAccessDenied
+	}
+	if fromUserID == toUserID {
+		return nil
+	}
+	if quota.Enabled() {
+		if err := quota.Check(s.countUserURLs(toUserID, quota.Key, quota.DayStart), 1); err != nil {
+			return err
+		}
+	}
+	keys := s.userToKeys[fromUserID]
+	if i := slices.Index(keys, key); i >= 0 {
+		s.userToKeys[fromUserID] = slices.Delete(keys, i, i+1)
+	}
+	s.userToKeys[toUserID] = append(s.userToKeys[toUserID], key)
+	s.keyToUser[key] = toUserID
+	meta := s.keyMeta[key]
+	meta.FolderID = 0
+	meta.CampaignID = 0
+	meta.QuotaKey = ""
+	meta.UpdatedAt = time.Now()
+	s.keyMeta[key] = meta
+	return nil
+}
+
+// OfferTransfer - сохраняет предложение передачи ссылки вместо прежнего предложения для нее.
+func (s *MapDBMutex) OfferTransfer(offer schema.TransferOffer) (schema.TransferOffer, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	owner, ok := s.keyToUser[offer.ShortKey]
+	if !ok {
+		return offer, errorapp.ErrorURLNotFound
+	}
+	if owner != offer.FromUserID {
+		return offer, errorapp.ErrorAccessDenied
+	}
+	offer.CreatedAt = time.Now()
+	s.transfers[offer.ShortKey] = offer
+	return offer, nil
+}
+
+// RestoreTransfer - записывает предложение передачи в хранилище, предложение без получателя удаляется.
+// Используется для восстановления состояния хранилища из журнала.
+func (s *MapDBMutex) RestoreTransfer(offer schema.TransferOffer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if offer.ToUserID == "" {
+		delete(s.transfers, offer.ShortKey)
+		return
+	}
+	s.transfers[offer.ShortKey] = offer
+}
+
+// ListTransfers - возвращает действующие предложения передачи, отправленные пользователем userID или ему.
+func (s *MapDBMutex) ListTransfers(userID string) ([]schema.TransferOffer, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := []schema.TransferOffer{}
+	for key, offer := range s.transfers {
+		if (offer.FromUserID == userID || offer.ToUserID == userID) && s.keyToUser[key] == offer.FromUserID {
+			result = append(result, offer)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result, nil
+}
+
+// AcceptTransfer - передает ссылку key пользователю toUserID по предложению и удаляет предложение.
+func (s *MapDBMutex) AcceptTransfer(key, toUserID string, quota schema.URLQuota) (schema.URLRecord, error) {
+	s.mutex.Lock()
+	offer, ok := s.transfers[key]
+	if !ok || offer.ToUserID != toUserID || s.keyToUser[key] != offer.FromUserID {
+		s.mutex.Unlock()
+		return schema.URLRecord{}, errorapp.ErrorTransferNotFound
+	}
+	if err := s.transferURL(key, offer.FromUserID, toUserID, quota); err != nil {
+		s.mutex.Unlock()
+		return schema.URLRecord{}, err
+	}
+	delete(s.transfers, key)
+	s.mutex.Unlock()
+	return s.GetRecord(key)
+}
+
+// DeleteTransfer - удаляет предложение передачи ссылки key, отправленное пользователем userID или ему.
+func (s *MapDBMutex) DeleteTransfer(key, userID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	offer, ok := s.transfers[key]
+	if !ok || (offer.FromUserID != userID && offer.ToUserID != userID) {
+		return errorapp.ErrorTransferNotFound
+	}
+	delete(s.transfers, key)
+	return nil
+}
+
+// CreateWorkspace - сохраняет рабочее пространство с владельцем ownerID.
+func (s *MapDBMutex) CreateWorkspace(workspace schema.Workspace, ownerID string) (schema.Workspace, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.workspaces[workspace.ID]; ok {
+		return workspace, fmt.Errorf("рабочее пространство %s уже существует", workspace.ID)
+	}
+	workspace.CreatedAt = time.Now()
+	workspace.Role, workspace.Members = "", nil
+	s.workspaces[workspace.ID] = workspace
+	s.members[workspace.ID] = map[string]schema.WorkspaceMember{
+		ownerID: {WorkspaceID: workspace.ID, UserID: ownerID, Role: schema.RoleOwner, AddedAt: workspace.CreatedAt},
+	}
+	return workspace, nil
+}
+
+// RestoreWorkspace - записывает рабочее пространство в хранилище, заменяя существующее с тем же идентификатором.
+// Используется для восстановления состояния хранилища из журнала.
+func (s *MapDBMutex) RestoreWorkspace(workspace schema.Workspace) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.workspaces[workspace.ID] = workspace
+}
+
+// GetWorkspace - возвращает рабочее пространство по идентификатору.
+func (s *MapDBMutex) GetWorkspace(id string) (schema.Workspace, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	workspace, ok := s.workspaces[id]
+	if !ok {
+		return workspace, errorapp.ErrorWorkspaceNotFound
+	}
+	return workspace, nil
+}
+
+// ListWorkspaces - возвращает рабочие пространства пользователя с его ролью в порядке создания.
+func (s *MapDBMutex) ListWorkspaces(userID string) ([]schema.Workspace, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := make([]schema.Workspace, 0)
+	for id, members := range s.members {
+		member, ok := members[userID]
+		if !ok {
+			continue
+		}
+		workspace := s.workspaces[id]
+		workspace.Role = member.Role
+		result = append(result, workspace)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// SetWorkspaceMember - добавляет участника рабочего пространства или изменяет его роль.
+// Время добавления существующего участника не меняется.
+func (s *MapDBMutex) SetWorkspaceMember(member schema.WorkspaceMember) (schema.WorkspaceMember, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.workspaces[member.WorkspaceID]; !ok {
+		return member, errorapp.ErrorWorkspaceNotFound
+	}
+	if prev, ok := s.members[member.WorkspaceID][member.UserID]; ok {
+		member.AddedAt = prev.AddedAt
+	} else {
+		member.AddedAt = time.Now()
+	}
+	s.restoreMember(member)
+	return member, nil
+}
+
+// RestoreWorkspaceMember - записывает участника рабочего пространства, участник с пустой ролью исключается.
+// Используется для восстановления состояния хранилища из журнала.
+func (s *MapDBMutex) RestoreWorkspaceMember(member schema.WorkspaceMember) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if member.Role == "" {
+		delete(s.members[member.WorkspaceID], member.UserID)
+		return
+	}
+	s.restoreMember(member)
+}
+
+// restoreMember - записывает участника рабочего пространства. Вызывается под блокировкой.
+func (s *MapDBMutex) restoreMember(member schema.WorkspaceMember) {
+	if s.members[member.WorkspaceID] == nil {
+		s.members[member.WorkspaceID] = make(map[string]schema.WorkspaceMember)
+	}
+	member.Email, member.Username = "", ""
+	s.members[member.WorkspaceID][member.UserID] = member
+}
+
+// GetWorkspaceMember - возвращает участника рабочего пространства.
+func (s *MapDBMutex) GetWorkspaceMember(workspaceID, userID string) (schema.WorkspaceMember, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	member, ok := s.members[workspaceID][userID]
+	if !ok {
+		return member, errorapp.ErrorMemberNotFound
+	}
+	return member, nil
+}
+
+// ListWorkspaceMembers - возвращает участников рабочего пространства в порядке добавления.
+func (s *MapDBMutex) ListWorkspaceMembers(workspaceID string) ([]schema.WorkspaceMember, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := make([]schema.WorkspaceMember, 0, len(s.members[workspaceID]))
+	for _, member := range s.members[workspaceID] {
+		account := s.accounts[member.UserID]
+		member.Email, member.Username = account.Email, account.Username
+		result = append(result, member)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].AddedAt.Equal(result[j].AddedAt) {
+			return result[i].AddedAt.Before(result[j].AddedAt)
+		}
+		return result[i].UserID < result[j].UserID
+	})
+	return result, nil
+}
+
+// RemoveWorkspaceMember - исключает участника из рабочего пространства.
+func (s *MapDBMutex) RemoveWorkspaceMember(workspaceID, userID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.members[workspaceID][userID]; !ok {
+		return errorapp.ErrorMemberNotFound
+	}
+	delete(s.members[workspaceID], userID)
+	return nil
+}
+
+// GetLastID - возвращает количество сохраненных URL в хранилище с учетом окончательно удаленных.
 // Второе значение всегда true, чтобы соответствовать типу возврата других методов.
 func (s *MapDBMutex) GetLastID() (int64, bool) {
-	return int64(len(s.keyToURL)), true
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return int64(len(s.keyToURL)) + s.purged, true
 }
 
 // GetStats - возвращает статистику по записям из хранилища
 func (s *MapDBMutex) GetStats() (schema.APIInternalStats, error) {
 	return schema.APIInternalStats{URLs: len(s.keyToURL), Users: len(s.userToKeys)}, nil
 }
+
+// TakeRateToken - забирает токен из корзины key. Заполненные корзины не отличаются от отсутствующих,
+// поэтому они удаляются не чаще раза в rateSweepInterval: обход всех корзин не выполняется на каждый запрос.
+func (s *MapDBMutex) TakeRateToken(key string, limit schema.RateLimit, now time.Time) (bool, time.Duration, error) {
+	s.rateMutex.Lock()
+	defer s.rateMutex.Unlock()
+	if now.Sub(s.rateSweptAt) >= rateSweepInterval {
+		for k, bucket := range s.buckets {
+			if !bucket.fullAt.After(now) {
+				delete(s.buckets, k)
+			}
+		}
+		s.rateSweptAt = now
+	}
+	bucket, ok, retryAfter := limit.Take(s.buckets[key].RateBucket, now)
+	s.buckets[key] = rateBucket{RateBucket: bucket, fullAt: limit.FullAt(bucket)}
+	return ok, retryAfter, nil
+}
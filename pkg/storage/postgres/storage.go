@@ -4,7 +4,12 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math/rand"
+	"sort"
 	"strings"
 	"time"
 
@@ -56,11 +61,12 @@ func New(cfg config.CfgDataBase) (*PDStore, error) {
 //
 //	batch: набор элементов APIShortenBatchInput, содержащих информацию о каждом добавляемом URL.
 //	token: токен пользователя, отправляющего запрос.
+//	quota: квоты пользователя, пакет учитывается в них целиком.
 //
 // Возвращает:
 //
 //	список коротких идентификаторов добавленных URL и ошибку, если она есть.
-func (p *PDStore) SetBatchURLs(batch schema.APIShortenBatchInput, token string) ([]string, error) {
+func (p *PDStore) SetBatchURLs(batch schema.APIShortenBatchInput, token string, quota schema.URLQuota) ([]string, error) {
 	result := make([]string, 0, len(batch))
 	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
 	defer cancel()
@@ -69,7 +75,10 @@ func (p *PDStore) SetBatchURLs(batch schema.APIShortenBatchInput, token string)
 		return nil, err
 	}
 	defer tx.Rollback()
-	stmnt, err := tx.Prepare("INSERT INTO urls (short_id, full_url, user_id) VALUES ($1, $2, $3)")
+	if err = checkQuota(ctx, tx, token, quota, len(batch)); err != nil {
+		return nil, err
+	}
+	stmnt, err := tx.Prepare("INSERT INTO urls (short_id, full_url, user_id, quota_key) VALUES ($1, $2, $3, nullif($4, ''))")
 	if err != nil {
 		return nil, err
 	}
@@ -84,7 +93,7 @@ func (p *PDStore) SetBatchURLs(batch schema.APIShortenBatchInput, token string)
 		if isFinded {
 			continue
 		}
-		_, err := stmnt.Exec(elem.CorrelationID, elem.OriginalURL, token)
+		_, err := stmnt.Exec(elem.CorrelationID, elem.OriginalURL, token, quota.Key)
 		if err != nil {
 			log.Println(err)
 			return nil, err
@@ -108,7 +117,9 @@ func (p *PDStore) DeleteBatch(inputChs []chan []string) error {
 	defer tx.Rollback()
 	qwr := `UPDATE urls 
 	SET full_url = short_id||'_deleted='||full_url,
-	available = FALSE 
+	available = FALSE,
+	deleted_at = now(),
+	updated_at = now()
 	WHERE user_id = $1 and short_id = $2 and available = TRUE
 	`
 	stmt, err := tx.PrepareContext(ctx, qwr)
@@ -135,11 +146,13 @@ func (p *PDStore) DeleteBatch(inputChs []chan []string) error {
 }
 
 // GetURL возвращает полное значение ссылки по ее короткому значению.
-// Если ссылка недоступна, то возвращается ошибка ErrorPageNotAvailable
+// Если ссылка удалена, истекла или отключена, то возвращается ошибка ErrorPageNotAvailable
+// (для отключенной ссылки - *errorapp.URLDisabledError, оборачивающая ее),
+// если время действия ссылки еще не наступило - ошибка *errorapp.URLNotActiveError.
 func (p *PDStore) GetURL(key string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
 	defer cancel()
-	query := "select full_url, available from urls where short_id = $1"
+	query := "select full_url, available, expires_at, active_from, disabled_reason from urls where short_id = $1"
 	row := p.db.QueryRowContext(ctx, query, key)
 	if err := row.Err(); err != nil {
 		log.Println(err)
@@ -147,16 +160,318 @@ func (p *PDStore) GetURL(key string) (string, error) {
 	}
 	fullURL := ""
 	available := false
-	err := row.Scan(&fullURL, &available)
+	disabledReason := ""
+	var expiresAt, activeFrom sql.NullTime
+	err := row.Scan(&fullURL, &available, &expiresAt, &activeFrom, &disabledReason)
 	if err != nil {
 		return "", err
 	}
-	if !available {
+	if !available || (expiresAt.Valid && !expiresAt.Time.After(time.Now())) {
 		return "", errorapp.ErrorPageNotAvailable
 	}
+	if disabledReason != "" {
+		return "", errorapp.NewURLDisabledError(disabledReason)
+	}
+	if activeFrom.Valid && activeFrom.Time.After(time.Now()) {
+		return "", errorapp.NewURLNotActiveError(activeFrom.Time)
+	}
 	return fullURL, nil
 }
 
+// GetRecord возвращает полную запись о ссылке по короткому ключу, в том числе для удаленной ссылки.
+func (p *PDStore) GetRecord(key string) (schema.URLRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := "select " + recordColumns + " from urls where short_id = $1"
+	rec, err := scanRecord(p.db.QueryRowContext(ctx, query, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return rec, errorapp.ErrorURLNotFound
+	}
+	return rec, err
+}
+
+// CountUserURLs возвращает количество ссылок пользователя, созданных начиная с since (в том числе удаленных),
+// и его действующих ссылок (не удаленных и не истекших). Если задан ключ квоты quotaKey,
+// считаются ссылки, созданные с этим ключом.
+func (p *PDStore) CountUserURLs(userID, quotaKey string, since time.Time) (schema.URLCounts, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	return countUserURLs(ctx, p.db, userID, quotaKey, since)
+}
+
+// countUserURLs - считает ссылки пользователя или ключа квоты quotaKey для учета квот через соединение
+// или транзакцию db.
+func countUserURLs(ctx context.Context, db interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}, userID, quotaKey string, since time.Time) (schema.URLCounts, error) {
+	column, owner := "user_id", userID
+	if quotaKey != "" {
+		column, owner = "quota_key", quotaKey
+	}
+	query := `SELECT count(*) FILTER (WHERE created_at >= $2),
+		count(*) FILTER (WHERE available AND (expires_at IS NULL OR expires_at > now()))
+		FROM urls WHERE ` + column + ` = $1`
+	counts := schema.URLCounts{}
+	err := db.QueryRowContext(ctx, query, owner, since).Scan(&counts.Created, &counts.Active)
+	return counts, err
+}
+
+// checkQuota - проверяет, что пользователь userID (или ключ квоты quota.Key) может создать еще count ссылок
+// в пределах квот quota. Рекомендательная блокировка пользователя (ключа) удерживается до конца транзакции,
+// поэтому параллельные транзакции (в том числе других экземпляров сервиса) считают ссылки только после
+// записи предыдущих.
+func checkQuota(ctx context.Context, tx *sql.Tx, userID string, quota schema.URLQuota, count int) error {
+	if !quota.Enabled() {
+		return nil
+	}
+	owner := userID
+	if quota.Key != "" {
+		owner = quota.Key
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('quota:' || $1))", owner); err != nil {
+		return err
+	}
+	counts, err := countUserURLs(ctx, tx, userID, quota.Key, quota.DayStart)
+	if err != nil {
+		return err
+	}
+	return quota.Check(counts, count)
+}
+
+// ListURLs возвращает страницу ссылок пользователя согласно параметрам выборки.
+// Используется пагинация по ключу (keyset): следующая страница начинается строго после записи из курсора,
+// что позволяет использовать индексы (user_id, created_at, short_id) и (user_id, short_id).
+func (p *PDStore) ListURLs(userID string, opts schema.ListURLsOptions) (schema.URLPage, error) {
+	opts.Owner = userID
+	return p.searchURLs(opts, true)
+}
+
+// SearchURLs возвращает страницу ссылок всех пользователей или владельца opts.Owner согласно параметрам выборки.
+func (p *PDStore) SearchURLs(opts schema.ListURLsOptions) (schema.URLPage, error) {
+	return p.searchURLs(opts, opts.Owner != "")
+}
+
+// searchURLs - выбирает ссылки владельца opts.Owner (byOwner) или всех пользователей.
+func (p *PDStore) searchURLs(opts schema.ListURLsOptions, byOwner bool) (schema.URLPage, error) {
+	page := schema.URLPage{}
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+
+	args := []any{}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	where := []string{"true"}
+	if byOwner {
+		where = append(where, "user_id = "+arg(opts.Owner))
+	}
+	switch opts.Status {
+	case schema.URLStatusActive:
+		where = append(where, "available AND disabled_reason = '' AND (expires_at IS NULL OR expires_at > now())",
+			"(active_from IS NULL OR active_from <= now())")
+	case schema.URLStatusDeleted:
+		where = append(where, "NOT available")
+	case schema.URLStatusExpired:
+		where = append(where, "available AND disabled_reason = '' AND expires_at <= now()")
+	case schema.URLStatusScheduled:
+		where = append(where, "available AND disabled_reason = '' AND (expires_at IS NULL OR expires_at > now()) AND active_from > now()")
+	case schema.URLStatusDisabled:
+		where = append(where, "available AND disabled_reason <> ''")
+	}
+	if opts.Query != "" {
+		where = append(where, "strpos(lower(full_url), lower("+arg(opts.Query)+")) > 0")
+	}
+	if opts.Tag != "" {
+		where = append(where, `EXISTS (select 1 from url_tags ut join tags t on t.id = ut.tag_id
+		where ut.short_id = urls.short_id and t.name = `+arg(opts.Tag)+")")
+	}
+	if opts.FolderID != 0 {
+		where = append(where, "folder_id = "+arg(opts.FolderID))
+	}
+	if opts.CampaignID != 0 {
+		where = append(where, "campaign_id = "+arg(opts.CampaignID))
+	}
+	if opts.Key != "" {
+		where = append(where, "strpos(short_id, "+arg(opts.Key)+") > 0")
+	}
+	if opts.Domain != "" {
+		host := `lower(substring(full_url from '://(?:[^@/?#]*@)?([^/:?#]+)'))`
+		d := arg(opts.Domain)
+		where = append(where, fmt.Sprintf("(%s = %s OR right(%s, length(%s) + 1) = '.' || %s)", host, d, host, d, d))
+	}
+	cmp, order := ">", "ASC"
+	if opts.Desc {
+		cmp, order = "<", "DESC"
+	}
+	orderBy := "short_id " + order
+	if opts.SortBy == schema.SortByCreated {
+		orderBy = "created_at " + order + ", short_id " + order
+	}
+	if opts.Cursor != "" {
+		cursor, err := schema.DecodeListCursor(opts.Cursor)
+		if err != nil {
+			return page, fmt.Errorf("%w %v", errorapp.ErrorInvalidListOptions, err)
+		}
+		if opts.SortBy == schema.SortByCreated {
+			where = append(where, fmt.Sprintf("(created_at, short_id) %s (%s, %s)", cmp, arg(cursor.CreatedAt), arg(cursor.ShortKey)))
+		} else {
+			where = append(where, fmt.Sprintf("short_id %s %s", cmp, arg(cursor.ShortKey)))
+		}
+	}
+	// запрашиваем на одну запись больше, чтобы определить наличие следующей страницы
+	query := fmt.Sprintf("select %s from urls where %s order by %s limit %s",
+		recordColumns, strings.Join(where, " AND "), orderBy, arg(opts.Limit+1))
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			return page, err
+		}
+		page.Items = append(page.Items, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	if len(page.Items) > opts.Limit {
+		page.Items = page.Items[:opts.Limit]
+		page.NextCursor = schema.NewListCursor(page.Items[len(page.Items)-1]).Encode()
+	}
+	return page, nil
+}
+
+// recordColumns - список колонок таблицы urls, из которых собирается schema.URLRecord (см. scanRecord).
+const recordColumns = "short_id, full_url, user_id, available, created_at, expires_at, active_from, " +
+	"updated_at, deleted_at, title, note, coalesce(folder_id, 0), force_preview, redirect_type, " +
+	"passthrough, passthrough_conflict, coalesce(campaign_id, 0), clicks, rules, targets, disabled_reason, " +
+	"coalesce((select json_agg(t.name order by t.name) from url_tags ut join tags t on t.id = ut.tag_id " +
+	"where ut.short_id = urls.short_id), '[]')"
+
+// scanRecord - считывает запись schema.URLRecord из строки результата запроса по колонкам recordColumns.
+// Для удаленных ссылок восстанавливает исходный URL.
+func scanRecord(row interface{ Scan(dest ...any) error }) (schema.URLRecord, error) {
+	rec := schema.URLRecord{}
+	var expiresAt, activeFrom, deletedAt sql.NullTime
+	var tags, rules, targets []byte
+	err := row.Scan(&rec.ShortKey, &rec.FullURL, &rec.UserID, &rec.Available, &rec.CreatedAt, &expiresAt, &activeFrom,
+		&rec.UpdatedAt, &deletedAt, &rec.Title, &rec.Note, &rec.FolderID, &rec.ForcePreview, &rec.RedirectType,
+		&rec.Passthrough, &rec.PassthroughConflict, &rec.CampaignID, &rec.Clicks, &rules, &targets,
+		&rec.DisabledReason, &tags)
+	if err != nil {
+		return rec, err
+	}
+	if err := json.Unmarshal(tags, &rec.Tags); err != nil {
+		return rec, err
+	}
+	if err := json.Unmarshal(rules, &rec.Rules); err != nil {
+		return rec, err
+	}
+	if len(rec.Rules) == 0 {
+		rec.Rules = nil
+	}
+	if err := json.Unmarshal(targets, &rec.Targets); err != nil {
+		return rec, err
+	}
+	if len(rec.Targets) == 0 {
+		rec.Targets = nil
+	}
+	if deletedAt.Valid {
+		rec.DeletedAt = &deletedAt.Time
+	}
+	// short_id и user_id имеют тип CHAR и дополняются пробелами
+	rec.ShortKey = strings.TrimSpace(rec.ShortKey)
+	rec.UserID = strings.TrimSpace(rec.UserID)
+	rec.FullURL = helperfunc.RestoreDeletedURL(rec.ShortKey, rec.FullURL)
+	if expiresAt.Valid {
+		rec.ExpiresAt = &expiresAt.Time
+	}
+	if activeFrom.Valid {
+		rec.ActiveFrom = &activeFrom.Time
+	}
+	return rec, nil
+}
+
+// marshalRules - сериализует правила перенаправления ссылки для колонки rules (JSONB).
+func marshalRules(rules []schema.RedirectRule) ([]byte, error) {
+	if rules == nil {
+		rules = []schema.RedirectRule{}
+	}
+	return json.Marshal(rules)
+}
+
+// marshalTargets - сериализует варианты адреса перехода ссылки для колонки targets (JSONB).
+func marshalTargets(targets []schema.SplitTarget) ([]byte, error) {
+	if targets == nil {
+		targets = []schema.SplitTarget{}
+	}
+	return json.Marshal(targets)
+}
+
+// UpdateURL изменяет метаданные ссылки key, принадлежащей пользователю userID, и возвращает обновленную запись.
+// Возвращает errorapp.ErrorURLNotFound если ссылки нет и errorapp.ErrorAccessDenied если ссылка принадлежит другому пользователю.
+func (p *PDStore) UpdateURL(key, userID string, patch schema.URLPatch) (schema.URLRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	defer tx.Rollback()
+	rec, err := lockOwnRecord(ctx, tx, key, userID)
+	if err != nil {
+		return rec, err
+	}
+	if patch.FolderID != nil && *patch.FolderID != 0 {
+		var folderUser string
+		err = tx.QueryRowContext(ctx, "select user_id from folders where id = $1", *patch.FolderID).Scan(&folderUser)
+		if errors.Is(err, sql.ErrNoRows) || strings.TrimSpace(folderUser) != userID {
+			return schema.URLRecord{}, errorapp.ErrorFolderNotFound
+		} else if err != nil {
+			return schema.URLRecord{}, err
+		}
+	}
+	if patch.CampaignID != nil && *patch.CampaignID != 0 {
+		var campaignUser string
+		err = tx.QueryRowContext(ctx, "select user_id from campaigns where id = $1", *patch.CampaignID).Scan(&campaignUser)
+		if errors.Is(err, sql.ErrNoRows) || strings.TrimSpace(campaignUser) != userID {
+			return schema.URLRecord{}, errorapp.ErrorCampaignNotFound
+		} else if err != nil {
+			return schema.URLRecord{}, err
+		}
+	}
+	if patch.Tags != nil {
+		if err = removeTags(ctx, tx, key, rec.Tags); err != nil {
+			return schema.URLRecord{}, err
+		}
+		if err = addTags(ctx, tx, key, userID, *patch.Tags); err != nil {
+			return schema.URLRecord{}, err
+		}
+	}
+	patch.Apply(&rec.URLMeta)
+	rules, err := marshalRules(rec.Rules)
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	targets, err := marshalTargets(rec.Targets)
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	query := `UPDATE urls SET title = $2, note = $3, expires_at = $4, folder_id = nullif($5, 0), redirect_type = $6,
+	passthrough = $7, passthrough_conflict = $8, campaign_id = nullif($9, 0), rules = $10, targets = $11, active_from = $12,
+	disabled_reason = $13, updated_at = now() WHERE short_id = $1 RETURNING ` + recordColumns
+	rec, err = scanRecord(tx.QueryRowContext(ctx, query, key, rec.Title, rec.Note, rec.ExpiresAt, rec.FolderID,
+		rec.RedirectType, rec.Passthrough, rec.PassthroughConflict, rec.CampaignID, rules, targets, rec.ActiveFrom,
+		rec.DisabledReason))
+	if err != nil {
+		return rec, err
+	}
+	return rec, tx.Commit()
+}
+
 // GetAllURLs возвращает все короткие ссылки и их полные значения для заданного пользователя в виде карты (short_id -> full_url).
 // При этом исключаются ссылки, которые помечены как недоступные (available=false)
 func (p *PDStore) GetAllURLs(userID string) map[string]string {
@@ -190,35 +505,878 @@ func (p *PDStore) GetAllURLs(userID string) map[string]string {
 	return result
 }
 
-// SetNewURL добавляет новый URL в базу данных. Если ключ уже существует, то возвращает ошибку дубликата URL
-// key - сокращенный ключ, по которому можно получить URL
-// URL - полный URL-адрес, который будет сокращен
-// tokenID - идентификатор пользователя, который создал короткую ссылку
-// available - флаг доступности короткой ссылки
+// SetNewURL добавляет новую запись о ссылке в базу данных. Если URL уже существует, то возвращает ошибку дубликата URL
+// rec.ShortKey - сокращенный ключ, по которому можно получить URL
+// rec.FullURL - полный URL-адрес, который будет сокращен
+// rec.UserID - идентификатор пользователя, который создал короткую ссылку
+// rec.Available - флаг доступности короткой ссылки
+// Если время создания не указано, используется время сервера БД.
+// quota - квоты пользователя, проверяются в той же транзакции (см. checkQuota).
 // Возвращает ошибку, если произошла ошибка вставки в базу данных или если ключ уже существует.
-func (p *PDStore) SetNewURL(key, URL, tokenID string, available bool) error {
+func (p *PDStore) SetNewURL(rec schema.URLRecord, quota schema.URLQuota) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
 	defer cancel()
-	query := "INSERT INTO urls (short_id, full_url, user_id, available) VALUES ($1, $2, $3, $4)"
-	_, err := p.db.ExecContext(ctx, query, key, URL, tokenID, available)
+	var createdAt sql.NullTime
+	if !rec.CreatedAt.IsZero() {
+		createdAt = sql.NullTime{Time: rec.CreatedAt, Valid: true}
+	}
+	rules, err := marshalRules(rec.Rules)
+	if err != nil {
+		return err
+	}
+	targets, err := marshalTargets(rec.Targets)
+	if err != nil {
+		return err
+	}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = checkQuota(ctx, tx, rec.UserID, quota, 1); err != nil {
+		return err
+	}
+	query := `INSERT INTO urls (short_id, full_url, user_id, available, created_at, expires_at, updated_at, title, note, folder_id,
+	force_preview, redirect_type, passthrough, passthrough_conflict, campaign_id, rules, targets, active_from, disabled_reason,
+	quota_key)
+	VALUES ($1, $2, $3, $4, coalesce($5, now()), $6, coalesce($5, now()), $7, $8, nullif($9, 0), $10, $11, $12, $13,
+	nullif($14, 0), $15, $16, $17, $18, nullif($19, ''))`
+	_, err = tx.ExecContext(ctx, query, rec.ShortKey, rec.FullURL, rec.UserID, rec.Available, createdAt, rec.ExpiresAt,
+		rec.Title, rec.Note, rec.FolderID, rec.ForcePreview, rec.RedirectType, rec.Passthrough, rec.PassthroughConflict,
+		rec.CampaignID, rules, targets, rec.ActiveFrom, rec.DisabledReason, rec.QuotaKey)
 	if err != nil && strings.Contains(err.Error(), pgerrcode.UniqueViolation) {
 		query := "select short_id from urls where full_url = $1 "
 		var key string
-		err = p.db.QueryRowContext(ctx, query, URL).Scan(&key)
+		err = p.db.QueryRowContext(ctx, query, rec.FullURL).Scan(&key)
 		if err != nil {
 			return err
 		}
-		return errorapp.NewURLDuplicateError(err, strings.TrimSpace(key), URL)
+		return errorapp.NewURLDuplicateError(err, strings.TrimSpace(key), rec.FullURL)
+	}
+	if err != nil {
+		return err
+	}
+	if err = addTags(ctx, tx, rec.ShortKey, rec.UserID, rec.Tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addTags - добавляет метки tags пользователя userID к ссылке key. Отсутствующие метки создаются.
+func addTags(ctx context.Context, tx *sql.Tx, key, userID string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO tags (user_id, name) SELECT $1, unnest($2::text[])
+	ON CONFLICT (user_id, name) DO NOTHING`, userID, tags)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO url_tags (short_id, tag_id)
+	SELECT $1, id FROM tags WHERE user_id = $2 AND name = ANY($3::text[])
+	ON CONFLICT DO NOTHING`, key, userID, tags)
+	return err
+}
+
+// removeTags - убирает метки tags у ссылки key.
+func removeTags(ctx context.Context, tx *sql.Tx, key string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM url_tags ut USING tags t
+	WHERE ut.tag_id = t.id AND ut.short_id = $1 AND t.name = ANY($2::text[])`, key, tags)
+	return err
+}
+
+// lockOwnRecord - блокирует запись о ссылке key в транзакции и проверяет, что она принадлежит пользователю userID.
+func lockOwnRecord(ctx context.Context, tx *sql.Tx, key, userID string) (schema.URLRecord, error) {
+	rec, err := scanRecord(tx.QueryRowContext(ctx, "select "+recordColumns+" from urls where short_id = $1 for update", key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return rec, errorapp.ErrorURLNotFound
+	} else if err != nil {
+		return rec, err
+	}
+	if rec.UserID != userID {
+		return schema.URLRecord{}, errorapp.ErrorAccessDenied
+	}
+	return rec, nil
+}
+
+// ChangeTags добавляет метки add и удаляет метки remove у ссылки key, принадлежащей пользователю userID.
+// Возвращает обновленную запись.
+func (p *PDStore) ChangeTags(key, userID string, add, remove []string) (schema.URLRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	defer tx.Rollback()
+	if _, err = lockOwnRecord(ctx, tx, key, userID); err != nil {
+		return schema.URLRecord{}, err
+	}
+	if err = removeTags(ctx, tx, key, remove); err != nil {
+		return schema.URLRecord{}, err
+	}
+	if err = addTags(ctx, tx, key, userID, add); err != nil {
+		return schema.URLRecord{}, err
+	}
+	rec, err := scanRecord(tx.QueryRowContext(ctx, "UPDATE urls SET updated_at = now() WHERE short_id = $1 RETURNING "+recordColumns, key))
+	if err != nil {
+		return rec, err
+	}
+	return rec, tx.Commit()
+}
+
+// ListTags возвращает метки активных ссылок пользователя и количество ссылок с каждой меткой.
+func (p *PDStore) ListTags(userID string) ([]schema.APITagInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := `select t.name, count(*) from tags t
+	join url_tags ut on ut.tag_id = t.id
+	join urls u on u.short_id = ut.short_id
+	where t.user_id = $1 and u.available
+	group by t.name order by t.name`
+	rows, err := p.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]schema.APITagInfo, 0)
+	for rows.Next() {
+		tag := schema.APITagInfo{}
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		result = append(result, tag)
+	}
+	return result, rows.Err()
+}
+
+// CreateFolder создает папку пользователя userID с названием name.
+func (p *PDStore) CreateFolder(userID, name string) (schema.Folder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	folder := schema.Folder{UserID: userID, Name: name}
+	query := "INSERT INTO folders (user_id, name) VALUES ($1, $2) RETURNING id, created_at"
+	err := p.db.QueryRowContext(ctx, query, userID, name).Scan(&folder.ID, &folder.CreatedAt)
+	return folder, err
+}
+
+// GetFolder возвращает папку по идентификатору или errorapp.ErrorFolderNotFound.
+func (p *PDStore) GetFolder(id int64) (schema.Folder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	folder := schema.Folder{}
+	query := "select id, user_id, name, created_at from folders where id = $1"
+	err := p.db.QueryRowContext(ctx, query, id).Scan(&folder.ID, &folder.UserID, &folder.Name, &folder.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return folder, errorapp.ErrorFolderNotFound
+	}
+	folder.UserID = strings.TrimSpace(folder.UserID)
+	return folder, err
+}
+
+// ListFolders возвращает папки пользователя с количеством активных ссылок в каждой.
+func (p *PDStore) ListFolders(userID string) ([]schema.Folder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := `select f.id, f.name, f.created_at, count(u.short_id) from folders f
+	left join urls u on u.folder_id = f.id and u.available
+	where f.user_id = $1
+	group by f.id order by f.id`
+	rows, err := p.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]schema.Folder, 0)
+	for rows.Next() {
+		folder := schema.Folder{UserID: userID}
+		if err := rows.Scan(&folder.ID, &folder.Name, &folder.CreatedAt, &folder.LinkCount); err != nil {
+			return nil, err
+		}
+		result = append(result, folder)
+	}
+	return result, rows.Err()
+}
+
+// DeleteFolder удаляет папку пользователя. Ссылки из папки остаются у пользователя без папки.
+func (p *PDStore) DeleteFolder(id int64, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	res, err := p.db.ExecContext(ctx, "DELETE FROM folders WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errorapp.ErrorFolderNotFound
+	}
+	return nil
+}
+
+// CreateCampaign создает кампанию campaign.UserID с названием и UTM-шаблоном из campaign.
+func (p *PDStore) CreateCampaign(campaign schema.Campaign) (schema.Campaign, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	utm, err := json.Marshal(campaign.UTM)
+	if err != nil {
+		return campaign, err
+	}
+	campaign.LinkCount, campaign.Clicks = 0, 0
+	query := "INSERT INTO campaigns (user_id, name, utm) VALUES ($1, $2, $3) RETURNING id, created_at"
+	err = p.db.QueryRowContext(ctx, query, campaign.UserID, campaign.Name, utm).Scan(&campaign.ID, &campaign.CreatedAt)
+	return campaign, err
+}
+
+// GetCampaign возвращает кампанию по идентификатору или errorapp.ErrorCampaignNotFound.
+func (p *PDStore) GetCampaign(id int64) (schema.Campaign, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := "select " + campaignColumns + " from campaigns c where c.id = $1"
+	campaign, err := scanCampaign(p.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return campaign, errorapp.ErrorCampaignNotFound
+	}
+	return campaign, err
+}
+
+// ListCampaigns возвращает кампании пользователя с количеством активных ссылок в каждой.
+func (p *PDStore) ListCampaigns(userID string) ([]schema.Campaign, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := "select " + campaignColumns + " from campaigns c where c.user_id = $1 order by c.id"
+	rows, err := p.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]schema.Campaign, 0)
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, campaign)
+	}
+	return result, rows.Err()
+}
+
+// campaignColumns - колонки кампании (таблица campaigns с псевдонимом c) в порядке, ожидаемом scanCampaign.
+const campaignColumns = "c.id, c.user_id, c.name, c.utm, c.created_at, c.clicks, " +
+	"(select count(*) from urls u where u.campaign_id = c.id and u.available)"
+
+// scanCampaign - считывает кампанию из строки результата запроса по колонкам campaignColumns.
+func scanCampaign(row interface{ Scan(dest ...any) error }) (schema.Campaign, error) {
+	campaign := schema.Campaign{}
+	var utm []byte
+	err := row.Scan(&campaign.ID, &campaign.UserID, &campaign.Name, &utm, &campaign.CreatedAt, &campaign.Clicks,
+		&campaign.LinkCount)
+	if err != nil {
+		return campaign, err
+	}
+	campaign.UserID = strings.TrimSpace(campaign.UserID)
+	return campaign, json.Unmarshal(utm, &campaign.UTM)
+}
+
+// DeleteCampaign удаляет кампанию пользователя. Ссылки кампании остаются у пользователя без кампании.
+func (p *PDStore) DeleteCampaign(id int64, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	res, err := p.db.ExecContext(ctx, "DELETE FROM campaigns WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
 	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errorapp.ErrorCampaignNotFound
+	}
+	return nil
+}
+
+// RecordClick увеличивает счетчик переходов ссылки key, кампании campaignID (если она задана)
+// и варианта адреса перехода variantID в колонке targets (если он задан).
+func (p *PDStore) RecordClick(key string, campaignID, variantID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := `WITH link AS (UPDATE urls SET clicks = clicks + 1,
+		targets = CASE WHEN $3 = 0 THEN targets ELSE (
+			SELECT coalesce(jsonb_agg(CASE WHEN (t->>'id')::bigint = $3
+				THEN jsonb_set(t, '{clicks}', to_jsonb(coalesce((t->>'clicks')::bigint, 0) + 1)) ELSE t END ORDER BY n), '[]')
+			FROM jsonb_array_elements(targets) WITH ORDINALITY AS v(t, n)) END
+		WHERE short_id = $1)
+	UPDATE campaigns SET clicks = clicks + 1 WHERE id = $2`
+	_, err := p.db.ExecContext(ctx, query, key, campaignID, variantID)
 	return err
 }
 
+// AddReport сохраняет жалобу на ссылку со статусом schema.ReportStatusOpen.
+func (p *PDStore) AddReport(report schema.AbuseReport) (schema.AbuseReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	report.Status, report.ClosedAt = schema.ReportStatusOpen, nil
+	query := `INSERT INTO reports (short_id, category, comment, reporter_ip, status) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+	err := p.db.QueryRowContext(ctx, query, report.ShortKey, report.Category, report.Comment, report.ReporterIP,
+		report.Status).Scan(&report.ID, &report.CreatedAt)
+	return report, err
+}
+
+// ListReports возвращает жалобы, соответствующие фильтру, от новых к старым.
+func (p *PDStore) ListReports(filter schema.ReportFilter) ([]schema.AbuseReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := "select " + reportColumns + ` from reports where ($1 = '' or short_id = $1) and ($2 = '' or status = $2)
+		order by id desc`
+	rows, err := p.db.QueryContext(ctx, query, filter.ShortKey, filter.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]schema.AbuseReport, 0)
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, report)
+	}
+	return result, rows.Err()
+}
+
+// CloseReports переводит открытые жалобы на ссылку key в статус status и возвращает их.
+func (p *PDStore) CloseReports(key, status string) ([]schema.AbuseReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := `UPDATE reports SET status = $2, closed_at = now() WHERE short_id = $1 AND status = $3
+		RETURNING ` + reportColumns
+	rows, err := p.db.QueryContext(ctx, query, key, status, schema.ReportStatusOpen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]schema.AbuseReport, 0)
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, report)
+	}
+	return result, rows.Err()
+}
+
+// reportColumns - колонки жалобы в порядке, ожидаемом scanReport.
+const reportColumns = "id, short_id, category, comment, reporter_ip, status, created_at, closed_at"
+
+// scanReport - считывает жалобу из строки результата запроса по колонкам reportColumns.
+func scanReport(row interface{ Scan(dest ...any) error }) (schema.AbuseReport, error) {
+	report := schema.AbuseReport{}
+	var closedAt sql.NullTime
+	err := row.Scan(&report.ID, &report.ShortKey, &report.Category, &report.Comment, &report.ReporterIP,
+		&report.Status, &report.CreatedAt, &closedAt)
+	if err != nil {
+		return report, err
+	}
+	report.ShortKey = strings.TrimSpace(report.ShortKey)
+	if closedAt.Valid {
+		report.ClosedAt = &closedAt.Time
+	}
+	return report, nil
+}
+
+// ReassignUser передает все ссылки, папки и кампании пользователя fromUserID пользователю toUserID в одной транзакции.
+// Метки переносятся по названию: одноименные метки объединяются с метками нового владельца.
+// Действующие ссылки учитываются в квотах quota нового владельца (см. checkQuota), ключ квоты ссылок сбрасывается.
+func (p *PDStore) ReassignUser(fromUserID, toUserID string, quota schema.URLQuota) (schema.ClaimResult, error) {
+	result := schema.ClaimResult{URLs: make([]string, 0), Folders: make([]int64, 0), Campaigns: make([]int64, 0)}
+	if fromUserID == toUserID {
+		return result, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5000*time.Millisecond)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+	if quota.Enabled() {
+		counts, err := countUserURLs(ctx, tx, fromUserID, "", time.Time{})
+		if err != nil {
+			return result, err
+		}
+		if err = checkQuota(ctx, tx, toUserID, quota, counts.Active); err != nil {
+			return result, err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO tags (user_id, name) SELECT $2, name FROM tags WHERE user_id = $1
+	ON CONFLICT (user_id, name) DO NOTHING`, fromUserID, toUserID)
+	if err != nil {
+		return result, err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO url_tags (short_id, tag_id)
+	SELECT ut.short_id, nt.id FROM url_tags ut
+	JOIN tags t ON t.id = ut.tag_id AND t.user_id = $1
+	JOIN tags nt ON nt.user_id = $2 AND nt.name = t.name
+	ON CONFLICT DO NOTHING`, fromUserID, toUserID)
+	if err != nil {
+		return result, err
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM tags WHERE user_id = $1", fromUserID); err != nil {
+		return result, err
+	}
+	if result.Folders, err = reassignIDs(ctx, tx, "UPDATE folders SET user_id = $2 WHERE user_id = $1 RETURNING id",
+		fromUserID, toUserID); err != nil {
+		return result, err
+	}
+	if result.Campaigns, err = reassignIDs(ctx, tx, "UPDATE campaigns SET user_id = $2 WHERE user_id = $1 RETURNING id",
+		fromUserID, toUserID); err != nil {
+		return result, err
+	}
+	rows, err := tx.QueryContext(ctx, "UPDATE urls SET user_id = $2, quota_key = NULL, updated_at = now() WHERE user_id = $1 RETURNING short_id",
+		fromUserID, toUserID)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return result, err
+		}
+		result.URLs = append(result.URLs, strings.TrimSpace(key))
+	}
+	if err = rows.Err(); err != nil {
+		return result, err
+	}
+	return result, tx.Commit()
+}
+
+// reassignIDs - выполняет запрос передачи объектов другому пользователю и возвращает их идентификаторы по возрастанию.
+func reassignIDs(ctx context.Context, tx *sql.Tx, query, fromUserID, toUserID string) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, query, fromUserID, toUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, rows.Err()
+}
+
+// TransferURL передает ссылку key от владельца fromUserID владельцу toUserID в одной транзакции.
+// Метки ссылки переносятся по названию в метки нового владельца, папка и кампания прежнего владельца сбрасываются.
+// Квоты quota нового владельца проверяются под его рекомендательной блокировкой (см. checkQuota).
+func (p *PDStore) TransferURL(key, fromUserID, toUserID string, quota schema.URLQuota) (schema.URLRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	defer tx.Rollback()
+	rec, err := lockOwnRecord(ctx, tx, key, fromUserID)
+	if err != nil || fromUserID == toUserID {
+		return rec, err
+	}
+	if rec, err = transferURL(ctx, tx, key, fromUserID, toUserID, quota); err != nil {
+		return rec, err
+	}
+	return rec, tx.Commit()
+}
+
+// transferURL передает ссылку key, заблокированную в транзакции tx (см. lockOwnRecord), от владельца fromUserID
+// владельцу toUserID с проверкой его квот quota.
+func transferURL(ctx context.Context, tx *sql.Tx, key, fromUserID, toUserID string, quota schema.URLQuota) (schema.URLRecord, error) {
+	if err := checkQuota(ctx, tx, toUserID, quota, 1); err != nil {
+		return schema.URLRecord{}, err
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO tags (user_id, name)
+	SELECT $2, t.name FROM url_tags ut JOIN tags t ON t.id = ut.tag_id WHERE ut.short_id = $1
+	ON CONFLICT (user_id, name) DO NOTHING`, key, toUserID)
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO url_tags (short_id, tag_id)
+	SELECT $1, nt.id FROM url_tags ut
+	JOIN tags t ON t.id = ut.tag_id AND t.user_id = $3
+	JOIN tags nt ON nt.user_id = $2 AND nt.name = t.name
+	WHERE ut.short_id = $1
+	ON CONFLICT DO NOTHING`, key, toUserID, fromUserID)
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM url_tags ut USING tags t
+	WHERE ut.tag_id = t.id AND ut.short_id = $1 AND t.user_id = $2`, key, fromUserID)
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	query := `UPDATE urls SET user_id = $2, folder_id = NULL, campaign_id = NULL, quota_key = NULL, updated_at = now()
+	WHERE short_id = $1 RETURNING ` + recordColumns
+	return scanRecord(tx.QueryRowContext(ctx, query, key, toUserID))
+}
+
+// OfferTransfer сохраняет предложение передачи ссылки вместо прежнего предложения для нее.
+// Принадлежность ссылки отправителю проверяется под блокировкой записи ссылки.
+func (p *PDStore) OfferTransfer(offer schema.TransferOffer) (schema.TransferOffer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return offer, err
+	}
+	defer tx.Rollback()
+	if _, err = lockOwnRecord(ctx, tx, offer.ShortKey, offer.FromUserID); err != nil {
+		return offer, err
+	}
+	err = tx.QueryRowContext(ctx, `INSERT INTO transfers (short_id, from_user, to_user) VALUES ($1, $2, $3)
+	ON CONFLICT (short_id) DO UPDATE SET from_user = EXCLUDED.from_user, to_user = EXCLUDED.to_user, created_at = now()
+	RETURNING created_at`, offer.ShortKey, offer.FromUserID, offer.ToUserID).Scan(&offer.CreatedAt)
+	if err != nil {
+		return offer, err
+	}
+	return offer, tx.Commit()
+}
+
+// ListTransfers возвращает действующие предложения передачи, отправленные пользователем userID или ему.
+func (p *PDStore) ListTransfers(userID string) ([]schema.TransferOffer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	rows, err := p.db.QueryContext(ctx, `SELECT t.short_id, t.from_user, t.to_user, t.created_at FROM transfers t
+	JOIN urls u ON u.short_id = t.short_id AND u.user_id = t.from_user
+	WHERE t.from_user = $1 OR t.to_user = $1 ORDER BY t.created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := []schema.TransferOffer{}
+	for rows.Next() {
+		offer := schema.TransferOffer{}
+		if err := rows.Scan(&offer.ShortKey, &offer.FromUserID, &offer.ToUserID, &offer.CreatedAt); err != nil {
+			return nil, err
+		}
+		offer.ShortKey = strings.TrimSpace(offer.ShortKey)
+		offer.FromUserID = strings.TrimSpace(offer.FromUserID)
+		offer.ToUserID = strings.TrimSpace(offer.ToUserID)
+		result = append(result, offer)
+	}
+	return result, rows.Err()
+}
+
+// AcceptTransfer передает ссылку key пользователю toUserID по предложению и удаляет предложение в одной транзакции.
+func (p *PDStore) AcceptTransfer(key, toUserID string, quota schema.URLQuota) (schema.URLRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return schema.URLRecord{}, err
+	}
+	defer tx.Rollback()
+	var fromUserID string
+	err = tx.QueryRowContext(ctx, "DELETE FROM transfers WHERE short_id = $1 AND to_user = $2 RETURNING from_user",
+		key, toUserID).Scan(&fromUserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return schema.URLRecord{}, errorapp.ErrorTransferNotFound
+	} else if err != nil {
+		return schema.URLRecord{}, err
+	}
+	fromUserID = strings.TrimSpace(fromUserID)
+	_, err = lockOwnRecord(ctx, tx, key, fromUserID)
+	if errors.Is(err, errorapp.ErrorURLNotFound) || errors.Is(err, errorapp.ErrorAccessDenied) {
+		return schema.URLRecord{}, errorapp.ErrorTransferNotFound
+	} else if err != nil {
+		return schema.URLRecord{}, err
+	}
+	rec, err := transferURL(ctx, tx, key, fromUserID, toUserID, quota)
+	if err != nil {
+		return rec, err
+	}
+	return rec, tx.Commit()
+}
+
+// DeleteTransfer удаляет предложение передачи ссылки key, отправленное пользователем userID или ему.
+func (p *PDStore) DeleteTransfer(key, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	result, err := p.db.ExecContext(ctx, "DELETE FROM transfers WHERE short_id = $1 AND (from_user = $2 OR to_user = $2)",
+		key, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errorapp.ErrorTransferNotFound
+	}
+	return nil
+}
+
+// CreateWorkspace сохраняет рабочее пространство и его владельца ownerID в одной транзакции.
+func (p *PDStore) CreateWorkspace(workspace schema.Workspace, ownerID string) (schema.Workspace, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return workspace, err
+	}
+	defer tx.Rollback()
+	workspace.Role, workspace.Members = "", nil
+	err = tx.QueryRowContext(ctx, "INSERT INTO workspaces (id, name) VALUES ($1, $2) RETURNING created_at",
+		workspace.ID, workspace.Name).Scan(&workspace.CreatedAt)
+	if err != nil {
+		return workspace, err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO workspace_members (workspace_id, user_id, role, added_at) VALUES ($1, $2, $3, $4)",
+		workspace.ID, ownerID, schema.RoleOwner, workspace.CreatedAt)
+	if err != nil {
+		return workspace, err
+	}
+	return workspace, tx.Commit()
+}
+
+// GetWorkspace возвращает рабочее пространство по идентификатору или errorapp.ErrorWorkspaceNotFound.
+func (p *PDStore) GetWorkspace(id string) (schema.Workspace, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	workspace := schema.Workspace{}
+	err := p.db.QueryRowContext(ctx, "select id, name, created_at from workspaces where id = $1", id).
+		Scan(&workspace.ID, &workspace.Name, &workspace.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return workspace, errorapp.ErrorWorkspaceNotFound
+	}
+	workspace.ID = strings.TrimSpace(workspace.ID)
+	return workspace, err
+}
+
+// ListWorkspaces возвращает рабочие пространства пользователя с его ролью в порядке создания.
+func (p *PDStore) ListWorkspaces(userID string) ([]schema.Workspace, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := `select w.id, w.name, w.created_at, m.role from workspaces w
+	join workspace_members m on m.workspace_id = w.id
+	where m.user_id = $1 order by w.created_at, w.id`
+	rows, err := p.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]schema.Workspace, 0)
+	for rows.Next() {
+		workspace := schema.Workspace{}
+		if err := rows.Scan(&workspace.ID, &workspace.Name, &workspace.CreatedAt, &workspace.Role); err != nil {
+			return nil, err
+		}
+		workspace.ID = strings.TrimSpace(workspace.ID)
+		result = append(result, workspace)
+	}
+	return result, rows.Err()
+}
+
+// SetWorkspaceMember добавляет участника рабочего пространства или изменяет его роль.
+// Время добавления существующего участника не меняется.
+func (p *PDStore) SetWorkspaceMember(member schema.WorkspaceMember) (schema.WorkspaceMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := `INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, $3)
+	ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = excluded.role
+	RETURNING added_at`
+	err := p.db.QueryRowContext(ctx, query, member.WorkspaceID, member.UserID, member.Role).Scan(&member.AddedAt)
+	if err != nil && strings.Contains(err.Error(), pgerrcode.ForeignKeyViolation) {
+		return member, errorapp.ErrorWorkspaceNotFound
+	}
+	return member, err
+}
+
+// GetWorkspaceMember возвращает участника рабочего пространства или errorapp.ErrorMemberNotFound.
+func (p *PDStore) GetWorkspaceMember(workspaceID, userID string) (schema.WorkspaceMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	member := schema.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID}
+	query := "select role, added_at from workspace_members where workspace_id = $1 and user_id = $2"
+	err := p.db.QueryRowContext(ctx, query, workspaceID, userID).Scan(&member.Role, &member.AddedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return member, errorapp.ErrorMemberNotFound
+	}
+	return member, err
+}
+
+// ListWorkspaceMembers возвращает участников рабочего пространства с данными учетных записей в порядке добавления.
+func (p *PDStore) ListWorkspaceMembers(workspaceID string) ([]schema.WorkspaceMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := `select m.user_id, m.role, m.added_at, coalesce(a.email, ''), coalesce(a.username, '')
+	from workspace_members m join accounts a on a.id = m.user_id
+	where m.workspace_id = $1 order by m.added_at, m.user_id`
+	rows, err := p.db.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]schema.WorkspaceMember, 0)
+	for rows.Next() {
+		member := schema.WorkspaceMember{WorkspaceID: workspaceID}
+		if err := rows.Scan(&member.UserID, &member.Role, &member.AddedAt, &member.Email, &member.Username); err != nil {
+			return nil, err
+		}
+		member.UserID = strings.TrimSpace(member.UserID)
+		result = append(result, member)
+	}
+	return result, rows.Err()
+}
+
+// RemoveWorkspaceMember исключает участника из рабочего пространства или возвращает errorapp.ErrorMemberNotFound.
+func (p *PDStore) RemoveWorkspaceMember(workspaceID, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	res, err := p.db.ExecContext(ctx, "DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2", workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errorapp.ErrorMemberNotFound
+	}
+	return nil
+}
+
+// CreateAccount сохраняет учетную запись. Если email или имя пользователя заняты, возвращает errorapp.ErrorAccountExists.
+func (p *PDStore) CreateAccount(account schema.Account) (schema.Account, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := `INSERT INTO accounts (id, email, username, password_hash) VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4)
+		RETURNING created_at`
+	err := p.db.QueryRowContext(ctx, query, account.ID, account.Email, account.Username, account.PasswordHash).
+		Scan(&account.CreatedAt)
+	if err != nil && strings.Contains(err.Error(), pgerrcode.UniqueViolation) {
+		return account, errorapp.ErrorAccountExists
+	}
+	return account, err
+}
+
+// GetAccount возвращает учетную запись по идентификатору пользователя или errorapp.ErrorAccountNotFound.
+func (p *PDStore) GetAccount(userID string) (schema.Account, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := "select " + accountColumns + " from accounts where id = $1"
+	return scanAccount(p.db.QueryRowContext(ctx, query, userID))
+}
+
+// FindAccount возвращает учетную запись по email или имени пользователя или errorapp.ErrorAccountNotFound.
+func (p *PDStore) FindAccount(login string) (schema.Account, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := "select " + accountColumns + " from accounts where email = $1 or username = $1"
+	return scanAccount(p.db.QueryRowContext(ctx, query, login))
+}
+
+// accountColumns - колонки учетной записи в порядке, ожидаемом scanAccount.
+const accountColumns = "id, coalesce(email, ''), coalesce(username, ''), password_hash, created_at"
+
+// scanAccount - считывает учетную запись из строки результата запроса по колонкам accountColumns.
+func scanAccount(row *sql.Row) (schema.Account, error) {
+	account := schema.Account{}
+	err := row.Scan(&account.ID, &account.Email, &account.Username, &account.PasswordHash, &account.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return account, errorapp.ErrorAccountNotFound
+	}
+	account.ID = strings.TrimSpace(account.ID)
+	return account, err
+}
+
+// CreateAPIKey сохраняет ключ API пользователя key.UserID.
+func (p *PDStore) CreateAPIKey(key schema.APIKey) (schema.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	key.RevokedAt = nil
+	query := `INSERT INTO api_keys (id, user_id, name, scopes, secret_hash) VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at`
+	err := p.db.QueryRowContext(ctx, query, key.ID, key.UserID, key.Name, strings.Join(key.Scopes, ","), key.SecretHash).
+		Scan(&key.CreatedAt)
+	return key, err
+}
+
+// GetAPIKey возвращает ключ API по идентификатору или errorapp.ErrorAPIKeyNotFound.
+func (p *PDStore) GetAPIKey(id string) (schema.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := "select " + apiKeyColumns + " from api_keys where id = $1"
+	key, err := scanAPIKey(p.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, errorapp.ErrorAPIKeyNotFound
+	}
+	return key, err
+}
+
+// ListAPIKeys возвращает ключи API пользователя в порядке создания, в том числе отозванные.
+func (p *PDStore) ListAPIKeys(userID string) ([]schema.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := "select " + apiKeyColumns + " from api_keys where user_id = $1 order by created_at, id"
+	rows, err := p.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]schema.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, key)
+	}
+	return result, rows.Err()
+}
+
+// RevokeAPIKey отзывает ключ API пользователя. Повторный отзыв не меняет время отзыва.
+// Для чужого или несуществующего ключа возвращает errorapp.ErrorAPIKeyNotFound.
+func (p *PDStore) RevokeAPIKey(id, userID string) (schema.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	query := `UPDATE api_keys SET revoked_at = coalesce(revoked_at, now()) WHERE id = $1 AND user_id = $2
+		RETURNING ` + apiKeyColumns
+	key, err := scanAPIKey(p.db.QueryRowContext(ctx, query, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, errorapp.ErrorAPIKeyNotFound
+	}
+	return key, err
+}
+
+// apiKeyColumns - колонки ключа API в порядке, ожидаемом scanAPIKey.
+const apiKeyColumns = "id, user_id, name, scopes, secret_hash, created_at, revoked_at"
+
+// scanAPIKey - считывает ключ API из строки результата запроса по колонкам apiKeyColumns.
+// Области действия хранятся в одной строке через запятую.
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (schema.APIKey, error) {
+	key := schema.APIKey{}
+	var scopes string
+	var revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &scopes, &key.SecretHash, &key.CreatedAt, &revokedAt)
+	if err != nil {
+		return key, err
+	}
+	key.UserID = strings.TrimSpace(key.UserID)
+	key.Scopes = make([]string, 0)
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
+
 // GetLastID получает последний ID из базы данных
 // Возвращает последний ID и флаг, указывающий, успешно ли был получен последний ID
 func (p *PDStore) GetLastID() (int64, bool) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
 	defer cancel()
-	query := "select count(*) from urls"
+	query := "select (select count(*) from urls) + (select count(*) from purged_urls)"
 	row := p.db.QueryRowContext(ctx, query)
 	lastID := 0
 	if err := row.Scan(&lastID); err != nil {
@@ -239,6 +1397,47 @@ func (p *PDStore) Ping() error {
 	return db.PingContext(ctx)
 }
 
+// PurgeURLs окончательно удаляет ссылки по списку коротких ключей; метки ссылок и жалобы удаляются каскадно.
+// Ключи удаленных ссылок сохраняются в таблице purged_urls, чтобы GetLastID не уменьшался.
+func (p *PDStore) PurgeURLs(keys []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5000*time.Millisecond)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, "DELETE FROM urls WHERE short_id = ANY($1::text[]) RETURNING short_id, user_id", keys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	purged := make([]string, 0, len(keys))
+	owners := make([]string, 0, len(keys))
+	for rows.Next() {
+		var key, owner string
+		if err := rows.Scan(&key, &owner); err != nil {
+			return nil, err
+		}
+		purged = append(purged, strings.TrimSpace(key))
+		owners = append(owners, strings.TrimSpace(owner))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, key := range purged {
+		_, err := tx.ExecContext(ctx, "INSERT INTO purged_urls (short_id, user_id) VALUES ($1, $2)", key, owners[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	sort.Strings(purged)
+	return purged, nil
+}
+
 // GetStats - возвращает статистику по записям из базы данных
 func (p *PDStore) GetStats() (schema.APIInternalStats, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*1000)
@@ -251,3 +1450,45 @@ func (p *PDStore) GetStats() (schema.APIInternalStats, error) {
 	}
 	return schema.APIInternalStats{URLs: countURLs, Users: countUsers}, nil
 }
+
+// rateCleanupChance - доля запросов TakeRateToken, после которых из таблицы удаляются заполненные корзины.
+const rateCleanupChance = 0.01
+
+// TakeRateToken - забирает токен из корзины key в таблице rate_buckets.
+// Строка корзины блокируется до конца транзакции, поэтому экземпляры сервиса с общей базой данных
+// соблюдают общий лимит. Заполненные корзины не отличаются от отсутствующих и время от времени удаляются.
+func (p *PDStore) TakeRateToken(key string, limit schema.RateLimit, now time.Time) (bool, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `INSERT INTO rate_buckets (key, tokens, updated_at, full_at) VALUES ($1, $2, $3, $3)
+		ON CONFLICT (key) DO NOTHING`, key, float64(limit.Burst), now)
+	if err != nil {
+		return false, 0, err
+	}
+	bucket := schema.RateBucket{}
+	err = tx.QueryRowContext(ctx, "SELECT tokens, updated_at FROM rate_buckets WHERE key = $1 FOR UPDATE", key).
+		Scan(&bucket.Tokens, &bucket.Updated)
+	if err != nil {
+		return false, 0, err
+	}
+	bucket, ok, retryAfter := limit.Take(bucket, now)
+	_, err = tx.ExecContext(ctx, "UPDATE rate_buckets SET tokens = $2, updated_at = $3, full_at = $4 WHERE key = $1",
+		key, bucket.Tokens, bucket.Updated, limit.FullAt(bucket))
+	if err != nil {
+		return false, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, 0, err
+	}
+	if rand.Float64() < rateCleanupChance {
+		if _, err := p.db.ExecContext(ctx, "DELETE FROM rate_buckets WHERE full_at <= $1", now); err != nil {
+			log.Println("не удалось удалить заполненные корзины ограничения запросов;", err)
+		}
+	}
+	return ok, retryAfter, nil
+}
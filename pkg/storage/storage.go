@@ -10,9 +10,11 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/bubu256/go-url-shortener-server/config"
 	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/bubu256/go-url-shortener-server/pkg/helperfunc"
 	"github.com/bubu256/go-url-shortener-server/pkg/storage/mem"
 	"github.com/bubu256/go-url-shortener-server/pkg/storage/postgres"
 )
@@ -20,11 +22,108 @@ import (
 // Storage - интерфейс, определяющий методы для работы с хранилищем URL
 type Storage interface {
 	// GetURL возвращает URL-адрес для заданного ключа.
+	// Для удаленной, истекшей или отключенной администратором ссылки возвращается ошибка,
+	// оборачивающая errorapp.ErrorPageNotAvailable (для отключенной - *errorapp.URLDisabledError),
+	// для ссылки, время действия которой еще не наступило, - *errorapp.URLNotActiveError.
 	GetURL(key string) (string, error)
+	// GetRecord возвращает полную запись о ссылке, в том числе удаленной.
+	GetRecord(key string) (schema.URLRecord, error)
 	// GetAllURLs возвращает все URL-адреса, связанные с указанным пользователем.
 	GetAllURLs(userID string) map[string]string
-	// SetNewURL сохраняет URL-адрес в хранилище и связывает его с указанным ключом.
-	SetNewURL(key, URL, tokenID string, available bool) error
+	// ListURLs возвращает страницу ссылок пользователя согласно параметрам выборки.
+	ListURLs(userID string, opts schema.ListURLsOptions) (schema.URLPage, error)
+	// CountUserURLs возвращает количество ссылок пользователя, созданных начиная с since, и его действующих ссылок.
+	// Если задан ключ квоты quotaKey, считаются ссылки, созданные с этим ключом (см. schema.URLQuota.Key).
+	CountUserURLs(userID, quotaKey string, since time.Time) (schema.URLCounts, error)
+	// SearchURLs возвращает страницу ссылок всех пользователей (или владельца opts.Owner) согласно параметрам выборки.
+	SearchURLs(opts schema.ListURLsOptions) (schema.URLPage, error)
+	// PurgeURLs окончательно удаляет ссылки по списку коротких ключей вместе с их метками и жалобами
+	// и возвращает ключи удаленных ссылок. Удаленные ссылки продолжают учитываться в GetLastID.
+	PurgeURLs(keys []string) ([]string, error)
+	// UpdateURL изменяет метаданные ссылки, принадлежащей пользователю, и возвращает обновленную запись.
+	UpdateURL(key, userID string, patch schema.URLPatch) (schema.URLRecord, error)
+	// ChangeTags добавляет и удаляет метки ссылки, принадлежащей пользователю, и возвращает обновленную запись.
+	ChangeTags(key, userID string, add, remove []string) (schema.URLRecord, error)
+	// ListTags возвращает метки ссылок пользователя с количеством ссылок.
+	ListTags(userID string) ([]schema.APITagInfo, error)
+	// CreateFolder создает папку пользователя.
+	CreateFolder(userID, name string) (schema.Folder, error)
+	// GetFolder возвращает папку по идентификатору.
+	GetFolder(id int64) (schema.Folder, error)
+	// ListFolders возвращает папки пользователя.
+	ListFolders(userID string) ([]schema.Folder, error)
+	// DeleteFolder удаляет папку пользователя, ссылки из папки не удаляются.
+	DeleteFolder(id int64, userID string) error
+	// CreateCampaign создает кампанию пользователя.
+	CreateCampaign(campaign schema.Campaign) (schema.Campaign, error)
+	// GetCampaign возвращает кампанию по идентификатору.
+	GetCampaign(id int64) (schema.Campaign, error)
+	// ListCampaigns возвращает кампании пользователя.
+	ListCampaigns(userID string) ([]schema.Campaign, error)
+	// DeleteCampaign удаляет кампанию пользователя, ссылки кампании не удаляются.
+	DeleteCampaign(id int64, userID string) error
+	// RecordClick учитывает переход по ссылке, в ее кампании и на вариант адреса перехода.
+	RecordClick(key string, campaignID, variantID int64) error
+	// AddReport сохраняет жалобу на ссылку и возвращает ее с идентификатором и временем создания.
+	AddReport(report schema.AbuseReport) (schema.AbuseReport, error)
+	// ListReports возвращает жалобы, соответствующие фильтру, от новых к старым.
+	ListReports(filter schema.ReportFilter) ([]schema.AbuseReport, error)
+	// CloseReports переводит открытые жалобы на ссылку key в статус status и возвращает закрытые жалобы.
+	CloseReports(key, status string) ([]schema.AbuseReport, error)
+	// CreateAccount сохраняет учетную запись и возвращает ее с временем создания.
+	// Если email или имя пользователя заняты, возвращается errorapp.ErrorAccountExists.
+	CreateAccount(account schema.Account) (schema.Account, error)
+	// GetAccount возвращает учетную запись по идентификатору пользователя или errorapp.ErrorAccountNotFound.
+	GetAccount(userID string) (schema.Account, error)
+	// FindAccount возвращает учетную запись по email или имени пользователя или errorapp.ErrorAccountNotFound.
+	FindAccount(login string) (schema.Account, error)
+	// CreateAPIKey сохраняет ключ API и возвращает его с временем создания.
+	CreateAPIKey(key schema.APIKey) (schema.APIKey, error)
+	// GetAPIKey возвращает ключ API по идентификатору или errorapp.ErrorAPIKeyNotFound.
+	GetAPIKey(id string) (schema.APIKey, error)
+	// ListAPIKeys возвращает ключи API пользователя в порядке создания, в том числе отозванные.
+	ListAPIKeys(userID string) ([]schema.APIKey, error)
+	// RevokeAPIKey отзывает ключ API пользователя и возвращает его.
+	// Для чужого или несуществующего ключа возвращается errorapp.ErrorAPIKeyNotFound.
+	RevokeAPIKey(id, userID string) (schema.APIKey, error)
+	// ReassignUser передает все ссылки (в том числе удаленные), папки и кампании пользователя fromUserID
+	// пользователю toUserID и возвращает их ключи и идентификаторы. Действующие ссылки учитываются в квотах quota
+	// нового владельца: если места не хватает, ничего не передается и возвращается *errorapp.QuotaExceededError.
+	ReassignUser(fromUserID, toUserID string, quota schema.URLQuota) (schema.ClaimResult, error)
+	// TransferURL передает ссылку key от владельца fromUserID владельцу toUserID и возвращает обновленную запись.
+	// Ссылка убирается из папки и кампании прежнего владельца. Для чужой ссылки возвращается errorapp.ErrorAccessDenied.
+	// Квоты quota владельца toUserID проверяются вместе с передачей (*errorapp.QuotaExceededError).
+	TransferURL(key, fromUserID, toUserID string, quota schema.URLQuota) (schema.URLRecord, error)
+	// OfferTransfer сохраняет предложение передать ссылку offer.ShortKey от владельца offer.FromUserID пользователю
+	// offer.ToUserID вместо прежнего предложения для этой ссылки. Для чужой ссылки возвращается errorapp.ErrorAccessDenied.
+	OfferTransfer(offer schema.TransferOffer) (schema.TransferOffer, error)
+	// ListTransfers возвращает предложения передачи, отправленные пользователем userID или ему, от новых к старым.
+	// Предложения ссылок, которые больше не принадлежат отправителю, не возвращаются.
+	ListTransfers(userID string) ([]schema.TransferOffer, error)
+	// AcceptTransfer передает ссылку key пользователю toUserID по предложению отправителя и удаляет предложение.
+	// Квоты quota получателя проверяются вместе с передачей. Если предложения ссылки этому пользователю нет
+	// или ссылка больше не принадлежит отправителю, возвращается errorapp.ErrorTransferNotFound.
+	AcceptTransfer(key, toUserID string, quota schema.URLQuota) (schema.URLRecord, error)
+	// DeleteTransfer удаляет предложение передачи ссылки key, отправленное пользователем userID или ему
+	// (errorapp.ErrorTransferNotFound, если такого предложения нет).
+	DeleteTransfer(key, userID string) error
+	// CreateWorkspace сохраняет рабочее пространство с владельцем ownerID и возвращает его с временем создания.
+	CreateWorkspace(workspace schema.Workspace, ownerID string) (schema.Workspace, error)
+	// GetWorkspace возвращает рабочее пространство по идентификатору или errorapp.ErrorWorkspaceNotFound.
+	GetWorkspace(id string) (schema.Workspace, error)
+	// ListWorkspaces возвращает рабочие пространства, в которых состоит пользователь, с его ролью в каждом.
+	ListWorkspaces(userID string) ([]schema.Workspace, error)
+	// SetWorkspaceMember добавляет участника рабочего пространства или изменяет его роль.
+	SetWorkspaceMember(member schema.WorkspaceMember) (schema.WorkspaceMember, error)
+	// GetWorkspaceMember возвращает участника рабочего пространства или errorapp.ErrorMemberNotFound.
+	GetWorkspaceMember(workspaceID, userID string) (schema.WorkspaceMember, error)
+	// ListWorkspaceMembers возвращает участников рабочего пространства с данными их учетных записей.
+	ListWorkspaceMembers(workspaceID string) ([]schema.WorkspaceMember, error)
+	// RemoveWorkspaceMember исключает участника из рабочего пространства или возвращает errorapp.ErrorMemberNotFound.
+	RemoveWorkspaceMember(workspaceID, userID string) error
+	// SetNewURL сохраняет запись о ссылке в хранилище. Квоты quota пользователя rec.UserID проверяются
+	// вместе с записью так, что параллельные запросы не могут их превысить (*errorapp.QuotaExceededError).
+	SetNewURL(rec schema.URLRecord, quota schema.URLQuota) error
 	// DeleteBatch удаляет из хранилища URL-адреса по списку коротких ключей
 	// переданных через каналы.
 	DeleteBatch(inputChs []chan []string) error
@@ -32,16 +131,21 @@ type Storage interface {
 	GetLastID() (int64, bool)
 	// Ping проверяет возможность подключения к хранилищу.
 	Ping() error
-	// SetBatchURLs сохраняет группу URL-адресов в хранилище.
-	SetBatchURLs(batch schema.APIShortenBatchInput, token string) ([]string, error)
+	// SetBatchURLs сохраняет группу URL-адресов в хранилище. Пакет учитывается в квотах quota целиком.
+	SetBatchURLs(batch schema.APIShortenBatchInput, token string, quota schema.URLQuota) ([]string, error)
 	// GetStats - возвращает статистику по записям из хранилища
 	GetStats() (schema.APIInternalStats, error)
+	// TakeRateToken забирает токен из корзины key с ограничением limit на момент now.
+	// Если токенов не хватает, возвращает false и время до появления токена.
+	// Корзины общие для всех экземпляров сервиса, работающих с одним хранилищем.
+	TakeRateToken(key string, limit schema.RateLimit, now time.Time) (bool, time.Duration, error)
 }
 
 // New - функция, создающая объект, реализующий интерфейс Storage, на основе настроек.
 // Если в настройках указаны параметры подключения к PostgreSQL, то создается объект postgres.Storage.
 // В противном случае создается объект mem.MapDBMutex. Если в настройках указан путь к файлу, то объект оборачивается
-// в обертку NewWrapToSaveFile, которая сохраняет данные хранилища в указанный файл при каждом изменении.
+// в обертку NewWrapToSaveFile, которая сохраняет данные хранилища в указанный файл при каждом изменении
+// (счетчики переходов - периодически).
 func New(cfgDB config.CfgDataBase, initData map[string]string) Storage {
 	if cfgDB.DataBaseDSN != "" {
 		db, err := postgres.New(cfgDB)
@@ -66,38 +170,77 @@ func New(cfgDB config.CfgDataBase, initData map[string]string) Storage {
 	return newStorage
 }
 
+// clickFlushInterval - период записи в файл счетчиков переходов, накопленных в памяти.
+const clickFlushInterval = 10 * time.Second
+
+// Closer - хранилище, которое накапливает изменения в памяти или выполняет фоновые задачи
+// и должно быть закрыто при остановке сервера.
+type Closer interface {
+	Close() error
+}
+
 // WrapToSaveFile - обертка над хранилищем, которая дополнительно сохраняет данные в файл
 type WrapToSaveFile struct {
 	storage Storage
 	file    *RWFile
+	// clickedKeys, clickedCampaigns - ссылки и кампании, счетчики переходов которых еще не записаны в файл
+	clickedKeys      map[string]struct{}
+	clickedCampaigns map[int64]struct{}
+	clicksMutex      sync.Mutex
+	// stop, done - остановка фоновой записи счетчиков переходов (см. Close)
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // SetNewURL - сохраняет новый URL и дополнительно записывает его в файл.
-func (s *WrapToSaveFile) SetNewURL(key, URL, TokenID string, available bool) error {
+func (s *WrapToSaveFile) SetNewURL(rec schema.URLRecord, quota schema.URLQuota) error {
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now()
+	}
+	if rec.UpdatedAt.IsZero() {
+		rec.UpdatedAt = rec.CreatedAt
+	}
 	// вызываем базовый обработчик
-	err := s.storage.SetNewURL(key, URL, TokenID, available)
+	err := s.storage.SetNewURL(rec, quota)
 	if err != nil {
 		return err
 	}
 	// пишем в файл
-	err = s.file.OpenAppend()
+	err = s.file.Append(NewMatch(rec))
 	if err != nil {
-		return fmt.Errorf("после записи урл в памяти, не удалось открыть файл для записи; %w", err)
+		return fmt.Errorf("после записи урл в памяти, не удалось записать его в файл; %w", err)
 	}
-	defer s.file.Close()
-	s.file.WriteMatch(Match{ShortKey: key, FullURL: URL, UserID: TokenID, Available: &available})
 	return nil
 }
 
+// UpdateURL - изменяет метаданные ссылки и дописывает обновленную запись в файл.
+func (s *WrapToSaveFile) UpdateURL(key, userID string, patch schema.URLPatch) (schema.URLRecord, error) {
+	rec, err := s.storage.UpdateURL(key, userID, patch)
+	if err != nil {
+		return rec, err
+	}
+	err = s.file.Append(NewMatch(rec))
+	if err != nil {
+		return rec, fmt.Errorf("после изменения урл в памяти, не удалось записать его в файл; %w", err)
+	}
+	return rec, nil
+}
+
 // SetBatchURLs - сохраняет пакет URL'ов и дополнительно записывает их в файл
-func (s *WrapToSaveFile) SetBatchURLs(batch schema.APIShortenBatchInput, token string) ([]string, error) {
-	result := make([]string, 0, len(batch))
-	for _, elem := range batch {
-		err := s.SetNewURL(elem.CorrelationID, elem.OriginalURL, token, true)
+func (s *WrapToSaveFile) SetBatchURLs(batch schema.APIShortenBatchInput, token string, quota schema.URLQuota) ([]string, error) {
+	result, err := s.storage.SetBatchURLs(batch, token, quota)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range result {
+		rec, err := s.storage.GetRecord(key)
 		if err != nil {
-			continue
+			return result, err
+		}
+		if err = s.file.Append(NewMatch(rec)); err != nil {
+			return result, fmt.Errorf("после записи урл в памяти, не удалось записать его в файл; %w", err)
 		}
-		result = append(result, elem.CorrelationID)
 	}
 	return result, nil
 }
@@ -140,6 +283,11 @@ func (s *WrapToSaveFile) GetURL(key string) (string, error) {
 	return s.storage.GetURL(key)
 }
 
+// GetRecord - возвращает полную запись о ссылке по короткому ключу.
+func (s *WrapToSaveFile) GetRecord(key string) (schema.URLRecord, error) {
+	return s.storage.GetRecord(key)
+}
+
 // GetLastID - возвращает последний сохраненный ID
 // возвращает bool - true, если последний ID найден и false, если ID отсутствует.
 func (s *WrapToSaveFile) GetLastID() (int64, bool) {
@@ -151,6 +299,35 @@ func (s *WrapToSaveFile) GetAllURLs(userID string) map[string]string {
 	return s.storage.GetAllURLs(userID)
 }
 
+// ListURLs - возвращает страницу ссылок пользователя.
+func (s *WrapToSaveFile) ListURLs(userID string, opts schema.ListURLsOptions) (schema.URLPage, error) {
+	return s.storage.ListURLs(userID, opts)
+}
+
+// CountUserURLs - возвращает количество созданных и действующих ссылок пользователя.
+func (s *WrapToSaveFile) CountUserURLs(userID, quotaKey string, since time.Time) (schema.URLCounts, error) {
+	return s.storage.CountUserURLs(userID, quotaKey, since)
+}
+
+// SearchURLs - возвращает страницу ссылок всех пользователей.
+func (s *WrapToSaveFile) SearchURLs(opts schema.ListURLsOptions) (schema.URLPage, error) {
+	return s.storage.SearchURLs(opts)
+}
+
+// PurgeURLs - окончательно удаляет ссылки и дописывает в файл строку об удалении каждой из них.
+func (s *WrapToSaveFile) PurgeURLs(keys []string) ([]string, error) {
+	purged, err := s.storage.PurgeURLs(keys)
+	if err != nil {
+		return purged, err
+	}
+	for _, key := range purged {
+		if err := s.file.Append(Match{Purge: &PurgeMatch{ShortKey: key}}); err != nil {
+			return purged, fmt.Errorf("после удаления ссылки в памяти, не удалось записать удаление в файл; %w", err)
+		}
+	}
+	return purged, nil
+}
+
 // Ping - возвращает ошибку, если к серверу нет подключения.
 func (s *WrapToSaveFile) Ping() error {
 	return s.storage.Ping()
@@ -161,24 +338,466 @@ func (s *WrapToSaveFile) GetStats() (schema.APIInternalStats, error) {
 	return s.storage.GetStats()
 }
 
+// TakeRateToken - забирает токен из корзины ограничения частоты запросов.
+// Состояние корзин не записывается в файл.
+func (s *WrapToSaveFile) TakeRateToken(key string, limit schema.RateLimit, now time.Time) (bool, time.Duration, error) {
+	return s.storage.TakeRateToken(key, limit, now)
+}
+
+// ChangeTags - изменяет метки ссылки и дописывает обновленную запись в файл.
+func (s *WrapToSaveFile) ChangeTags(key, userID string, add, remove []string) (schema.URLRecord, error) {
+	rec, err := s.storage.ChangeTags(key, userID, add, remove)
+	if err != nil {
+		return rec, err
+	}
+	err = s.file.Append(NewMatch(rec))
+	if err != nil {
+		return rec, fmt.Errorf("после изменения меток в памяти, не удалось записать их в файл; %w", err)
+	}
+	return rec, nil
+}
+
+// ListTags - возвращает метки ссылок пользователя.
+func (s *WrapToSaveFile) ListTags(userID string) ([]schema.APITagInfo, error) {
+	return s.storage.ListTags(userID)
+}
+
+// CreateFolder - создает папку и дописывает ее в файл.
+func (s *WrapToSaveFile) CreateFolder(userID, name string) (schema.Folder, error) {
+	folder, err := s.storage.CreateFolder(userID, name)
+	if err != nil {
+		return folder, err
+	}
+	err = s.file.Append(Match{Folder: &FolderMatch{ID: folder.ID, UserID: folder.UserID, Name: folder.Name, CreatedAt: folder.CreatedAt}})
+	if err != nil {
+		return folder, fmt.Errorf("после создания папки в памяти, не удалось записать ее в файл; %w", err)
+	}
+	return folder, nil
+}
+
+// GetFolder - возвращает папку по идентификатору.
+func (s *WrapToSaveFile) GetFolder(id int64) (schema.Folder, error) {
+	return s.storage.GetFolder(id)
+}
+
+// ListFolders - возвращает папки пользователя.
+func (s *WrapToSaveFile) ListFolders(userID string) ([]schema.Folder, error) {
+	return s.storage.ListFolders(userID)
+}
+
+// DeleteFolder - удаляет папку и дописывает в файл запись об удалении.
+func (s *WrapToSaveFile) DeleteFolder(id int64, userID string) error {
+	err := s.storage.DeleteFolder(id, userID)
+	if err != nil {
+		return err
+	}
+	err = s.file.Append(Match{Folder: &FolderMatch{ID: id}})
+	if err != nil {
+		return fmt.Errorf("после удаления папки в памяти, не удалось записать удаление в файл; %w", err)
+	}
+	return nil
+}
+
+// CreateCampaign - создает кампанию и дописывает ее в файл.
+func (s *WrapToSaveFile) CreateCampaign(campaign schema.Campaign) (schema.Campaign, error) {
+	campaign, err := s.storage.CreateCampaign(campaign)
+	if err != nil {
+		return campaign, err
+	}
+	err = s.file.Append(Match{Campaign: NewCampaignMatch(campaign)})
+	if err != nil {
+		return campaign, fmt.Errorf("после создания кампании в памяти, не удалось записать ее в файл; %w", err)
+	}
+	return campaign, nil
+}
+
+// GetCampaign - возвращает кампанию по идентификатору.
+func (s *WrapToSaveFile) GetCampaign(id int64) (schema.Campaign, error) {
+	return s.storage.GetCampaign(id)
+}
+
+// ListCampaigns - возвращает кампании пользователя.
+func (s *WrapToSaveFile) ListCampaigns(userID string) ([]schema.Campaign, error) {
+	return s.storage.ListCampaigns(userID)
+}
+
+// DeleteCampaign - удаляет кампанию и дописывает в файл запись об удалении.
+func (s *WrapToSaveFile) DeleteCampaign(id int64, userID string) error {
+	err := s.storage.DeleteCampaign(id, userID)
+	if err != nil {
+		return err
+	}
+	err = s.file.Append(Match{Campaign: &CampaignMatch{ID: id}})
+	if err != nil {
+		return fmt.Errorf("после удаления кампании в памяти, не удалось записать удаление в файл; %w", err)
+	}
+	return nil
+}
+
+// RecordClick - учитывает переход по ссылке в памяти. Счетчики переходов записываются в файл
+// не при каждом переходе, а периодически (см. Flush).
+func (s *WrapToSaveFile) RecordClick(key string, campaignID, variantID int64) error {
+	err := s.storage.RecordClick(key, campaignID, variantID)
+	if err != nil {
+		return err
+	}
+	s.clicksMutex.Lock()
+	defer s.clicksMutex.Unlock()
+	s.clickedKeys[key] = struct{}{}
+	if campaignID != 0 {
+		s.clickedCampaigns[campaignID] = struct{}{}
+	}
+	return nil
+}
+
+// Flush - дописывает в файл состояние ссылок и кампаний, у которых изменились счетчики переходов
+// с момента прошлой записи. Вызывается каждые clickFlushInterval и из Close при остановке сервера.
+func (s *WrapToSaveFile) Flush() error {
+	s.clicksMutex.Lock()
+	keys, campaigns := s.clickedKeys, s.clickedCampaigns
+	s.clickedKeys, s.clickedCampaigns = make(map[string]struct{}), make(map[int64]struct{})
+	s.clicksMutex.Unlock()
+	if len(keys) == 0 && len(campaigns) == 0 {
+		return nil
+	}
+	err := s.file.AppendSnapshot(func() []Match {
+		matches := make([]Match, 0, len(keys)+len(campaigns))
+		for key := range keys {
+			// окончательно удаленная ссылка в файл не пишется
+			if rec, err := s.storage.GetRecord(key); err == nil {
+				matches = append(matches, NewMatch(rec))
+			}
+		}
+		for id := range campaigns {
+			if campaign, err := s.storage.GetCampaign(id); err == nil {
+				matches = append(matches, Match{Campaign: NewCampaignMatch(campaign)})
+			}
+		}
+		return matches
+	})
+	if err != nil {
+		// счетчики будут записаны при следующем сохранении
+		s.clicksMutex.Lock()
+		for key := range keys {
+			s.clickedKeys[key] = struct{}{}
+		}
+		for id := range campaigns {
+			s.clickedCampaigns[id] = struct{}{}
+		}
+		s.clicksMutex.Unlock()
+		return fmt.Errorf("не удалось записать счетчики переходов в файл; %w", err)
+	}
+	return nil
+}
+
+// flushClicks - периодически записывает в файл накопленные счетчики переходов до вызова Close.
+func (s *WrapToSaveFile) flushClicks() {
+	defer close(s.done)
+	ticker := time.NewTicker(clickFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// Close - останавливает периодическую запись счетчиков переходов и записывает в файл накопленные изменения.
+// Повторный вызов только записывает изменения, накопленные после прошлого вызова.
+func (s *WrapToSaveFile) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+	return s.Flush()
+}
+
+// AddReport - сохраняет жалобу и дописывает ее в файл.
+func (s *WrapToSaveFile) AddReport(report schema.AbuseReport) (schema.AbuseReport, error) {
+	report, err := s.storage.AddReport(report)
+	if err != nil {
+		return report, err
+	}
+	err = s.file.Append(Match{Report: &report})
+	if err != nil {
+		return report, fmt.Errorf("после сохранения жалобы в памяти, не удалось записать ее в файл; %w", err)
+	}
+	return report, nil
+}
+
+// ListReports - возвращает жалобы, соответствующие фильтру.
+func (s *WrapToSaveFile) ListReports(filter schema.ReportFilter) ([]schema.AbuseReport, error) {
+	return s.storage.ListReports(filter)
+}
+
+// CloseReports - закрывает открытые жалобы на ссылку и дописывает их новое состояние в файл.
+func (s *WrapToSaveFile) CloseReports(key, status string) ([]schema.AbuseReport, error) {
+	reports, err := s.storage.CloseReports(key, status)
+	if err != nil {
+		return reports, err
+	}
+	for i := range reports {
+		if err = s.file.Append(Match{Report: &reports[i]}); err != nil {
+			return reports, fmt.Errorf("после закрытия жалоб в памяти, не удалось записать их в файл; %w", err)
+		}
+	}
+	return reports, nil
+}
+
+// CreateAccount - сохраняет учетную запись и дописывает ее в файл.
+func (s *WrapToSaveFile) CreateAccount(account schema.Account) (schema.Account, error) {
+	account, err := s.storage.CreateAccount(account)
+	if err != nil {
+		return account, err
+	}
+	err = s.file.Append(Match{Account: NewAccountMatch(account)})
+	if err != nil {
+		return account, fmt.Errorf("после создания учетной записи в памяти, не удалось записать ее в файл; %w", err)
+	}
+	return account, nil
+}
+
+// GetAccount - возвращает учетную запись по идентификатору пользователя.
+func (s *WrapToSaveFile) GetAccount(userID string) (schema.Account, error) {
+	return s.storage.GetAccount(userID)
+}
+
+// FindAccount - возвращает учетную запись по email или имени пользователя.
+func (s *WrapToSaveFile) FindAccount(login string) (schema.Account, error) {
+	return s.storage.FindAccount(login)
+}
+
+// CreateAPIKey - сохраняет ключ API и дописывает его в файл.
+func (s *WrapToSaveFile) CreateAPIKey(key schema.APIKey) (schema.APIKey, error) {
+	key, err := s.storage.CreateAPIKey(key)
+	if err != nil {
+		return key, err
+	}
+	err = s.file.Append(Match{APIKey: NewAPIKeyMatch(key)})
+	if err != nil {
+		return key, fmt.Errorf("после создания ключа API в памяти, не удалось записать его в файл; %w", err)
+	}
+	return key, nil
+}
+
+// GetAPIKey - возвращает ключ API по идентификатору.
+func (s *WrapToSaveFile) GetAPIKey(id string) (schema.APIKey, error) {
+	return s.storage.GetAPIKey(id)
+}
+
+// ListAPIKeys - возвращает ключи API пользователя.
+func (s *WrapToSaveFile) ListAPIKeys(userID string) ([]schema.APIKey, error) {
+	return s.storage.ListAPIKeys(userID)
+}
+
+// RevokeAPIKey - отзывает ключ API и дописывает его новое состояние в файл.
+func (s *WrapToSaveFile) RevokeAPIKey(id, userID string) (schema.APIKey, error) {
+	key, err := s.storage.RevokeAPIKey(id, userID)
+	if err != nil {
+		return key, err
+	}
+	err = s.file.Append(Match{APIKey: NewAPIKeyMatch(key)})
+	if err != nil {
+		return key, fmt.Errorf("после отзыва ключа API в памяти, не удалось записать его в файл; %w", err)
+	}
+	return key, nil
+}
+
+// ReassignUser - передает ссылки, папки и кампании другому пользователю и дописывает их новое состояние в файл.
+func (s *WrapToSaveFile) ReassignUser(fromUserID, toUserID string, quota schema.URLQuota) (schema.ClaimResult, error) {
+	result, err := s.storage.ReassignUser(fromUserID, toUserID, quota)
+	if err != nil {
+		return result, err
+	}
+	for _, key := range result.URLs {
+		rec, err := s.storage.GetRecord(key)
+		if err == nil {
+			err = s.file.Append(NewMatch(rec))
+		}
+		if err != nil {
+			return result, fmt.Errorf("после передачи ссылок в памяти, не удалось записать их в файл; %w", err)
+		}
+	}
+	for _, id := range result.Folders {
+		folder, err := s.storage.GetFolder(id)
+		if err == nil {
+			err = s.file.Append(Match{Folder: &FolderMatch{ID: folder.ID, UserID: folder.UserID, Name: folder.Name, CreatedAt: folder.CreatedAt}})
+		}
+		if err != nil {
+			return result, fmt.Errorf("после передачи папок в памяти, не удалось записать их в файл; %w", err)
+		}
+	}
+	for _, id := range result.Campaigns {
+		campaign, err := s.storage.GetCampaign(id)
+		if err == nil {
+			err = s.file.Append(Match{Campaign: NewCampaignMatch(campaign)})
+		}
+		if err != nil {
+			return result, fmt.Errorf("после передачи кампаний в памяти, не удалось записать их в файл; %w", err)
+		}
+	}
+	return result, nil
+}
+
+// TransferURL - передает ссылку другому владельцу и дописывает ее новое состояние в файл.
+func (s *WrapToSaveFile) TransferURL(key, fromUserID, toUserID string, quota schema.URLQuota) (schema.URLRecord, error) {
+	rec, err := s.storage.TransferURL(key, fromUserID, toUserID, quota)
+	if err != nil {
+		return rec, err
+	}
+	if err = s.file.Append(NewMatch(rec)); err != nil {
+		return rec, fmt.Errorf("после передачи ссылки в памяти, не удалось записать ее в файл; %w", err)
+	}
+	return rec, nil
+}
+
+// OfferTransfer - сохраняет предложение передачи ссылки и дописывает его в файл.
+func (s *WrapToSaveFile) OfferTransfer(offer schema.TransferOffer) (schema.TransferOffer, error) {
+	offer, err := s.storage.OfferTransfer(offer)
+	if err != nil {
+		return offer, err
+	}
+	if err = s.file.Append(Match{Transfer: &offer}); err != nil {
+		return offer, fmt.Errorf("после сохранения предложения передачи в памяти, не удалось записать его в файл; %w", err)
+	}
+	return offer, nil
+}
+
+// ListTransfers - возвращает предложения передачи пользователя.
+func (s *WrapToSaveFile) ListTransfers(userID string) ([]schema.TransferOffer, error) {
+	return s.storage.ListTransfers(userID)
+}
+
+// AcceptTransfer - передает ссылку по предложению и дописывает в файл ее новое состояние и удаление предложения.
+func (s *WrapToSaveFile) AcceptTransfer(key, toUserID string, quota schema.URLQuota) (schema.URLRecord, error) {
+	rec, err := s.storage.AcceptTransfer(key, toUserID, quota)
+	if err != nil {
+		return rec, err
+	}
+	err = s.file.Append(NewMatch(rec))
+	if err == nil {
+		err = s.file.Append(Match{Transfer: &schema.TransferOffer{ShortKey: key}})
+	}
+	if err != nil {
+		return rec, fmt.Errorf("после передачи ссылки в памяти, не удалось записать ее в файл; %w", err)
+	}
+	return rec, nil
+}
+
+// DeleteTransfer - удаляет предложение передачи и дописывает удаление в файл.
+func (s *WrapToSaveFile) DeleteTransfer(key, userID string) error {
+	if err := s.storage.DeleteTransfer(key, userID); err != nil {
+		return err
+	}
+	if err := s.file.Append(Match{Transfer: &schema.TransferOffer{ShortKey: key}}); err != nil {
+		return fmt.Errorf("после удаления предложения передачи в памяти, не удалось записать удаление в файл; %w", err)
+	}
+	return nil
+}
+
+// CreateWorkspace - сохраняет рабочее пространство с владельцем и дописывает их в файл.
+func (s *WrapToSaveFile) CreateWorkspace(workspace schema.Workspace, ownerID string) (schema.Workspace, error) {
+	workspace, err := s.storage.CreateWorkspace(workspace, ownerID)
+	if err != nil {
+		return workspace, err
+	}
+	owner, err := s.storage.GetWorkspaceMember(workspace.ID, ownerID)
+	if err == nil {
+		err = s.file.Append(Match{Workspace: &WorkspaceMatch{ID: workspace.ID, Name: workspace.Name, CreatedAt: workspace.CreatedAt}})
+	}
+	if err == nil {
+		err = s.file.Append(Match{Member: NewMemberMatch(owner)})
+	}
+	if err != nil {
+		return workspace, fmt.Errorf("после создания рабочего пространства в памяти, не удалось записать его в файл; %w", err)
+	}
+	return workspace, nil
+}
+
+// GetWorkspace - возвращает рабочее пространство по идентификатору.
+func (s *WrapToSaveFile) GetWorkspace(id string) (schema.Workspace, error) {
+	return s.storage.GetWorkspace(id)
+}
+
+// ListWorkspaces - возвращает рабочие пространства пользователя.
+func (s *WrapToSaveFile) ListWorkspaces(userID string) ([]schema.Workspace, error) {
+	return s.storage.ListWorkspaces(userID)
+}
+
+// SetWorkspaceMember - добавляет участника или изменяет его роль и дописывает участника в файл.
+func (s *WrapToSaveFile) SetWorkspaceMember(member schema.WorkspaceMember) (schema.WorkspaceMember, error) {
+	member, err := s.storage.SetWorkspaceMember(member)
+	if err != nil {
+		return member, err
+	}
+	if err = s.file.Append(Match{Member: NewMemberMatch(member)}); err != nil {
+		return member, fmt.Errorf("после изменения участника в памяти, не удалось записать его в файл; %w", err)
+	}
+	return member, nil
+}
+
+// GetWorkspaceMember - возвращает участника рабочего пространства.
+func (s *WrapToSaveFile) GetWorkspaceMember(workspaceID, userID string) (schema.WorkspaceMember, error) {
+	return s.storage.GetWorkspaceMember(workspaceID, userID)
+}
+
+// ListWorkspaceMembers - возвращает участников рабочего пространства.
+func (s *WrapToSaveFile) ListWorkspaceMembers(workspaceID string) ([]schema.WorkspaceMember, error) {
+	return s.storage.ListWorkspaceMembers(workspaceID)
+}
+
+// RemoveWorkspaceMember - исключает участника и дописывает в файл участника с пустой ролью.
+func (s *WrapToSaveFile) RemoveWorkspaceMember(workspaceID, userID string) error {
+	if err := s.storage.RemoveWorkspaceMember(workspaceID, userID); err != nil {
+		return err
+	}
+	err := s.file.Append(Match{Member: &MemberMatch{WorkspaceID: workspaceID, UserID: userID}})
+	if err != nil {
+		return fmt.Errorf("после исключения участника в памяти, не удалось записать его в файл; %w", err)
+	}
+	return nil
+}
+
 // attemptSetAvailableFalse проверяет, является ли пользователь автором записи
 // и помечает запись как недоступную, если да.
 func (s *WrapToSaveFile) attemptSetAvailableFalse(key, user string) {
-	key2fullURL := s.storage.GetAllURLs(user)
-	if fullURL, ok := key2fullURL[key]; ok {
-		err := s.file.OpenAppend()
-		if err == nil {
-			available := false
-			s.file.WriteMatch(Match{ShortKey: key,
-				FullURL:   key + "_deleted=" + fullURL,
-				UserID:    user,
-				Available: &available})
-			s.file.Close()
-		}
+	rec, err := s.storage.GetRecord(key)
+	if err != nil || rec.UserID != user || !rec.Available {
+		return
+	}
+	now := time.Now()
+	rec.Available = false
+	rec.UpdatedAt = now
+	rec.DeletedAt = &now
+	if err := s.file.Append(NewMatch(rec)); err != nil {
+		log.Println("не удалось записать удаление ссылки в файл;", err)
 	}
 }
 
+// restorer - хранилище, поддерживающее восстановление записей из журнала без проверки дубликатов.
+type restorer interface {
+	RestoreRecord(rec schema.URLRecord)
+	RestoreFolder(folder schema.Folder)
+	RestoreCampaign(campaign schema.Campaign)
+	RestoreReport(report schema.AbuseReport)
+	RestoreAccount(account schema.Account)
+	RestoreAPIKey(key schema.APIKey)
+	RestoreWorkspace(workspace schema.Workspace)
+	RestoreWorkspaceMember(member schema.WorkspaceMember)
+	RestoreTransfer(offer schema.TransferOffer)
+}
+
 // NewWrapToSaveFile - оборачивает и возвращает Storage с возможностью записывать данные в файл.
+// Файл является журналом: каждая строка содержит состояние записи после изменения, последняя строка для ключа актуальна.
+// Строки переходов (ClickMatch) из прежних версий файла учитываются при загрузке, новые не пишутся:
+// счетчики переходов сохраняются в записях ссылок и кампаний.
+// Записям из старых версий файла без времени создания проставляется время изменения файла,
+// дополненные записи дописываются в конец файла.
 func NewWrapToSaveFile(pathFile string, st Storage) (Storage, error) {
 	//загружаем данные из файла если он есть
 	file, err := NewRWFile(pathFile)
@@ -187,31 +806,353 @@ func NewWrapToSaveFile(pathFile string, st Storage) (Storage, error) {
 	}
 	defer file.Close()
 	file.path = pathFile
+	backfillTime := time.Now()
+	if info, err := file.file.Stat(); err == nil {
+		backfillTime = info.ModTime()
+	}
+	r, ok := st.(restorer)
+	if !ok {
+		return nil, errors.New("хранилище не поддерживает восстановление записей из файла")
+	}
+	backfilled := make(map[string]bool)
 	countRead := 0
 	match, err := file.ReadMatch()
-	for err == nil {
+	for ; err == nil; match, err = file.ReadMatch() {
 		countRead++
+		if match.Folder != nil {
+			r.RestoreFolder(match.Folder.Folder())
+			continue
+		}
+		if match.Campaign != nil {
+			r.RestoreCampaign(match.Campaign.Campaign())
+			continue
+		}
+		if match.Report != nil {
+			r.RestoreReport(*match.Report)
+			continue
+		}
+		if match.Account != nil {
+			r.RestoreAccount(match.Account.Account())
+			continue
+		}
+		if match.APIKey != nil {
+			r.RestoreAPIKey(match.APIKey.APIKey())
+			continue
+		}
+		if match.Workspace != nil {
+			r.RestoreWorkspace(match.Workspace.Workspace())
+			continue
+		}
+		if match.Member != nil {
+			r.RestoreWorkspaceMember(match.Member.Member())
+			continue
+		}
+		if match.Transfer != nil {
+			r.RestoreTransfer(*match.Transfer)
+			continue
+		}
+		if match.Purge != nil {
+			if _, err := st.PurgeURLs([]string{match.Purge.ShortKey}); err != nil {
+				log.Println("не удалось восстановить удаление ссылки из файла;", err)
+			}
+			delete(backfilled, match.Purge.ShortKey)
+			continue
+		}
+		if match.Click != nil {
+			if err := st.RecordClick(match.Click.ShortKey, match.Click.CampaignID, match.Click.VariantID); err != nil {
+				log.Println("не удалось восстановить переход из файла;", err)
+			}
+			continue
+		}
 		if match.Available == nil {
 			return nil, errors.New("match.Available == nil, хотя должен быть true od false")
 		}
-		st.SetNewURL(match.ShortKey, match.FullURL, match.UserID, *(match.Available))
-		match, err = file.ReadMatch()
+		rec := match.Record()
+		backfilled[rec.ShortKey] = rec.CreatedAt.IsZero()
+		if rec.CreatedAt.IsZero() {
+			rec.CreatedAt = backfillTime
+		}
+		if rec.UpdatedAt.IsZero() {
+			rec.UpdatedAt = rec.CreatedAt
+		}
+		if !rec.Available && rec.DeletedAt == nil {
+			rec.DeletedAt = &rec.UpdatedAt
+		}
+		r.RestoreRecord(rec)
 	}
 	if err != io.EOF {
 		return nil, err
 	}
 
 	log.Println("Из файла", file.path, "загружено элементов:", countRead)
-	return &WrapToSaveFile{storage: st, file: file}, nil
+	wrap := &WrapToSaveFile{storage: st, file: file,
+		clickedKeys: make(map[string]struct{}), clickedCampaigns: make(map[int64]struct{}),
+		stop: make(chan struct{}), done: make(chan struct{})}
+	countBackfilled := 0
+	for key, ok := range backfilled {
+		if !ok {
+			continue
+		}
+		rec, err := st.GetRecord(key)
+		if err != nil {
+			continue
+		}
+		if err := file.Append(NewMatch(rec)); err != nil {
+			return nil, err
+		}
+		countBackfilled++
+	}
+	if countBackfilled > 0 {
+		log.Println("В файл", file.path, "дописаны записи с временем создания:", countBackfilled)
+	}
+	go wrap.flushClicks()
+	return wrap, nil
 }
 
 // Match - структура для сериализации данных
 // Available *bool необходим так как указывает на наличие поля и установку значения по умолчанию true.
+// Для удаленных ссылок full_url хранится с префиксом (см. helperfunc.DeletedURL), как и в других хранилищах.
 type Match struct {
-	ShortKey  string `json:"short_key"`
-	FullURL   string `json:"full_url"`
-	UserID    string `json:"user_id"`
-	Available *bool  `json:"available"` // default true
+	ShortKey     string                `json:"short_key"`
+	FullURL      string                `json:"full_url"`
+	UserID       string                `json:"user_id"`
+	Available    *bool                 `json:"available"` // default true
+	CreatedAt    *time.Time            `json:"created_at,omitempty"`
+	UpdatedAt    *time.Time            `json:"updated_at,omitempty"`
+	DeletedAt    *time.Time            `json:"deleted_at,omitempty"`
+	ExpiresAt    *time.Time            `json:"expires_at,omitempty"`
+	ActiveFrom   *time.Time            `json:"active_from,omitempty"`
+	Disabled     string                `json:"disabled_reason,omitempty"`
+	Title        string                `json:"title,omitempty"`
+	Note         string                `json:"note,omitempty"`
+	Tags         []string              `json:"tags,omitempty"`
+	FolderID     int64                 `json:"folder_id,omitempty"`
+	ForcePreview bool                  `json:"force_preview,omitempty"`
+	RedirectType int                   `json:"redirect_type,omitempty"`
+	Passthrough  string                `json:"passthrough,omitempty"`
+	Conflict     string                `json:"passthrough_conflict,omitempty"`
+	CampaignID   int64                 `json:"campaign_id,omitempty"`
+	Clicks       int64                 `json:"clicks,omitempty"`
+	Rules        []schema.RedirectRule `json:"rules,omitempty"`
+	Targets      []schema.SplitTarget  `json:"targets,omitempty"`
+	QuotaKey     string                `json:"quota_key,omitempty"`
+	// Folder - строка журнала содержит состояние папки, а не ссылки.
+	Folder *FolderMatch `json:"folder,omitempty"`
+	// Campaign - строка журнала содержит состояние кампании.
+	Campaign *CampaignMatch `json:"campaign,omitempty"`
+	// Click - строка журнала содержит переход по ссылке (только в файлах прежних версий).
+	Click *ClickMatch `json:"click,omitempty"`
+	// Report - строка журнала содержит состояние жалобы на ссылку.
+	Report *schema.AbuseReport `json:"report,omitempty"`
+	// Account - строка журнала содержит учетную запись.
+	Account *AccountMatch `json:"account,omitempty"`
+	// APIKey - строка журнала содержит состояние ключа API.
+	APIKey *APIKeyMatch `json:"api_key,omitempty"`
+	// Workspace - строка журнала содержит рабочее пространство.
+	Workspace *WorkspaceMatch `json:"workspace,omitempty"`
+	// Member - строка журнала содержит участника рабочего пространства.
+	Member *MemberMatch `json:"member,omitempty"`
+	// Transfer - строка журнала содержит предложение передачи ссылки (без получателя - удаление предложения).
+	Transfer *schema.TransferOffer `json:"transfer,omitempty"`
+	// Purge - строка журнала содержит окончательное удаление ссылки администратором.
+	Purge *PurgeMatch `json:"purge,omitempty"`
+}
+
+// PurgeMatch - структура для сериализации окончательного удаления ссылки.
+type PurgeMatch struct {
+	ShortKey string `json:"short_key"`
+}
+
+// WorkspaceMatch - структура для сериализации рабочего пространства.
+type WorkspaceMatch struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Workspace - возвращает рабочее пространство, соответствующее элементу WorkspaceMatch.
+func (w WorkspaceMatch) Workspace() schema.Workspace {
+	return schema.Workspace{ID: w.ID, Name: w.Name, CreatedAt: w.CreatedAt}
+}
+
+// MemberMatch - структура для сериализации участника рабочего пространства.
+// Исключенный участник записывается с пустой ролью.
+type MemberMatch struct {
+	WorkspaceID string    `json:"workspace_id"`
+	UserID      string    `json:"user_id"`
+	Role        string    `json:"role"`
+	AddedAt     time.Time `json:"added_at"`
+}
+
+// NewMemberMatch - создает элемент MemberMatch для записи в файл.
+func NewMemberMatch(member schema.WorkspaceMember) *MemberMatch {
+	return &MemberMatch{WorkspaceID: member.WorkspaceID, UserID: member.UserID, Role: member.Role, AddedAt: member.AddedAt}
+}
+
+// Member - возвращает участника рабочего пространства, соответствующего элементу MemberMatch.
+func (m MemberMatch) Member() schema.WorkspaceMember {
+	return schema.WorkspaceMember{WorkspaceID: m.WorkspaceID, UserID: m.UserID, Role: m.Role, AddedAt: m.AddedAt}
+}
+
+// AccountMatch - структура для сериализации учетной записи вместе с хешем пароля.
+type AccountMatch struct {
+	ID           string    `json:"id"`
+	Email        string    `json:"email,omitempty"`
+	Username     string    `json:"username,omitempty"`
+	PasswordHash string    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NewAccountMatch - создает элемент AccountMatch для записи в файл.
+func NewAccountMatch(account schema.Account) *AccountMatch {
+	return &AccountMatch{ID: account.ID, Email: account.Email, Username: account.Username,
+		PasswordHash: account.PasswordHash, CreatedAt: account.CreatedAt}
+}
+
+// Account - возвращает учетную запись, соответствующую элементу AccountMatch.
+func (a AccountMatch) Account() schema.Account {
+	return schema.Account{ID: a.ID, Email: a.Email, Username: a.Username, PasswordHash: a.PasswordHash, CreatedAt: a.CreatedAt}
+}
+
+// APIKeyMatch - структура для сериализации ключа API вместе с хешем секретной части.
+type APIKeyMatch struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	SecretHash string     `json:"secret_hash"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// NewAPIKeyMatch - создает элемент APIKeyMatch для записи в файл. Ключ целиком в файл не пишется.
+func NewAPIKeyMatch(key schema.APIKey) *APIKeyMatch {
+	return &APIKeyMatch{ID: key.ID, UserID: key.UserID, Name: key.Name, Scopes: key.Scopes,
+		SecretHash: key.SecretHash, CreatedAt: key.CreatedAt, RevokedAt: key.RevokedAt}
+}
+
+// APIKey - возвращает ключ API, соответствующий элементу APIKeyMatch.
+func (k APIKeyMatch) APIKey() schema.APIKey {
+	return schema.APIKey{ID: k.ID, UserID: k.UserID, Name: k.Name, Scopes: k.Scopes,
+		SecretHash: k.SecretHash, CreatedAt: k.CreatedAt, RevokedAt: k.RevokedAt}
+}
+
+// CampaignMatch - структура для сериализации кампании. Удаленная кампания записывается с пустым UserID.
+// В файлах прежних версий количество переходов не хранится, а восстанавливается по строкам ClickMatch.
+type CampaignMatch struct {
+	ID        int64              `json:"id"`
+	UserID    string             `json:"user_id"`
+	Name      string             `json:"name"`
+	UTM       schema.UTMTemplate `json:"utm"`
+	CreatedAt time.Time          `json:"created_at"`
+	Clicks    int64              `json:"clicks,omitempty"`
+}
+
+// NewCampaignMatch - создает элемент CampaignMatch для записи в файл.
+func NewCampaignMatch(campaign schema.Campaign) *CampaignMatch {
+	return &CampaignMatch{ID: campaign.ID, UserID: campaign.UserID, Name: campaign.Name, UTM: campaign.UTM,
+		CreatedAt: campaign.CreatedAt, Clicks: campaign.Clicks}
+}
+
+// Campaign - возвращает кампанию, соответствующую элементу CampaignMatch.
+func (c CampaignMatch) Campaign() schema.Campaign {
+	return schema.Campaign{ID: c.ID, UserID: c.UserID, Name: c.Name, UTM: c.UTM, CreatedAt: c.CreatedAt, Clicks: c.Clicks}
+}
+
+// ClickMatch - структура для сериализации перехода по ссылке в файлах прежних версий.
+type ClickMatch struct {
+	ShortKey   string `json:"short_key"`
+	CampaignID int64  `json:"campaign_id,omitempty"`
+	VariantID  int64  `json:"variant_id,omitempty"`
+}
+
+// FolderMatch - структура для сериализации папки. Удаленная папка записывается с пустым UserID.
+type FolderMatch struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Folder - возвращает папку, соответствующую элементу FolderMatch.
+func (f FolderMatch) Folder() schema.Folder {
+	return schema.Folder{ID: f.ID, UserID: f.UserID, Name: f.Name, CreatedAt: f.CreatedAt}
+}
+
+// NewMatch - создает элемент Match для записи в файл из записи хранилища.
+func NewMatch(rec schema.URLRecord) Match {
+	available := rec.Available
+	createdAt := rec.CreatedAt
+	updatedAt := rec.UpdatedAt
+	m := Match{
+		ShortKey:     rec.ShortKey,
+		FullURL:      rec.FullURL,
+		UserID:       rec.UserID,
+		Available:    &available,
+		CreatedAt:    &createdAt,
+		UpdatedAt:    &updatedAt,
+		DeletedAt:    rec.DeletedAt,
+		ExpiresAt:    rec.ExpiresAt,
+		ActiveFrom:   rec.ActiveFrom,
+		Disabled:     rec.DisabledReason,
+		Title:        rec.Title,
+		Note:         rec.Note,
+		Tags:         rec.Tags,
+		FolderID:     rec.FolderID,
+		ForcePreview: rec.ForcePreview,
+		RedirectType: rec.RedirectType,
+		Passthrough:  rec.Passthrough,
+		Conflict:     rec.PassthroughConflict,
+		CampaignID:   rec.CampaignID,
+		Clicks:       rec.Clicks,
+		Rules:        rec.Rules,
+		Targets:      rec.Targets,
+		QuotaKey:     rec.QuotaKey,
+	}
+	if !available {
+		m.FullURL = helperfunc.DeletedURL(rec.ShortKey, rec.FullURL)
+	}
+	return m
+}
+
+// Record - возвращает запись хранилища, соответствующую элементу Match.
+// Для записей, сохраненных без времени создания или изменения, эти поля не заполняются.
+func (m Match) Record() schema.URLRecord {
+	rec := schema.URLRecord{
+		ShortKey:  m.ShortKey,
+		FullURL:   m.FullURL,
+		UserID:    m.UserID,
+		Available: m.Available == nil || *m.Available,
+		URLMeta: schema.URLMeta{
+			DeletedAt:           m.DeletedAt,
+			ExpiresAt:           m.ExpiresAt,
+			ActiveFrom:          m.ActiveFrom,
+			DisabledReason:      m.Disabled,
+			Title:               m.Title,
+			Note:                m.Note,
+			Tags:                m.Tags,
+			FolderID:            m.FolderID,
+			ForcePreview:        m.ForcePreview,
+			RedirectType:        m.RedirectType,
+			Passthrough:         m.Passthrough,
+			PassthroughConflict: m.Conflict,
+			CampaignID:          m.CampaignID,
+			Clicks:              m.Clicks,
+			Rules:               m.Rules,
+			Targets:             m.Targets,
+			QuotaKey:            m.QuotaKey,
+		},
+	}
+	if !rec.Available {
+		rec.FullURL = helperfunc.RestoreDeletedURL(m.ShortKey, m.FullURL)
+	}
+	if m.CreatedAt != nil {
+		rec.CreatedAt = *m.CreatedAt
+	}
+	if m.UpdatedAt != nil {
+		rec.UpdatedAt = *m.UpdatedAt
+	}
+	return rec
 }
 
 // RWFile - структура для работы с файлом.
@@ -241,6 +1182,45 @@ func (r *RWFile) WriteMatch(match Match) error {
 	return r.encoder.Encode(match)
 }
 
+// Append - открывает файл на дозапись, записывает элемент Match и закрывает файл.
+// Безопасна для вызова из нескольких горутин.
+func (r *RWFile) Append(match Match) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0777)
+	if err != nil {
+		log.Println("Не удалось открыть файл для записи;", err)
+		return err
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(match)
+}
+
+// AppendSnapshot - дописывает в файл элементы, которые возвращает snapshot.
+// snapshot вызывается под блокировкой файла, поэтому изменения хранилища, сделанные после него,
+// будут дописаны в файл позже и останутся актуальными.
+func (r *RWFile) AppendSnapshot(snapshot func() []Match) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	matches := snapshot()
+	if len(matches) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0777)
+	if err != nil {
+		log.Println("Не удалось открыть файл для записи;", err)
+		return err
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	for _, match := range matches {
+		if err := encoder.Encode(match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ReadMatch - декодирует элемент Match из файла.
 func (r *RWFile) ReadMatch() (*Match, error) {
 	match := Match{}
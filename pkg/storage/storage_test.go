@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bubu256/go-url-shortener-server/config"
+	"github.com/bubu256/go-url-shortener-server/internal/app/errorapp"
+	"github.com/bubu256/go-url-shortener-server/internal/app/schema"
+	"github.com/bubu256/go-url-shortener-server/pkg/storage/mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openFileStorage - открывает хранилище в памяти с журналом в файле path и закрывает его по завершении теста.
+func openFileStorage(t *testing.T, path string) Storage {
+	t.Helper()
+	st, err := NewWrapToSaveFile(path, mem.NewMapDBMutex(config.CfgDataBase{}, nil))
+	require.NoError(t, err)
+	t.Cleanup(func() { st.(Closer).Close() })
+	return st
+}
+
+func TestWrapToSaveFile_Close(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.json")
+	st := openFileStorage(t, path)
+	campaign, err := st.CreateCampaign(schema.Campaign{UserID: "u1", Name: "spring"})
+	require.NoError(t, err)
+	rec := schema.URLRecord{ShortKey: "abc", FullURL: "http://example.com", UserID: "u1", Available: true}
+	rec.CampaignID = campaign.ID
+	require.NoError(t, st.SetNewURL(rec, schema.URLQuota{}))
+	require.NoError(t, st.RecordClick("abc", campaign.ID, 0))
+	require.NoError(t, st.RecordClick("abc", campaign.ID, 0))
+
+	// счетчики переходов записываются в файл при закрытии, повторное закрытие не блокируется
+	closer := st.(Closer)
+	require.NoError(t, closer.Close())
+	require.NoError(t, closer.Close())
+
+	restored := openFileStorage(t, path)
+	got, err := restored.GetRecord("abc")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, got.Clicks)
+	gotCampaign, err := restored.GetCampaign(campaign.ID)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, gotCampaign.Clicks)
+}
+
+func TestWrapToSaveFile_ReassignUser(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.json")
+	st := openFileStorage(t, path)
+	campaign, err := st.CreateCampaign(schema.Campaign{UserID: "u1", Name: "spring"})
+	require.NoError(t, err)
+	rec := schema.URLRecord{ShortKey: "abc", FullURL: "http://example.com", UserID: "u1", Available: true}
+	rec.CampaignID = campaign.ID
+	require.NoError(t, st.SetNewURL(rec, schema.URLQuota{}))
+	require.NoError(t, st.RecordClick("abc", campaign.ID, 0))
+	require.NoError(t, st.(Closer).Close())
+
+	// передача кампании не сбрасывает ее счетчик переходов в файле
+	_, err = st.ReassignUser("u1", "u2", schema.URLQuota{})
+	require.NoError(t, err)
+
+	restored := openFileStorage(t, path)
+	gotCampaign, err := restored.GetCampaign(campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "u2", gotCampaign.UserID)
+	assert.EqualValues(t, 1, gotCampaign.Clicks)
+}
+
+func TestWrapToSaveFile_Transfers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.json")
+	st := openFileStorage(t, path)
+	for _, key := range []string{"abc", "def"} {
+		rec := schema.URLRecord{ShortKey: key, FullURL: "http://example.com/" + key, UserID: "u1", Available: true}
+		require.NoError(t, st.SetNewURL(rec, schema.URLQuota{}))
+	}
+	_, err := st.OfferTransfer(schema.TransferOffer{ShortKey: "abc", FromUserID: "u2", ToUserID: "u3"})
+	require.ErrorIs(t, err, errorapp.ErrorAccessDenied)
+	for _, key := range []string{"abc", "def"} {
+		_, err = st.OfferTransfer(schema.TransferOffer{ShortKey: key, FromUserID: "u1", ToUserID: "u2"})
+		require.NoError(t, err)
+	}
+	require.NoError(t, st.(Closer).Close())
+
+	// предложения восстанавливаются из файла вместе с их принятием и отклонением
+	restored := openFileStorage(t, path)
+	offers, err := restored.ListTransfers("u2")
+	require.NoError(t, err)
+	assert.Len(t, offers, 2)
+	_, err = restored.AcceptTransfer("abc", "u3", schema.URLQuota{})
+	require.ErrorIs(t, err, errorapp.ErrorTransferNotFound)
+	rec, err := restored.AcceptTransfer("abc", "u2", schema.URLQuota{})
+	require.NoError(t, err)
+	assert.Equal(t, "u2", rec.UserID)
+	require.NoError(t, restored.DeleteTransfer("def", "u1"))
+	require.NoError(t, restored.(Closer).Close())
+
+	restored = openFileStorage(t, path)
+	offers, err = restored.ListTransfers("u2")
+	require.NoError(t, err)
+	assert.Empty(t, offers)
+	got, err := restored.GetRecord("abc")
+	require.NoError(t, err)
+	assert.Equal(t, "u2", got.UserID)
+}